@@ -12,6 +12,7 @@ import (
 	"github.com/Roshick/go-autumn-web/metrics"
 	"github.com/Roshick/go-autumn-web/resiliency"
 	"github.com/Roshick/go-autumn-web/tracing"
+	"github.com/bradleyfalzon/ghinstallation/v2"
 	"github.com/gofri/go-github-pagination/githubpagination"
 	"github.com/gofri/go-github-ratelimit/v2/github_ratelimit"
 	"github.com/google/go-github/v90/github"
@@ -33,6 +34,8 @@ type BasicAuthOptions struct {
 type HTTPClientOptions struct {
 	*BasicAuthOptions
 	Timeout time.Duration
+	// Transport carries the requests, e.g. with custom TLS or proxy options, defaults to http.DefaultTransport.
+	Transport http.RoundTripper
 }
 
 //nolint:mnd // magic numbers are used for client configuration
@@ -50,6 +53,9 @@ func (f *Factory) NewHTTPClient(clientName string, opts *HTTPClientOptions) (*ht
 
 	// RoundTrippers are called bottom to top
 	rt := http.DefaultTransport
+	if opts.Transport != nil {
+		rt = opts.Transport
+	}
 	// inject basic auth transport
 	if opts.BasicAuthOptions != nil {
 		rt = auth.NewBasicAuthTransport(rt, opts.Username, opts.Password, nil)
@@ -74,6 +80,10 @@ func (f *Factory) NewHTTPClient(clientName string, opts *HTTPClientOptions) (*ht
 
 type GitHubClientOptions struct {
 	Timeout time.Duration
+	// EnterpriseBaseURL is the API URL of a GitHub Enterprise Server, github.com is used if empty.
+	EnterpriseBaseURL string
+	// EnterpriseUploadURL is the upload URL of a GitHub Enterprise Server, defaults to EnterpriseBaseURL if empty.
+	EnterpriseUploadURL string
 }
 
 //nolint:mnd // magic numbers are used for client configuration
@@ -83,26 +93,49 @@ func DefaultGitHubClientOptions() *GitHubClientOptions {
 	}
 }
 
-//nolint:mnd // magic numbers are used for client configuration
 func (f *Factory) NewGitHubClient(
 	appID int64,
 	appInstallationID int64,
 	privateKey *rsa.PrivateKey,
+	tokenBroker *GitHubTokenBroker,
+	opts *GitHubClientOptions,
+) (*github.Client, error) {
+	clientName := fmt.Sprintf("github-%d-%d", appID, appInstallationID)
+	return f.newGitHubClient(clientName, func(rt http.RoundTripper) http.RoundTripper {
+		return NewGitHubAuthTransport(rt, appID, appInstallationID, privateKey, tokenBroker)
+	}, opts)
+}
+
+// NewGitHubAppClient creates a client that authenticates as the GitHub App itself, e.g. to create installation
+// tokens. It does not depend on installation tokens and can therefore be used by the token broker.
+func (f *Factory) NewGitHubAppClient(
+	appID int64,
+	privateKey *rsa.PrivateKey,
+	opts *GitHubClientOptions,
+) (*github.Client, error) {
+	clientName := fmt.Sprintf("github-%d", appID)
+	return f.newGitHubClient(clientName, func(rt http.RoundTripper) http.RoundTripper {
+		return ghinstallation.NewAppsTransportFromPrivateKey(rt, appID, privateKey)
+	}, opts)
+}
+
+//nolint:mnd // magic numbers are used for client configuration
+func (f *Factory) newGitHubClient(
+	clientName string,
+	authTransport func(rt http.RoundTripper) http.RoundTripper,
 	opts *GitHubClientOptions,
 ) (*github.Client, error) {
 	if opts == nil {
 		opts = DefaultGitHubClientOptions()
 	}
 
-	clientName := fmt.Sprintf("github-%d-%d", appID, appInstallationID)
-
 	// RoundTrippers are called bottom to top
 	rt := http.DefaultTransport
 	// rate limit every retry
 	rt = github_ratelimit.NewSecondaryLimiter(rt)
 	rt = github_ratelimit.NewPrimaryLimiter(rt)
 	// update auth for every retry
-	rt = NewGitHubAuthTransport(rt, appID, appInstallationID, privateKey)
+	rt = authTransport(rt)
 	rt = resiliency.NewCircuitBreakerTransport(rt, nil)
 	// record metrics for every retry
 	rt = metrics.NewRequestMetricsTransport(rt, clientName, nil)
@@ -118,8 +151,18 @@ func (f *Factory) NewGitHubClient(
 	rt = otelhttp.NewTransport(rt, otelhttp.WithServerName(clientName))
 	rt = tracing.NewRequestIDHeaderTransport(rt, nil)
 
-	return github.NewClient(github.WithHTTPClient(&http.Client{
-		Transport: rt,
-		Timeout:   opts.Timeout,
-	}))
+	clientOpts := []github.ClientOptionsFunc{
+		github.WithHTTPClient(&http.Client{
+			Transport: rt,
+			Timeout:   opts.Timeout,
+		}),
+	}
+	if opts.EnterpriseBaseURL != "" {
+		uploadURL := opts.EnterpriseUploadURL
+		if uploadURL == "" {
+			uploadURL = opts.EnterpriseBaseURL
+		}
+		clientOpts = append(clientOpts, github.WithEnterpriseURLs(opts.EnterpriseBaseURL, uploadURL))
+	}
+	return github.NewClient(clientOpts...)
 }
@@ -0,0 +1,233 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	aulogging "github.com/StephanHCB/go-autumn-logging"
+	"github.com/google/go-github/v90/github"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"golang.org/x/sync/singleflight"
+)
+
+// GitHubTokenMintFn creates a new token for an installation of a GitHub App.
+type GitHubTokenMintFn func(ctx context.Context, appInstallationID int64) (*github.InstallationToken, error)
+
+// NewGitHubInstallationTokenMint creates installation tokens with the given client, which must authenticate as the
+// GitHub App itself, see Factory.NewGitHubAppClient.
+func NewGitHubInstallationTokenMint(appClient *github.Client) GitHubTokenMintFn {
+	return func(ctx context.Context, appInstallationID int64) (*github.InstallationToken, error) {
+		token, _, err := appClient.Apps.CreateInstallationToken(ctx, appInstallationID, nil)
+		return token, err
+	}
+}
+
+type Clock interface {
+	Now() time.Time
+}
+
+type GitHubTokenBrokerOptions struct {
+	// MinValidity is the remaining validity below which a token is no longer handed out.
+	MinValidity time.Duration
+	// RefreshBefore is the remaining validity below which a token is refreshed in the background.
+	RefreshBefore time.Duration
+	// RefreshInterval is the interval in which tokens are checked for background refresh.
+	RefreshInterval time.Duration
+}
+
+//nolint:mnd // magic numbers are used for broker configuration
+func DefaultGitHubTokenBrokerOptions() *GitHubTokenBrokerOptions {
+	return &GitHubTokenBrokerOptions{
+		MinValidity:     1 * time.Minute,
+		RefreshBefore:   10 * time.Minute,
+		RefreshInterval: 1 * time.Minute,
+	}
+}
+
+type brokeredToken struct {
+	token     string
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+// GitHubTokenBroker hands out installation tokens of a GitHub App. It is safe for concurrent use: tokens are
+// created at most once at a time per installation and refreshed in the background before they expire.
+type GitHubTokenBroker struct {
+	appID int64
+	mint  GitHubTokenMintFn
+	clock Clock
+	opts  *GitHubTokenBrokerOptions
+
+	mutex  sync.RWMutex
+	tokens map[int64]brokeredToken
+	group  singleflight.Group
+
+	tokenCreations metric.Int64Counter
+}
+
+func NewGitHubTokenBroker(
+	appID int64,
+	mint GitHubTokenMintFn,
+	clock Clock,
+	opts *GitHubTokenBrokerOptions,
+) (*GitHubTokenBroker, error) {
+	if opts == nil {
+		opts = DefaultGitHubTokenBrokerOptions()
+	}
+	broker := &GitHubTokenBroker{
+		appID:  appID,
+		mint:   mint,
+		clock:  clock,
+		opts:   opts,
+		tokens: make(map[int64]brokeredToken),
+	}
+	if err := broker.registerMetrics(); err != nil {
+		return nil, err
+	}
+	return broker, nil
+}
+
+// Token returns a token of the installation that is valid for at least the configured minimum validity.
+func (b *GitHubTokenBroker) Token(ctx context.Context, appInstallationID int64) (string, error) {
+	if token, ok := b.validToken(appInstallationID, b.opts.MinValidity); ok {
+		return token.token, nil
+	}
+	token, err := b.refresh(ctx, appInstallationID, b.opts.MinValidity)
+	if err != nil {
+		return "", err
+	}
+	return token.token, nil
+}
+
+// Run refreshes tokens that are about to expire until the context is done.
+func (b *GitHubTokenBroker) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.opts.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.RefreshExpiring(ctx)
+		}
+	}
+}
+
+// RefreshExpiring refreshes all tokens whose remaining validity is below the configured refresh threshold.
+func (b *GitHubTokenBroker) RefreshExpiring(ctx context.Context) {
+	b.mutex.RLock()
+	expiring := make([]int64, 0)
+	for appInstallationID, token := range b.tokens {
+		if token.expiresAt.Sub(b.clock.Now()) < b.opts.RefreshBefore {
+			expiring = append(expiring, appInstallationID)
+		}
+	}
+	b.mutex.RUnlock()
+
+	for _, appInstallationID := range expiring {
+		if _, err := b.refresh(ctx, appInstallationID, b.opts.RefreshBefore); err != nil {
+			aulogging.Logger.Ctx(ctx).Warn().WithErr(err).
+				Printf("failed to refresh token of github application %d installation %d", b.appID, appInstallationID)
+		}
+	}
+}
+
+func (b *GitHubTokenBroker) validToken(appInstallationID int64, minValidity time.Duration) (brokeredToken, bool) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	token, ok := b.tokens[appInstallationID]
+	if !ok || token.expiresAt.Sub(b.clock.Now()) < minValidity {
+		return brokeredToken{}, false
+	}
+	return token, true
+}
+
+// refresh creates a new token unless a concurrent call already did so. The token is created independently of the
+// cancellation of the context, as all concurrent callers share the result.
+func (b *GitHubTokenBroker) refresh(
+	ctx context.Context,
+	appInstallationID int64,
+	minValidity time.Duration,
+) (brokeredToken, error) {
+	result, err, _ := b.group.Do(strconv.FormatInt(appInstallationID, 10), func() (any, error) {
+		if token, ok := b.validToken(appInstallationID, minValidity); ok {
+			return token, nil
+		}
+
+		installationToken, err := b.mint(context.WithoutCancel(ctx), appInstallationID)
+		b.tokenCreations.Add(ctx, 1, metric.WithAttributes(
+			attribute.Int64("github_app_id", b.appID),
+			attribute.Int64("github_app_installation_id", appInstallationID),
+			attribute.Bool("success", err == nil),
+		))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create token for installation %d: %w", appInstallationID, err)
+		}
+
+		token := brokeredToken{
+			token:     installationToken.GetToken(),
+			createdAt: b.clock.Now(),
+			expiresAt: installationToken.GetExpiresAt().Time,
+		}
+		b.mutex.Lock()
+		b.tokens[appInstallationID] = token
+		b.mutex.Unlock()
+		return token, nil
+	})
+	if err != nil {
+		return brokeredToken{}, err
+	}
+	return result.(brokeredToken), nil
+}
+
+func (b *GitHubTokenBroker) registerMetrics() error {
+	meter := otel.GetMeterProvider().Meter("")
+
+	var err error
+	b.tokenCreations, err = meter.Int64Counter(
+		"github.installation_token.creations",
+		metric.WithDescription("Number of attempts to create GitHub App installation tokens."),
+	)
+	if err != nil {
+		return err
+	}
+	tokenAge, err := meter.Float64ObservableGauge(
+		"github.installation_token.age",
+		metric.WithDescription("Age of the current GitHub App installation token."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+	tokenExpiresIn, err := meter.Float64ObservableGauge(
+		"github.installation_token.expires_in",
+		metric.WithDescription("Remaining validity of the current GitHub App installation token."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, observer metric.Observer) error {
+		b.mutex.RLock()
+		defer b.mutex.RUnlock()
+
+		now := b.clock.Now()
+		for appInstallationID, token := range b.tokens {
+			attributes := metric.WithAttributes(
+				attribute.Int64("github_app_id", b.appID),
+				attribute.Int64("github_app_installation_id", appInstallationID),
+			)
+			observer.ObserveFloat64(tokenAge, now.Sub(token.createdAt).Seconds(), attributes)
+			observer.ObserveFloat64(tokenExpiresIn, token.expiresAt.Sub(now).Seconds(), attributes)
+		}
+		return nil
+	}, tokenAge, tokenExpiresIn)
+	return err
+}
@@ -0,0 +1,184 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v90/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+type fakeMint struct {
+	clock   *fakeClock
+	calls   atomic.Int32
+	release chan struct{}
+	err     error
+}
+
+func (m *fakeMint) Mint(_ context.Context, appInstallationID int64) (*github.InstallationToken, error) {
+	call := m.calls.Add(1)
+	if m.release != nil {
+		<-m.release
+	}
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &github.InstallationToken{
+		Token:     github.Ptr(fmt.Sprintf("token-%d-%d", appInstallationID, call)),
+		ExpiresAt: &github.Timestamp{Time: m.clock.Now().Add(time.Hour)},
+	}, nil
+}
+
+func newTestBroker(t *testing.T, mint *fakeMint) *GitHubTokenBroker {
+	t.Helper()
+	broker, err := NewGitHubTokenBroker(1, mint.Mint, mint.clock, nil)
+	require.NoError(t, err)
+	return broker
+}
+
+func TestGitHubTokenBroker_Token_CachesPerInstallation(t *testing.T) {
+	ctx := context.Background()
+	mint := &fakeMint{clock: &fakeClock{now: time.Now()}}
+	broker := newTestBroker(t, mint)
+
+	token, err := broker.Token(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "token-10-1", token)
+	token, err = broker.Token(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "token-10-1", token)
+	token, err = broker.Token(ctx, 20)
+	require.NoError(t, err)
+	assert.Equal(t, "token-20-2", token)
+
+	assert.Equal(t, int32(2), mint.calls.Load())
+}
+
+func TestGitHubTokenBroker_Token_RenewsExpiringTokens(t *testing.T) {
+	ctx := context.Background()
+	mint := &fakeMint{clock: &fakeClock{now: time.Now()}}
+	broker := newTestBroker(t, mint)
+
+	_, err := broker.Token(ctx, 10)
+	require.NoError(t, err)
+	mint.clock.Advance(time.Hour - 30*time.Second)
+
+	token, err := broker.Token(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "token-10-2", token)
+}
+
+func TestGitHubTokenBroker_Token_ConcurrentCallsCreateOnce(t *testing.T) {
+	ctx := context.Background()
+	mint := &fakeMint{clock: &fakeClock{now: time.Now()}, release: make(chan struct{})}
+	broker := newTestBroker(t, mint)
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	for i := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := broker.Token(ctx, 10)
+			assert.NoError(t, err)
+			tokens[i] = token
+		}()
+	}
+	close(mint.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), mint.calls.Load())
+	for _, token := range tokens {
+		assert.Equal(t, "token-10-1", token)
+	}
+}
+
+func TestGitHubTokenBroker_Token_Error(t *testing.T) {
+	ctx := context.Background()
+	mint := &fakeMint{clock: &fakeClock{now: time.Now()}, err: errors.New("failed")}
+	broker := newTestBroker(t, mint)
+
+	_, err := broker.Token(ctx, 10)
+	assert.Error(t, err)
+
+	mint.err = nil
+	token, err := broker.Token(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "token-10-2", token, "failures should not be cached")
+}
+
+func TestGitHubTokenBroker_RefreshExpiring(t *testing.T) {
+	ctx := context.Background()
+	mint := &fakeMint{clock: &fakeClock{now: time.Now()}}
+	broker := newTestBroker(t, mint)
+
+	_, err := broker.Token(ctx, 10)
+	require.NoError(t, err)
+
+	broker.RefreshExpiring(ctx)
+	assert.Equal(t, int32(1), mint.calls.Load(), "tokens far from expiry should not be refreshed")
+
+	mint.clock.Advance(55 * time.Minute)
+	broker.RefreshExpiring(ctx)
+	assert.Equal(t, int32(2), mint.calls.Load())
+
+	token, err := broker.Token(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "token-10-2", token)
+	assert.Equal(t, int32(2), mint.calls.Load())
+}
+
+func TestNewGitHubInstallationTokenMint_AuthenticatesAsApp(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v3/app/installations/10/access_tokens" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		authorization = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"token":"token-10","expires_at":"2030-01-01T00:00:00Z"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	opts := DefaultGitHubClientOptions()
+	opts.EnterpriseBaseURL = server.URL
+	appClient, err := NewFactory().NewGitHubAppClient(1, privateKey, opts)
+	require.NoError(t, err)
+
+	token, err := NewGitHubInstallationTokenMint(appClient)(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, "token-10", token.GetToken())
+	assert.True(t, strings.HasPrefix(authorization, "Bearer "), "installation tokens should be created with the app's JWT")
+}
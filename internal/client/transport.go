@@ -1,19 +1,32 @@
 package client
 
 import (
+	"context"
 	"crypto/rsa"
 	"net/http"
-	"strings"
+	"regexp"
 
 	"github.com/bradleyfalzon/ghinstallation/v2"
 )
 
+type gitHubAppInstallationIDKey struct{}
+
+// WithGitHubAppInstallationID selects the installation, whose token authenticates GitHub requests made with the
+// returned context, in place of the default installation of the client.
+func WithGitHubAppInstallationID(ctx context.Context, appInstallationID int64) context.Context {
+	return context.WithValue(ctx, gitHubAppInstallationIDKey{}, appInstallationID)
+}
+
+// appPath matches the endpoints of the app itself and those to find the installation of a repository, organization
+// or user, which require authentication as the app. GitHub Enterprise Server serves the API below '/api/v3'.
+var appPath = regexp.MustCompile(`^(/api/v3)?/(app(/.*)?|(repos/[^/]+/[^/]+|orgs/[^/]+|users/[^/]+)/installation)$`)
+
 type GithubAuthTransport struct {
-	base http.RoundTripper
+	base          http.RoundTripper
+	appsTransport *ghinstallation.AppsTransport
+	tokenBroker   *GitHubTokenBroker
 
-	appID             int64
 	appInstallationID int64
-	privateKey        *rsa.PrivateKey
 }
 
 func NewGitHubAuthTransport(
@@ -21,6 +34,7 @@ func NewGitHubAuthTransport(
 	appID int64,
 	appInstallationID int64,
 	privateKey *rsa.PrivateKey,
+	tokenBroker *GitHubTokenBroker,
 ) *GithubAuthTransport {
 	if rt == nil {
 		rt = http.DefaultTransport
@@ -28,18 +42,27 @@ func NewGitHubAuthTransport(
 
 	return &GithubAuthTransport{
 		base:              rt,
-		appID:             appID,
+		appsTransport:     ghinstallation.NewAppsTransportFromPrivateKey(rt, appID, privateKey),
+		tokenBroker:       tokenBroker,
 		appInstallationID: appInstallationID,
-		privateKey:        privateKey,
 	}
 }
 
 func (t *GithubAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	rt1 := ghinstallation.NewAppsTransportFromPrivateKey(t.base, t.appID, t.privateKey)
-	if strings.HasPrefix(req.URL.Path, "/app/installations") {
-		return rt1.RoundTrip(req)
+	if appPath.MatchString(req.URL.Path) {
+		return t.appsTransport.RoundTrip(req)
 	}
 
-	rt2 := ghinstallation.NewFromAppsTransport(rt1, t.appInstallationID)
-	return rt2.RoundTrip(req)
+	appInstallationID := t.appInstallationID
+	if contextInstallationID, ok := req.Context().Value(gitHubAppInstallationIDKey{}).(int64); ok {
+		appInstallationID = contextInstallationID
+	}
+	token, err := t.tokenBroker.Token(req.Context(), appInstallationID)
+	if err != nil {
+		return nil, err
+	}
+	// RoundTrippers must not modify the original request
+	authenticatedReq := req.Clone(req.Context())
+	authenticatedReq.Header.Set("Authorization", "token "+token)
+	return t.base.RoundTrip(authenticatedReq)
 }
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v90/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGithubAuthTransport_EnterpriseServer(t *testing.T) {
+	ctx := context.Background()
+
+	var mutex sync.Mutex
+	authorizations := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		authorizations[r.URL.Path] = r.Header.Get("Authorization")
+		mutex.Unlock()
+
+		switch r.URL.Path {
+		case "/api/v3/app/installations/10/access_tokens":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = fmt.Fprintf(w, `{"token":"installation-token","expires_at":"%s"}`,
+				time.Now().Add(time.Hour).Format(time.RFC3339))
+		case "/api/v3/repos/org/repo/installation":
+			_, _ = w.Write([]byte(`{"id":10}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var gitHubClient *github.Client
+	broker, err := NewGitHubTokenBroker(1, func(ctx context.Context, appInstallationID int64) (*github.InstallationToken, error) {
+		token, _, innerErr := gitHubClient.Apps.CreateInstallationToken(ctx, appInstallationID, nil)
+		return token, innerErr
+	}, &fakeClock{now: time.Now()}, nil)
+	require.NoError(t, err)
+	gitHubClient, err = github.NewClient(
+		github.WithHTTPClient(&http.Client{Transport: NewGitHubAuthTransport(nil, 1, 10, privateKey, broker)}),
+		github.WithEnterpriseURLs(server.URL, server.URL),
+	)
+	require.NoError(t, err)
+
+	_, _, err = gitHubClient.Apps.GetRepositoryInstallation(ctx, "org", "repo")
+	require.NoError(t, err)
+	_, _, err = gitHubClient.Repositories.Get(ctx, "org", "repo")
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(authorizations["/api/v3/repos/org/repo/installation"], "Bearer "),
+		"installation lookups should be authenticated as the app")
+	assert.True(t, strings.HasPrefix(authorizations["/api/v3/app/installations/10/access_tokens"], "Bearer "),
+		"token creation should be authenticated as the app")
+	assert.Equal(t, "token installation-token", authorizations["/api/v3/repos/org/repo"])
+}
@@ -2,16 +2,18 @@ package config
 
 import (
 	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"reflect"
+	"slices"
 	"strings"
-
-	"helm.sh/helm/v4/pkg/getter"
-	"helm.sh/helm/v4/pkg/registry"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 )
@@ -31,7 +33,99 @@ const (
 	SynchronizationMethodRedis
 )
 
-type HelmHostProviders map[string]getter.Providers
+// HelmHostProviders maps hosts to the providers of the Helm repositories and OCI registries on that host.
+type HelmHostProviders map[string][]HelmHostProvider
+
+type HelmProviderType string
+
+const (
+	HelmProviderTypeHTTP HelmProviderType = "http"
+	HelmProviderTypeOCI  HelmProviderType = "oci"
+)
+
+// HelmHostProvider holds the authentication and connection options for the URL schemes it provides on a host. The
+// options of 'oci' providers are also used to pull OCI artifacts other than Helm charts from the host.
+type HelmHostProvider struct {
+	Type    HelmProviderType
+	Schemes []string
+
+	Username string
+	Password string
+	// BearerToken is sent instead of Basic Auth credentials if set.
+	BearerToken string
+
+	// TLSConfig is nil unless a CA bundle, a client certificate or insecureSkipVerify is configured.
+	TLSConfig *tls.Config
+	// ProxyURL is nil if the proxy is taken from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	ProxyURL *url.URL
+	// PlainHTTP connects to OCI registries via HTTP instead of HTTPS.
+	PlainHTTP bool
+}
+
+func (p HelmHostProvider) Provides(scheme string) bool {
+	return slices.Contains(p.Schemes, scheme)
+}
+
+// HasTransportOptions reports whether the provider needs its own transport instead of the default one.
+func (p HelmHostProvider) HasTransportOptions() bool {
+	return p.TLSConfig != nil || p.ProxyURL != nil
+}
+
+// NewTransport returns an HTTP transport with the TLS and proxy options of the provider. Like Helm's transports, it
+// leaves responses compressed, so gzipped chart archives are not decompressed on the fly.
+func (p HelmHostProvider) NewTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableCompression = true
+	if p.TLSConfig != nil {
+		transport.TLSClientConfig = p.TLSConfig.Clone()
+	}
+	if p.ProxyURL != nil {
+		transport.Proxy = http.ProxyURL(p.ProxyURL)
+	}
+	return transport
+}
+
+// GitHubAppInstallationIDs maps GitHub repository owners to the installation of the GitHub App for that owner.
+type GitHubAppInstallationIDs map[string]int64
+
+type GitCredentialType string
+
+const (
+	GitCredentialTypeBasicAuth GitCredentialType = "basicAuth"
+	GitCredentialTypeToken     GitCredentialType = "token"
+	GitCredentialTypeSSH       GitCredentialType = "ssh"
+	GitCredentialTypeGitHubApp GitCredentialType = "githubApp"
+)
+
+type GitHostCredentials map[string]GitHostCredential
+
+type GitHostCredential struct {
+	Type GitCredentialType
+
+	// basic auth and token
+	Username string
+	Password string
+	Token    string
+
+	// ssh
+	SSHUser       string
+	SSHPrivateKey []byte
+	SSHPassphrase string
+	SSHKnownHosts []byte
+}
+
+// S3EndpointCredentials maps hosts of S3-compatible object storages, e.g. 'minio.example.com:9000', to the
+// credentials for accessing their buckets.
+type S3EndpointCredentials map[string]S3EndpointCredential
+
+type S3EndpointCredential struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// VirtualHostedStyle addresses buckets as subdomains of the host instead of as first path segments.
+	VirtualHostedStyle bool
+}
 
 type ApplicationConfig struct {
 	ApplicationName string `env:"APPLICATION_NAME" envDefault:"manifest-maestro"`
@@ -44,9 +138,37 @@ type ApplicationConfig struct {
 	HelmDefaultKubernetesAPIVersions []string          `env:"HELM_DEFAULT_KUBERNETES_API_VERSIONS" envDefault:"[]"`
 	HelmHostProviders                HelmHostProviders `env:"HELM_HOST_PROVIDERS"                  envDefault:"{}"`
 
-	GitHubAppID             int64          `env:"GITHUB_APP_ID"`
-	GitHubAppInstallationID int64          `env:"GITHUB_APP_INSTALLATION_ID"`
-	GitHubAppPrivateKey     rsa.PrivateKey `env:"GITHUB_APP_PRIVATE_KEY"`
+	OCIArtifactAllowedHosts []string `env:"OCI_ARTIFACT_ALLOWED_HOSTS"`
+
+	GitSparseFetch               bool               `env:"GIT_SPARSE_FETCH"        envDefault:"false"`
+	GitSubmodules                bool               `env:"GIT_SUBMODULES"          envDefault:"false"`
+	GitSubmodulesAllowOtherHosts bool               `env:"GIT_SUBMODULES_ALLOW_OTHER_HOSTS" envDefault:"false"`
+	GitLFS                       bool               `env:"GIT_LFS"                 envDefault:"false"`
+	GitLFSSizeLimit              int64              `env:"GIT_LFS_SIZE_LIMIT"      envDefault:"268435456"`
+	GitLFSTimeout                time.Duration      `env:"GIT_LFS_TIMEOUT"         envDefault:"5m"`
+	GitHostCredentials           GitHostCredentials `env:"GIT_HOST_CREDENTIALS"    envDefault:"{}"`
+	GitReferenceCacheTTL         time.Duration      `env:"GIT_REFERENCE_CACHE_TTL" envDefault:"30s"`
+	ReferenceInvalidationToken   string             `env:"REFERENCE_INVALIDATION_TOKEN"`
+	GitMirrorDirectory           string             `env:"GIT_MIRROR_DIRECTORY"`
+	GitMirrorSizeLimit           int64              `env:"GIT_MIRROR_SIZE_LIMIT"   envDefault:"10737418240"`
+
+	GitHubAPIURL             string                   `env:"GITHUB_API_URL"`
+	GitHubUploadURL          string                   `env:"GITHUB_UPLOAD_URL"`
+	GitHubAppID              int64                    `env:"GITHUB_APP_ID"`
+	GitHubAppInstallationID  int64                    `env:"GITHUB_APP_INSTALLATION_ID"`
+	GitHubAppInstallationIDs GitHubAppInstallationIDs `env:"GITHUB_APP_INSTALLATION_IDS" envDefault:"{}"`
+	GitHubAppPrivateKey      rsa.PrivateKey           `env:"GITHUB_APP_PRIVATE_KEY"`
+	GitHubWebhookSecret      string                   `env:"GITHUB_WEBHOOK_SECRET"`
+	GitHubWebhookPrefetch    bool                     `env:"GITHUB_WEBHOOK_PREFETCH"     envDefault:"false"`
+	GitHubArchiveDownload    bool                     `env:"GITHUB_ARCHIVE_DOWNLOAD"     envDefault:"false"`
+	GitHubArchiveTimeout     time.Duration            `env:"GITHUB_ARCHIVE_TIMEOUT"      envDefault:"5m"`
+
+	FileSystemCacheSizeLimit int64 `env:"FILESYSTEM_CACHE_SIZE_LIMIT" envDefault:"268435456"`
+
+	LocalPathBaseDirectories []string `env:"LOCAL_PATH_BASE_DIRECTORIES"`
+
+	S3EndpointCredentials S3EndpointCredentials `env:"S3_ENDPOINT_CREDENTIALS" envDefault:"{}"`
+	S3AllowedHosts        []string              `env:"S3_ALLOWED_HOSTS"`
 
 	SynchronizationMethod        SynchronizationMethod `env:"SYNCHRONIZATION_METHOD"         envDefault:"MEMORY"`
 	SynchronizationRedisURL      string                `env:"SYNCHRONIZATION_REDIS_URL"`
@@ -58,7 +180,7 @@ func NewApplicationConfig() *ApplicationConfig {
 }
 
 func (c *ApplicationConfig) ObtainValuesFromEnv() error {
-	return env.ParseWithOptions(c, env.Options{
+	if err := env.ParseWithOptions(c, env.Options{
 		FuncMap: map[reflect.Type]env.ParserFunc{
 			reflect.TypeOf(rsa.PrivateKey{}): func(v string) (any, error) {
 				return parseGithubPrivateKey(v)
@@ -69,8 +191,54 @@ func (c *ApplicationConfig) ObtainValuesFromEnv() error {
 			reflect.TypeOf(HelmHostProviders{}): func(v string) (any, error) {
 				return parseHelmHostProviders(v)
 			},
+			reflect.TypeOf(GitHostCredentials{}): func(v string) (any, error) {
+				return parseGitHostCredentials(v)
+			},
+			reflect.TypeOf(GitHubAppInstallationIDs{}): func(v string) (any, error) {
+				return parseGitHubAppInstallationIDs(v)
+			},
+			reflect.TypeOf(S3EndpointCredentials{}): func(v string) (any, error) {
+				return parseS3EndpointCredentials(v)
+			},
 		},
-	})
+	}); err != nil {
+		return err
+	}
+	for name, value := range map[string]string{"GITHUB_API_URL": c.GitHubAPIURL, "GITHUB_UPLOAD_URL": c.GitHubUploadURL} {
+		if value == "" {
+			continue
+		}
+		if parsed, err := url.Parse(value); err != nil || !parsed.IsAbs() || parsed.Host == "" {
+			return fmt.Errorf("invalid %s: '%s' is not an absolute url", name, value)
+		}
+	}
+	return nil
+}
+
+// GitHubHost returns the host serving the Git repositories of the configured GitHub instance, e.g. 'github.com'
+// for 'https://api.github.com/' or 'github.example.com' for 'https://github.example.com/api/v3/'.
+func (c *ApplicationConfig) GitHubHost() string {
+	if c.GitHubAPIURL == "" {
+		return "github.com"
+	}
+	apiURL, err := url.Parse(c.GitHubAPIURL)
+	if err != nil {
+		return "github.com"
+	}
+	return strings.TrimPrefix(apiURL.Host, "api.")
+}
+
+func parseGitHubAppInstallationIDs(raw string) (GitHubAppInstallationIDs, error) {
+	var installationIDs GitHubAppInstallationIDs
+	if err := json.Unmarshal([]byte(raw), &installationIDs); err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_APP_INSTALLATION_IDS: %w", err)
+	}
+	for owner, installationID := range installationIDs {
+		if installationID <= 0 {
+			return nil, fmt.Errorf("invalid GITHUB_APP_INSTALLATION_IDS: installation id of owner '%s' must be positive", owner)
+		}
+	}
+	return installationIDs, nil
 }
 
 func parseGithubPrivateKey(value string) (rsa.PrivateKey, error) {
@@ -99,9 +267,13 @@ func parseSynchronizationMethod(value string) (SynchronizationMethod, error) {
 type helmHostProvidersRaw = map[string][]helmHostProviderRaw
 
 type helmHostProviderRaw struct {
-	Type      string        `json:"type"`
-	Schemes   []string      `json:"schemes"`
-	BasicAuth *basicAuthRaw `json:"basicAuth"`
+	Type        string          `json:"type"`
+	Schemes     []string        `json:"schemes"`
+	BasicAuth   *basicAuthRaw   `json:"basicAuth"`
+	BearerToken *bearerTokenRaw `json:"bearerToken"`
+	TLS         *tlsRaw         `json:"tls"`
+	PlainHTTP   bool            `json:"plainHTTP"`
+	Proxy       *string         `json:"proxy"`
 }
 
 type basicAuthRaw struct {
@@ -109,6 +281,27 @@ type basicAuthRaw struct {
 	Password       *string `json:"password"`
 	UsernameEnvVar *string `json:"usernameEnvVar"`
 	PasswordEnvVar *string `json:"passwordEnvVar"`
+	UsernameFile   *string `json:"usernameFile"`
+	PasswordFile   *string `json:"passwordFile"`
+}
+
+type bearerTokenRaw struct {
+	Token       *string `json:"token"`
+	TokenEnvVar *string `json:"tokenEnvVar"`
+	TokenFile   *string `json:"tokenFile"`
+}
+
+type tlsRaw struct {
+	CACert             *string `json:"caCert"`
+	CACertEnvVar       *string `json:"caCertEnvVar"`
+	CACertFile         *string `json:"caCertFile"`
+	ClientCert         *string `json:"clientCert"`
+	ClientCertEnvVar   *string `json:"clientCertEnvVar"`
+	ClientCertFile     *string `json:"clientCertFile"`
+	ClientKey          *string `json:"clientKey"`
+	ClientKeyEnvVar    *string `json:"clientKeyEnvVar"`
+	ClientKeyFile      *string `json:"clientKeyFile"`
+	InsecureSkipVerify bool    `json:"insecureSkipVerify"`
 }
 
 func parseHelmHostProviders(raw string) (HelmHostProviders, error) {
@@ -116,60 +309,158 @@ func parseHelmHostProviders(raw string) (HelmHostProviders, error) {
 	if err := json.Unmarshal([]byte(raw), &raws); err != nil {
 		return nil, fmt.Errorf("invalid HELM_HOST_PROVIDERS: %w", err)
 	}
-	helmHostProviders := make(map[string]getter.Providers)
+	helmHostProviders := make(HelmHostProviders)
 	for host, r := range raws {
-		providers := make(getter.Providers, 0, len(raws))
+		providers := make([]HelmHostProvider, 0, len(r))
 		for i, p := range r {
 			ptype := strings.ToLower(strings.TrimSpace(p.Type))
 			if ptype == "" {
 				return nil, fmt.Errorf("helm provider at index %d missing type", i)
 			}
+			var provider HelmHostProvider
+			var err error
 			switch ptype {
 			case "http", "https":
-				providers = append(providers, buildHTTPProviderFromRaw(p))
+				provider, err = buildHTTPProviderFromRaw(p)
 			case "oci":
-				providers = append(providers, buildOCIProviderFromRaw(p))
+				provider, err = buildOCIProviderFromRaw(p)
 			default:
 				return nil, fmt.Errorf("unsupported helm provider type '%s' at index %d", p.Type, i)
 			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid HELM_HOST_PROVIDERS: helm provider of host '%s' at index %d: %w", host, i, err)
+			}
+			providers = append(providers, provider)
 		}
 		helmHostProviders[host] = providers
 	}
 	return helmHostProviders, nil
 }
 
-func buildHTTPProviderFromRaw(raw helmHostProviderRaw) getter.Provider {
+func buildHTTPProviderFromRaw(raw helmHostProviderRaw) (HelmHostProvider, error) {
+	if raw.PlainHTTP {
+		return HelmHostProvider{}, fmt.Errorf("plainHTTP is only supported by 'oci' providers, use an 'http' URL instead")
+	}
 	schemes := raw.Schemes
 	if len(schemes) == 0 {
 		schemes = []string{"http", "https"}
 	}
-	username, password := extractCredentials(raw.BasicAuth)
-	return getter.Provider{Schemes: schemes, New: func(options ...getter.Option) (getter.Getter, error) {
-		if username != "" && password != "" {
-			options = append(options, getter.WithBasicAuth(username, password))
-		}
-		return getter.NewHTTPGetter(options...)
-	}}
+	return buildProviderFromRaw(HelmProviderTypeHTTP, schemes, raw)
 }
 
-func buildOCIProviderFromRaw(raw helmHostProviderRaw) getter.Provider {
+func buildOCIProviderFromRaw(raw helmHostProviderRaw) (HelmHostProvider, error) {
 	schemes := raw.Schemes
 	if len(schemes) == 0 {
 		schemes = []string{"oci"}
 	}
-	username, password := extractCredentials(raw.BasicAuth)
-	return getter.Provider{Schemes: schemes, New: func(options ...getter.Option) (getter.Getter, error) {
-		if username != "" && password != "" {
-			client, err := registry.NewClient(
-				registry.ClientOptBasicAuth(username, password),
-			)
-			if err != nil {
-				return nil, err
-			}
-			options = append(options, getter.WithRegistryClient(client))
+	return buildProviderFromRaw(HelmProviderTypeOCI, schemes, raw)
+}
+
+func buildProviderFromRaw(providerType HelmProviderType, schemes []string, raw helmHostProviderRaw) (HelmHostProvider, error) {
+	provider := HelmHostProvider{Type: providerType, Schemes: schemes, PlainHTTP: raw.PlainHTTP}
+
+	username, password, err := extractCredentialsWithFiles(raw.BasicAuth)
+	if err != nil {
+		return HelmHostProvider{}, err
+	}
+	if username != "" && password != "" {
+		provider.Username, provider.Password = username, password
+	}
+	if raw.BearerToken != nil {
+		token, err := valueOrEnvOrFile(raw.BearerToken.Token, raw.BearerToken.TokenEnvVar, raw.BearerToken.TokenFile)
+		if err != nil {
+			return HelmHostProvider{}, fmt.Errorf("bearer token: %w", err)
+		}
+		provider.BearerToken = strings.TrimSpace(token)
+	}
+
+	if raw.TLS != nil {
+		tlsConfig, err := buildTLSConfigFromRaw(*raw.TLS)
+		if err != nil {
+			return HelmHostProvider{}, err
+		}
+		provider.TLSConfig = tlsConfig
+	}
+
+	if raw.Proxy != nil && *raw.Proxy != "" {
+		proxyURL, err := url.Parse(*raw.Proxy)
+		if err != nil {
+			return HelmHostProvider{}, fmt.Errorf("invalid proxy: %w", err)
+		}
+		if proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return HelmHostProvider{}, fmt.Errorf("invalid proxy '%s': expected an absolute URL", proxyURL.Redacted())
+		}
+		provider.ProxyURL = proxyURL
+	}
+	return provider, nil
+}
+
+func buildTLSConfigFromRaw(raw tlsRaw) (*tls.Config, error) {
+	caCert, err := valueOrEnvOrFile(raw.CACert, raw.CACertEnvVar, raw.CACertFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls CA certificate: %w", err)
+	}
+	clientCert, err := valueOrEnvOrFile(raw.ClientCert, raw.ClientCertEnvVar, raw.ClientCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls client certificate: %w", err)
+	}
+	clientKey, err := valueOrEnvOrFile(raw.ClientKey, raw.ClientKeyEnvVar, raw.ClientKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls client key: %w", err)
+	}
+	if caCert == "" && clientCert == "" && clientKey == "" && !raw.InsecureSkipVerify {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: raw.InsecureSkipVerify, //nolint:gosec // opt-in for test registries
+	}
+	if caCert != "" {
+		// the CA bundle is trusted in addition to the system roots, so public hosts keep working behind proxies
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM([]byte(caCert)) {
+			return nil, fmt.Errorf("tls CA certificate: no PEM encoded certificates found")
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	if clientCert != "" || clientKey != "" {
+		if clientCert == "" || clientKey == "" {
+			return nil, fmt.Errorf("tls client certificate and key must be configured together")
+		}
+		certificate, err := tls.X509KeyPair([]byte(clientCert), []byte(clientKey))
+		if err != nil {
+			return nil, fmt.Errorf("tls client certificate: %w", err)
 		}
-		return getter.NewOCIGetter(options...)
-	}}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+// extractCredentialsWithFiles is like extractCredentials, with the credentials read from files if configured.
+func extractCredentialsWithFiles(auth *basicAuthRaw) (string, string, error) {
+	username, password := extractCredentials(auth)
+	if auth == nil {
+		return username, password, nil
+	}
+	if username == "" && auth.UsernameFile != nil && *auth.UsernameFile != "" {
+		value, err := readSecretFile(*auth.UsernameFile)
+		if err != nil {
+			return "", "", fmt.Errorf("basic auth username: %w", err)
+		}
+		username = value
+	}
+	if password == "" && auth.PasswordFile != nil && *auth.PasswordFile != "" {
+		value, err := readSecretFile(*auth.PasswordFile)
+		if err != nil {
+			return "", "", fmt.Errorf("basic auth password: %w", err)
+		}
+		password = value
+	}
+	return username, password, nil
 }
 
 func extractCredentials(auth *basicAuthRaw) (string, string) {
@@ -192,3 +483,153 @@ func extractCredentials(auth *basicAuthRaw) (string, string) {
 	}
 	return username, password
 }
+
+type gitHostCredentialRaw struct {
+	Type      string        `json:"type"`
+	BasicAuth *basicAuthRaw `json:"basicAuth"`
+	Token     *tokenRaw     `json:"token"`
+	SSH       *sshRaw       `json:"ssh"`
+}
+
+type tokenRaw struct {
+	Username    *string `json:"username"`
+	Token       *string `json:"token"`
+	TokenEnvVar *string `json:"tokenEnvVar"`
+}
+
+type sshRaw struct {
+	User             *string `json:"user"`
+	PrivateKey       *string `json:"privateKey"`
+	PrivateKeyEnvVar *string `json:"privateKeyEnvVar"`
+	Passphrase       *string `json:"passphrase"`
+	PassphraseEnvVar *string `json:"passphraseEnvVar"`
+	KnownHosts       *string `json:"knownHosts"`
+	KnownHostsEnvVar *string `json:"knownHostsEnvVar"`
+}
+
+func parseGitHostCredentials(raw string) (GitHostCredentials, error) {
+	var raws map[string]gitHostCredentialRaw
+	if err := json.Unmarshal([]byte(raw), &raws); err != nil {
+		return nil, fmt.Errorf("invalid GIT_HOST_CREDENTIALS: %w", err)
+	}
+	gitHostCredentials := make(GitHostCredentials)
+	for host, r := range raws {
+		credential, err := buildGitHostCredentialFromRaw(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GIT_HOST_CREDENTIALS for host '%s': %w", host, err)
+		}
+		gitHostCredentials[host] = credential
+	}
+	return gitHostCredentials, nil
+}
+
+func buildGitHostCredentialFromRaw(raw gitHostCredentialRaw) (GitHostCredential, error) {
+	switch credentialType := GitCredentialType(strings.TrimSpace(raw.Type)); credentialType {
+	case GitCredentialTypeBasicAuth:
+		username, password := extractCredentials(raw.BasicAuth)
+		if username == "" || password == "" {
+			return GitHostCredential{}, fmt.Errorf("basic auth requires username and password")
+		}
+		return GitHostCredential{Type: credentialType, Username: username, Password: password}, nil
+	case GitCredentialTypeToken:
+		if raw.Token == nil {
+			return GitHostCredential{}, fmt.Errorf("token credential requires token")
+		}
+		token := valueOrEnv(raw.Token.Token, raw.Token.TokenEnvVar)
+		if token == "" {
+			return GitHostCredential{}, fmt.Errorf("token credential requires token")
+		}
+		return GitHostCredential{Type: credentialType, Username: valueOrEnv(raw.Token.Username, nil), Token: token}, nil
+	case GitCredentialTypeSSH:
+		if raw.SSH == nil {
+			return GitHostCredential{}, fmt.Errorf("ssh credential requires private key and known hosts")
+		}
+		privateKey := valueOrEnv(raw.SSH.PrivateKey, raw.SSH.PrivateKeyEnvVar)
+		knownHosts := valueOrEnv(raw.SSH.KnownHosts, raw.SSH.KnownHostsEnvVar)
+		if privateKey == "" || knownHosts == "" {
+			return GitHostCredential{}, fmt.Errorf("ssh credential requires private key and known hosts")
+		}
+		user := valueOrEnv(raw.SSH.User, nil)
+		if user == "" {
+			user = "git"
+		}
+		return GitHostCredential{
+			Type:          credentialType,
+			SSHUser:       user,
+			SSHPrivateKey: []byte(privateKey),
+			SSHPassphrase: valueOrEnv(raw.SSH.Passphrase, raw.SSH.PassphraseEnvVar),
+			SSHKnownHosts: []byte(knownHosts),
+		}, nil
+	case GitCredentialTypeGitHubApp:
+		return GitHostCredential{Type: credentialType}, nil
+	case "":
+		return GitHostCredential{}, fmt.Errorf("missing type")
+	default:
+		return GitHostCredential{}, fmt.Errorf("unsupported type '%s'", raw.Type)
+	}
+}
+
+type s3EndpointCredentialRaw struct {
+	Region                *string `json:"region"`
+	AccessKeyID           *string `json:"accessKeyId"`
+	AccessKeyIDEnvVar     *string `json:"accessKeyIdEnvVar"`
+	SecretAccessKey       *string `json:"secretAccessKey"`
+	SecretAccessKeyEnvVar *string `json:"secretAccessKeyEnvVar"`
+	SessionToken          *string `json:"sessionToken"`
+	SessionTokenEnvVar    *string `json:"sessionTokenEnvVar"`
+	VirtualHostedStyle    bool    `json:"virtualHostedStyle"`
+}
+
+func parseS3EndpointCredentials(raw string) (S3EndpointCredentials, error) {
+	var raws map[string]s3EndpointCredentialRaw
+	if err := json.Unmarshal([]byte(raw), &raws); err != nil {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT_CREDENTIALS: %w", err)
+	}
+	s3EndpointCredentials := make(S3EndpointCredentials)
+	for host, r := range raws {
+		credential := S3EndpointCredential{
+			Region:             valueOrEnv(r.Region, nil),
+			AccessKeyID:        valueOrEnv(r.AccessKeyID, r.AccessKeyIDEnvVar),
+			SecretAccessKey:    valueOrEnv(r.SecretAccessKey, r.SecretAccessKeyEnvVar),
+			SessionToken:       valueOrEnv(r.SessionToken, r.SessionTokenEnvVar),
+			VirtualHostedStyle: r.VirtualHostedStyle,
+		}
+		if (credential.AccessKeyID == "") != (credential.SecretAccessKey == "") {
+			return nil, fmt.Errorf(
+				"invalid S3_ENDPOINT_CREDENTIALS for host '%s': access key id and secret access key must be set together", host)
+		}
+		s3EndpointCredentials[host] = credential
+	}
+	return s3EndpointCredentials, nil
+}
+
+// valueOrEnvOrFile returns the literal value if set, otherwise the value of the environment variable, otherwise the
+// content of the file. Files are read once at startup, e.g. secrets mounted into the container.
+func valueOrEnvOrFile(value *string, envVar *string, file *string) (string, error) {
+	if resolved := valueOrEnv(value, envVar); resolved != "" {
+		return resolved, nil
+	}
+	if file != nil && *file != "" {
+		return readSecretFile(*file)
+	}
+	return "", nil
+}
+
+func readSecretFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file '%s': %w", path, err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// valueOrEnv returns the literal value if set, otherwise the value of the environment variable.
+func valueOrEnv(value *string, envVar *string) string {
+	if value != nil && *value != "" {
+		return *value
+	}
+	if envVar != nil && *envVar != "" {
+		return os.Getenv(*envVar)
+	}
+	return ""
+}
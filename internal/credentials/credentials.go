@@ -0,0 +1,178 @@
+package credentials
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// Credentials are sent along with a single request to access private sources the server holds no credentials for,
+// e.g. a short-lived registry token or a Git personal access token. They take precedence over the configured
+// credentials of the same host, are used only for the fetches of that request and are never logged.
+type Credentials struct {
+	// Git authenticates Git repositories, keyed by host like GIT_HOST_CREDENTIALS.
+	Git map[string]GitCredential `json:"git,omitempty"`
+	// Helm authenticates Helm repositories and OCI registries, keyed by host like HELM_HOST_PROVIDERS.
+	Helm map[string]HelmCredential `json:"helm,omitempty"`
+}
+
+// GitCredential authenticates with username and password, with a token as password if a username is given, or
+// with a bearer token otherwise.
+type GitCredential struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+func (c GitCredential) String() string {
+	return fmt.Sprintf("GitCredential{Username: %q, Password: %s, Token: %s}",
+		c.Username, redact(c.Password), redact(c.Token))
+}
+
+func (c GitCredential) GoString() string {
+	return c.String()
+}
+
+// HelmCredential authenticates with Basic Auth, registry tokens are passed as password.
+type HelmCredential struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+func (c HelmCredential) String() string {
+	return fmt.Sprintf("HelmCredential{Username: %q, Password: %s}", c.Username, redact(c.Password))
+}
+
+func (c HelmCredential) GoString() string {
+	return c.String()
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return `""`
+	}
+	return "<redacted>"
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the credentials, which apply to all fetches made with it.
+func NewContext(ctx context.Context, credentials *Credentials) context.Context {
+	if credentials == nil || (len(credentials.Git) == 0 && len(credentials.Helm) == 0) {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{}, credentials)
+}
+
+func fromContext(ctx context.Context) *Credentials {
+	credentials, _ := ctx.Value(contextKey{}).(*Credentials)
+	return credentials
+}
+
+// GitCredentialFor returns the request credential for the Git host, as named by the endpoint of its repository URLs.
+func GitCredentialFor(ctx context.Context, host string) (GitCredential, bool) {
+	credentials := fromContext(ctx)
+	if credentials == nil {
+		return GitCredential{}, false
+	}
+	credential, ok := credentials.Git[host]
+	return credential, ok
+}
+
+// HelmCredentialFor returns the request credential for the host, including the port if any, of a Helm repository or
+// OCI registry.
+func HelmCredentialFor(ctx context.Context, host string) (HelmCredential, bool) {
+	credentials := fromContext(ctx)
+	if credentials == nil {
+		return HelmCredential{}, false
+	}
+	credential, ok := credentials.Helm[host]
+	return credential, ok
+}
+
+// HasGitCredential reports whether the repository is fetched with a request credential.
+func HasGitCredential(ctx context.Context, repositoryURL string) bool {
+	_, ok := GitCredentialFor(ctx, gitHost(repositoryURL))
+	return ok
+}
+
+// GitCacheKey partitions the cache key of content fetched from the Git repository, if it is fetched with a request
+// credential, so the content is only served to requests with the same credential.
+func GitCacheKey(ctx context.Context, repositoryURL string, key string) string {
+	host := gitHost(repositoryURL)
+	credential, ok := GitCredentialFor(ctx, host)
+	if !ok {
+		return key
+	}
+	return partition(key, host, credential.Username, credential.Password, credential.Token)
+}
+
+// GitCheckoutCacheKey partitions the cache key of a checked out Git repository on the request credentials of all Git
+// hosts, as its submodules may be fetched from other hosts than the one of the repository.
+func GitCheckoutCacheKey(ctx context.Context, key string) string {
+	credentials := fromContext(ctx)
+	if credentials == nil || len(credentials.Git) == 0 {
+		return key
+	}
+	values := make([]string, 0, 4*len(credentials.Git))
+	for _, host := range slices.Sorted(maps.Keys(credentials.Git)) {
+		credential := credentials.Git[host]
+		values = append(values, host, credential.Username, credential.Password, credential.Token)
+	}
+	return partition(key, values...)
+}
+
+// HelmCacheKey partitions the cache key of content fetched from the URL of a Helm repository or OCI registry, like
+// GitCacheKey. References without scheme, e.g. 'ghcr.io/org/charts', are accepted as well.
+func HelmCacheKey(ctx context.Context, rawURL string, key string) string {
+	host := helmHost(rawURL)
+	credential, ok := HelmCredentialFor(ctx, host)
+	if !ok {
+		return key
+	}
+	return partition(key, host, credential.Username, credential.Password)
+}
+
+func gitHost(repositoryURL string) string {
+	endpoint, err := transport.NewEndpoint(repositoryURL)
+	if err != nil {
+		return ""
+	}
+	return endpoint.Host
+}
+
+func helmHost(rawURL string) string {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "oci://" + rawURL
+	}
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return parsedURL.Host
+}
+
+// partitionKey keys the digests of credentials in cache keys. It is chosen per process, so cache keys reveal
+// nothing about the credentials, at the cost of not sharing partitioned entries between instances.
+var partitionKey = func() []byte {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	return key
+}()
+
+func partition(key string, values ...string) string {
+	mac := hmac.New(sha256.New, partitionKey)
+	for _, value := range values {
+		mac.Write([]byte(value))
+		mac.Write([]byte{0})
+	}
+	return fmt.Sprintf("%s|credentials:%x", key, mac.Sum(nil))
+}
@@ -0,0 +1,67 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheKey(t *testing.T) {
+	ctx := NewContext(context.Background(), &Credentials{
+		Git:  map[string]GitCredential{"github.com": {Token: "token"}},
+		Helm: map[string]HelmCredential{"registry.example.com:5000": {Username: "user", Password: "password"}},
+	})
+	otherCtx := NewContext(context.Background(), &Credentials{
+		Git: map[string]GitCredential{"github.com": {Token: "other-token"}},
+	})
+
+	key := GitCacheKey(ctx, "https://github.com/org/repo.git", "key")
+	assert.Contains(t, key, "key|credentials:")
+	assert.NotContains(t, key, "token")
+	assert.Equal(t, key, GitCacheKey(ctx, "git@github.com:org/other.git", "key"))
+	assert.NotEqual(t, key, GitCacheKey(otherCtx, "https://github.com/org/repo.git", "key"))
+	assert.Equal(t, "key", GitCacheKey(ctx, "https://gitlab.com/org/repo.git", "key"))
+	assert.Equal(t, "key", GitCacheKey(context.Background(), "https://github.com/org/repo.git", "key"))
+
+	key = HelmCacheKey(ctx, "oci://registry.example.com:5000/charts/app", "key")
+	assert.Contains(t, key, "key|credentials:")
+	assert.Equal(t, key, HelmCacheKey(ctx, "registry.example.com:5000/charts/app", "key"))
+	assert.Equal(t, "key", HelmCacheKey(ctx, "oci://registry.example.com/charts/app", "key"))
+}
+
+func TestGitCheckoutCacheKey(t *testing.T) {
+	ctx := NewContext(context.Background(), &Credentials{
+		Git: map[string]GitCredential{"github.com": {Token: "token"}, "gitlab.com": {Token: "token"}},
+	})
+	otherCtx := NewContext(context.Background(), &Credentials{
+		Git: map[string]GitCredential{"github.com": {Token: "token"}, "gitlab.com": {Token: "other-token"}},
+	})
+
+	key := GitCheckoutCacheKey(ctx, "key")
+	assert.Contains(t, key, "key|credentials:")
+	assert.NotContains(t, key, "token")
+	assert.Equal(t, key, GitCheckoutCacheKey(ctx, "key"))
+	assert.NotEqual(t, key, GitCheckoutCacheKey(otherCtx, "key"),
+		"submodules of other hosts may be fetched with the credentials")
+	assert.Equal(t, "key", GitCheckoutCacheKey(context.Background(), "key"))
+}
+
+func TestNewContext_Empty(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, ctx, NewContext(ctx, nil))
+	assert.Equal(t, ctx, NewContext(ctx, &Credentials{}))
+}
+
+func TestCredential_String(t *testing.T) {
+	credentials := Credentials{
+		Git:  map[string]GitCredential{"github.com": {Username: "user", Token: "secret-token"}},
+		Helm: map[string]HelmCredential{"ghcr.io": {Username: "user", Password: "secret-password"}},
+	}
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		formatted := fmt.Sprintf(format, credentials)
+		assert.NotContains(t, formatted, "secret")
+		assert.Contains(t, formatted, "user")
+	}
+}
@@ -1,44 +1,318 @@
 package git
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	nethttp "net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/Roshick/manifest-maestro/internal/credentials"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
 	"github.com/google/go-github/v90/github"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
+// GitHubAppAuthProvider authenticates with installation tokens of a GitHub App. The installation is selected by the
+// owner of the repository: configured owners map to their installation, all other owners use the default
+// installation or, without one, the installation found for the repository. Owners without installation are looked
+// up again after missingInstallationTTL, so installations added later are picked up.
 type GitHubAppAuthProvider struct {
-	client            *github.Client
-	appInstallationID int64
+	client                  *github.Client
+	tokenSource             InstallationTokenSource
+	clock                   Clock
+	defaultInstallationID   int64
+	ownerAppInstallationIDs map[string]int64
 
-	token *github.InstallationToken
+	mutex                     sync.Mutex
+	discoveredInstallationIDs map[string]discoveredInstallation
+}
+
+const missingInstallationTTL = 5 * time.Minute
+
+type discoveredInstallation struct {
+	installationID int64
+	// expiresAt is only set for owners without installation
+	expiresAt time.Time
+}
+
+type Clock interface {
+	Now() time.Time
+}
+
+// InstallationTokenSource provides valid tokens of GitHub App installations.
+type InstallationTokenSource interface {
+	Token(ctx context.Context, appInstallationID int64) (string, error)
 }
 
 func NewGitHubAppAuthProvider(
 	client *github.Client,
-	appInstallationID int64,
+	tokenSource InstallationTokenSource,
+	clock Clock,
+	defaultInstallationID int64,
+	ownerInstallationIDs map[string]int64,
 ) *GitHubAppAuthProvider {
+	ownerAppInstallationIDs := make(map[string]int64, len(ownerInstallationIDs))
+	for owner, installationID := range ownerInstallationIDs {
+		ownerAppInstallationIDs[strings.ToLower(owner)] = installationID
+	}
 	return &GitHubAppAuthProvider{
-		client:            client,
-		appInstallationID: appInstallationID,
+		client:                    client,
+		tokenSource:               tokenSource,
+		clock:                     clock,
+		defaultInstallationID:     defaultInstallationID,
+		ownerAppInstallationIDs:   ownerAppInstallationIDs,
+		discoveredInstallationIDs: make(map[string]discoveredInstallation),
 	}
 }
 
-func (p *GitHubAppAuthProvider) GetAuth(ctx context.Context) (transport.AuthMethod, error) {
-	next30Seconds := time.Now().Add(30 * time.Second)
-	if p.token == nil || p.token.GetExpiresAt().Before(next30Seconds) {
-		var err error
-		p.token, _, err = p.client.Apps.CreateInstallationToken(ctx, p.appInstallationID, nil)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create installation token: %w", err)
-		}
+func (p *GitHubAppAuthProvider) GetAuth(ctx context.Context, repositoryURL string) (transport.AuthMethod, error) {
+	installationID, err := p.installationID(ctx, repositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	if installationID == 0 {
+		// the app is not installed for the owner, public repositories remain accessible
+		return nil, nil
+	}
+
+	token, err := p.tokenSource.Token(ctx, installationID)
+	if err != nil {
+		return nil, err
 	}
 
 	return &http.BasicAuth{
 		Username: "x-access-token",
-		Password: p.token.GetToken(),
+		Password: token,
+	}, nil
+}
+
+// InstallationIDs returns the configured installations and those discovered so far.
+func (p *GitHubAppAuthProvider) InstallationIDs() []int64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	installationIDs := make([]int64, 0)
+	if p.defaultInstallationID != 0 {
+		installationIDs = append(installationIDs, p.defaultInstallationID)
+	}
+	for _, installationID := range p.ownerAppInstallationIDs {
+		installationIDs = append(installationIDs, installationID)
+	}
+	for _, installation := range p.discoveredInstallationIDs {
+		installationIDs = append(installationIDs, installation.installationID)
+	}
+	slices.Sort(installationIDs)
+	return slices.Compact(slices.DeleteFunc(installationIDs, func(installationID int64) bool {
+		return installationID == 0
+	}))
+}
+
+// installationID returns the installation for the owner of the repository, or 0 if the app is not installed for it.
+func (p *GitHubAppAuthProvider) installationID(ctx context.Context, repositoryURL string) (int64, error) {
+	owner, repository, err := repositoryOwnerAndName(repositoryURL)
+	if err != nil {
+		return 0, err
+	}
+	owner = strings.ToLower(owner)
+	if installationID, ok := p.ownerAppInstallationIDs[owner]; ok {
+		return installationID, nil
+	}
+	if p.defaultInstallationID != 0 {
+		return p.defaultInstallationID, nil
+	}
+
+	p.mutex.Lock()
+	discovered, ok := p.discoveredInstallationIDs[owner]
+	p.mutex.Unlock()
+	if ok && (discovered.expiresAt.IsZero() || p.clock.Now().Before(discovered.expiresAt)) {
+		return discovered.installationID, nil
+	}
+
+	discovered = discoveredInstallation{}
+	installation, response, err := p.client.Apps.GetRepositoryInstallation(ctx, owner, repository)
+	if err != nil {
+		if response == nil || response.StatusCode != nethttp.StatusNotFound {
+			return 0, fmt.Errorf("failed to find installation for repository '%s': %w", repositoryURL, err)
+		}
+		discovered.expiresAt = p.clock.Now().Add(missingInstallationTTL)
+	} else {
+		discovered.installationID = installation.GetID()
+	}
+
+	p.mutex.Lock()
+	p.discoveredInstallationIDs[owner] = discovered
+	p.mutex.Unlock()
+	return discovered.installationID, nil
+}
+
+func repositoryOwnerAndName(repositoryURL string) (string, string, error) {
+	endpoint, err := transport.NewEndpoint(repositoryURL)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse git repository url '%s': %w", repositoryURL, err)
+	}
+	owner, repository, found := strings.Cut(strings.Trim(endpoint.Path, "/"), "/")
+	if !found || owner == "" || repository == "" {
+		return "", "", fmt.Errorf("git repository url '%s' does not name an owner and repository", repositoryURL)
+	}
+	return owner, strings.TrimSuffix(repository, ".git"), nil
+}
+
+// HostAuthProvider selects the authentication method by the host of the repository. Credentials sent along with the
+// request take precedence over the providers, and repositories of hosts without either are accessed anonymously.
+type HostAuthProvider struct {
+	providers map[string]AuthProviderFn
+}
+
+func NewHostAuthProvider(providers map[string]AuthProviderFn) *HostAuthProvider {
+	return &HostAuthProvider{
+		providers: providers,
+	}
+}
+
+func (p *HostAuthProvider) GetAuth(ctx context.Context, repositoryURL string) (transport.AuthMethod, error) {
+	endpoint, err := transport.NewEndpoint(repositoryURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse git repository url '%s': %w", repositoryURL, err)
+	}
+	if credential, ok := credentials.GitCredentialFor(ctx, endpoint.Host); ok {
+		return requestAuth(credential), nil
+	}
+	if provider, ok := p.providers[endpoint.Host]; ok {
+		return provider(ctx, repositoryURL)
+	}
+	return nil, nil
+}
+
+// requestAuth converts a request credential like the token and basic auth credentials of GIT_HOST_CREDENTIALS.
+func requestAuth(credential credentials.GitCredential) transport.AuthMethod {
+	switch {
+	case credential.Token != "" && credential.Username == "":
+		return &http.TokenAuth{Token: credential.Token}
+	case credential.Token != "":
+		return &http.BasicAuth{Username: credential.Username, Password: credential.Token}
+	default:
+		return &http.BasicAuth{Username: credential.Username, Password: credential.Password}
+	}
+}
+
+func NewStaticAuthProvider(auth transport.AuthMethod) AuthProviderFn {
+	return func(_ context.Context, _ string) (transport.AuthMethod, error) {
+		return auth, nil
+	}
+}
+
+// NewBasicAuthProvider authenticates with username and password, or with a token as password.
+func NewBasicAuthProvider(username string, password string) AuthProviderFn {
+	return NewStaticAuthProvider(&http.BasicAuth{
+		Username: username,
+		Password: password,
+	})
+}
+
+// NewTokenAuthProvider authenticates with a bearer token.
+func NewTokenAuthProvider(token string) AuthProviderFn {
+	return NewStaticAuthProvider(&http.TokenAuth{
+		Token: token,
+	})
+}
+
+// NewSSHAuthProvider authenticates with a PEM encoded private key. The host key of the remote is verified against
+// the given known_hosts content.
+func NewSSHAuthProvider(
+	user string,
+	privateKey []byte,
+	passphrase string,
+	knownHosts []byte,
+) (AuthProviderFn, error) {
+	publicKeys, err := gitssh.NewPublicKeys(user, privateKey, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ssh private key: %w", err)
+	}
+	hostKeyCallback, err := knownHostsCallback(knownHosts)
+	if err != nil {
+		return nil, err
+	}
+	publicKeys.HostKeyCallback = hostKeyCallback
+	return NewStaticAuthProvider(publicKeys), nil
+}
+
+// knownHostsCallback verifies host keys against known_hosts content with the semantics of OpenSSH, i.e. hashed host
+// names, wildcard patterns, '@revoked' keys and '@cert-authority' keys are supported.
+func knownHostsCallback(knownHosts []byte) (ssh.HostKeyCallback, error) {
+	entries := 0
+	rest := knownHosts
+	for {
+		_, _, _, _, nextRest, err := ssh.ParseKnownHosts(rest)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse known hosts: %w", err)
+		}
+		entries++
+		rest = nextRest
+	}
+	if entries == 0 {
+		return nil, errors.New("known hosts must not be empty")
+	}
+
+	certificateCallback, err := newKnownHostsCallback(knownHosts)
+	if err != nil {
+		return nil, err
+	}
+	// knownhosts accepts the keys of '@cert-authority' lines as plain host keys as well, so plain host keys are
+	// verified without them
+	var hostKeyLines [][]byte
+	for line := range bytes.Lines(knownHosts) {
+		if !bytes.HasPrefix(bytes.TrimSpace(line), []byte("@cert-authority")) {
+			hostKeyLines = append(hostKeyLines, line)
+		}
+	}
+	hostKeyCallback, err := newKnownHostsCallback(bytes.Join(hostKeyLines, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		callback := hostKeyCallback
+		if _, ok := key.(*ssh.Certificate); ok {
+			callback = certificateCallback
+		}
+		if err := callback(hostname, remote, key); err != nil {
+			return fmt.Errorf("host key of '%s' is not a known host key: %w", hostname, err)
+		}
+		return nil
 	}, nil
 }
+
+// newKnownHostsCallback parses the known_hosts content with knownhosts, which only reads files.
+func newKnownHostsCallback(knownHosts []byte) (ssh.HostKeyCallback, error) {
+	file, err := os.CreateTemp("", "known_hosts-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.Remove(file.Name()) }()
+	_, err = file.Write(knownHosts)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	callback, err := knownhosts.New(file.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse known hosts: %w", err)
+	}
+	return callback, nil
+}
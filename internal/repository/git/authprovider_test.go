@@ -0,0 +1,314 @@
+package git
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net"
+	nethttp "net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Roshick/manifest-maestro/internal/credentials"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/google/go-github/v90/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestHostAuthProvider_GetAuth(t *testing.T) {
+	ctx := context.Background()
+	basicAuth := &http.BasicAuth{Username: "user", Password: "password"}
+	tokenAuth := &http.TokenAuth{Token: "token"}
+	provider := NewHostAuthProvider(map[string]AuthProviderFn{
+		"gitlab.example.com": NewStaticAuthProvider(basicAuth),
+		"git.example.com":    NewStaticAuthProvider(tokenAuth),
+	})
+
+	testCases := []struct {
+		repositoryURL string
+		expected      transport.AuthMethod
+	}{
+		{repositoryURL: "https://gitlab.example.com/group/repo.git", expected: basicAuth},
+		{repositoryURL: "git@gitlab.example.com:group/repo.git", expected: basicAuth},
+		{repositoryURL: "https://git.example.com/repo.git", expected: tokenAuth},
+		{repositoryURL: "https://github.com/org/repo.git", expected: nil},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.repositoryURL, func(t *testing.T) {
+			auth, err := provider.GetAuth(ctx, testCase.repositoryURL)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, auth)
+		})
+	}
+}
+
+func TestHostAuthProvider_GetAuth_RequestCredentials(t *testing.T) {
+	provider := NewHostAuthProvider(map[string]AuthProviderFn{
+		"gitlab.example.com": NewBasicAuthProvider("user", "password"),
+	})
+	ctx := credentials.NewContext(context.Background(), &credentials.Credentials{
+		Git: map[string]credentials.GitCredential{
+			"gitlab.example.com": {Username: "oauth2", Token: "pat"},
+			"github.com":         {Token: "token"},
+		},
+	})
+
+	auth, err := provider.GetAuth(ctx, "https://gitlab.example.com/group/repo.git")
+	require.NoError(t, err)
+	assert.Equal(t, &http.BasicAuth{Username: "oauth2", Password: "pat"}, auth)
+
+	auth, err = provider.GetAuth(ctx, "git@github.com:org/repo.git")
+	require.NoError(t, err)
+	assert.Equal(t, &http.TokenAuth{Token: "token"}, auth)
+
+	auth, err = provider.GetAuth(context.Background(), "https://gitlab.example.com/group/repo.git")
+	require.NoError(t, err)
+	assert.Equal(t, &http.BasicAuth{Username: "user", Password: "password"}, auth)
+}
+
+func TestMapURL(t *testing.T) {
+	publicKeys := &gitssh.PublicKeys{User: "git"}
+	basicAuth := &http.BasicAuth{Username: "user", Password: "password"}
+
+	testCases := []struct {
+		name          string
+		repositoryURL string
+		auth          transport.AuthMethod
+		expected      string
+	}{
+		{
+			name:          "https with ssh key",
+			repositoryURL: "https://gitlab.example.com/group/repo.git",
+			auth:          publicKeys,
+			expected:      "ssh://git@gitlab.example.com/group/repo.git",
+		},
+		{
+			name:          "scp-like with ssh key",
+			repositoryURL: "git@gitlab.example.com:group/repo.git",
+			auth:          publicKeys,
+			expected:      "git@gitlab.example.com:group/repo.git",
+		},
+		{
+			name:          "scp-like with basic auth",
+			repositoryURL: "git@gitlab.example.com:group/repo.git",
+			auth:          basicAuth,
+			expected:      "https://gitlab.example.com/group/repo.git",
+		},
+		{
+			name:          "ssh without auth",
+			repositoryURL: "ssh://git@github.com/org/repo.git",
+			auth:          nil,
+			expected:      "https://github.com/org/repo.git",
+		},
+		{
+			name:          "enterprise server scp-like with basic auth",
+			repositoryURL: "git@github.example.com:org/repo.git",
+			auth:          basicAuth,
+			expected:      "https://github.example.com/org/repo.git",
+		},
+		{
+			name:          "https with basic auth",
+			repositoryURL: "https://github.com/org/repo.git",
+			auth:          basicAuth,
+			expected:      "https://github.com/org/repo.git",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, mapURL(testCase.repositoryURL, testCase.auth))
+		})
+	}
+}
+
+func TestKnownHostsCallback(t *testing.T) {
+	knownKey := newPublicKey(t)
+	unknownKey := newPublicKey(t)
+	knownHosts := []byte("gitlab.example.com " + string(ssh.MarshalAuthorizedKey(knownKey)))
+
+	callback, err := knownHostsCallback(knownHosts)
+	require.NoError(t, err)
+
+	assert.NoError(t, callback("gitlab.example.com:22", remoteAddr, knownKey))
+	assert.Error(t, callback("gitlab.example.com:22", remoteAddr, unknownKey))
+	assert.Error(t, callback("other.example.com:22", remoteAddr, knownKey))
+}
+
+func TestKnownHostsCallback_Revoked(t *testing.T) {
+	revokedKey := newPublicKey(t)
+	knownHosts := []byte("gitlab.example.com " + string(ssh.MarshalAuthorizedKey(revokedKey)) +
+		"@revoked * " + string(ssh.MarshalAuthorizedKey(revokedKey)))
+
+	callback, err := knownHostsCallback(knownHosts)
+	require.NoError(t, err)
+
+	err = callback("gitlab.example.com:22", remoteAddr, revokedKey)
+	var revokedErr *knownhosts.RevokedError
+	assert.ErrorAs(t, err, &revokedErr)
+}
+
+func TestKnownHostsCallback_CertAuthority(t *testing.T) {
+	_, caPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	caSigner, err := ssh.NewSignerFromKey(caPrivateKey)
+	require.NoError(t, err)
+	hostKey := newPublicKey(t)
+	knownHosts := []byte("@cert-authority *.example.com " + string(ssh.MarshalAuthorizedKey(caSigner.PublicKey())))
+
+	callback, err := knownHostsCallback(knownHosts)
+	require.NoError(t, err)
+
+	certificate := &ssh.Certificate{
+		Key:             hostKey,
+		CertType:        ssh.HostCert,
+		ValidPrincipals: []string{"gitlab.example.com"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	require.NoError(t, certificate.SignCert(rand.Reader, caSigner))
+
+	assert.NoError(t, callback("gitlab.example.com:22", remoteAddr, certificate))
+	// the key of the CA is no host key itself
+	assert.Error(t, callback("gitlab.example.com:22", remoteAddr, caSigner.PublicKey()))
+	assert.Error(t, callback("gitlab.example.com:22", remoteAddr, hostKey))
+}
+
+var remoteAddr = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 22}
+
+func TestKnownHostsCallback_Empty(t *testing.T) {
+	_, err := knownHostsCallback([]byte("# no hosts\n"))
+	assert.Error(t, err)
+}
+
+func newPublicKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	require.NoError(t, err)
+	return sshPublicKey
+}
+
+type fakeGitHubAPI struct {
+	installations map[string]int64
+
+	lookups atomic.Int32
+}
+
+type fakeTokenSource struct{}
+
+type fakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (fakeTokenSource) Token(_ context.Context, appInstallationID int64) (string, error) {
+	return fmt.Sprintf("token-%d", appInstallationID), nil
+}
+
+func (f *fakeGitHubAPI) client(t *testing.T) *github.Client {
+	t.Helper()
+	mux := nethttp.NewServeMux()
+	mux.HandleFunc("GET /repos/{owner}/{repo}/installation", func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		f.lookups.Add(1)
+		installationID, ok := f.installations[r.PathValue("owner")]
+		if !ok {
+			w.WriteHeader(nethttp.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"Not Found"}`))
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"id":%d}`, installationID)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	baseURL := server.URL + "/"
+	client, err := github.NewClient(github.WithURLs(&baseURL, &baseURL))
+	require.NoError(t, err)
+	return client
+}
+
+func TestGitHubAppAuthProvider_GetAuth_ConfiguredOwners(t *testing.T) {
+	ctx := context.Background()
+	api := &fakeGitHubAPI{}
+	provider := NewGitHubAppAuthProvider(api.client(t), fakeTokenSource{}, &fakeClock{now: time.Now()}, 1, map[string]int64{"Org-A": 2, "org-b": 3})
+
+	testCases := []struct {
+		repositoryURL string
+		expected      string
+	}{
+		{repositoryURL: "https://github.com/org-a/repo.git", expected: "token-2"},
+		{repositoryURL: "git@github.com:org-b/repo.git", expected: "token-3"},
+		{repositoryURL: "https://github.com/org-c/repo", expected: "token-1"},
+		{repositoryURL: "https://github.com/ORG-A/other.git", expected: "token-2"},
+	}
+	for _, testCase := range testCases {
+		auth, err := provider.GetAuth(ctx, testCase.repositoryURL)
+		require.NoError(t, err)
+		require.IsType(t, &http.BasicAuth{}, auth)
+		assert.Equal(t, testCase.expected, auth.(*http.BasicAuth).Password, testCase.repositoryURL)
+	}
+
+	assert.Equal(t, int32(0), api.lookups.Load())
+	assert.Equal(t, []int64{1, 2, 3}, provider.InstallationIDs())
+}
+
+func TestGitHubAppAuthProvider_GetAuth_DiscoversInstallations(t *testing.T) {
+	ctx := context.Background()
+	api := &fakeGitHubAPI{installations: map[string]int64{"org-a": 4}}
+	provider := NewGitHubAppAuthProvider(api.client(t), fakeTokenSource{}, &fakeClock{now: time.Now()}, 0, nil)
+
+	for range 2 {
+		auth, err := provider.GetAuth(ctx, "https://github.com/org-a/repo.git")
+		require.NoError(t, err)
+		assert.Equal(t, "token-4", auth.(*http.BasicAuth).Password)
+	}
+
+	auth, err := provider.GetAuth(ctx, "https://github.com/org-b/repo.git")
+	require.NoError(t, err)
+	assert.Nil(t, auth, "repositories of owners without installation should be accessed anonymously")
+
+	assert.Equal(t, int32(2), api.lookups.Load(), "installations should be discovered once per owner")
+	assert.Equal(t, []int64{4}, provider.InstallationIDs())
+}
+
+func TestGitHubAppAuthProvider_GetAuth_LooksUpMissingInstallationsAgain(t *testing.T) {
+	ctx := context.Background()
+	api := &fakeGitHubAPI{installations: map[string]int64{}}
+	clock := &fakeClock{now: time.Now()}
+	provider := NewGitHubAppAuthProvider(api.client(t), fakeTokenSource{}, clock, 0, nil)
+
+	for range 2 {
+		auth, err := provider.GetAuth(ctx, "https://github.com/org-a/repo.git")
+		require.NoError(t, err)
+		assert.Nil(t, auth)
+	}
+	assert.Equal(t, int32(1), api.lookups.Load(), "missing installations should be cached")
+
+	api.installations["org-a"] = 5
+	clock.Advance(missingInstallationTTL)
+	auth, err := provider.GetAuth(ctx, "https://github.com/org-a/repo.git")
+	require.NoError(t, err)
+	assert.Equal(t, "token-5", auth.(*http.BasicAuth).Password)
+	assert.Equal(t, int32(2), api.lookups.Load())
+	assert.Equal(t, []int64{5}, provider.InstallationIDs())
+}
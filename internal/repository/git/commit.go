@@ -0,0 +1,55 @@
+package git
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+type CommitMetadata struct {
+	Hash      string
+	Author    Signature
+	Committer Signature
+	Message   string
+}
+
+// CommitMetadata fetches only the commit itself, without its history or, if the remote supports it, file contents.
+func (g *Git) CommitMetadata(ctx context.Context, repositoryURL string, commitHash string) (*CommitMetadata, error) {
+	repositoryURL, auth, err := g.resolve(ctx, repositoryURL)
+	if err != nil {
+		return nil, err
+	}
+
+	storage := memory.NewStorage()
+	hash := plumbing.NewHash(commitHash)
+	if err = fetchObjects(ctx, repositoryURL, auth, storage, []plumbing.Hash{hash}, true); err != nil {
+		return nil, err
+	}
+	commit, err := object.GetCommit(storage, hash)
+	if err != nil {
+		return nil, err
+	}
+	return &CommitMetadata{
+		Hash: commit.Hash.String(),
+		Author: Signature{
+			Name:  commit.Author.Name,
+			Email: commit.Author.Email,
+			When:  commit.Author.When,
+		},
+		Committer: Signature{
+			Name:  commit.Committer.Name,
+			Email: commit.Committer.Email,
+			When:  commit.Committer.When,
+		},
+		Message: commit.Message,
+	}, nil
+}
@@ -0,0 +1,22 @@
+package git
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGit_CommitMetadata(t *testing.T) {
+	remoteURL, commitHash, _ := setupRemote(t, true)
+
+	metadata, err := newTestGit(t, nil).CommitMetadata(context.Background(), remoteURL, commitHash)
+	require.NoError(t, err)
+
+	assert.Equal(t, commitHash, metadata.Hash)
+	assert.Equal(t, Signature{Name: "test", Email: "test@test.com", When: metadata.Author.When}, metadata.Author)
+	assert.Equal(t, "test", metadata.Committer.Name)
+	assert.False(t, metadata.Committer.When.IsZero())
+	assert.Equal(t, "initial\n", metadata.Message)
+}
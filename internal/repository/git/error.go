@@ -19,9 +19,14 @@ func NewRepositoryNotFoundError(repositoryURL string) *RepositoryNotFoundError {
 type RepositoryReferenceNotFoundError struct {
 	repositoryURL string
 	gitReference  string
+	reason        string
 }
 
 func (e *RepositoryReferenceNotFoundError) Error() string {
+	if e.reason != "" {
+		return fmt.Sprintf("reference '%s' does not exist in git repository '%s': %s",
+			e.gitReference, e.repositoryURL, e.reason)
+	}
 	return fmt.Sprintf("reference '%s' does not exist in git repository '%s'", e.gitReference, e.repositoryURL)
 }
 
@@ -34,3 +39,62 @@ func NewRepositoryReferenceNotFoundError(
 		gitReference:  gitReference,
 	}
 }
+
+// NewAbbreviatedCommitHashNotFoundError explains why an abbreviated commit hash was not resolved. Abbreviated
+// hashes are only resolved if they identify the tip of exactly one branch or tag, as the remote reports no other
+// commits without fetching them.
+func NewAbbreviatedCommitHashNotFoundError(
+	repositoryURL string,
+	abbreviatedCommitHash string,
+	ambiguous bool,
+) *RepositoryReferenceNotFoundError {
+	reason := "abbreviated commit hashes only resolve to the tips of branches and tags, use the full commit hash"
+	if ambiguous {
+		reason = "abbreviated commit hash matches the tips of several commits, use a longer or the full commit hash"
+	}
+	return &RepositoryReferenceNotFoundError{
+		repositoryURL: repositoryURL,
+		gitReference:  abbreviatedCommitHash,
+		reason:        reason,
+	}
+}
+
+type SubmoduleURLNotAllowedError struct {
+	repositoryURL string
+	submoduleURL  string
+	reason        string
+}
+
+func (e *SubmoduleURLNotAllowedError) Error() string {
+	return fmt.Sprintf("submodule url '%s' of git repository '%s' is not allowed: %s",
+		e.submoduleURL, e.repositoryURL, e.reason)
+}
+
+func NewSubmoduleURLNotAllowedError(
+	repositoryURL string,
+	submoduleURL string,
+	reason string,
+) *SubmoduleURLNotAllowedError {
+	return &SubmoduleURLNotAllowedError{
+		repositoryURL: repositoryURL,
+		submoduleURL:  submoduleURL,
+		reason:        reason,
+	}
+}
+
+type LFSObjectsTooLargeError struct {
+	repositoryURL string
+	limit         int64
+}
+
+func (e *LFSObjectsTooLargeError) Error() string {
+	return fmt.Sprintf("git lfs objects of git repository '%s' exceed the limit of %d bytes",
+		e.repositoryURL, e.limit)
+}
+
+func NewLFSObjectsTooLargeError(repositoryURL string, limit int64) *LFSObjectsTooLargeError {
+	return &LFSObjectsTooLargeError{
+		repositoryURL: repositoryURL,
+		limit:         limit,
+	}
+}
@@ -4,41 +4,115 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	nethttp "net/http"
 	"net/url"
 	"regexp"
 	"strings"
 
+	"github.com/Roshick/manifest-maestro/internal/credentials"
 	"github.com/go-git/go-git/v5/plumbing/transport"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
 
+	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-billy/v5/memfs"
 	"github.com/go-git/go-git/v5/storage/memory"
 
 	"github.com/go-git/go-git/v5"
 	gitConfig "github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
-type AuthProviderFn func(context.Context) (transport.AuthMethod, error)
+// ReferenceCache caches the references advertised by remote repositories. On a cache miss, the references are
+// listed by the given function.
+type ReferenceCache interface {
+	RetrieveReferences(
+		ctx context.Context,
+		repositoryURL string,
+		list func(context.Context) ([]*plumbing.Reference, error),
+	) ([]*plumbing.Reference, error)
+}
+
+// AuthProviderFn returns the authentication method for a repository, or nil for anonymous access.
+type AuthProviderFn func(ctx context.Context, repositoryURL string) (transport.AuthMethod, error)
+
+type Options struct {
+	// Submodules enables the recursive checkout of submodules.
+	Submodules bool
+	// SubmodulesAllowOtherHosts allows submodules to be cloned from other hosts than the one of their repository.
+	SubmodulesAllowOtherHosts bool
+	// LFS enables the download of Git LFS objects over the LFS batch API.
+	LFS bool
+	// HTTPClient is used for requests to the LFS batch API and LFS object downloads.
+	HTTPClient *nethttp.Client
+	// LFSSizeLimit is the total size in bytes of the LFS objects of a checkout, which is held in memory.
+	LFSSizeLimit int64
+	// ReferenceCache caches the remote references used to resolve Git references, they are listed on every
+	// resolution if nil.
+	ReferenceCache ReferenceCache
+	// MirrorDirectory enables on-disk mirrors of cloned repositories in the directory, which are fetched
+	// incrementally instead of cloning every commit from scratch.
+	MirrorDirectory string
+	// MirrorSizeLimit is the total size in bytes of all mirrors, beyond which the least recently used are removed.
+	MirrorSizeLimit int64
+}
+
+func DefaultOptions() *Options {
+	return &Options{
+		HTTPClient:      nethttp.DefaultClient,
+		LFSSizeLimit:    256 << 20,
+		MirrorSizeLimit: 10 << 30,
+	}
+}
 
 type Git struct {
 	authProviderFn AuthProviderFn
+	opts           *Options
+	mirrors        *mirrors
 
 	commitHashRegex *regexp.Regexp
 }
 
 func New(
 	authProviderFn AuthProviderFn,
+	opts *Options,
 ) (*Git, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = nethttp.DefaultClient
+	}
+	if opts.LFSSizeLimit <= 0 {
+		opts.LFSSizeLimit = DefaultOptions().LFSSizeLimit
+	}
+	var repositoryMirrors *mirrors
+	if opts.MirrorDirectory != "" {
+		var err error
+		if repositoryMirrors, err = newMirrors(opts.MirrorDirectory, opts.MirrorSizeLimit); err != nil {
+			return nil, err
+		}
+	}
 	return &Git{
 		authProviderFn:  authProviderFn,
-		commitHashRegex: regexp.MustCompile("[[:xdigit:]]{40}"),
+		opts:            opts,
+		mirrors:         repositoryMirrors,
+		commitHashRegex: regexp.MustCompile("^[[:xdigit:]]{40}$"),
 	}, nil
 }
 
 func (g *Git) RemoteReferences(ctx context.Context, repositoryURL string) ([]*plumbing.Reference, error) {
-	repositoryURL = mapURL(repositoryURL)
+	if g.opts.ReferenceCache != nil {
+		list := func(ctx context.Context) ([]*plumbing.Reference, error) {
+			return g.listRemoteReferences(ctx, repositoryURL)
+		}
+		return g.opts.ReferenceCache.RetrieveReferences(ctx, repositoryURL, list)
+	}
+	return g.listRemoteReferences(ctx, repositoryURL)
+}
 
-	auth, err := g.authProviderFn(ctx)
+func (g *Git) listRemoteReferences(ctx context.Context, repositoryURL string) ([]*plumbing.Reference, error) {
+	repositoryURL, auth, err := g.resolve(ctx, repositoryURL)
 	if err != nil {
 		return nil, err
 	}
@@ -48,8 +122,9 @@ func (g *Git) RemoteReferences(ctx context.Context, repositoryURL string) ([]*pl
 		URLs: []string{repositoryURL},
 	})
 
-	references, err := rem.List(&git.ListOptions{
-		Auth: auth,
+	references, err := rem.ListContext(ctx, &git.ListOptions{
+		Auth:          auth,
+		PeelingOption: git.AppendPeeled,
 	})
 	if err != nil {
 		if errors.As(err, new(*url.Error)) ||
@@ -64,12 +139,35 @@ func (g *Git) RemoteReferences(ctx context.Context, repositoryURL string) ([]*pl
 }
 
 func (g *Git) CloneCommit(ctx context.Context, repositoryURL string, reference string) (*git.Repository, error) {
-	repositoryURL = mapURL(repositoryURL)
+	return g.cloneCommit(ctx, repositoryURL, reference, 0)
+}
 
-	auth, err := g.authProviderFn(ctx)
+// cloneCommit clones the reference of a repository, which is a submodule at the given depth if depth > 0.
+func (g *Git) cloneCommit(
+	ctx context.Context, repositoryURL string, reference string, depth int,
+) (*git.Repository, error) {
+	originalURL := repositoryURL
+	repositoryURL, auth, err := g.resolve(ctx, repositoryURL)
 	if err != nil {
 		return nil, err
 	}
+	// mirrors are shared by all requests, so repositories fetched with request credentials bypass them
+	if g.mirrors != nil && !credentials.HasGitCredential(ctx, originalURL) {
+		repo, commitTree, mirrorErr := g.cloneCommitFromMirror(ctx, repositoryURL, auth, reference)
+		if mirrorErr != nil {
+			return nil, mirrorErr
+		}
+		tree, mirrorErr := repo.Worktree()
+		if mirrorErr != nil {
+			return nil, mirrorErr
+		}
+		if mirrorErr = g.completeWorktree(
+			ctx, originalURL, commitTree, tree.Filesystem, []string{"."}, depth,
+		); mirrorErr != nil {
+			return nil, mirrorErr
+		}
+		return repo, nil
+	}
 
 	repo, err := git.Init(memory.NewStorage(), memfs.New())
 	if err != nil {
@@ -90,12 +188,7 @@ func (g *Git) CloneCommit(ctx context.Context, repositoryURL string, reference s
 		RefSpecs: []gitConfig.RefSpec{gitConfig.RefSpec(refSpec)},
 		Depth:    1,
 	}); err != nil {
-		if errors.As(err, new(*url.Error)) ||
-			strings.HasPrefix(err.Error(), "unsupported scheme") ||
-			strings.HasPrefix(err.Error(), "repository not found") {
-			return nil, NewRepositoryNotFoundError(repositoryURL)
-		}
-		return nil, err
+		return nil, mapFetchError(repositoryURL, err)
 	}
 
 	tree, err := repo.Worktree()
@@ -110,30 +203,93 @@ func (g *Git) CloneCommit(ctx context.Context, repositoryURL string, reference s
 		return nil, err
 	}
 
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	commitTree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	if err = g.completeWorktree(ctx, originalURL, commitTree, tree.Filesystem, []string{"."}, depth); err != nil {
+		return nil, err
+	}
 	return repo, nil
 }
 
 func (g *Git) ToHash(ctx context.Context, repositoryURL string, gitReference string) (string, error) {
-	if g.isCommitHash(gitReference) {
-		return gitReference, nil
-	}
-
-	remoteReferences, err := g.RemoteReferences(ctx, repositoryURL)
+	resolved, err := g.ResolveReference(ctx, repositoryURL, gitReference)
 	if err != nil {
 		return "", err
 	}
-	for _, ref := range remoteReferences {
-		if ref.Name().String() == gitReference {
-			return ref.Hash().String(), nil
-		}
-	}
-	return "", NewRepositoryReferenceNotFoundError(repositoryURL, gitReference)
+	return resolved.CommitHash, nil
 }
 
 func (g *Git) isCommitHash(gitReference string) bool {
 	return g.commitHashRegex.MatchString(gitReference)
 }
 
-func mapURL(url string) string {
-	return strings.Replace(url, "git@github.com:", "https://github.com/", 1)
+func mapFetchError(repositoryURL string, err error) error {
+	if errors.As(err, new(*url.Error)) ||
+		strings.HasPrefix(err.Error(), "unsupported scheme") ||
+		strings.HasPrefix(err.Error(), "repository not found") {
+		return NewRepositoryNotFoundError(repositoryURL)
+	}
+	return err
+}
+
+// completeWorktree downloads the LFS objects of the checked out files and checks out the submodules located at or
+// below the given paths, if enabled.
+func (g *Git) completeWorktree(
+	ctx context.Context,
+	repositoryURL string,
+	commitTree *object.Tree,
+	worktree billy.Filesystem,
+	paths []string,
+	depth int,
+) error {
+	if g.opts.LFS {
+		if err := g.fetchLFSObjects(ctx, repositoryURL, worktree); err != nil {
+			return err
+		}
+	}
+	if g.opts.Submodules {
+		if err := g.checkoutSubmodules(ctx, repositoryURL, commitTree, worktree, paths, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *Git) resolve(ctx context.Context, repositoryURL string) (string, transport.AuthMethod, error) {
+	auth, err := g.authProviderFn(ctx, repositoryURL)
+	if err != nil {
+		return "", nil, err
+	}
+	return mapURL(repositoryURL, auth), auth, nil
+}
+
+// mapURL converts the repository URL to the protocol of the authentication method, as SSH keys only work for SSH
+// URLs and all other methods only for HTTPS URLs.
+func mapURL(repositoryURL string, auth transport.AuthMethod) string {
+	endpoint, err := transport.NewEndpoint(repositoryURL)
+	if err != nil {
+		return repositoryURL
+	}
+	repositoryPath := strings.TrimPrefix(endpoint.Path, "/")
+
+	if publicKeys, ok := auth.(*gitssh.PublicKeys); ok {
+		if endpoint.Protocol == "http" || endpoint.Protocol == "https" {
+			return fmt.Sprintf("ssh://%s@%s/%s", publicKeys.User, endpoint.Host, repositoryPath)
+		}
+		return repositoryURL
+	}
+	if endpoint.Protocol == "ssh" {
+		return fmt.Sprintf("https://%s/%s", endpoint.Host, repositoryPath)
+	}
+	return repositoryURL
 }
@@ -0,0 +1,112 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	nethttp "net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Roshick/manifest-maestro/pkg/targz"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// GitHubArchive downloads repositories of a GitHub instance as tarballs via the repository archive API, which is
+// considerably cheaper than cloning them. Like 'git archive', the tarballs respect the 'export-ignore' and
+// 'export-subst' attributes and contain neither submodules nor, by default, LFS objects.
+type GitHubArchive struct {
+	host           string
+	apiURL         string
+	authProviderFn AuthProviderFn
+	httpClient     *nethttp.Client
+}
+
+// NewGitHubArchive creates a downloader for the repositories on the host, e.g. 'github.com', using the REST API at
+// apiURL, e.g. 'https://api.github.com/'. Repositories are authenticated like their clones.
+func NewGitHubArchive(
+	host string, apiURL string, authProviderFn AuthProviderFn, httpClient *nethttp.Client,
+) *GitHubArchive {
+	if httpClient == nil {
+		httpClient = nethttp.DefaultClient
+	}
+	return &GitHubArchive{
+		host:           host,
+		apiURL:         strings.TrimSuffix(apiURL, "/"),
+		authProviderFn: authProviderFn,
+		httpClient:     httpClient,
+	}
+}
+
+// Supports reports whether the repository can be downloaded as archive. Repositories of other hosts or accessed via
+// SSH have to be cloned instead.
+func (a *GitHubArchive) Supports(ctx context.Context, repositoryURL string) (bool, error) {
+	_, supported, err := a.auth(ctx, repositoryURL)
+	return supported, err
+}
+
+// DownloadTarball returns the repository at the commit as gzip-compressed tarball, with its entries located at the
+// root like in the tarballs of cloned repositories. The repository must be supported.
+func (a *GitHubArchive) DownloadTarball(ctx context.Context, repositoryURL string, commitHash string) ([]byte, error) {
+	auth, supported, err := a.auth(ctx, repositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	if !supported {
+		return nil, fmt.Errorf("git repository '%s' cannot be downloaded as archive", repositoryURL)
+	}
+	owner, repository, err := repositoryOwnerAndName(repositoryURL)
+	if err != nil {
+		return nil, err
+	}
+
+	archiveURL := fmt.Sprintf("%s/repos/%s/%s/tarball/%s",
+		a.apiURL, url.PathEscape(owner), url.PathEscape(repository), url.PathEscape(commitHash))
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodGet, archiveURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	// the archive is served via a redirect to another host, where the http client does not forward the credentials
+	setHTTPAuth(req, auth)
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode == nethttp.StatusNotFound {
+		return nil, NewRepositoryNotFoundError(repositoryURL)
+	}
+	if resp.StatusCode != nethttp.StatusOK {
+		return nil, fmt.Errorf("download of archive of git repository '%s' failed with status %d",
+			repositoryURL, resp.StatusCode)
+	}
+
+	tarball := new(bytes.Buffer)
+	if err = targz.StripTopLevelDirectory(ctx, resp.Body, tarball); err != nil {
+		return nil, fmt.Errorf("failed to read archive of git repository '%s': %w", repositoryURL, err)
+	}
+	return tarball.Bytes(), nil
+}
+
+func (a *GitHubArchive) auth(ctx context.Context, repositoryURL string) (transport.AuthMethod, bool, error) {
+	endpoint, err := transport.NewEndpoint(repositoryURL)
+	if err != nil || !strings.EqualFold(endpoint.Host, a.host) {
+		return nil, false, nil
+	}
+	if _, _, err = repositoryOwnerAndName(repositoryURL); err != nil {
+		return nil, false, nil
+	}
+	auth, err := a.authProviderFn(ctx, repositoryURL)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, ok := auth.(http.AuthMethod); auth != nil && !ok {
+		return nil, false, nil
+	}
+	return auth, true, nil
+}
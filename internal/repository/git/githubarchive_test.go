@@ -0,0 +1,131 @@
+package git
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+	"github.com/Roshick/manifest-maestro/pkg/targz"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const archiveCommitHash = "0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c"
+
+func githubTarball(t *testing.T) []byte {
+	t.Helper()
+	buffer := new(bytes.Buffer)
+	gzw := gzip.NewWriter(buffer)
+	tw := tar.NewWriter(gzw)
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeXGlobalHeader,
+		Name:       "pax_global_header",
+		PAXRecords: map[string]string{"comment": archiveCommitHash},
+	}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "org-repo-0d1a26e/", Mode: 0o755}))
+	content := "name: app\n"
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg, Name: "org-repo-0d1a26e/charts/app/Chart.yaml", Mode: 0o644, Size: int64(len(content)),
+	}))
+	_, err := tw.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+	return buffer.Bytes()
+}
+
+// newGitHubArchiveServer serves the archive API, which redirects to the archive on another host like GitHub does.
+func newGitHubArchiveServer(t *testing.T, tarball []byte) (*httptest.Server, *[]string) {
+	t.Helper()
+	codeloadAuthorizations := make([]string, 0)
+	codeload := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		codeloadAuthorizations = append(codeloadAuthorizations, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/x-gzip")
+		_, _ = w.Write(tarball)
+	}))
+	t.Cleanup(codeload.Close)
+
+	api := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "x-access-token" || password != "secret" {
+			w.WriteHeader(nethttp.StatusNotFound)
+			return
+		}
+		if r.URL.Path != "/api/v3/repos/org/repo/tarball/"+archiveCommitHash {
+			w.WriteHeader(nethttp.StatusNotFound)
+			return
+		}
+		// codeload is served by another host, 'localhost' instead of '127.0.0.1'
+		codeloadURL := strings.Replace(codeload.URL, "127.0.0.1", "localhost", 1)
+		nethttp.Redirect(w, r, codeloadURL+"/org/repo/legacy.tar.gz/"+archiveCommitHash, nethttp.StatusFound)
+	}))
+	t.Cleanup(api.Close)
+	return api, &codeloadAuthorizations
+}
+
+func TestGitHubArchive_DownloadTarball(t *testing.T) {
+	api, codeloadAuthorizations := newGitHubArchiveServer(t, githubTarball(t))
+	archive := NewGitHubArchive("github.example.com", api.URL+"/api/v3/",
+		NewBasicAuthProvider("x-access-token", "secret"), nil)
+
+	tarball, err := archive.DownloadTarball(context.Background(),
+		"https://github.example.com/org/repo.git", archiveCommitHash)
+	require.NoError(t, err)
+
+	fileSystem := filesystem.New()
+	require.NoError(t, targz.Extract(context.Background(), fileSystem, bytes.NewReader(tarball), fileSystem.Root))
+	content, err := fileSystem.ReadFile(fileSystem.Join(fileSystem.Root, "charts", "app", "Chart.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "name: app\n", string(content))
+	assert.Equal(t, []string{""}, *codeloadAuthorizations, "credentials must not be forwarded to the archive host")
+}
+
+func TestGitHubArchive_DownloadTarball_NotFound(t *testing.T) {
+	api, _ := newGitHubArchiveServer(t, githubTarball(t))
+	archive := NewGitHubArchive("github.example.com", api.URL+"/api/v3/",
+		NewBasicAuthProvider("x-access-token", "wrong"), nil)
+
+	_, err := archive.DownloadTarball(context.Background(),
+		"https://github.example.com/org/repo.git", archiveCommitHash)
+	assert.ErrorAs(t, err, new(*RepositoryNotFoundError))
+}
+
+func TestGitHubArchive_Supports(t *testing.T) {
+	archive := NewGitHubArchive("github.com", "https://api.github.com/",
+		func(_ context.Context, repositoryURL string) (transport.AuthMethod, error) {
+			if strings.HasPrefix(repositoryURL, "ssh://") {
+				return &sshAuthStub{}, nil
+			}
+			return &http.BasicAuth{Username: "x-access-token", Password: "secret"}, nil
+		}, nil)
+
+	for repositoryURL, expected := range map[string]bool{
+		"https://github.com/org/repo.git":   true,
+		"https://gitlab.com/org/repo.git":   false,
+		"ssh://git@github.com/org/repo.git": false,
+	} {
+		supported, err := archive.Supports(context.Background(), repositoryURL)
+		require.NoError(t, err)
+		assert.Equal(t, expected, supported, repositoryURL)
+	}
+
+	_, err := archive.DownloadTarball(context.Background(), "https://gitlab.com/org/repo.git", archiveCommitHash)
+	assert.Error(t, err)
+}
+
+type sshAuthStub struct{}
+
+func (a *sshAuthStub) Name() string {
+	return "ssh-public-keys"
+}
+
+func (a *sshAuthStub) String() string {
+	return "ssh-public-keys"
+}
@@ -0,0 +1,319 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+const (
+	// lfsPointerMaxSize is the size limit of LFS pointer files set by the LFS specification.
+	lfsPointerMaxSize = 1024
+	// lfsBatchSize is the number of objects requested per LFS batch request.
+	lfsBatchSize = 100
+
+	lfsMediaType = "application/vnd.git-lfs+json"
+)
+
+var lfsPointerRegex = regexp.MustCompile(
+	`^version https://git-lfs\.github\.com/spec/v1\noid sha256:([0-9a-f]{64})\nsize ([0-9]+)\n`,
+)
+
+type lfsPointer struct {
+	Oid  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+type lfsBatchRequest struct {
+	Operation string       `json:"operation"`
+	Transfers []string     `json:"transfers"`
+	Objects   []lfsPointer `json:"objects"`
+	HashAlgo  string       `json:"hash_algo"`
+}
+
+type lfsBatchResponse struct {
+	Objects []lfsBatchObject `json:"objects"`
+}
+
+type lfsBatchObject struct {
+	lfsPointer
+	Actions struct {
+		Download *lfsAction `json:"download"`
+	} `json:"actions"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type lfsAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header"`
+}
+
+// fetchLFSObjects replaces all LFS pointer files of the worktree with the objects they point to, which are
+// downloaded over the LFS batch API of the repository.
+func (g *Git) fetchLFSObjects(ctx context.Context, repositoryURL string, worktree billy.Filesystem) error {
+	pointerFiles, err := findLFSPointers(worktree)
+	if err != nil {
+		return err
+	}
+	if len(pointerFiles) == 0 {
+		return nil
+	}
+
+	auth, err := g.authProviderFn(ctx, repositoryURL)
+	if err != nil {
+		return err
+	}
+	lfsURL, err := lfsEndpoint(repositoryURL)
+	if err != nil {
+		return err
+	}
+
+	// the sizes are taken from the pointers, downloads not matching them are rejected
+	pointers := make([]lfsPointer, 0, len(pointerFiles))
+	var totalSize int64
+	for pointer := range pointerFiles {
+		pointers = append(pointers, pointer)
+		if pointer.Size > g.opts.LFSSizeLimit {
+			return NewLFSObjectsTooLargeError(repositoryURL, g.opts.LFSSizeLimit)
+		}
+		totalSize += pointer.Size * int64(len(pointerFiles[pointer]))
+		if totalSize > g.opts.LFSSizeLimit {
+			return NewLFSObjectsTooLargeError(repositoryURL, g.opts.LFSSizeLimit)
+		}
+	}
+	for start := 0; start < len(pointers); start += lfsBatchSize {
+		batch := pointers[start:min(start+lfsBatchSize, len(pointers))]
+		actions, innerErr := g.requestLFSBatch(ctx, lfsURL, auth, batch)
+		if innerErr != nil {
+			return innerErr
+		}
+		for _, pointer := range batch {
+			filePaths := pointerFiles[pointer]
+			downloadErr := g.downloadLFSObject(ctx, lfsURL, auth, pointer, actions[pointer.Oid], worktree, filePaths[0])
+			if downloadErr != nil {
+				return downloadErr
+			}
+			for _, filePath := range filePaths[1:] {
+				if copyErr := copyFile(worktree, filePaths[0], filePath); copyErr != nil {
+					return copyErr
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// findLFSPointers lists the files of the worktree by the LFS object they point to.
+func findLFSPointers(worktree billy.Filesystem) (map[lfsPointer][]string, error) {
+	pointerFiles := make(map[lfsPointer][]string)
+	err := util.Walk(worktree, "/", func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Size() >= lfsPointerMaxSize {
+			return nil
+		}
+		content, err := util.ReadFile(worktree, filePath)
+		if err != nil {
+			return err
+		}
+		if pointer, ok := parseLFSPointer(content); ok {
+			pointerFiles[pointer] = append(pointerFiles[pointer], filePath)
+		}
+		return nil
+	})
+	return pointerFiles, err
+}
+
+func parseLFSPointer(content []byte) (lfsPointer, bool) {
+	matches := lfsPointerRegex.FindSubmatch(content)
+	if matches == nil {
+		return lfsPointer{}, false
+	}
+	size, err := strconv.ParseInt(string(matches[2]), 10, 64)
+	if err != nil {
+		return lfsPointer{}, false
+	}
+	return lfsPointer{Oid: string(matches[1]), Size: size}, true
+}
+
+// lfsEndpoint derives the LFS server of a repository, which is always accessed via HTTPS.
+func lfsEndpoint(repositoryURL string) (string, error) {
+	endpoint, err := transport.NewEndpoint(mapURL(repositoryURL, nil))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse git repository url '%s': %w", repositoryURL, err)
+	}
+	if endpoint.Protocol != "http" && endpoint.Protocol != "https" {
+		return "", fmt.Errorf("git lfs is not supported for git repository '%s'", repositoryURL)
+	}
+	repositoryPath := strings.TrimSuffix(endpoint.Path, "/")
+	if !strings.HasSuffix(repositoryPath, ".git") {
+		repositoryPath += ".git"
+	}
+	endpoint.Path = repositoryPath + "/info/lfs"
+	return endpoint.String(), nil
+}
+
+func (g *Git) requestLFSBatch(
+	ctx context.Context,
+	lfsURL string,
+	auth transport.AuthMethod,
+	pointers []lfsPointer,
+) (map[string]*lfsAction, error) {
+	body, err := json.Marshal(lfsBatchRequest{
+		Operation: "download",
+		Transfers: []string{"basic"},
+		Objects:   pointers,
+		HashAlgo:  "sha256",
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodPost, lfsURL+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", lfsMediaType)
+	req.Header.Set("Content-Type", lfsMediaType)
+	setHTTPAuth(req, auth)
+
+	resp, err := g.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != nethttp.StatusOK {
+		return nil, fmt.Errorf("git lfs batch request to '%s' failed with status %d", lfsURL, resp.StatusCode)
+	}
+
+	batchResponse := lfsBatchResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(&batchResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode git lfs batch response of '%s': %w", lfsURL, err)
+	}
+	actions := make(map[string]*lfsAction)
+	for _, object := range batchResponse.Objects {
+		if object.Error != nil {
+			return nil, fmt.Errorf("git lfs object '%s' is not available at '%s': %s",
+				object.Oid, lfsURL, object.Error.Message)
+		}
+		actions[object.Oid] = object.Actions.Download
+	}
+	return actions, nil
+}
+
+// downloadLFSObject streams the object into the pointer file at filePath and verifies it against the pointer.
+func (g *Git) downloadLFSObject(
+	ctx context.Context,
+	lfsURL string,
+	auth transport.AuthMethod,
+	pointer lfsPointer,
+	action *lfsAction,
+	worktree billy.Filesystem,
+	filePath string,
+) error {
+	if action == nil {
+		return fmt.Errorf("git lfs server '%s' offers no download of object '%s'", lfsURL, pointer.Oid)
+	}
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodGet, action.Href, nil)
+	if err != nil {
+		return err
+	}
+	for key, value := range action.Header {
+		req.Header.Set(key, value)
+	}
+	// the download may be served elsewhere, e.g. by a storage bucket, or downgraded to plain HTTP, neither of which
+	// must receive the credentials
+	if len(action.Header) == 0 && sameOrigin(lfsURL, action.Href) {
+		setHTTPAuth(req, auth)
+	}
+
+	resp, err := g.opts.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != nethttp.StatusOK {
+		return fmt.Errorf("download of git lfs object '%s' failed with status %d", pointer.Oid, resp.StatusCode)
+	}
+
+	// a mismatching object fails the checkout, so the partially written file is never used
+	hash := sha256.New()
+	size, err := replaceFile(worktree, filePath, io.TeeReader(io.LimitReader(resp.Body, pointer.Size+1), hash))
+	if err != nil {
+		return err
+	}
+	if size != pointer.Size || hex.EncodeToString(hash.Sum(nil)) != pointer.Oid {
+		return fmt.Errorf("downloaded git lfs object '%s' does not match its pointer", pointer.Oid)
+	}
+	return nil
+}
+
+func setHTTPAuth(req *nethttp.Request, auth transport.AuthMethod) {
+	if httpAuth, ok := auth.(http.AuthMethod); ok {
+		httpAuth.SetAuth(req)
+	}
+}
+
+func sameOrigin(first string, second string) bool {
+	firstURL, err := url.Parse(first)
+	if err != nil {
+		return false
+	}
+	secondURL, err := url.Parse(second)
+	if err != nil {
+		return false
+	}
+	return firstURL.Scheme == secondURL.Scheme && firstURL.Host == secondURL.Host
+}
+
+// replaceFile overwrites the file with the content, keeping its permissions, and returns the number of bytes written.
+func replaceFile(worktree billy.Filesystem, filePath string, content io.Reader) (int64, error) {
+	info, err := worktree.Lstat(filePath)
+	if err != nil {
+		return 0, err
+	}
+	file, err := worktree.OpenFile(filePath, os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return size, err
+}
+
+// copyFile replaces the file at targetPath with the content of the file at sourcePath.
+func copyFile(worktree billy.Filesystem, sourcePath string, targetPath string) error {
+	source, err := worktree.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = source.Close()
+	}()
+	_, err = replaceFile(worktree, targetPath, source)
+	return err
+}
@@ -0,0 +1,108 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupLFSRemote(t *testing.T) (*httpRemote, string, string, []byte) {
+	t.Helper()
+	remote := newHTTPRemote(t)
+	binary := []byte("\x00binary chart asset\x01")
+	repositoryURL, commitHash := remote.addRepository(t, "lfs", map[string]string{
+		".gitattributes":             "*.bin filter=lfs diff=lfs merge=lfs -text\n",
+		"charts/app/files/asset.bin": remote.addLFSObject(binary),
+		"charts/app/files/copy.bin":  remote.addLFSObject(binary),
+		"charts/app/Chart.yaml":      "name: app\n",
+	}, nil)
+	return remote, repositoryURL, commitHash, binary
+}
+
+func TestGit_CloneCommit_LFS(t *testing.T) {
+	remote, repositoryURL, commitHash, binary := setupLFSRemote(t)
+
+	repo, err := newTestGit(t, &Options{LFS: true}).CloneCommit(context.Background(), repositoryURL, commitHash)
+	require.NoError(t, err)
+
+	for _, name := range []string{"charts/app/files/asset.bin", "charts/app/files/copy.bin"} {
+		content, innerErr := readWorktreeFile(t, repo, name)
+		require.NoError(t, innerErr)
+		assert.Equal(t, string(binary), content)
+	}
+	assert.Equal(t, []string{"Basic dXNlcjpwYXNzd29yZA=="}, remote.authorizations,
+		"the batch api should be requested once with the credentials of the host")
+}
+
+func TestGit_CloneCommit_LFSDisabled(t *testing.T) {
+	_, repositoryURL, commitHash, _ := setupLFSRemote(t)
+
+	repo, err := newTestGit(t, nil).CloneCommit(context.Background(), repositoryURL, commitHash)
+	require.NoError(t, err)
+
+	content, err := readWorktreeFile(t, repo, "charts/app/files/asset.bin")
+	require.NoError(t, err)
+	_, isPointer := parseLFSPointer([]byte(content))
+	assert.True(t, isPointer)
+}
+
+func TestGit_CloneCommit_LFSObjectMismatch(t *testing.T) {
+	remote, repositoryURL, commitHash, _ := setupLFSRemote(t)
+	for oid := range remote.lfsObjects {
+		remote.lfsObjects[oid] = []byte("tampered")
+	}
+
+	_, err := newTestGit(t, &Options{LFS: true}).CloneCommit(context.Background(), repositoryURL, commitHash)
+	assert.Error(t, err)
+}
+
+func TestGit_CloneCommit_LFSSizeLimit(t *testing.T) {
+	remote, repositoryURL, commitHash, binary := setupLFSRemote(t)
+
+	// both pointer files of the object are replaced, so it counts twice
+	_, err := newTestGit(t, &Options{LFS: true, LFSSizeLimit: int64(len(binary))}).
+		CloneCommit(context.Background(), repositoryURL, commitHash)
+	assert.True(t, errors.As(err, new(*LFSObjectsTooLargeError)))
+	assert.Empty(t, remote.authorizations, "no object should be requested beyond the limit")
+
+	_, err = newTestGit(t, &Options{LFS: true, LFSSizeLimit: int64(2 * len(binary))}).
+		CloneCommit(context.Background(), repositoryURL, commitHash)
+	assert.NoError(t, err)
+}
+
+func TestParseLFSPointer(t *testing.T) {
+	pointer, ok := parseLFSPointer([]byte("version https://git-lfs.github.com/spec/v1\n" +
+		"oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\nsize 12345\n"))
+	require.True(t, ok)
+	assert.Equal(t, lfsPointer{Oid: "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393", Size: 12345}, pointer)
+
+	_, ok = parseLFSPointer([]byte("name: app\n"))
+	assert.False(t, ok)
+}
+
+func TestLFSEndpoint(t *testing.T) {
+	testCases := map[string]string{
+		"https://github.com/org/repo.git": "https://github.com/org/repo.git/info/lfs",
+		"https://github.com/org/repo":     "https://github.com/org/repo.git/info/lfs",
+		"git@github.com:org/repo.git":     "https://github.com/org/repo.git/info/lfs",
+	}
+	for repositoryURL, expected := range testCases {
+		endpoint, err := lfsEndpoint(repositoryURL)
+		require.NoError(t, err)
+		assert.Equal(t, expected, endpoint, repositoryURL)
+	}
+
+	_, err := lfsEndpoint("file://" + os.TempDir())
+	assert.Error(t, err)
+}
+
+func TestSameOrigin(t *testing.T) {
+	lfsURL := "https://github.com/org/repo.git/info/lfs"
+	assert.True(t, sameOrigin(lfsURL, "https://github.com/org/repo.git/info/lfs/objects/abc"))
+	assert.False(t, sameOrigin(lfsURL, "http://github.com/org/repo.git/info/lfs/objects/abc"))
+	assert.False(t, sameOrigin(lfsURL, "https://objects.githubusercontent.com/abc"))
+}
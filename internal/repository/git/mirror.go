@@ -0,0 +1,383 @@
+package git
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	gitConfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+
+	aulogging "github.com/StephanHCB/go-autumn-logging"
+)
+
+// mirrorRefSpecs mirror all branches and tags, so later fetches only transfer objects not known yet.
+var mirrorRefSpecs = []gitConfig.RefSpec{
+	"+refs/heads/*:refs/heads/*",
+	"+refs/tags/*:refs/tags/*",
+}
+
+// mirrors keeps bare copies of remote repositories on disk, one per repository URL. Commits are fetched
+// incrementally into the copy of their repository, so only objects missing locally are transferred. Least recently
+// used copies are removed once the total size of all copies exceeds the size limit. The size of a copy is measured
+// once on startup and grows by the packfiles of each fetch. Copies found on disk are reused after restarts.
+type mirrors struct {
+	directory string
+	sizeLimit int64
+
+	mutex   sync.Mutex
+	entries map[string]*mirror
+}
+
+type mirror struct {
+	path string
+
+	// lock serializes fetches and checkouts, as the on-disk storage is not safe for concurrent use
+	lock sync.Mutex
+	// grown is the size of the packfiles fetched since the mirror was acquired, guarded by lock
+	grown int64
+	// users, size and lastUsed are guarded by the mutex of mirrors; mirrors with users are never evicted
+	users    int
+	size     int64
+	lastUsed time.Time
+}
+
+func newMirrors(directory string, sizeLimit int64) (*mirrors, error) {
+	if err := os.MkdirAll(directory, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create git mirror directory '%s': %w", directory, err)
+	}
+	dirEntries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git mirror directory '%s': %w", directory, err)
+	}
+
+	m := &mirrors{
+		directory: directory,
+		sizeLimit: sizeLimit,
+		entries:   make(map[string]*mirror),
+	}
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+		info, innerErr := dirEntry.Info()
+		if innerErr != nil {
+			return nil, innerErr
+		}
+		mirrorPath := filepath.Join(directory, dirEntry.Name())
+		size, innerErr := directorySize(mirrorPath)
+		if innerErr != nil {
+			return nil, innerErr
+		}
+		m.entries[dirEntry.Name()] = &mirror{path: mirrorPath, size: size, lastUsed: info.ModTime()}
+	}
+	return m, nil
+}
+
+// acquire returns the locked mirror of the repository, which must be released after use.
+func (m *mirrors) acquire(repositoryURL string) *mirror {
+	name := mirrorName(repositoryURL)
+
+	m.mutex.Lock()
+	entry, ok := m.entries[name]
+	if !ok {
+		entry = &mirror{path: filepath.Join(m.directory, name)}
+		m.entries[name] = entry
+	}
+	entry.users++
+	entry.lastUsed = time.Now()
+	m.mutex.Unlock()
+
+	entry.lock.Lock()
+	return entry
+}
+
+// release unlocks the mirror and evicts least recently used mirrors beyond the size limit.
+func (m *mirrors) release(ctx context.Context, entry *mirror) {
+	grown := entry.grown
+	entry.grown = 0
+	now := time.Now()
+	// the modification time restores the usage order after restarts
+	if err := os.Chtimes(entry.path, now, now); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		aulogging.Logger.Ctx(ctx).Warn().WithErr(err).Printf("failed to touch git mirror '%s'", entry.path)
+	}
+	entry.lock.Unlock()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	entry.users--
+	entry.size += grown
+	m.evict(ctx)
+}
+
+// evict removes least recently used mirrors without users beyond the size limit. Mirrors are only acquired with the
+// mutex held, so mirrors without users cannot be acquired while they are removed.
+func (m *mirrors) evict(ctx context.Context) {
+	total := int64(0)
+	names := make([]string, 0, len(m.entries))
+	for name, entry := range m.entries {
+		total += entry.size
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a string, b string) int {
+		return m.entries[a].lastUsed.Compare(m.entries[b].lastUsed)
+	})
+
+	for _, name := range names {
+		if total <= m.sizeLimit {
+			return
+		}
+		entry := m.entries[name]
+		if entry.users > 0 {
+			// acquired, possibly still waiting for its lock; it is not least recently used anymore anyway
+			continue
+		}
+		if err := os.RemoveAll(entry.path); err != nil {
+			aulogging.Logger.Ctx(ctx).Warn().WithErr(err).Printf("failed to evict git mirror '%s'", entry.path)
+			continue
+		}
+		aulogging.Logger.Ctx(ctx).Info().Printf("evicted git mirror '%s' of %d bytes", entry.path, entry.size)
+		total -= entry.size
+		delete(m.entries, name)
+	}
+}
+
+// cloneCommitFromMirror checks out the commit from the mirror of the repository, fetching it first if the mirror
+// does not contain it yet. The trees of the commit are copied into the storage of the returned repository, so
+// submodules can be resolved without accessing the mirror again.
+func (g *Git) cloneCommitFromMirror(
+	ctx context.Context,
+	repositoryURL string,
+	auth transport.AuthMethod,
+	reference string,
+) (*git.Repository, *object.Tree, error) {
+	entry := g.mirrors.acquire(repositoryURL)
+	defer g.mirrors.release(ctx, entry)
+
+	mirrorRepo, err := openMirror(entry.path, repositoryURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	commitHash, err := g.fetchIntoMirror(ctx, entry, mirrorRepo, repositoryURL, auth, reference)
+	if err != nil {
+		return nil, nil, err
+	}
+	commit, err := mirrorRepo.CommitObject(commitHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	commitTree, err := commit.Tree()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	storage := memory.NewStorage()
+	worktree := memfs.New()
+	if err = checkoutMirrorTree(mirrorRepo.Storer, commitTree, storage, worktree); err != nil {
+		return nil, nil, err
+	}
+	repo, err := git.Init(storage, worktree)
+	if err != nil {
+		return nil, nil, err
+	}
+	tree, err := object.GetTree(storage, commitTree.Hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return repo, tree, nil
+}
+
+func openMirror(mirrorPath string, repositoryURL string) (*git.Repository, error) {
+	repo, err := git.PlainOpen(mirrorPath)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		if repo, err = git.PlainInit(mirrorPath, true); err != nil {
+			return nil, fmt.Errorf("failed to create git mirror '%s': %w", mirrorPath, err)
+		}
+		_, err = repo.CreateRemote(&gitConfig.RemoteConfig{
+			Name:  "origin",
+			URLs:  []string{repositoryURL},
+			Fetch: mirrorRefSpecs,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open git mirror '%s': %w", mirrorPath, err)
+	}
+	return repo, nil
+}
+
+// fetchIntoMirror returns the commit of the reference, which is fetched unless it is a commit already present in
+// the mirror. Branches and tags are mirrored on every fetch; commits not at the tip of any of them are fetched
+// on their own, through a temporary reference that is removed again, as the fetched objects remain in the mirror.
+func (g *Git) fetchIntoMirror(
+	ctx context.Context,
+	entry *mirror,
+	mirrorRepo *git.Repository,
+	repositoryURL string,
+	auth transport.AuthMethod,
+	reference string,
+) (plumbing.Hash, error) {
+	if g.isCommitHash(reference) {
+		commitHash := plumbing.NewHash(reference)
+		if _, err := mirrorRepo.CommitObject(commitHash); err == nil {
+			return commitHash, nil
+		}
+	}
+
+	refSpecs := slices.Clone(mirrorRefSpecs)
+	localReference := plumbing.ReferenceName("refs/commits/" + reference)
+	if g.isCommitHash(reference) {
+		refSpecs = append(refSpecs, gitConfig.RefSpec(fmt.Sprintf("+%s:%s", reference, localReference)))
+	} else {
+		localReference = plumbing.ReferenceName(reference)
+	}
+
+	packsBefore, err := packfileSizes(entry.path)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	err = mirrorRepo.FetchContext(ctx, &git.FetchOptions{
+		RemoteURL: repositoryURL,
+		Auth:      auth,
+		RefSpecs:  refSpecs,
+		Tags:      git.NoTags,
+		Force:     true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return plumbing.ZeroHash, mapFetchError(repositoryURL, err)
+	}
+	packsAfter, err := packfileSizes(entry.path)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	for name, size := range packsAfter {
+		if _, ok := packsBefore[name]; !ok {
+			entry.grown += size
+		}
+	}
+
+	resolved, err := mirrorRepo.ResolveRevision(plumbing.Revision(localReference))
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("reference '%s' of git repository '%s' is not available: %w",
+			reference, repositoryURL, err)
+	}
+	if g.isCommitHash(reference) {
+		if err = mirrorRepo.Storer.RemoveReference(localReference); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+	return *resolved, nil
+}
+
+// packfileSizes returns the sizes of the packfiles of the mirror by name, which is where fetches store objects.
+func packfileSizes(mirrorPath string) (map[string]int64, error) {
+	dirEntries, err := os.ReadDir(filepath.Join(mirrorPath, "objects", "pack"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]int64{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sizes := make(map[string]int64, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		info, innerErr := dirEntry.Info()
+		if innerErr != nil {
+			return nil, innerErr
+		}
+		sizes[dirEntry.Name()] = info.Size()
+	}
+	return sizes, nil
+}
+
+// checkoutMirrorTree writes the files of the tree into the worktree and copies the tree objects into the storage.
+func checkoutMirrorTree(
+	mirrorStorer storer.EncodedObjectStorer,
+	commitTree *object.Tree,
+	storage *memory.Storage,
+	worktree billy.Filesystem,
+) error {
+	if err := copyObject(mirrorStorer, storage, commitTree.Hash); err != nil {
+		return err
+	}
+	walker := object.NewTreeWalker(commitTree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case !entry.Mode.IsFile():
+			if entry.Mode == filemode.Dir {
+				if err = copyObject(mirrorStorer, storage, entry.Hash); err != nil {
+					return err
+				}
+			}
+		case name == ".gitmodules":
+			// read again from the tree when resolving submodules
+			if err = copyObject(mirrorStorer, storage, entry.Hash); err != nil {
+				return err
+			}
+			fallthrough
+		default:
+			if err = checkoutFile(mirrorStorer, worktree, name, entry); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func copyObject(source storer.EncodedObjectStorer, target storer.EncodedObjectStorer, hash plumbing.Hash) error {
+	encodedObject, err := source.EncodedObject(plumbing.AnyObject, hash)
+	if err != nil {
+		return err
+	}
+	_, err = target.SetEncodedObject(encodedObject)
+	return err
+}
+
+func mirrorName(repositoryURL string) string {
+	checksum := sha256.Sum256([]byte(repositoryURL))
+	return hex.EncodeToString(checksum[:])
+}
+
+func directorySize(directory string) (int64, error) {
+	size := int64(0)
+	err := filepath.WalkDir(directory, func(_ string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if dirEntry.IsDir() {
+			return nil
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
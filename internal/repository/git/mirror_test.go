@@ -0,0 +1,163 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMirrorTestGit(t *testing.T, mirrorDirectory string, sizeLimit int64) *Git {
+	t.Helper()
+	gitClient, err := New(func(_ context.Context, _ string) (transport.AuthMethod, error) {
+		return nil, nil
+	}, &Options{MirrorDirectory: mirrorDirectory, MirrorSizeLimit: sizeLimit})
+	require.NoError(t, err)
+	return gitClient
+}
+
+// pushCommit commits the file to the remote and returns the hash of the commit.
+func pushCommit(t *testing.T, remoteURL string, name string, content string) string {
+	t.Helper()
+	workDir := filepath.Join(t.TempDir(), "work")
+	runGit(t, t.TempDir(), "clone", "--quiet", remoteURL, workDir)
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, name), []byte(content), 0644))
+	runGit(t, workDir, "add", ".")
+	runGit(t, workDir, "commit", "--quiet", "-m", "update")
+	runGit(t, workDir, "push", "--quiet", "origin", "HEAD")
+	return runGit(t, workDir, "rev-parse", "HEAD")
+}
+
+func TestGit_CloneCommit_Mirror(t *testing.T) {
+	remoteURL, commitHash, _ := setupRemote(t, false)
+	mirrorDirectory := t.TempDir()
+	gitClient := newMirrorTestGit(t, mirrorDirectory, 1<<30)
+
+	repo, err := gitClient.CloneCommit(context.Background(), remoteURL, commitHash)
+	require.NoError(t, err)
+	tree, err := repo.Worktree()
+	require.NoError(t, err)
+	content, err := util.ReadFile(tree.Filesystem, "charts/app/Chart.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "name: app\n", string(content))
+
+	updatedHash := pushCommit(t, remoteURL, "README.md", "# updated\n")
+	repo, err = gitClient.CloneCommit(context.Background(), remoteURL, updatedHash)
+	require.NoError(t, err)
+	tree, err = repo.Worktree()
+	require.NoError(t, err)
+	content, err = util.ReadFile(tree.Filesystem, "README.md")
+	require.NoError(t, err)
+	assert.Equal(t, "# updated\n", string(content))
+
+	mirrorEntries, err := os.ReadDir(mirrorDirectory)
+	require.NoError(t, err)
+	assert.Len(t, mirrorEntries, 1)
+
+	// commits present in the mirror are checked out without accessing the remote, also after restarts
+	require.NoError(t, os.RemoveAll(strings.TrimPrefix(remoteURL, "file://")))
+	gitClient = newMirrorTestGit(t, mirrorDirectory, 1<<30)
+	repo, err = gitClient.CloneCommit(context.Background(), remoteURL, commitHash)
+	require.NoError(t, err)
+	tree, err = repo.Worktree()
+	require.NoError(t, err)
+	content, err = util.ReadFile(tree.Filesystem, "README.md")
+	require.NoError(t, err)
+	assert.Equal(t, "# monorepo\n", string(content))
+}
+
+func TestGit_CloneCommit_MirrorPrunesCommitReferences(t *testing.T) {
+	remoteURL, commitHash, _ := setupRemote(t, false)
+	pushCommit(t, remoteURL, "README.md", "# updated\n")
+	gitClient := newMirrorTestGit(t, t.TempDir(), 1<<30)
+
+	// the commit is no tip anymore, so it is fetched on its own
+	_, err := gitClient.CloneCommit(context.Background(), remoteURL, commitHash)
+	require.NoError(t, err)
+
+	entry := gitClient.mirrors.entries[mirrorName(remoteURL)]
+	mirrorRepo, err := openMirror(entry.path, remoteURL)
+	require.NoError(t, err)
+	references, err := mirrorRepo.References()
+	require.NoError(t, err)
+	require.NoError(t, references.ForEach(func(reference *plumbing.Reference) error {
+		assert.False(t, strings.HasPrefix(reference.Name().String(), "refs/commits/"), reference.Name())
+		return nil
+	}))
+	packs, err := packfileSizes(entry.path)
+	require.NoError(t, err)
+	size := int64(0)
+	for _, packSize := range packs {
+		size += packSize
+	}
+	assert.Equal(t, size, entry.size, "the mirror grows by the fetched packfiles")
+}
+
+func TestGit_CloneCommit_MirrorEviction(t *testing.T) {
+	firstURL, firstHash, _ := setupRemote(t, false)
+	secondURL, secondHash, _ := setupRemote(t, false)
+	mirrorDirectory := t.TempDir()
+
+	gitClient := newMirrorTestGit(t, mirrorDirectory, 1<<30)
+	_, err := gitClient.CloneCommit(context.Background(), firstURL, firstHash)
+	require.NoError(t, err)
+	size, err := directorySize(mirrorDirectory)
+	require.NoError(t, err)
+
+	// the limit only fits one mirror, so the least recently used one is removed
+	gitClient = newMirrorTestGit(t, mirrorDirectory, size+size/2)
+	_, err = gitClient.CloneCommit(context.Background(), secondURL, secondHash)
+	require.NoError(t, err)
+
+	mirrorEntries, err := os.ReadDir(mirrorDirectory)
+	require.NoError(t, err)
+	require.Len(t, mirrorEntries, 1)
+	_, err = os.Stat(filepath.Join(mirrorDirectory, mirrorEntries[0].Name(), "objects"))
+	assert.NoError(t, err)
+	assert.Equal(t, mirrorName(secondURL), mirrorEntries[0].Name())
+}
+
+func TestMirrors_ConcurrentAcquireAndEvict(t *testing.T) {
+	m, err := newMirrors(t.TempDir(), 0)
+	require.NoError(t, err)
+	repositoryURLs := []string{"https://github.com/org/first.git", "https://github.com/org/second.git"}
+
+	var holders [2]atomic.Int32
+	var wg sync.WaitGroup
+	for worker := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			index := worker % len(repositoryURLs)
+			for range 200 {
+				entry := m.acquire(repositoryURLs[index])
+				// no other entry of the same repository is held at the same time
+				assert.Equal(t, int32(1), holders[index].Add(1))
+				m.mutex.Lock()
+				assert.Same(t, entry, m.entries[mirrorName(repositoryURLs[index])])
+				m.mutex.Unlock()
+				// a size limit of 0 evicts every mirror without users on every release
+				assert.NoError(t, os.MkdirAll(entry.path, 0o750))
+				assert.NoError(t, os.WriteFile(filepath.Join(entry.path, "HEAD"), []byte("ref"), 0o600))
+				// like a fetch, the mirror grows while it is held
+				entry.grown = int64(len("ref"))
+				_, statErr := os.Stat(filepath.Join(entry.path, "HEAD"))
+				assert.NoError(t, statErr)
+				holders[index].Add(-1)
+				m.release(context.Background(), entry)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Empty(t, m.entries)
+}
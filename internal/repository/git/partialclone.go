@@ -0,0 +1,242 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/sideband"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// ClonePaths clones a single commit, but only checks out the files located at or below the given slash-separated
+// paths relative to the repository root. If the remote supports partial clones, the commit is fetched without any
+// file contents first, and only the contents of the checked out files are fetched afterwards. Otherwise, the whole
+// commit is fetched.
+func (g *Git) ClonePaths(
+	ctx context.Context,
+	repositoryURL string,
+	commitHash string,
+	paths []string,
+) (*git.Repository, error) {
+	originalURL := repositoryURL
+	repositoryURL, auth, err := g.resolve(ctx, repositoryURL)
+	if err != nil {
+		return nil, err
+	}
+
+	storage := memory.NewStorage()
+	worktree := memfs.New()
+	repo, err := git.Init(storage, worktree)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := plumbing.NewHash(commitHash)
+	if err = fetchObjects(ctx, repositoryURL, auth, storage, []plumbing.Hash{hash}, true); err != nil {
+		return nil, err
+	}
+	commit, err := object.GetCommit(storage, hash)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	checkoutPaths := paths
+	if g.opts.Submodules {
+		// submodules are resolved by their configuration
+		checkoutPaths = append(slices.Clone(paths), ".gitmodules")
+	}
+	files, err := treeFilesInPaths(tree, checkoutPaths)
+	if err != nil {
+		return nil, err
+	}
+	missingBlobs := make([]plumbing.Hash, 0)
+	seenBlobs := make(map[plumbing.Hash]struct{})
+	for _, entry := range files {
+		if _, ok := seenBlobs[entry.Hash]; ok {
+			continue
+		}
+		seenBlobs[entry.Hash] = struct{}{}
+		if storage.HasEncodedObject(entry.Hash) != nil {
+			missingBlobs = append(missingBlobs, entry.Hash)
+		}
+	}
+	if len(missingBlobs) > 0 {
+		if err = fetchObjects(ctx, repositoryURL, auth, storage, missingBlobs, false); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, entry := range files {
+		if err = checkoutFile(storage, worktree, name, entry); err != nil {
+			return nil, err
+		}
+	}
+	if err = g.completeWorktree(ctx, originalURL, tree, worktree, paths, 0); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// treeFilesInPaths lists the files of the tree located at or below the given paths, without reading their contents.
+func treeFilesInPaths(tree *object.Tree, paths []string) (map[string]object.TreeEntry, error) {
+	inPaths := pathsMatcher(paths)
+	files := make(map[string]object.TreeEntry)
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entry.Mode.IsFile() && inPaths(name) {
+			files[name] = entry
+		}
+	}
+	return files, nil
+}
+
+// pathsMatcher reports whether a slash-separated path is located at or below any of the given paths.
+func pathsMatcher(paths []string) func(name string) bool {
+	cleanPaths := make([]string, 0, len(paths))
+	for _, p := range paths {
+		cleanPaths = append(cleanPaths, path.Clean(strings.TrimPrefix(p, "/")))
+	}
+	return func(name string) bool {
+		for _, p := range cleanPaths {
+			if p == "." || name == p || strings.HasPrefix(name, p+"/") {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func checkoutFile(storage storer.EncodedObjectStorer, worktree billy.Filesystem, name string, entry object.TreeEntry) error {
+	blob, err := object.GetBlob(storage, entry.Hash)
+	if err != nil {
+		return err
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	if entry.Mode == filemode.Symlink {
+		target, innerErr := io.ReadAll(reader)
+		if innerErr != nil {
+			return innerErr
+		}
+		return worktree.Symlink(string(target), name)
+	}
+
+	mode, err := entry.Mode.ToOSFileMode()
+	if err != nil {
+		return err
+	}
+	file, err := worktree.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(file, reader); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// fetchObjects fetches the wanted objects into the storage. Commits are fetched shallowly and without file
+// contents, if the remote supports it.
+func fetchObjects(
+	ctx context.Context,
+	repositoryURL string,
+	auth transport.AuthMethod,
+	storage *memory.Storage,
+	wants []plumbing.Hash,
+	commits bool,
+) error {
+	endpoint, err := transport.NewEndpoint(repositoryURL)
+	if err != nil {
+		return err
+	}
+	gitClient, err := client.NewClient(endpoint)
+	if err != nil {
+		return err
+	}
+	session, err := gitClient.NewUploadPackSession(endpoint, auth)
+	if err != nil {
+		return mapFetchError(repositoryURL, err)
+	}
+	defer func() {
+		_ = session.Close()
+	}()
+
+	advertisedReferences, err := session.AdvertisedReferencesContext(ctx)
+	if err != nil {
+		return mapFetchError(repositoryURL, err)
+	}
+	capabilities := advertisedReferences.Capabilities
+
+	request := packp.NewUploadPackRequestFromCapabilities(capabilities)
+	request.Wants = wants
+	if capabilities.Supports(capability.NoProgress) {
+		if err = request.Capabilities.Set(capability.NoProgress); err != nil {
+			return err
+		}
+	}
+	if commits {
+		request.Depth = packp.DepthCommits(1)
+		if err = request.Capabilities.Set(capability.Shallow); err != nil {
+			return err
+		}
+		if capabilities.Supports(capability.Filter) {
+			if err = request.Capabilities.Set(capability.Filter); err != nil {
+				return err
+			}
+			request.Filter = packp.FilterBlobNone()
+		}
+	}
+
+	response, err := session.UploadPack(ctx, request)
+	if err != nil {
+		return mapFetchError(repositoryURL, err)
+	}
+	defer func() {
+		_ = response.Close()
+	}()
+
+	var packReader io.Reader = response
+	switch {
+	case request.Capabilities.Supports(capability.Sideband64k):
+		packReader = sideband.NewDemuxer(sideband.Sideband64k, response)
+	case request.Capabilities.Supports(capability.Sideband):
+		packReader = sideband.NewDemuxer(sideband.Sideband, response)
+	}
+	return packfile.UpdateObjectStorage(storage, packReader)
+}
@@ -0,0 +1,103 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@test.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@test.com",
+	)
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+	return strings.TrimSpace(string(output))
+}
+
+func setupRemote(t *testing.T, allowFilter bool) (string, string, string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	sourceDir := t.TempDir()
+	files := map[string]string{
+		"charts/app/Chart.yaml":          "name: app\n",
+		"charts/app/templates/cm.yaml":   "kind: ConfigMap\n",
+		"charts/common/Chart.yaml":       "name: common\n",
+		"charts/other/large-values.yaml": strings.Repeat("value: large\n", 1000),
+		"README.md":                      "# monorepo\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(sourceDir, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(sourceDir, name), []byte(content), 0644))
+	}
+	runGit(t, sourceDir, "init", "--quiet")
+	runGit(t, sourceDir, "add", ".")
+	runGit(t, sourceDir, "commit", "--quiet", "-m", "initial")
+	commitHash := runGit(t, sourceDir, "rev-parse", "HEAD")
+	largeBlobHash := runGit(t, sourceDir, "rev-parse", "HEAD:charts/other/large-values.yaml")
+
+	remoteDir := filepath.Join(t.TempDir(), "remote.git")
+	runGit(t, sourceDir, "clone", "--quiet", "--bare", sourceDir, remoteDir)
+	runGit(t, remoteDir, "config", "uploadpack.allowFilter", boolString(allowFilter))
+	runGit(t, remoteDir, "config", "uploadpack.allowAnySHA1InWant", "true")
+	return "file://" + remoteDir, commitHash, largeBlobHash
+}
+
+func boolString(value bool) string {
+	if value {
+		return "true"
+	}
+	return "false"
+}
+
+func TestGit_ClonePaths(t *testing.T) {
+	for _, allowFilter := range []bool{true, false} {
+		t.Run("allowFilter="+boolString(allowFilter), func(t *testing.T) {
+			remoteURL, commitHash, largeBlobHash := setupRemote(t, allowFilter)
+			gitClient, err := New(func(_ context.Context, _ string) (transport.AuthMethod, error) {
+				return nil, nil
+			}, nil)
+			require.NoError(t, err)
+
+			repo, err := gitClient.ClonePaths(context.Background(), remoteURL, commitHash,
+				[]string{"charts/app", "charts/common/Chart.yaml"})
+			require.NoError(t, err)
+
+			worktree, err := repo.Worktree()
+			require.NoError(t, err)
+			content, err := util.ReadFile(worktree.Filesystem, "charts/app/templates/cm.yaml")
+			require.NoError(t, err)
+			assert.Equal(t, "kind: ConfigMap\n", string(content))
+			content, err = util.ReadFile(worktree.Filesystem, "charts/common/Chart.yaml")
+			require.NoError(t, err)
+			assert.Equal(t, "name: common\n", string(content))
+
+			for _, name := range []string{"charts/other", "README.md"} {
+				_, err = worktree.Filesystem.Stat(name)
+				assert.True(t, os.IsNotExist(err), "%s should not be checked out", name)
+			}
+
+			if allowFilter {
+				// contents of files outside the paths are never fetched
+				assert.Error(t, repo.Storer.HasEncodedObject(plumbing.NewHash(largeBlobHash)))
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package git
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+const peeledSuffix = "^{}"
+
+var abbreviatedCommitHashRegex = regexp.MustCompile("^[[:xdigit:]]{7,39}$")
+
+// ResolvedReference is a Git reference resolved to the commit it points to.
+type ResolvedReference struct {
+	// Reference is the full name of the resolved reference, e.g. 'refs/tags/v1.2.3', or the full commit hash if a
+	// commit was requested.
+	Reference string
+	// CommitHash is the commit the reference points to. Annotated tags are peeled to their commit.
+	CommitHash string
+}
+
+// ResolveReference resolves a Git reference, which is, in order of precedence:
+//   - a full commit hash
+//   - a full reference name, e.g. 'refs/heads/main' or 'HEAD'
+//   - a short tag or branch name, e.g. 'v1.2.3' or 'main', where tags take precedence like in git
+//   - an abbreviated commit hash of at least 7 characters, if it identifies the tip of a branch or tag. Other
+//     commits are not listed by the remote, so their abbreviated hashes fail with an explaining error
+//   - a semantic version range over the tags, e.g. 'v1.*' or '>=2.3 <3', resolving to the highest matching version
+func (g *Git) ResolveReference(
+	ctx context.Context, repositoryURL string, gitReference string,
+) (*ResolvedReference, error) {
+	if g.isCommitHash(gitReference) {
+		return &ResolvedReference{Reference: gitReference, CommitHash: gitReference}, nil
+	}
+
+	remoteReferences, err := g.RemoteReferences(ctx, repositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	if resolved, ok := resolveReference(remoteReferences, gitReference); ok {
+		return resolved, nil
+	}
+	if abbreviatedCommitHashRegex.MatchString(gitReference) {
+		matches := newReferenceIndex(remoteReferences).commitHashesWithPrefix(strings.ToLower(gitReference))
+		return nil, NewAbbreviatedCommitHashNotFoundError(repositoryURL, gitReference, len(matches) > 1)
+	}
+	return nil, NewRepositoryReferenceNotFoundError(repositoryURL, gitReference)
+}
+
+func resolveReference(remoteReferences []*plumbing.Reference, gitReference string) (*ResolvedReference, bool) {
+	references := newReferenceIndex(remoteReferences)
+
+	for _, name := range []string{
+		gitReference,
+		"refs/" + gitReference,
+		"refs/tags/" + gitReference,
+		"refs/heads/" + gitReference,
+	} {
+		if resolved, ok := references.resolve(name); ok {
+			return resolved, true
+		}
+	}
+	if abbreviatedCommitHashRegex.MatchString(gitReference) {
+		if resolved, ok := references.resolveAbbreviatedCommitHash(strings.ToLower(gitReference)); ok {
+			return resolved, true
+		}
+	}
+	return references.resolveVersionRange(gitReference)
+}
+
+type referenceIndex struct {
+	references map[string]*plumbing.Reference
+	peeled     map[string]plumbing.Hash
+	tagNames   []string
+}
+
+func newReferenceIndex(remoteReferences []*plumbing.Reference) *referenceIndex {
+	index := &referenceIndex{
+		references: make(map[string]*plumbing.Reference),
+		peeled:     make(map[string]plumbing.Hash),
+		tagNames:   make([]string, 0),
+	}
+	for _, reference := range remoteReferences {
+		name := reference.Name().String()
+		if peeledName, found := strings.CutSuffix(name, peeledSuffix); found {
+			index.peeled[peeledName] = reference.Hash()
+			continue
+		}
+		index.references[name] = reference
+		if reference.Name().IsTag() {
+			index.tagNames = append(index.tagNames, name)
+		}
+	}
+	return index
+}
+
+// resolve returns the commit of the reference, following symbolic references and peeling annotated tags.
+func (i *referenceIndex) resolve(name string) (*ResolvedReference, bool) {
+	reference, ok := i.references[name]
+	for depth := 0; ok && reference.Type() == plumbing.SymbolicReference && depth < 10; depth++ {
+		reference, ok = i.references[reference.Target().String()]
+	}
+	if !ok || reference.Type() != plumbing.HashReference {
+		return nil, false
+	}
+
+	commitHash := reference.Hash()
+	if peeledHash, isPeeled := i.peeled[reference.Name().String()]; isPeeled {
+		commitHash = peeledHash
+	}
+	return &ResolvedReference{Reference: reference.Name().String(), CommitHash: commitHash.String()}, true
+}
+
+// resolveAbbreviatedCommitHash resolves the prefix if it identifies the tip of exactly one commit.
+func (i *referenceIndex) resolveAbbreviatedCommitHash(prefix string) (*ResolvedReference, bool) {
+	matches := i.commitHashesWithPrefix(prefix)
+	if len(matches) != 1 {
+		return nil, false
+	}
+	return &ResolvedReference{Reference: matches[0], CommitHash: matches[0]}, true
+}
+
+// commitHashesWithPrefix lists the distinct commits of branch and tag tips starting with the prefix.
+func (i *referenceIndex) commitHashesWithPrefix(prefix string) []string {
+	matches := make([]string, 0)
+	for name := range i.references {
+		resolved, ok := i.resolve(name)
+		if ok && strings.HasPrefix(resolved.CommitHash, prefix) && !slices.Contains(matches, resolved.CommitHash) {
+			matches = append(matches, resolved.CommitHash)
+		}
+	}
+	return matches
+}
+
+func (i *referenceIndex) resolveVersionRange(versionRange string) (*ResolvedReference, bool) {
+	constraints, err := semver.NewConstraint(versionRange)
+	if err != nil {
+		return nil, false
+	}
+
+	var bestName string
+	var bestVersion *semver.Version
+	for _, name := range i.tagNames {
+		version, innerErr := semver.NewVersion(strings.TrimPrefix(name, "refs/tags/"))
+		if innerErr != nil || !constraints.Check(version) {
+			continue
+		}
+		if bestVersion == nil || version.GreaterThan(bestVersion) {
+			bestName = name
+			bestVersion = version
+		}
+	}
+	if bestVersion == nil {
+		return nil, false
+	}
+	return i.resolve(bestName)
+}
@@ -0,0 +1,144 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	mainCommit    = "1111111111111111111111111111111111111111"
+	releaseCommit = "2222222222222222222222222222222222222222"
+	tagObject     = "3333333333333333333333333333333333333333"
+	v1Commit      = "4444444444444444444444444444444444444444"
+	v12Commit     = "5555555555555555555555555555555555555555"
+	v2Commit      = "6666666666666666666666666666666666666666"
+	v3RCCommit    = "7777777777777777777777777777777777777777"
+	abcCommit     = "abcdef0123456789abcdef0123456789abcdef01"
+)
+
+func testReferences() []*plumbing.Reference {
+	return []*plumbing.Reference{
+		plumbing.NewSymbolicReference("HEAD", "refs/heads/main"),
+		plumbing.NewReferenceFromStrings("refs/heads/main", mainCommit),
+		plumbing.NewReferenceFromStrings("refs/heads/release", releaseCommit),
+		plumbing.NewReferenceFromStrings("refs/heads/feature", abcCommit),
+		// a tag and a branch of the same name
+		plumbing.NewReferenceFromStrings("refs/tags/release", v1Commit),
+		plumbing.NewReferenceFromStrings("refs/tags/v1.0.0", v1Commit),
+		plumbing.NewReferenceFromStrings("refs/tags/v1.2.0", tagObject),
+		plumbing.NewReferenceFromStrings("refs/tags/v1.2.0^{}", v12Commit),
+		plumbing.NewReferenceFromStrings("refs/tags/2.3.1", v2Commit),
+		plumbing.NewReferenceFromStrings("refs/tags/v3.0.0-rc.1", v3RCCommit),
+		plumbing.NewReferenceFromStrings("refs/tags/not-a-version", mainCommit),
+	}
+}
+
+func TestResolveReference(t *testing.T) {
+	testCases := []struct {
+		gitReference       string
+		expectedReference  string
+		expectedCommitHash string
+	}{
+		{gitReference: "refs/heads/main", expectedReference: "refs/heads/main", expectedCommitHash: mainCommit},
+		{gitReference: "HEAD", expectedReference: "refs/heads/main", expectedCommitHash: mainCommit},
+		{gitReference: "main", expectedReference: "refs/heads/main", expectedCommitHash: mainCommit},
+		{gitReference: "heads/release", expectedReference: "refs/heads/release", expectedCommitHash: releaseCommit},
+		{gitReference: "release", expectedReference: "refs/tags/release", expectedCommitHash: v1Commit},
+		{gitReference: "v1.0.0", expectedReference: "refs/tags/v1.0.0", expectedCommitHash: v1Commit},
+		{gitReference: "v1.2.0", expectedReference: "refs/tags/v1.2.0", expectedCommitHash: v12Commit},
+		{gitReference: "refs/tags/v1.2.0", expectedReference: "refs/tags/v1.2.0", expectedCommitHash: v12Commit},
+		{gitReference: "abcdef0", expectedReference: abcCommit, expectedCommitHash: abcCommit},
+		{gitReference: "ABCDEF01234", expectedReference: abcCommit, expectedCommitHash: abcCommit},
+		{gitReference: "v1.*", expectedReference: "refs/tags/v1.2.0", expectedCommitHash: v12Commit},
+		{gitReference: "~1.0", expectedReference: "refs/tags/v1.0.0", expectedCommitHash: v1Commit},
+		{gitReference: ">=2.3 <3", expectedReference: "refs/tags/2.3.1", expectedCommitHash: v2Commit},
+		{gitReference: "*", expectedReference: "refs/tags/2.3.1", expectedCommitHash: v2Commit},
+		{gitReference: ">=3.0.0-0", expectedReference: "refs/tags/v3.0.0-rc.1", expectedCommitHash: v3RCCommit},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.gitReference, func(t *testing.T) {
+			resolved, ok := resolveReference(testReferences(), testCase.gitReference)
+			require.True(t, ok)
+			assert.Equal(t, testCase.expectedReference, resolved.Reference)
+			assert.Equal(t, testCase.expectedCommitHash, resolved.CommitHash)
+		})
+	}
+}
+
+func TestResolveReference_NotFound(t *testing.T) {
+	for _, gitReference := range []string{"develop", "refs/heads/develop", ">=4", "1111", "1234567", "invalid range ~"} {
+		t.Run(gitReference, func(t *testing.T) {
+			_, ok := resolveReference(testReferences(), gitReference)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestGit_ResolveReference_AnnotatedTag(t *testing.T) {
+	remoteURL, commitHash, _ := setupRemote(t, false)
+	remoteDir := filepath.Clean(remoteURL[len("file://"):])
+	runGit(t, remoteDir, "tag", "-a", "v1.0.0", "-m", "release", commitHash)
+	gitClient := newTestGit(t, nil)
+
+	resolved, err := gitClient.ResolveReference(context.Background(), remoteURL, "v1.*")
+	require.NoError(t, err)
+	assert.Equal(t, &ResolvedReference{Reference: "refs/tags/v1.0.0", CommitHash: commitHash}, resolved)
+
+	commitHashOfBranch, err := gitClient.ToHash(context.Background(), remoteURL, "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, commitHash, commitHashOfBranch)
+
+	_, err = gitClient.ToHash(context.Background(), remoteURL, "missing")
+	assert.True(t, errors.As(err, new(*RepositoryReferenceNotFoundError)))
+}
+
+func TestReferenceIndex_CommitHashesWithPrefix(t *testing.T) {
+	references := append(testReferences(),
+		plumbing.NewReferenceFromStrings("refs/heads/other", "abcdef0fffffffffffffffffffffffffffffffff"))
+	index := newReferenceIndex(references)
+
+	assert.Equal(t, []string{abcCommit}, index.commitHashesWithPrefix("abcdef01"))
+	assert.Len(t, index.commitHashesWithPrefix("abcdef0"), 2)
+	assert.Empty(t, index.commitHashesWithPrefix("1234567"))
+
+	_, ok := resolveReference(references, "abcdef0")
+	assert.False(t, ok)
+}
+
+func TestGit_ResolveReference_AbbreviatedCommitHashOfNoTip(t *testing.T) {
+	remoteURL, commitHash, _ := setupRemote(t, false)
+	gitClient := newTestGit(t, nil)
+
+	resolved, err := gitClient.ResolveReference(context.Background(), remoteURL, commitHash[:7])
+	require.NoError(t, err)
+	assert.Equal(t, commitHash, resolved.CommitHash)
+
+	// abbreviated hashes of commits that are no branch or tag tip are not listed by the remote
+	_, err = gitClient.ResolveReference(context.Background(), remoteURL, "1234567")
+	require.True(t, errors.As(err, new(*RepositoryReferenceNotFoundError)))
+	assert.Contains(t, err.Error(), "abbreviated commit hashes only resolve to the tips of branches and tags")
+
+	_, err = gitClient.ResolveReference(context.Background(), remoteURL, "develop")
+	require.True(t, errors.As(err, new(*RepositoryReferenceNotFoundError)))
+	assert.NotContains(t, err.Error(), "abbreviated")
+}
+
+func TestGit_IsCommitHash(t *testing.T) {
+	gitClient := newTestGit(t, nil)
+
+	assert.True(t, gitClient.isCommitHash(abcCommit))
+	for _, gitReference := range []string{
+		"release/" + abcCommit,
+		abcCommit + "-hotfix",
+		abcCommit + "0",
+		"abcdef0",
+	} {
+		assert.False(t, gitClient.isCommitHash(gitReference), gitReference)
+	}
+}
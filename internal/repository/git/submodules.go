@@ -0,0 +1,179 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	gitConfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// maxSubmoduleDepth limits the nesting of submodules, which also stops submodules that include each other.
+const maxSubmoduleDepth = 8
+
+// checkoutSubmodules clones the submodules located at or below the given paths, or containing any of them, at the
+// commits recorded in the tree and copies their files into the worktree. Submodules are cloned like any other
+// repository, so they are authenticated by their own host, but only from the host of the repository unless other
+// hosts are allowed.
+func (g *Git) checkoutSubmodules(
+	ctx context.Context,
+	repositoryURL string,
+	commitTree *object.Tree,
+	worktree billy.Filesystem,
+	paths []string,
+	depth int,
+) error {
+	gitlinks, err := treeSubmodulesInPaths(commitTree, paths)
+	if err != nil {
+		return err
+	}
+	if len(gitlinks) == 0 {
+		return nil
+	}
+	if depth >= maxSubmoduleDepth {
+		return fmt.Errorf("submodules of git repository '%s' exceed the maximum depth of %d",
+			repositoryURL, maxSubmoduleDepth)
+	}
+
+	modulesFile, err := commitTree.File(".gitmodules")
+	if err != nil {
+		if errors.Is(err, object.ErrFileNotFound) {
+			// like git, ignore submodules without configuration
+			return nil
+		}
+		return err
+	}
+	modulesContent, err := modulesFile.Contents()
+	if err != nil {
+		return err
+	}
+	modules := gitConfig.NewModules()
+	if err = modules.Unmarshal([]byte(modulesContent)); err != nil {
+		return fmt.Errorf("failed to parse submodules of git repository '%s': %w", repositoryURL, err)
+	}
+
+	for _, submodule := range modules.Submodules {
+		commitHash, ok := gitlinks[path.Clean(submodule.Path)]
+		if !ok {
+			continue
+		}
+		submoduleURL, innerErr := resolveSubmoduleURL(repositoryURL, submodule.URL, g.opts.SubmodulesAllowOtherHosts)
+		if innerErr != nil {
+			return innerErr
+		}
+		submoduleRepo, innerErr := g.cloneCommit(ctx, submoduleURL, commitHash.String(), depth+1)
+		if innerErr != nil {
+			return fmt.Errorf("failed to clone submodule '%s' of git repository '%s': %w",
+				submodule.Name, repositoryURL, innerErr)
+		}
+		submoduleTree, innerErr := submoduleRepo.Worktree()
+		if innerErr != nil {
+			return innerErr
+		}
+		if innerErr = copyWorktree(submoduleTree.Filesystem, worktree, submodule.Path); innerErr != nil {
+			return innerErr
+		}
+	}
+	return nil
+}
+
+// treeSubmodulesInPaths lists the commits of the submodules located at or below the given paths, or containing any
+// of them.
+func treeSubmodulesInPaths(tree *object.Tree, paths []string) (map[string]plumbing.Hash, error) {
+	inPaths := pathsMatcher(paths)
+	containsPath := func(name string) bool {
+		for _, p := range paths {
+			if strings.HasPrefix(path.Clean(strings.TrimPrefix(p, "/")), name+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	gitlinks := make(map[string]plumbing.Hash)
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entry.Mode == filemode.Submodule && (inPaths(name) || containsPath(name)) {
+			gitlinks[name] = entry.Hash
+		}
+	}
+	return gitlinks, nil
+}
+
+// submoduleProtocols are the protocols submodules may be cloned with. In particular, 'file' URLs and local paths are
+// rejected, which would be served from the disk of the server.
+var submoduleProtocols = []string{"http", "https", "ssh"}
+
+// resolveSubmoduleURL resolves URLs relative to the repository URL, e.g. '../other.git', and rejects URLs with other
+// protocols than submoduleProtocols, as well as URLs of other hosts than the one of the repository unless allowed.
+func resolveSubmoduleURL(repositoryURL string, submoduleURL string, allowOtherHosts bool) (string, error) {
+	repositoryEndpoint, err := transport.NewEndpoint(repositoryURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse git repository url '%s': %w", repositoryURL, err)
+	}
+	resolvedURL := submoduleURL
+	if strings.HasPrefix(submoduleURL, "./") || strings.HasPrefix(submoduleURL, "../") {
+		endpoint := *repositoryEndpoint
+		endpoint.Path = path.Join(endpoint.Path, submoduleURL)
+		resolvedURL = endpoint.String()
+	}
+
+	submoduleEndpoint, err := transport.NewEndpoint(resolvedURL)
+	if err != nil {
+		return "", NewSubmoduleURLNotAllowedError(repositoryURL, submoduleURL, err.Error())
+	}
+	if !slices.Contains(submoduleProtocols, submoduleEndpoint.Protocol) {
+		return "", NewSubmoduleURLNotAllowedError(repositoryURL, submoduleURL,
+			fmt.Sprintf("protocol '%s' is not one of %s", submoduleEndpoint.Protocol, strings.Join(submoduleProtocols, ", ")))
+	}
+	if !allowOtherHosts && !strings.EqualFold(submoduleEndpoint.Host, repositoryEndpoint.Host) {
+		return "", NewSubmoduleURLNotAllowedError(repositoryURL, submoduleURL,
+			fmt.Sprintf("host '%s' differs from the host of the repository", submoduleEndpoint.Host))
+	}
+	return resolvedURL, nil
+}
+
+// copyWorktree copies all files of the source into the target path of the destination.
+func copyWorktree(source billy.Filesystem, destination billy.Filesystem, targetPath string) error {
+	return util.Walk(source, "/", func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		targetFilePath := path.Join(targetPath, filePath)
+		switch {
+		case info.IsDir():
+			return destination.MkdirAll(targetFilePath, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			target, innerErr := source.Readlink(filePath)
+			if innerErr != nil {
+				return innerErr
+			}
+			return destination.Symlink(target, targetFilePath)
+		default:
+			content, innerErr := util.ReadFile(source, filePath)
+			if innerErr != nil {
+				return innerErr
+			}
+			return util.WriteFile(destination, targetFilePath, content, info.Mode().Perm())
+		}
+	})
+}
@@ -0,0 +1,257 @@
+package git
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// httpRemote serves bare repositories via git's smart HTTP protocol, together with a minimal LFS server.
+type httpRemote struct {
+	server      *httptest.Server
+	projectRoot string
+
+	mutex          sync.Mutex
+	lfsObjects     map[string][]byte
+	authorizations []string
+}
+
+func newHTTPRemote(t *testing.T) *httpRemote {
+	t.Helper()
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+
+	remote := &httpRemote{
+		projectRoot: t.TempDir(),
+		lfsObjects:  make(map[string][]byte),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /{repository}/info/lfs/objects/batch", remote.handleLFSBatch)
+	mux.HandleFunc("GET /lfs/objects/{oid}", remote.handleLFSDownload)
+	mux.Handle("/", &cgi.Handler{
+		Path: gitPath,
+		Args: []string{"http-backend"},
+		Env:  []string{"GIT_PROJECT_ROOT=" + remote.projectRoot, "GIT_HTTP_EXPORT_ALL=1"},
+	})
+	remote.server = httptest.NewServer(mux)
+	t.Cleanup(remote.server.Close)
+	return remote
+}
+
+func (r *httpRemote) handleLFSBatch(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	r.authorizations = append(r.authorizations, req.Header.Get("Authorization"))
+	r.mutex.Unlock()
+
+	batchRequest := lfsBatchRequest{}
+	if err := json.NewDecoder(req.Body).Decode(&batchRequest); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	objects := make([]map[string]any, 0)
+	for _, pointer := range batchRequest.Objects {
+		objects = append(objects, map[string]any{
+			"oid":  pointer.Oid,
+			"size": pointer.Size,
+			"actions": map[string]any{
+				"download": map[string]any{"href": fmt.Sprintf("http://%s/lfs/objects/%s", req.Host, pointer.Oid)},
+			},
+		})
+	}
+	w.Header().Set("Content-Type", lfsMediaType)
+	_ = json.NewEncoder(w).Encode(map[string]any{"objects": objects})
+}
+
+func (r *httpRemote) handleLFSDownload(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	content, ok := r.lfsObjects[req.PathValue("oid")]
+	r.mutex.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_, _ = w.Write(content)
+}
+
+// addLFSObject stores the content on the LFS server and returns the pointer file referencing it.
+func (r *httpRemote) addLFSObject(content []byte) string {
+	checksum := sha256.Sum256(content)
+	oid := hex.EncodeToString(checksum[:])
+	r.mutex.Lock()
+	r.lfsObjects[oid] = content
+	r.mutex.Unlock()
+	return fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", oid, len(content))
+}
+
+// addRepository commits the files and publishes them as a bare repository, gitlinks map paths to submodule commits.
+func (r *httpRemote) addRepository(
+	t *testing.T, name string, files map[string]string, gitlinks map[string]string,
+) (string, string) {
+	t.Helper()
+	sourceDir := t.TempDir()
+	for fileName, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(sourceDir, fileName)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(sourceDir, fileName), []byte(content), 0644))
+	}
+	runGit(t, sourceDir, "init", "--quiet")
+	runGit(t, sourceDir, "add", ".")
+	for gitlinkPath, commitHash := range gitlinks {
+		runGit(t, sourceDir, "update-index", "--add", "--cacheinfo", "160000,"+commitHash+","+gitlinkPath)
+	}
+	runGit(t, sourceDir, "commit", "--quiet", "-m", "initial")
+	commitHash := runGit(t, sourceDir, "rev-parse", "HEAD")
+
+	remoteDir := filepath.Join(r.projectRoot, name+".git")
+	runGit(t, sourceDir, "clone", "--quiet", "--bare", sourceDir, remoteDir)
+	runGit(t, remoteDir, "config", "uploadpack.allowAnySHA1InWant", "true")
+	return r.server.URL + "/" + name + ".git", commitHash
+}
+
+func newTestGit(t *testing.T, opts *Options) *Git {
+	t.Helper()
+	gitClient, err := New(func(_ context.Context, _ string) (transport.AuthMethod, error) {
+		return &githttp.BasicAuth{Username: "user", Password: "password"}, nil
+	}, opts)
+	require.NoError(t, err)
+	return gitClient
+}
+
+func setupSubmoduleRemote(t *testing.T) (*httpRemote, string, string) {
+	t.Helper()
+	remote := newHTTPRemote(t)
+	_, nestedCommit := remote.addRepository(t, "nested", map[string]string{
+		"nested.yaml": "nested: true\n",
+	}, nil)
+	_, subCommit := remote.addRepository(t, "sub", map[string]string{
+		"common/Chart.yaml": "name: common\n",
+		".gitmodules":       "[submodule \"nested\"]\n\tpath = nested\n\turl = ./../nested.git\n",
+	}, map[string]string{"nested": nestedCommit})
+	parentURL, parentCommit := remote.addRepository(t, "parent", map[string]string{
+		"charts/app/Chart.yaml": "name: app\n",
+		".gitmodules":           "[submodule \"sub\"]\n\tpath = vendor/sub\n\turl = ../sub.git\n",
+	}, map[string]string{"vendor/sub": subCommit})
+	return remote, parentURL, parentCommit
+}
+
+func readWorktreeFile(t *testing.T, repo *git.Repository, name string) (string, error) {
+	t.Helper()
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+	content, err := util.ReadFile(worktree.Filesystem, name)
+	return string(content), err
+}
+
+func TestGit_CloneCommit_Submodules(t *testing.T) {
+	_, parentURL, parentCommit := setupSubmoduleRemote(t)
+
+	repo, err := newTestGit(t, &Options{Submodules: true}).CloneCommit(context.Background(), parentURL, parentCommit)
+	require.NoError(t, err)
+
+	content, err := readWorktreeFile(t, repo, "vendor/sub/common/Chart.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "name: common\n", content)
+	content, err = readWorktreeFile(t, repo, "vendor/sub/nested/nested.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "nested: true\n", content)
+}
+
+func TestGit_CloneCommit_SubmodulesDisabled(t *testing.T) {
+	_, parentURL, parentCommit := setupSubmoduleRemote(t)
+
+	repo, err := newTestGit(t, nil).CloneCommit(context.Background(), parentURL, parentCommit)
+	require.NoError(t, err)
+
+	_, err = readWorktreeFile(t, repo, "vendor/sub/common/Chart.yaml")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestGit_ClonePaths_Submodules(t *testing.T) {
+	_, parentURL, parentCommit := setupSubmoduleRemote(t)
+
+	repo, err := newTestGit(t, &Options{Submodules: true}).ClonePaths(context.Background(), parentURL, parentCommit,
+		[]string{"vendor/sub/common"})
+	require.NoError(t, err)
+
+	content, err := readWorktreeFile(t, repo, "vendor/sub/common/Chart.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "name: common\n", content)
+	_, err = readWorktreeFile(t, repo, "charts/app/Chart.yaml")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestResolveSubmoduleURL(t *testing.T) {
+	testCases := []struct {
+		repositoryURL   string
+		submoduleURL    string
+		allowOtherHosts bool
+		expected        string
+	}{
+		{
+			repositoryURL: "https://github.com/org/parent.git",
+			submoduleURL:  "../sub.git",
+			expected:      "https://github.com/org/sub.git",
+		},
+		{
+			repositoryURL: "https://github.com/org/parent",
+			submoduleURL:  "./sub",
+			expected:      "https://github.com/org/parent/sub",
+		},
+		{
+			repositoryURL: "https://github.com/org/parent.git",
+			submoduleURL:  "git@github.com:org/sub.git",
+			expected:      "git@github.com:org/sub.git",
+		},
+		{
+			repositoryURL:   "https://github.com/org/parent.git",
+			submoduleURL:    "https://gitlab.example.com/group/sub.git",
+			allowOtherHosts: true,
+			expected:        "https://gitlab.example.com/group/sub.git",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.submoduleURL, func(t *testing.T) {
+			resolved, err := resolveSubmoduleURL(testCase.repositoryURL, testCase.submoduleURL, testCase.allowOtherHosts)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, resolved)
+		})
+	}
+}
+
+func TestResolveSubmoduleURL_NotAllowed(t *testing.T) {
+	testCases := []struct {
+		submoduleURL    string
+		allowOtherHosts bool
+	}{
+		{submoduleURL: "file:///etc/secrets.git", allowOtherHosts: true},
+		{submoduleURL: "/srv/git/internal.git", allowOtherHosts: true},
+		{submoduleURL: "git://github.com/org/sub.git", allowOtherHosts: true},
+		{submoduleURL: "https://gitlab.example.com/group/sub.git"},
+		{submoduleURL: "http://169.254.169.254/latest/meta-data"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.submoduleURL, func(t *testing.T) {
+			_, err := resolveSubmoduleURL("https://github.com/org/parent.git", testCase.submoduleURL,
+				testCase.allowOtherHosts)
+			assert.ErrorAs(t, err, new(*SubmoduleURLNotAllowedError))
+		})
+	}
+}
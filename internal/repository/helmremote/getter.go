@@ -0,0 +1,152 @@
+package helmremote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/Roshick/manifest-maestro/internal/client"
+	"github.com/Roshick/manifest-maestro/internal/config"
+	"github.com/Roshick/manifest-maestro/internal/credentials"
+	"helm.sh/helm/v4/pkg/getter"
+	"helm.sh/helm/v4/pkg/registry"
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+// getterTimeout limits requests of Helm's HTTP getter, which does not time out by default.
+var getterTimeout = client.DefaultHTTPClientOptions().Timeout
+
+// hostProvider creates the getters of a configured provider. Its transport and client are shared by all getters,
+// so connections to the host are reused.
+type hostProvider struct {
+	config.HelmHostProvider
+	// transport is used by Helm's HTTP getter, which creates its own client
+	transport *http.Transport
+	// httpClient sends the requests of the other getters via the transport
+	httpClient *http.Client
+}
+
+func newHostProviders(
+	hostProviders config.HelmHostProviders,
+	clientFactory ClientFactory,
+) (map[string][]hostProvider, error) {
+	result := make(map[string][]hostProvider, len(hostProviders))
+	for host, providers := range hostProviders {
+		for _, provider := range providers {
+			hostProvider := hostProvider{HelmHostProvider: provider}
+			// bearer tokens are sent by our own getter, which must not decompress chart archives either
+			if provider.HasTransportOptions() || provider.BearerToken != "" {
+				hostProvider.transport = provider.NewTransport()
+
+				clientOptions := client.DefaultHTTPClientOptions()
+				clientOptions.Transport = hostProvider.transport
+				httpClient, err := clientFactory.NewHTTPClient(fmt.Sprintf("helm-%s-%s", provider.Type, host), clientOptions)
+				if err != nil {
+					return nil, err
+				}
+				hostProvider.httpClient = httpClient
+			}
+			result[host] = append(result[host], hostProvider)
+		}
+	}
+	return result, nil
+}
+
+// newGetter creates a getter for the URL authenticating with the credential, if given, or with the configured
+// credentials. Requests of the getter are canceled with the context.
+func (p hostProvider) newGetter(
+	ctx context.Context,
+	targetURL url.URL,
+	credential *credentials.HelmCredential,
+) (getter.Getter, error) {
+	username, password, bearerToken := p.Username, p.Password, p.BearerToken
+	if credential != nil {
+		username, password, bearerToken = credential.Username, credential.Password, ""
+	}
+
+	if p.Type == config.HelmProviderTypeOCI {
+		return p.newOCIGetter(username, password, bearerToken)
+	}
+	if bearerToken != "" {
+		return &bearerTokenGetter{ctx: ctx, client: p.httpClient, token: bearerToken}, nil
+	}
+	// Helm's HTTP getter only sends Basic Auth credentials to the scheme and host of its URL
+	options := []getter.Option{getter.WithURL(targetURL.String()), getter.WithTimeout(getterTimeout)}
+	if p.transport != nil {
+		options = append(options, getter.WithTransport(p.transport))
+	}
+	if username != "" && password != "" {
+		options = append(options, getter.WithBasicAuth(username, password))
+	}
+	return getter.NewHTTPGetter(options...)
+}
+
+func (p hostProvider) newOCIGetter(username string, password string, bearerToken string) (getter.Getter, error) {
+	clientOptions := make([]registry.ClientOption, 0, 3)
+	if p.PlainHTTP {
+		clientOptions = append(clientOptions, registry.ClientOptPlainHTTP())
+	}
+	if p.httpClient != nil {
+		httpClient := p.httpClient
+		credential := auth.EmptyCredential
+		if bearerToken != "" {
+			credential = auth.Credential{AccessToken: bearerToken}
+		} else if username != "" && password != "" {
+			credential = auth.Credential{Username: username, Password: password}
+		}
+		clientOptions = append(clientOptions,
+			registry.ClientOptHTTPClient(httpClient),
+			registry.ClientOptAuthorizer(auth.Client{
+				Client: httpClient,
+				Cache:  auth.NewCache(),
+				Credential: func(_ context.Context, _ string) (auth.Credential, error) {
+					return credential, nil
+				},
+			}),
+		)
+	} else if username != "" && password != "" {
+		clientOptions = append(clientOptions, registry.ClientOptBasicAuth(username, password))
+	}
+	if len(clientOptions) == 0 {
+		return getter.NewOCIGetter()
+	}
+
+	registryClient, err := registry.NewClient(clientOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return getter.NewOCIGetter(getter.WithRegistryClient(registryClient))
+}
+
+// bearerTokenGetter fetches files from HTTP(S) chart repositories that authenticate with bearer tokens, which Helm's
+// HTTP getter does not support. Like the latter, it reports unexpected statuses as 'failed to fetch <url> : <status>'.
+// Helm's getters take no context, so the getter is created per request with the context of the request.
+type bearerTokenGetter struct {
+	ctx    context.Context
+	client *http.Client
+	token  string
+}
+
+func (g *bearerTokenGetter) Get(href string, _ ...getter.Option) (*bytes.Buffer, error) {
+	req, err := http.NewRequestWithContext(g.ctx, http.MethodGet, href, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+g.token)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s : %s", href, resp.Status)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	_, err = io.Copy(buf, resp.Body)
+	return buf, err
+}
@@ -0,0 +1,123 @@
+package helmremote
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Roshick/manifest-maestro/internal/client"
+	"github.com/Roshick/manifest-maestro/internal/config"
+	"github.com/Roshick/manifest-maestro/internal/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTLSIndexServer(t *testing.T, authorization *string) (*httptest.Server, url.URL, *tls.Config) {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*authorization = r.Header.Get("Authorization")
+		if r.URL.Path != "/charts/index.yaml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("apiVersion: v1\n"))
+	}))
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(server.Certificate())
+	return server, *serverURL.JoinPath("charts"), &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12}
+}
+
+func TestHelmRemote_GetIndex_BearerTokenWithCustomCA(t *testing.T) {
+	var authorization string
+	_, repositoryURL, tlsConfig := newTLSIndexServer(t, &authorization)
+
+	remote, err := New(config.HelmHostProviders{
+		repositoryURL.Host: {{
+			Type:        config.HelmProviderTypeHTTP,
+			Schemes:     []string{"https"},
+			BearerToken: "configured-token",
+			TLSConfig:   tlsConfig,
+		}},
+	}, client.NewFactory(), nil, nil)
+	require.NoError(t, err)
+
+	index, err := remote.GetIndex(context.Background(), repositoryURL)
+	require.NoError(t, err)
+	assert.Equal(t, "apiVersion: v1\n", string(index))
+	assert.Equal(t, "Bearer configured-token", authorization)
+
+	_, err = remote.GetIndex(context.Background(), *repositoryURL.JoinPath("missing"))
+	assert.ErrorAs(t, err, new(*RepositoryNotFoundError))
+}
+
+func TestHelmRemote_GetIndex_RequestCredentialKeepsTLSOptions(t *testing.T) {
+	var authorization string
+	_, repositoryURL, tlsConfig := newTLSIndexServer(t, &authorization)
+
+	remote, err := New(config.HelmHostProviders{
+		repositoryURL.Host: {{
+			Type:        config.HelmProviderTypeHTTP,
+			Schemes:     []string{"https"},
+			BearerToken: "configured-token",
+			TLSConfig:   tlsConfig,
+		}},
+	}, client.NewFactory(), nil, nil)
+	require.NoError(t, err)
+
+	ctx := credentials.NewContext(context.Background(), &credentials.Credentials{
+		Helm: map[string]credentials.HelmCredential{
+			repositoryURL.Host: {Username: "ci", Password: "request-token"},
+		},
+	})
+	_, err = remote.GetIndex(ctx, repositoryURL)
+	require.NoError(t, err)
+
+	request, err := http.NewRequest(http.MethodGet, repositoryURL.String(), nil)
+	require.NoError(t, err)
+	request.SetBasicAuth("ci", "request-token")
+	assert.Equal(t, request.Header.Get("Authorization"), authorization)
+}
+
+func TestHelmRemote_GetIndex_UntrustedCertificate(t *testing.T) {
+	var authorization string
+	_, repositoryURL, _ := newTLSIndexServer(t, &authorization)
+
+	remote, err := New(config.HelmHostProviders{
+		repositoryURL.Host: {{Type: config.HelmProviderTypeHTTP, Schemes: []string{"https"}, BearerToken: "token"}},
+	}, client.NewFactory(), nil, nil)
+	require.NoError(t, err)
+
+	_, err = remote.GetIndex(context.Background(), repositoryURL)
+	assert.Error(t, err)
+	assert.Empty(t, authorization)
+}
+
+func TestHelmRemote_GetIndex_BearerTokenCanceledRequest(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	remote, err := New(config.HelmHostProviders{
+		serverURL.Host: {{Type: config.HelmProviderTypeHTTP, Schemes: []string{"http"}, BearerToken: "token"}},
+	}, client.NewFactory(), nil, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = remote.GetIndex(ctx, *serverURL)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
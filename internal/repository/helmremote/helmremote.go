@@ -4,35 +4,77 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
+	"path"
 	"path/filepath"
 	"strings"
 
+	"github.com/Roshick/manifest-maestro/internal/client"
 	"github.com/Roshick/manifest-maestro/internal/config"
+	"github.com/Roshick/manifest-maestro/internal/credentials"
+	"github.com/Roshick/manifest-maestro/internal/repository/ociregistry"
+	"github.com/Roshick/manifest-maestro/internal/repository/s3"
+	"helm.sh/helm/v4/pkg/getter"
+	"helm.sh/helm/v4/pkg/registry"
 	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/errdef"
 )
 
+// ObjectStorage serves Helm repositories stored in buckets, addressed by 's3://<host>/<bucket>/<prefix>' URLs, or
+// by 's3+http://' URLs for endpoints without TLS.
+type ObjectStorage interface {
+	GetObject(ctx context.Context, endpoint string, bucket string, key string) ([]byte, string, error)
+}
+
+// ClientFactory creates the HTTP clients of providers with their own transport.
+type ClientFactory interface {
+	NewHTTPClient(clientName string, opts *client.HTTPClientOptions) (*http.Client, error)
+}
+
+// ChartRegistry resolves the tags of charts stored in OCI registries.
+type ChartRegistry interface {
+	Repository(ctx context.Context, repository string) (ociregistry.Repository, error)
+}
+
 type HelmRemote struct {
-	hostProviders config.HelmHostProviders
+	hostProviders map[string][]hostProvider
+	objectStorage ObjectStorage
+	chartRegistry ChartRegistry
 }
 
-func New(hostProviders config.HelmHostProviders) *HelmRemote {
-	return &HelmRemote{hostProviders: hostProviders}
+func New(
+	hostProviders config.HelmHostProviders,
+	clientFactory ClientFactory,
+	objectStorage ObjectStorage,
+	chartRegistry ChartRegistry,
+) (*HelmRemote, error) {
+	providers, err := newHostProviders(hostProviders, clientFactory)
+	if err != nil {
+		return nil, err
+	}
+	return &HelmRemote{
+		hostProviders: providers,
+		objectStorage: objectStorage,
+		chartRegistry: chartRegistry,
+	}, nil
 }
 
-func (r *HelmRemote) GetIndex(_ context.Context, repositoryURL url.URL) ([]byte, error) {
+func (r *HelmRemote) GetIndex(ctx context.Context, repositoryURL url.URL) ([]byte, error) {
+	if isObjectStorageURL(repositoryURL) {
+		index, err := r.getObject(ctx, repositoryURL.JoinPath("index.yaml"))
+		if errors.As(err, new(*s3.ObjectNotFoundError)) {
+			return nil, NewRepositoryNotFoundError2(repositoryURL)
+		}
+		return index, err
+	}
 	if repositoryURL.Scheme != "http" && repositoryURL.Scheme != "https" {
 		return nil, fmt.Errorf("unsupported scheme: %s", repositoryURL.Scheme)
 	}
 
-	providers, ok := r.hostProviders[repositoryURL.Host]
-	if !ok {
-		return nil, NewMissingProviderError(repositoryURL)
-	}
-
-	urlGetter, err := providers.ByScheme(repositoryURL.Scheme)
+	urlGetter, err := r.getter(ctx, repositoryURL)
 	if err != nil {
-		return nil, NewMissingProviderError(repositoryURL)
+		return nil, err
 	}
 
 	indexURL := repositoryURL
@@ -48,15 +90,18 @@ func (r *HelmRemote) GetIndex(_ context.Context, repositoryURL url.URL) ([]byte,
 	return chartBuffer.Bytes(), nil
 }
 
-func (r *HelmRemote) GetChart(_ context.Context, chartURL url.URL) ([]byte, error) {
-	providers, ok := r.hostProviders[chartURL.Host]
-	if !ok {
-		return nil, NewMissingProviderError(chartURL)
+func (r *HelmRemote) GetChart(ctx context.Context, chartURL url.URL) ([]byte, error) {
+	if isObjectStorageURL(chartURL) {
+		chart, err := r.getObject(ctx, &chartURL)
+		if errors.As(err, new(*s3.ObjectNotFoundError)) {
+			return nil, NewRepositoryChartNotFoundError2(chartURL)
+		}
+		return chart, err
 	}
 
-	urlGetter, err := providers.ByScheme(chartURL.Scheme)
+	urlGetter, err := r.getter(ctx, chartURL)
 	if err != nil {
-		return nil, NewMissingProviderError(chartURL)
+		return nil, err
 	}
 
 	chartBuffer, err := urlGetter.Get(chartURL.String())
@@ -67,12 +112,97 @@ func (r *HelmRemote) GetChart(_ context.Context, chartURL url.URL) ([]byte, erro
 		if strings.HasPrefix(err.Error(), "invalid reference:") {
 			return nil, NewRepositoryChartNotFoundError2(chartURL)
 		}
+		if strings.HasSuffix(err.Error(), "404 Not Found") {
+			return nil, NewRepositoryChartNotFoundError2(chartURL)
+		}
 		return nil, err
 	}
 
 	return chartBuffer.Bytes(), nil
 }
 
+// ResolveChartDigest resolves the tag of an OCI chart, addressed by 'oci://<host>/<repository>:<tag>', to the digest
+// of its manifest.
+func (r *HelmRemote) ResolveChartDigest(ctx context.Context, chartURL url.URL) (string, error) {
+	if chartURL.Scheme != "oci" {
+		return "", fmt.Errorf("unsupported scheme: %s", chartURL.Scheme)
+	}
+	if r.chartRegistry == nil {
+		return "", NewMissingProviderError(chartURL)
+	}
+
+	repositoryPath, tag := chartURL.Path, ""
+	if i := strings.LastIndex(chartURL.Path, ":"); i >= 0 {
+		repositoryPath, tag = chartURL.Path[:i], chartURL.Path[i+1:]
+	}
+	if tag == "" {
+		return "", NewRepositoryChartNotFoundError2(chartURL)
+	}
+
+	repository, err := r.chartRegistry.Repository(ctx, chartURL.Host+repositoryPath)
+	if err != nil {
+		return "", err
+	}
+	descriptor, err := repository.Resolve(ctx, tag)
+	if errors.Is(err, errdef.ErrNotFound) || errors.Is(err, errdef.ErrInvalidReference) {
+		return "", NewRepositoryChartNotFoundError2(chartURL)
+	}
+	if err != nil {
+		return "", err
+	}
+	return descriptor.Digest.String(), nil
+}
+
+// getter returns a getter of the provider for the host and scheme of the URL. Credentials sent along with the request
+// take precedence over the ones of the provider, which keeps its TLS and proxy options, and hosts without provider
+// are accessed with the default HTTP and OCI getters if there are such credentials.
+func (r *HelmRemote) getter(ctx context.Context, targetURL url.URL) (getter.Getter, error) {
+	credential, hasCredential := credentials.HelmCredentialFor(ctx, targetURL.Host)
+	providers, ok := r.hostProviders[targetURL.Host]
+	if !ok {
+		if !hasCredential {
+			return nil, NewMissingProviderError(targetURL)
+		}
+		providers = defaultProviders
+	}
+
+	for _, provider := range providers {
+		if !provider.Provides(targetURL.Scheme) {
+			continue
+		}
+		if hasCredential {
+			return provider.newGetter(ctx, targetURL, &credential)
+		}
+		return provider.newGetter(ctx, targetURL, nil)
+	}
+	return nil, NewMissingProviderError(targetURL)
+}
+
+var defaultProviders = []hostProvider{
+	{HelmHostProvider: config.HelmHostProvider{Type: config.HelmProviderTypeHTTP, Schemes: []string{"http", "https"}}},
+	{HelmHostProvider: config.HelmHostProvider{Type: config.HelmProviderTypeOCI, Schemes: []string{registry.OCIScheme}}},
+}
+
+func (r *HelmRemote) getObject(ctx context.Context, objectURL *url.URL) ([]byte, error) {
+	if r.objectStorage == nil {
+		return nil, NewMissingProviderError(*objectURL)
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(path.Clean(objectURL.Path), "/"), "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("s3 url '%s' does not select an object of a bucket", objectURL.String())
+	}
+	endpoint := url.URL{Scheme: "https", Host: objectURL.Host}
+	if objectURL.Scheme == "s3+http" {
+		endpoint.Scheme = "http"
+	}
+	content, _, err := r.objectStorage.GetObject(ctx, endpoint.String(), bucket, key)
+	return content, err
+}
+
+func isObjectStorageURL(objectURL url.URL) bool {
+	return objectURL.Scheme == "s3" || objectURL.Scheme == "s3+http"
+}
+
 func (r *HelmRemote) Write(_ []byte) (int, error) {
 	return 0, nil
 }
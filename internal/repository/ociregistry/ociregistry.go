@@ -0,0 +1,98 @@
+package ociregistry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Roshick/manifest-maestro/internal/credentials"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/registry"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/retry"
+)
+
+// Host holds the authentication and connection options of a registry host. Requests are authenticated with Basic
+// Auth, or with a token obtained via Basic Auth, unless an access token is given.
+type Host struct {
+	Username    string
+	Password    string
+	AccessToken string
+	// PlainHTTP connects to the registry via HTTP instead of HTTPS.
+	PlainHTTP bool
+	// HTTPClient replaces the default HTTP client for the host, e.g. to use a custom CA bundle or proxy.
+	HTTPClient *http.Client
+}
+
+func (h Host) credential() auth.Credential {
+	if h.AccessToken != "" {
+		return auth.Credential{AccessToken: h.AccessToken}
+	}
+	if h.Username != "" && h.Password != "" {
+		return auth.Credential{Username: h.Username, Password: h.Password}
+	}
+	return auth.EmptyCredential
+}
+
+// Repository is a repository of a registry, whose manifests and blobs are retrieved by digest or tag.
+type Repository interface {
+	oras.ReadOnlyTarget
+	registry.TagLister
+}
+
+// OCIRegistry connects to repositories of OCI registries, authenticating with the options of the registry host.
+// Registries on hosts without options are accessed anonymously.
+type OCIRegistry struct {
+	hosts   map[string]Host
+	client  *auth.Client
+	clients map[string]*auth.Client
+}
+
+func New(hosts map[string]Host, httpClient *http.Client) *OCIRegistry {
+	if httpClient == nil {
+		httpClient = retry.DefaultClient
+	}
+	credential := func(_ context.Context, hostport string) (auth.Credential, error) {
+		return hosts[hostport].credential(), nil
+	}
+	clients := make(map[string]*auth.Client)
+	for host, options := range hosts {
+		if options.HTTPClient != nil {
+			clients[host] = &auth.Client{Client: options.HTTPClient, Cache: auth.NewCache(), Credential: credential}
+		}
+	}
+	return &OCIRegistry{
+		hosts:   hosts,
+		client:  &auth.Client{Client: httpClient, Cache: auth.NewCache(), Credential: credential},
+		clients: clients,
+	}
+}
+
+// Repository connects to the repository, e.g. 'ghcr.io/org/manifests'. An 'oci://' scheme is ignored. Credentials
+// for the registry host sent along with the request take precedence; their tokens are not shared with other
+// requests.
+func (r *OCIRegistry) Repository(ctx context.Context, repository string) (Repository, error) {
+	remoteRepository, err := remote.NewRepository(strings.TrimPrefix(repository, "oci://"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid oci repository '%s': %w", repository, err)
+	}
+	registryHost := remoteRepository.Reference.Registry
+	client, ok := r.clients[registryHost]
+	if !ok {
+		client = r.client
+	}
+	remoteRepository.Client = client
+	remoteRepository.PlainHTTP = r.hosts[registryHost].PlainHTTP
+	if credential, ok := credentials.HelmCredentialFor(ctx, registryHost); ok {
+		remoteRepository.Client = &auth.Client{
+			Client: client.Client,
+			Credential: auth.StaticCredential(registryHost, auth.Credential{
+				Username: credential.Username,
+				Password: credential.Password,
+			}),
+		}
+	}
+	return remoteRepository, nil
+}
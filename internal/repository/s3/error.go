@@ -0,0 +1,62 @@
+package s3
+
+import "fmt"
+
+type ObjectNotFoundError struct {
+	objectURL string
+}
+
+func (e *ObjectNotFoundError) Error() string {
+	return fmt.Sprintf("s3 object '%s' does not exist", e.objectURL)
+}
+
+func NewObjectNotFoundError(endpoint string, bucket string, key string) *ObjectNotFoundError {
+	return &ObjectNotFoundError{
+		objectURL: fmt.Sprintf("%s/%s/%s", endpoint, bucket, key),
+	}
+}
+
+// EndpointNotAllowedError is returned for endpoints whose host has neither credentials nor is allowed otherwise.
+type EndpointNotAllowedError struct {
+	endpoint string
+}
+
+func (e *EndpointNotAllowedError) Error() string {
+	return fmt.Sprintf("s3 endpoint '%s' is not allowed", e.endpoint)
+}
+
+func NewEndpointNotAllowedError(endpoint string) *EndpointNotAllowedError {
+	return &EndpointNotAllowedError{
+		endpoint: endpoint,
+	}
+}
+
+type ObjectTooLargeError struct {
+	objectURL string
+	maxSize   int64
+}
+
+func (e *ObjectTooLargeError) Error() string {
+	return fmt.Sprintf("s3 object '%s' is larger than %d bytes", e.objectURL, e.maxSize)
+}
+
+func NewObjectTooLargeError(endpoint string, bucket string, key string, maxSize int64) *ObjectTooLargeError {
+	return &ObjectTooLargeError{
+		objectURL: fmt.Sprintf("%s/%s/%s", endpoint, bucket, key),
+		maxSize:   maxSize,
+	}
+}
+
+// ResponseError is an error response of an S3 endpoint, other than a missing bucket or object.
+type ResponseError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *ResponseError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3 request failed with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3 request failed with status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
@@ -0,0 +1,222 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Credentials authenticate requests to an S3 endpoint. Requests to endpoints without credentials are anonymous.
+type Credentials struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// VirtualHostedStyle addresses buckets as subdomain of the endpoint instead of as first path segment.
+	VirtualHostedStyle bool
+}
+
+// Object is an entry of a bucket listing.
+type Object struct {
+	Key  string
+	ETag string
+	Size int64
+}
+
+// MaxObjectSize caps the content of a single object, which is held in memory as a whole.
+const MaxObjectSize int64 = 64 << 20
+
+// S3 reads objects from S3-compatible object storages, like AWS S3, MinIO or Ceph. Endpoints are base URLs, e.g.
+// 'https://s3.eu-central-1.amazonaws.com' or 'http://minio.local:9000'.
+type S3 struct {
+	credentials  map[string]Credentials
+	allowedHosts map[string]bool
+	httpClient   *http.Client
+	now          func() time.Time
+}
+
+// New creates a client authenticating requests with the credentials of the endpoint host, e.g. 'minio.local:9000'.
+// Only hosts with credentials and the additionally allowed hosts, which are accessed anonymously, are requested.
+func New(credentials map[string]Credentials, allowedHosts []string, httpClient *http.Client) *S3 {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	normalizedCredentials := make(map[string]Credentials, len(credentials))
+	normalizedAllowedHosts := make(map[string]bool, len(credentials)+len(allowedHosts))
+	for host, hostCredentials := range credentials {
+		if hostCredentials.Region == "" {
+			hostCredentials.Region = "us-east-1"
+		}
+		normalizedCredentials[strings.ToLower(host)] = hostCredentials
+		normalizedAllowedHosts[strings.ToLower(host)] = true
+	}
+	for _, host := range allowedHosts {
+		normalizedAllowedHosts[strings.ToLower(host)] = true
+	}
+	return &S3{
+		credentials:  normalizedCredentials,
+		allowedHosts: normalizedAllowedHosts,
+		httpClient:   httpClient,
+		now:          time.Now,
+	}
+}
+
+// HeadObject returns the ETag of the object.
+func (s *S3) HeadObject(ctx context.Context, endpoint string, bucket string, key string) (string, error) {
+	resp, err := s.do(ctx, http.MethodHead, endpoint, bucket, key, nil)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if err = checkResponse(resp, endpoint, bucket, key); err != nil {
+		return "", err
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+// GetObject returns the content and the ETag of the object. Objects larger than MaxObjectSize are rejected.
+func (s *S3) GetObject(ctx context.Context, endpoint string, bucket string, key string) ([]byte, string, error) {
+	resp, err := s.do(ctx, http.MethodGet, endpoint, bucket, key, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if err = checkResponse(resp, endpoint, bucket, key); err != nil {
+		return nil, "", err
+	}
+	if resp.ContentLength > MaxObjectSize {
+		return nil, "", NewObjectTooLargeError(endpoint, bucket, key, MaxObjectSize)
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, MaxObjectSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(content)) > MaxObjectSize {
+		return nil, "", NewObjectTooLargeError(endpoint, bucket, key, MaxObjectSize)
+	}
+	return content, resp.Header.Get("ETag"), nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		ETag string `xml:"ETag"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// ListObjects returns all objects of the bucket whose keys start with the prefix, in lexicographical key order.
+func (s *S3) ListObjects(ctx context.Context, endpoint string, bucket string, prefix string) ([]Object, error) {
+	objects := make([]Object, 0)
+	continuationToken := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+		result, err := s.listObjectsPage(ctx, endpoint, bucket, prefix, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, content := range result.Contents {
+			objects = append(objects, Object{Key: content.Key, ETag: content.ETag, Size: content.Size})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+func (s *S3) listObjectsPage(
+	ctx context.Context, endpoint string, bucket string, prefix string, query url.Values,
+) (*listBucketResult, error) {
+	resp, err := s.do(ctx, http.MethodGet, endpoint, bucket, "", query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if err = checkResponse(resp, endpoint, bucket, prefix); err != nil {
+		return nil, err
+	}
+	result := &listBucketResult{}
+	if err = xml.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, fmt.Errorf("failed to decode listing of s3 bucket '%s': %w", bucket, err)
+	}
+	return result, nil
+}
+
+func (s *S3) do(
+	ctx context.Context, method string, endpoint string, bucket string, key string, query url.Values,
+) (*http.Response, error) {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil || (endpointURL.Scheme != "http" && endpointURL.Scheme != "https") || endpointURL.Host == "" {
+		return nil, fmt.Errorf("s3 endpoint '%s' is not an absolute http(s) url", endpoint)
+	}
+	if !s.allowedHosts[strings.ToLower(endpointURL.Host)] {
+		return nil, NewEndpointNotAllowedError(endpoint)
+	}
+	if bucket == "" {
+		return nil, fmt.Errorf("s3 bucket must not be empty")
+	}
+	credentials, authenticated := s.credentials[strings.ToLower(endpointURL.Host)]
+
+	requestURL := *endpointURL
+	basePath := strings.TrimSuffix(endpointURL.EscapedPath(), "/")
+	if credentials.VirtualHostedStyle {
+		requestURL.Host = bucket + "." + endpointURL.Host
+		requestURL.RawPath = basePath + "/" + uriEncode(key, false)
+	} else {
+		requestURL.RawPath = basePath + "/" + uriEncode(bucket, true) + "/" + uriEncode(key, false)
+	}
+	if requestURL.Path, err = url.PathUnescape(requestURL.RawPath); err != nil {
+		return nil, err
+	}
+	requestURL.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	req, err := http.NewRequestWithContext(ctx, method, requestURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if authenticated && credentials.AccessKeyID != "" {
+		req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+		signRequest(req, credentials, s.now())
+	}
+	return s.httpClient.Do(req)
+}
+
+type errorResponse struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func checkResponse(resp *http.Response, endpoint string, bucket string, key string) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return NewObjectNotFoundError(endpoint, bucket, key)
+	}
+	responseErr := &ResponseError{StatusCode: resp.StatusCode}
+	body := errorResponse{}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		return responseErr
+	}
+	responseErr.Code = body.Code
+	responseErr.Message = body.Message
+	return responseErr
+}
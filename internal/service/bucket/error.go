@@ -0,0 +1,17 @@
+package bucket
+
+import "fmt"
+
+type ReferenceInvalidError struct {
+	reason string
+}
+
+func (e *ReferenceInvalidError) Error() string {
+	return fmt.Sprintf("bucket reference is invalid: %s", e.reason)
+}
+
+func NewReferenceInvalidError(reason string) *ReferenceInvalidError {
+	return &ReferenceInvalidError{
+		reason: reason,
+	}
+}
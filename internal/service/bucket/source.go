@@ -0,0 +1,249 @@
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	aucache "github.com/Roshick/go-autumn-synchronisation/pkg/cache"
+	"github.com/Roshick/manifest-maestro/internal/repository/s3"
+	"github.com/Roshick/manifest-maestro/internal/service/cache"
+	"github.com/Roshick/manifest-maestro/pkg/archive"
+	"github.com/Roshick/manifest-maestro/pkg/archive/limit"
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+	"github.com/Roshick/manifest-maestro/pkg/targz"
+	aulogging "github.com/StephanHCB/go-autumn-logging"
+	"golang.org/x/sync/errgroup"
+)
+
+// Reference selects an archive or a directory of files in a bucket of an S3-compatible object storage.
+type Reference struct {
+	// Endpoint is the base URL of the object storage, e.g. 'https://s3.eu-central-1.amazonaws.com'.
+	Endpoint string `json:"endpoint"`
+	Bucket   string `json:"bucket"`
+	// Key selects a gzip-compressed tarball or zip archive, e.g. a packaged Helm chart.
+	Key string `json:"key,omitempty"`
+	// Prefix selects all objects below the directory, used if Key is not set. Either Key or Prefix is required.
+	Prefix string `json:"prefix,omitempty"`
+	// Path is the slash-separated directory relative to the archive root or the prefix. Without path, the root is
+	// selected, unless it contains no marker file but a single directory, like packaged Helm charts do.
+	Path string `json:"path,omitempty"`
+}
+
+// extractionLimits cap the content of archives and directories, which is held in memory as a whole.
+var extractionLimits = limit.Limits{
+	MaxEntries: 10000,
+	MaxSize:    256 << 20,
+}
+
+type ObjectStorage interface {
+	HeadObject(ctx context.Context, endpoint string, bucket string, key string) (string, error)
+
+	GetObject(ctx context.Context, endpoint string, bucket string, key string) ([]byte, string, error)
+
+	ListObjects(ctx context.Context, endpoint string, bucket string, prefix string) ([]s3.Object, error)
+}
+
+// Source loads archives and directories from buckets. Content is cached by the ETags of the objects, so changed
+// objects are picked up with the next retrieval.
+type Source struct {
+	objectStorage   ObjectStorage
+	cache           aucache.Cache[[]byte]
+	fileSystemCache *cache.FileSystemCache
+}
+
+func NewSource(
+	objectStorage ObjectStorage, cache aucache.Cache[[]byte], fileSystemCache *cache.FileSystemCache,
+) *Source {
+	return &Source{
+		objectStorage:   objectStorage,
+		cache:           cache,
+		fileSystemCache: fileSystemCache,
+	}
+}
+
+// RetrieveFileSystem returns the extracted archive or directory and the path of the selected directory within it.
+// The file system is shared with other requests for the same content and must not be mutated, wrap it with
+// filesystem.NewOverlay instead.
+func (s *Source) RetrieveFileSystem(
+	ctx context.Context, reference Reference, markers ...string,
+) (*filesystem.FileSystem, string, error) {
+	if reference.Endpoint == "" || reference.Bucket == "" {
+		return nil, "", NewReferenceInvalidError("endpoint and bucket are required")
+	}
+	if reference.Key == "" && strings.Trim(reference.Prefix, "/") == "" {
+		return nil, "", NewReferenceInvalidError("key or prefix is required")
+	}
+	selectedPath := path.Clean(reference.Path)
+	if path.IsAbs(selectedPath) || selectedPath == ".." || strings.HasPrefix(selectedPath, "../") {
+		return nil, "", NewReferenceInvalidError(fmt.Sprintf("path '%s' is not relative", reference.Path))
+	}
+
+	var fileSystem *filesystem.FileSystem
+	var err error
+	if reference.Key != "" {
+		fileSystem, err = s.retrieveArchive(ctx, reference)
+	} else {
+		fileSystem, err = s.retrieveDirectory(ctx, reference)
+	}
+	if errors.As(err, new(*s3.EndpointNotAllowedError)) {
+		return nil, "", NewReferenceInvalidError(err.Error())
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if reference.Path == "" {
+		return fileSystem, archive.Root(fileSystem, fileSystem.Root, markers...), nil
+	}
+	targetPath := fileSystem.Join(fileSystem.Root, selectedPath)
+	if !fileSystem.IsDir(targetPath) {
+		return nil, "", NewReferenceInvalidError(fmt.Sprintf("path '%s' is no directory", reference.Path))
+	}
+	return fileSystem, targetPath, nil
+}
+
+func (s *Source) retrieveArchive(ctx context.Context, reference Reference) (*filesystem.FileSystem, error) {
+	etag, err := s.objectStorage.HeadObject(ctx, reference.Endpoint, reference.Bucket, reference.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("%s|%s", objectURL(reference.Endpoint, reference.Bucket, reference.Key), etag)
+	return s.fileSystemCache.Retrieve(ctx, key, func(ctx context.Context, fileSystem *filesystem.FileSystem) error {
+		content, innerErr := s.retrieve(ctx, key, func() ([]byte, error) {
+			data, _, getErr := s.objectStorage.GetObject(ctx, reference.Endpoint, reference.Bucket, reference.Key)
+			return data, getErr
+		})
+		if innerErr != nil {
+			return innerErr
+		}
+		innerErr = archive.ExtractWithLimits(ctx, fileSystem, content, fileSystem.Root, extractionLimits)
+		if innerErr != nil {
+			return NewReferenceInvalidError(fmt.Sprintf("s3 object '%s' is no valid archive: %v", reference.Key, innerErr))
+		}
+		return nil
+	})
+}
+
+// retrieveDirectory downloads all objects below the prefix. The listing is cached as a tarball, keyed by the keys
+// and ETags of all listed objects. Listings exceeding the extraction limits are rejected before downloading.
+func (s *Source) retrieveDirectory(ctx context.Context, reference Reference) (*filesystem.FileSystem, error) {
+	prefix := strings.TrimPrefix(reference.Prefix, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	objects, err := s.objectStorage.ListObjects(ctx, reference.Endpoint, reference.Bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.New()
+	files := make(map[string]string)
+	size := int64(0)
+	for _, object := range objects {
+		// keys ending with a slash are directory markers created by some clients
+		if strings.HasSuffix(object.Key, "/") {
+			continue
+		}
+		size += object.Size
+		if len(files) >= extractionLimits.MaxEntries || size > extractionLimits.MaxSize {
+			return nil, NewReferenceInvalidError(fmt.Sprintf(
+				"prefix '%s' selects more than %d objects or %d bytes", prefix,
+				extractionLimits.MaxEntries, extractionLimits.MaxSize,
+			))
+		}
+		filePath := path.Clean(strings.TrimPrefix(object.Key, prefix))
+		if filePath == ".." || strings.HasPrefix(filePath, "../") || path.IsAbs(filePath) {
+			return nil, fmt.Errorf("failed to load s3 object '%s': key escapes prefix '%s'", object.Key, prefix)
+		}
+		files[object.Key] = filePath
+		_, _ = fmt.Fprintf(digest, "%s:%s\n", object.Key, object.ETag)
+	}
+	if len(files) == 0 {
+		return nil, s3.NewObjectNotFoundError(reference.Endpoint, reference.Bucket, prefix)
+	}
+
+	key := fmt.Sprintf("%s|sha256:%x", objectURL(reference.Endpoint, reference.Bucket, prefix), digest.Sum(nil))
+	return s.fileSystemCache.Retrieve(ctx, key, func(ctx context.Context, fileSystem *filesystem.FileSystem) error {
+		tarball, innerErr := s.retrieve(ctx, key, func() ([]byte, error) {
+			return s.downloadAsTarball(ctx, reference, files)
+		})
+		if innerErr != nil {
+			return innerErr
+		}
+		return targz.ExtractWithLimits(ctx, fileSystem, bytes.NewBuffer(tarball), fileSystem.Root, extractionLimits)
+	})
+}
+
+func (s *Source) downloadAsTarball(ctx context.Context, reference Reference, files map[string]string) ([]byte, error) {
+	fileSystem := filesystem.New()
+	contents := make(map[string][]byte, len(files))
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(8)
+	mutex := sync.Mutex{}
+	for objectKey := range files {
+		group.Go(func() error {
+			content, _, err := s.objectStorage.GetObject(groupCtx, reference.Endpoint, reference.Bucket, objectKey)
+			if err != nil {
+				return err
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			contents[objectKey] = content
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	for objectKey, filePath := range files {
+		targetPath := fileSystem.Join(fileSystem.Root, filePath)
+		if err := fileSystem.MkdirAll(fileSystem.Dir(targetPath)); err != nil {
+			return nil, err
+		}
+		if err := fileSystem.WriteFile(targetPath, contents[objectKey]); err != nil {
+			return nil, err
+		}
+	}
+
+	tarball := new(bytes.Buffer)
+	if err := targz.Compress(ctx, fileSystem, fileSystem.Root, "", tarball); err != nil {
+		return nil, err
+	}
+	return tarball.Bytes(), nil
+}
+
+func (s *Source) retrieve(ctx context.Context, key string, fetch func() ([]byte, error)) ([]byte, error) {
+	cached, err := s.cache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		aulogging.Logger.Ctx(ctx).Info().Printf("cache hit for s3 object with key '%s'", key)
+		return *cached, nil
+	}
+	aulogging.Logger.Ctx(ctx).Info().Printf("cache miss for s3 object with key '%s', retrieving from remote", key)
+
+	content, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	if err = s.cache.Set(ctx, key, content, 15*time.Minute); err != nil {
+		aulogging.Logger.Ctx(ctx).Warn().WithErr(err).Printf("failed to cache s3 object with key '%s'", key)
+	} else {
+		aulogging.Logger.Ctx(ctx).Info().Printf("successfully cached s3 object with key '%s'", key)
+	}
+	return content, nil
+}
+
+func objectURL(endpoint string, bucket string, key string) string {
+	return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(endpoint, "/"), bucket, key)
+}
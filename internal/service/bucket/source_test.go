@@ -0,0 +1,114 @@
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Roshick/manifest-maestro/internal/repository/s3"
+	"github.com/Roshick/manifest-maestro/internal/service/cache"
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+	"github.com/Roshick/manifest-maestro/pkg/targz"
+	"github.com/Roshick/manifest-maestro/test/mock/cachemock"
+	"github.com/Roshick/manifest-maestro/test/mock/s3mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tarball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	fileSystem := filesystem.New()
+	for name, content := range files {
+		filePath := fileSystem.Join(fileSystem.Root, name)
+		require.NoError(t, fileSystem.MkdirAll(fileSystem.Dir(filePath)))
+		require.NoError(t, fileSystem.WriteFile(filePath, []byte(content)))
+	}
+	buffer := new(bytes.Buffer)
+	require.NoError(t, targz.Compress(context.Background(), fileSystem, fileSystem.Root, "", buffer))
+	return buffer.Bytes()
+}
+
+func newTestSource(server *s3mock.Server, byteCache *cachemock.Cache[[]byte], fileSystemCache *cache.FileSystemCache) *Source {
+	objectStorage := s3.New(nil, []string{strings.TrimPrefix(server.URL, "http://")}, nil)
+	return NewSource(objectStorage, byteCache, fileSystemCache)
+}
+
+func TestSource_RetrieveFileSystem_Archive(t *testing.T) {
+	ctx := context.Background()
+	server := s3mock.New("")
+	defer server.Close()
+	server.PutObject("charts", "web-1.0.0.tgz", tarball(t, map[string]string{
+		"web/Chart.yaml":        "name: web\n",
+		"web/templates/cm.yaml": "kind: ConfigMap\n",
+	}))
+	source := newTestSource(server, cachemock.New[[]byte](), cache.NewFileSystemCache(1<<20))
+
+	reference := Reference{Endpoint: server.URL, Bucket: "charts", Key: "web-1.0.0.tgz"}
+	fileSystem, targetPath, err := source.RetrieveFileSystem(ctx, reference, "Chart.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "/web", targetPath)
+	assert.True(t, fileSystem.Exists("/web/templates/cm.yaml"))
+
+	_, _, err = source.RetrieveFileSystem(ctx, reference, "Chart.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), server.GetObjectCallCount.Load())
+
+	// a changed object has a different ETag and is retrieved again
+	server.PutObject("charts", "web-1.0.0.tgz", tarball(t, map[string]string{"web/Chart.yaml": "name: web\n"}))
+	fileSystem, _, err = source.RetrieveFileSystem(ctx, reference, "Chart.yaml")
+	require.NoError(t, err)
+	assert.False(t, fileSystem.Exists("/web/templates/cm.yaml"))
+	assert.Equal(t, int32(2), server.GetObjectCallCount.Load())
+}
+
+func TestSource_RetrieveFileSystem_Prefix(t *testing.T) {
+	ctx := context.Background()
+	server := s3mock.New("")
+	defer server.Close()
+	server.PutObject("manifests", "apps/", nil)
+	server.PutObject("manifests", "apps/overlays/dev/kustomization.yaml", []byte("resources:\n- ../../base\n"))
+	server.PutObject("manifests", "apps/base/deployment.yaml", []byte("kind: Deployment\n"))
+	server.PutObject("manifests", "apps-other/service.yaml", []byte("kind: Service\n"))
+	byteCache := cachemock.New[[]byte]()
+	source := newTestSource(server, byteCache, cache.NewFileSystemCache(0))
+
+	reference := Reference{Endpoint: server.URL, Bucket: "manifests", Prefix: "apps", Path: "overlays/dev"}
+	fileSystem, targetPath, err := source.RetrieveFileSystem(ctx, reference, "kustomization.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "/overlays/dev", targetPath)
+	assert.True(t, fileSystem.Exists("/base/deployment.yaml"))
+	assert.False(t, fileSystem.Exists("/service.yaml"))
+	assert.Equal(t, int32(2), server.GetObjectCallCount.Load())
+
+	// the file system cache is disabled, so the listing is extracted again from the byte cache
+	_, _, err = source.RetrieveFileSystem(ctx, reference, "kustomization.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), server.GetObjectCallCount.Load())
+}
+
+func TestSource_RetrieveFileSystem_Invalid(t *testing.T) {
+	ctx := context.Background()
+	server := s3mock.New("")
+	defer server.Close()
+	server.PutObject("manifests", "apps/kustomization.yaml", []byte("resources: []\n"))
+	source := newTestSource(server, cachemock.New[[]byte](), cache.NewFileSystemCache(0))
+
+	for _, reference := range []Reference{
+		{Bucket: "manifests", Prefix: "apps"},
+		{Endpoint: server.URL, Bucket: "manifests"},
+		{Endpoint: server.URL, Bucket: "manifests", Prefix: "/"},
+		{Endpoint: "http://169.254.169.254", Bucket: "manifests", Prefix: "apps"},
+		{Endpoint: server.URL, Bucket: "manifests", Prefix: "apps", Path: "../secrets"},
+		{Endpoint: server.URL, Bucket: "manifests", Prefix: "apps", Path: "missing"},
+	} {
+		_, _, err := source.RetrieveFileSystem(ctx, reference)
+		assert.ErrorAs(t, err, new(*ReferenceInvalidError), reference.Path)
+	}
+
+	_, _, err := source.RetrieveFileSystem(ctx, Reference{Endpoint: server.URL, Bucket: "manifests", Prefix: "missing"})
+	assert.ErrorAs(t, err, new(*s3.ObjectNotFoundError))
+
+	_, _, err = source.RetrieveFileSystem(ctx, Reference{Endpoint: server.URL, Bucket: "manifests", Key: "missing.tgz"})
+	assert.ErrorAs(t, err, new(*s3.ObjectNotFoundError))
+}
@@ -17,3 +17,56 @@ func NewInvalidHelmRepositoryURLError(repositoryURL string) *InvalidHelmReposito
 		repositoryURL: repositoryURL,
 	}
 }
+
+type InvalidHelmChartVersionError struct {
+	chartVersion string
+	reason       string
+}
+
+func (e *InvalidHelmChartVersionError) Error() string {
+	return fmt.Sprintf("Helm chart version '%s' is invalid: %s", e.chartVersion, e.reason)
+}
+
+func NewInvalidHelmChartVersionError(chartVersion string, reason string) *InvalidHelmChartVersionError {
+	return &InvalidHelmChartVersionError{
+		chartVersion: chartVersion,
+		reason:       reason,
+	}
+}
+
+type InvalidHelmChartURLError struct {
+	chartURL string
+}
+
+func (e *InvalidHelmChartURLError) Error() string {
+	return fmt.Sprintf("Helm chart URL '%s' is invalid", e.chartURL)
+}
+
+func NewInvalidHelmChartURLError(chartURL string) *InvalidHelmChartURLError {
+	return &InvalidHelmChartURLError{
+		chartURL: chartURL,
+	}
+}
+
+type HelmChartChecksumMismatchError struct {
+	chartURL         string
+	expectedChecksum string
+	actualChecksum   string
+}
+
+func (e *HelmChartChecksumMismatchError) Error() string {
+	return fmt.Sprintf("Helm chart '%s' has sha256 checksum '%s' instead of the expected '%s'",
+		e.chartURL, e.actualChecksum, e.expectedChecksum)
+}
+
+func NewHelmChartChecksumMismatchError(
+	chartURL string,
+	expectedChecksum string,
+	actualChecksum string,
+) *HelmChartChecksumMismatchError {
+	return &HelmChartChecksumMismatchError{
+		chartURL:         chartURL,
+		expectedChecksum: expectedChecksum,
+		actualChecksum:   actualChecksum,
+	}
+}
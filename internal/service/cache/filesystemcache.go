@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"os"
+	"sync"
+
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+	aulogging "github.com/StephanHCB/go-autumn-logging"
+	"golang.org/x/sync/singleflight"
+)
+
+// FileSystemCache keeps extracted file system trees in process memory, so they do not have to be extracted again
+// for every request. Cached trees are shared between requests and must never be mutated, callers are expected to
+// wrap them with filesystem.NewOverlay. Keys must identify immutable content, e.g. a commit hash or a digest. Least
+// recently used trees are evicted once the total size of all cached trees exceeds the size limit, a size limit of
+// zero disables caching.
+type FileSystemCache struct {
+	sizeLimit int64
+
+	mutex   sync.Mutex
+	size    int64
+	entries map[string]*list.Element
+	usage   *list.List
+
+	group singleflight.Group
+}
+
+type fileSystemCacheEntry struct {
+	key        string
+	fileSystem *filesystem.FileSystem
+	size       int64
+}
+
+func NewFileSystemCache(sizeLimit int64) *FileSystemCache {
+	return &FileSystemCache{
+		sizeLimit: sizeLimit,
+		entries:   make(map[string]*list.Element),
+		usage:     list.New(),
+	}
+}
+
+// Retrieve returns the cached tree for the given key. On a cache miss, the tree is populated by the given function
+// on a fresh file system. Concurrent misses for the same key populate the tree only once, with a context that is not
+// canceled along with the context of the caller that happens to populate it.
+func (c *FileSystemCache) Retrieve(
+	ctx context.Context,
+	key string,
+	populate func(context.Context, *filesystem.FileSystem) error,
+) (*filesystem.FileSystem, error) {
+	if fileSystem := c.get(key); fileSystem != nil {
+		aulogging.Logger.Ctx(ctx).Debug().Printf("cache hit for file system with key '%s'", key)
+		return fileSystem, nil
+	}
+
+	result, err, _ := c.group.Do(key, func() (any, error) {
+		if fileSystem := c.get(key); fileSystem != nil {
+			return fileSystem, nil
+		}
+
+		// the tree is shared with concurrent callers, which must not fail if this caller gives up
+		fileSystem := filesystem.New()
+		if err := populate(context.WithoutCancel(ctx), fileSystem); err != nil {
+			return nil, err
+		}
+		if c.sizeLimit <= 0 {
+			return fileSystem, nil
+		}
+		size, err := c.sizeOf(fileSystem)
+		if err != nil {
+			return nil, err
+		}
+		c.set(ctx, key, fileSystem, size)
+		return fileSystem, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*filesystem.FileSystem), nil
+}
+
+// add caches the tree under a further key. Every key accounts for the size of the tree.
+func (c *FileSystemCache) add(ctx context.Context, key string, fileSystem *filesystem.FileSystem) {
+	if c.sizeLimit <= 0 {
+		return
+	}
+	size, err := c.sizeOf(fileSystem)
+	if err != nil {
+		aulogging.Logger.Ctx(ctx).Warn().WithErr(err).Printf("failed to determine size of file system with key '%s'", key)
+		return
+	}
+	c.set(ctx, key, fileSystem, size)
+}
+
+func (c *FileSystemCache) get(key string) *filesystem.FileSystem {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.usage.MoveToFront(element)
+	return element.Value.(*fileSystemCacheEntry).fileSystem
+}
+
+func (c *FileSystemCache) set(ctx context.Context, key string, fileSystem *filesystem.FileSystem, size int64) {
+	if size > c.sizeLimit {
+		aulogging.Logger.Ctx(ctx).Info().Printf(
+			"file system with key '%s' exceeds cache size limit (%d > %d bytes), not caching", key, size, c.sizeLimit)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+	for c.size+size > c.sizeLimit {
+		oldest := c.usage.Back()
+		entry := c.usage.Remove(oldest).(*fileSystemCacheEntry)
+		delete(c.entries, entry.key)
+		c.size -= entry.size
+		aulogging.Logger.Ctx(ctx).Debug().Printf("evicted file system with key '%s' from cache", entry.key)
+	}
+	c.entries[key] = c.usage.PushFront(&fileSystemCacheEntry{
+		key:        key,
+		fileSystem: fileSystem,
+		size:       size,
+	})
+	c.size += size
+}
+
+// sizeOf approximates the memory held by a tree as the sum of its file sizes and path lengths.
+func (c *FileSystemCache) sizeOf(fileSystem *filesystem.FileSystem) (int64, error) {
+	size := int64(0)
+	err := fileSystem.Walk(fileSystem.Root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		size += int64(len(path))
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
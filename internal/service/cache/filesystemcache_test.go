@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func populateWith(calls *atomic.Int32, content string) func(context.Context, *filesystem.FileSystem) error {
+	return func(_ context.Context, fileSystem *filesystem.FileSystem) error {
+		calls.Add(1)
+		return fileSystem.WriteFile(fileSystem.Join(fileSystem.Root, "file.txt"), []byte(content))
+	}
+}
+
+func TestFileSystemCache_Retrieve_CacheHit(t *testing.T) {
+	ctx := context.Background()
+	fileSystemCache := NewFileSystemCache(1024)
+
+	var calls atomic.Int32
+	first, err := fileSystemCache.Retrieve(ctx, "key", populateWith(&calls, "content"))
+	require.NoError(t, err)
+	second, err := fileSystemCache.Retrieve(ctx, "key", populateWith(&calls, "other content"))
+	require.NoError(t, err)
+
+	assert.Same(t, first, second)
+	assert.Equal(t, int32(1), calls.Load())
+	content, err := second.ReadFile("/file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+}
+
+func TestFileSystemCache_Retrieve_PopulateError(t *testing.T) {
+	ctx := context.Background()
+	fileSystemCache := NewFileSystemCache(1024)
+
+	_, err := fileSystemCache.Retrieve(ctx, "key", func(_ context.Context, _ *filesystem.FileSystem) error {
+		return errors.New("failed")
+	})
+	assert.Error(t, err)
+
+	var calls atomic.Int32
+	_, err = fileSystemCache.Retrieve(ctx, "key", populateWith(&calls, "content"))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), calls.Load(), "failed populations should not be cached")
+}
+
+func TestFileSystemCache_Retrieve_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	// each tree holds 100 bytes of content plus the lengths of "/" and "/file.txt"
+	fileSystemCache := NewFileSystemCache(250)
+	content := string(make([]byte, 100))
+
+	var calls atomic.Int32
+	_, err := fileSystemCache.Retrieve(ctx, "first", populateWith(&calls, content))
+	require.NoError(t, err)
+	_, err = fileSystemCache.Retrieve(ctx, "second", populateWith(&calls, content))
+	require.NoError(t, err)
+	// mark first as recently used, so second is evicted next
+	_, err = fileSystemCache.Retrieve(ctx, "first", populateWith(&calls, content))
+	require.NoError(t, err)
+	_, err = fileSystemCache.Retrieve(ctx, "third", populateWith(&calls, content))
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), calls.Load())
+
+	_, err = fileSystemCache.Retrieve(ctx, "first", populateWith(&calls, content))
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), calls.Load(), "first should still be cached")
+
+	_, err = fileSystemCache.Retrieve(ctx, "second", populateWith(&calls, content))
+	require.NoError(t, err)
+	assert.Equal(t, int32(4), calls.Load(), "second should have been evicted")
+}
+
+func TestFileSystemCache_Retrieve_Disabled(t *testing.T) {
+	ctx := context.Background()
+	fileSystemCache := NewFileSystemCache(0)
+
+	var calls atomic.Int32
+	first, err := fileSystemCache.Retrieve(ctx, "key", populateWith(&calls, "content"))
+	require.NoError(t, err)
+	second, err := fileSystemCache.Retrieve(ctx, "key", populateWith(&calls, "content"))
+	require.NoError(t, err)
+
+	assert.NotSame(t, first, second)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestFileSystemCache_Retrieve_ConcurrentMissesPopulateOnce(t *testing.T) {
+	ctx := context.Background()
+	fileSystemCache := NewFileSystemCache(1024)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	populate := func(ctx context.Context, fileSystem *filesystem.FileSystem) error {
+		<-release
+		return populateWith(&calls, "content")(ctx, fileSystem)
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*filesystem.FileSystem, 10)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fileSystem, err := fileSystemCache.Retrieve(ctx, "key", populate)
+			assert.NoError(t, err)
+			results[i] = fileSystem
+		}()
+	}
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	for _, result := range results {
+		assert.Same(t, results[0], result)
+	}
+}
+
+func TestFileSystemCache_Retrieve_CanceledCallerDoesNotFailWaiters(t *testing.T) {
+	fileSystemCache := NewFileSystemCache(1024)
+	firstCtx, cancel := context.WithCancel(context.Background())
+
+	started := make(chan struct{})
+	proceed := make(chan struct{})
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := fileSystemCache.Retrieve(firstCtx, "key", func(ctx context.Context, fileSystem *filesystem.FileSystem) error {
+			close(started)
+			<-proceed
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return fileSystem.WriteFile(fileSystem.Join(fileSystem.Root, "file.txt"), []byte("content"))
+		})
+		firstErr <- err
+	}()
+	<-started
+
+	var calls atomic.Int32
+	secondResult := make(chan error, 1)
+	go func() {
+		_, err := fileSystemCache.Retrieve(context.Background(), "key", populateWith(&calls, "other content"))
+		secondResult <- err
+	}()
+	cancel()
+	close(proceed)
+
+	assert.NoError(t, <-firstErr)
+	assert.NoError(t, <-secondResult)
+}
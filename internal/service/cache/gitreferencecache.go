@@ -0,0 +1,166 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Roshick/go-autumn-synchronisation/pkg/cache"
+	"github.com/Roshick/manifest-maestro/internal/credentials"
+	aulogging "github.com/StephanHCB/go-autumn-logging"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"golang.org/x/sync/singleflight"
+)
+
+// GitReferenceCache caches the references advertised by remote repositories for a short time, so repeated
+// resolutions of the same branch or tag do not list the references of the remote every time. Concurrent misses for
+// the same repository list the references only once. Entries are shared via the cache backend and can be invalidated
+// before they expire, e.g. after a push. A ttl of zero disables caching.
+type GitReferenceCache struct {
+	cache cache.Cache[[]byte]
+	ttl   time.Duration
+	now   func() time.Time
+
+	group singleflight.Group
+}
+
+type gitReferenceCacheEntry struct {
+	// ExpiresAt is checked on retrieval, as not all cache backends expire entries on their own.
+	ExpiresAt  time.Time                `json:"expiresAt"`
+	References []gitReferenceCacheValue `json:"references"`
+}
+
+type gitReferenceCacheValue struct {
+	Name   string `json:"name"`
+	Hash   string `json:"hash,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
+func NewGitReferenceCache(cache cache.Cache[[]byte], ttl time.Duration) *GitReferenceCache {
+	return &GitReferenceCache{
+		cache: cache,
+		ttl:   ttl,
+		now:   time.Now,
+	}
+}
+
+func (c *GitReferenceCache) RetrieveReferences(
+	ctx context.Context,
+	repositoryURL string,
+	list func(context.Context) ([]*plumbing.Reference, error),
+) ([]*plumbing.Reference, error) {
+	if c.ttl <= 0 {
+		return list(ctx)
+	}
+
+	key := gitReferenceCacheKey(ctx, repositoryURL)
+	if references := c.get(ctx, key); references != nil {
+		aulogging.Logger.Ctx(ctx).Debug().Printf("cache hit for git references with key '%s'", key)
+		return references, nil
+	}
+
+	result, err, _ := c.group.Do(key, func() (any, error) {
+		if references := c.get(ctx, key); references != nil {
+			return references, nil
+		}
+		aulogging.Logger.Ctx(ctx).Debug().Printf("cache miss for git references with key '%s', listing remote", key)
+
+		// the listing is shared with concurrent callers, which must not fail if this caller gives up
+		references, err := list(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		c.set(ctx, key, references)
+		return references, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]*plumbing.Reference), nil
+}
+
+// Invalidate removes the cached references of the repository, so the next resolution lists them again.
+func (c *GitReferenceCache) Invalidate(ctx context.Context, repositoryURL string) error {
+	key := gitReferenceCacheKey(ctx, repositoryURL)
+	c.group.Forget(key)
+	if err := c.cache.Remove(ctx, key); err != nil {
+		return fmt.Errorf("failed to invalidate git references with key '%s': %w", key, err)
+	}
+	aulogging.Logger.Ctx(ctx).Info().Printf("invalidated git references with key '%s'", key)
+	return nil
+}
+
+func (c *GitReferenceCache) get(ctx context.Context, key string) []*plumbing.Reference {
+	cached, err := c.cache.Get(ctx, key)
+	if err != nil {
+		aulogging.Logger.Ctx(ctx).Warn().WithErr(err).Printf("failed to read git references with key '%s'", key)
+		return nil
+	}
+	if cached == nil {
+		return nil
+	}
+	entry := gitReferenceCacheEntry{}
+	if err = json.Unmarshal(*cached, &entry); err != nil {
+		aulogging.Logger.Ctx(ctx).Warn().WithErr(err).Printf("failed to decode git references with key '%s'", key)
+		return nil
+	}
+	if !c.now().Before(entry.ExpiresAt) {
+		return nil
+	}
+
+	references := make([]*plumbing.Reference, 0, len(entry.References))
+	for _, value := range entry.References {
+		if value.Target != "" {
+			references = append(references, plumbing.NewSymbolicReference(
+				plumbing.ReferenceName(value.Name), plumbing.ReferenceName(value.Target)))
+		} else {
+			references = append(references, plumbing.NewHashReference(
+				plumbing.ReferenceName(value.Name), plumbing.NewHash(value.Hash)))
+		}
+	}
+	return references
+}
+
+func (c *GitReferenceCache) set(ctx context.Context, key string, references []*plumbing.Reference) {
+	entry := gitReferenceCacheEntry{
+		ExpiresAt:  c.now().Add(c.ttl),
+		References: make([]gitReferenceCacheValue, 0, len(references)),
+	}
+	for _, reference := range references {
+		value := gitReferenceCacheValue{Name: reference.Name().String()}
+		if reference.Type() == plumbing.SymbolicReference {
+			value.Target = reference.Target().String()
+		} else {
+			value.Hash = reference.Hash().String()
+		}
+		entry.References = append(entry.References, value)
+	}
+
+	data, err := json.Marshal(entry)
+	if err == nil {
+		err = c.cache.Set(ctx, key, data, c.ttl)
+	}
+	if err != nil {
+		aulogging.Logger.Ctx(ctx).Warn().WithErr(err).Printf("failed to cache git references with key '%s'", key)
+	}
+}
+
+// gitReferenceCacheKey identifies a repository by gitRepositoryKey. References listed with request credentials are
+// partitioned.
+func gitReferenceCacheKey(ctx context.Context, repositoryURL string) string {
+	return credentials.GitCacheKey(ctx, repositoryURL, gitRepositoryKey(repositoryURL))
+}
+
+// gitRepositoryKey identifies a repository by host and path, so the different URLs of a repository, e.g. with or
+// without the '.git' suffix or via SSH, share their cached content.
+func gitRepositoryKey(repositoryURL string) string {
+	endpoint, err := transport.NewEndpoint(repositoryURL)
+	if err != nil || endpoint.Host == "" {
+		return repositoryURL
+	}
+	repositoryPath := strings.TrimSuffix(strings.Trim(endpoint.Path, "/"), ".git")
+	return fmt.Sprintf("%s/%s", strings.ToLower(endpoint.Host), repositoryPath)
+}
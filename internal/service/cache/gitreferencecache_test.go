@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Roshick/manifest-maestro/test/mock/cachemock"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testReferences() []*plumbing.Reference {
+	return []*plumbing.Reference{
+		plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/main"),
+		plumbing.NewHashReference("refs/heads/main", plumbing.NewHash("1111111111111111111111111111111111111111")),
+		plumbing.NewHashReference("refs/tags/v1.0.0", plumbing.NewHash("2222222222222222222222222222222222222222")),
+	}
+}
+
+func countingList(calls *atomic.Int32) func(context.Context) ([]*plumbing.Reference, error) {
+	return func(context.Context) ([]*plumbing.Reference, error) {
+		calls.Add(1)
+		return testReferences(), nil
+	}
+}
+
+func TestGitReferenceCache_RetrieveReferences(t *testing.T) {
+	ctx := context.Background()
+	referenceCache := NewGitReferenceCache(cachemock.New[[]byte](), time.Minute)
+	var calls atomic.Int32
+
+	references, err := referenceCache.RetrieveReferences(ctx, "https://example.com/org/repo.git", countingList(&calls))
+	require.NoError(t, err)
+	assert.Equal(t, testReferences(), references)
+
+	// equivalent urls share the cached references
+	for _, repositoryURL := range []string{
+		"https://example.com/org/repo.git", "https://EXAMPLE.com/org/repo", "ssh://git@example.com/org/repo.git",
+	} {
+		references, err = referenceCache.RetrieveReferences(ctx, repositoryURL, countingList(&calls))
+		require.NoError(t, err)
+		assert.Equal(t, testReferences(), references)
+	}
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestGitReferenceCache_RetrieveReferences_Expiry(t *testing.T) {
+	ctx := context.Background()
+	referenceCache := NewGitReferenceCache(cachemock.New[[]byte](), time.Minute)
+	now := time.Now()
+	referenceCache.now = func() time.Time { return now }
+	var calls atomic.Int32
+
+	_, err := referenceCache.RetrieveReferences(ctx, "https://example.com/org/repo.git", countingList(&calls))
+	require.NoError(t, err)
+	now = now.Add(59 * time.Second)
+	_, err = referenceCache.RetrieveReferences(ctx, "https://example.com/org/repo.git", countingList(&calls))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), calls.Load())
+
+	now = now.Add(time.Second)
+	_, err = referenceCache.RetrieveReferences(ctx, "https://example.com/org/repo.git", countingList(&calls))
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestGitReferenceCache_Invalidate(t *testing.T) {
+	ctx := context.Background()
+	referenceCache := NewGitReferenceCache(cachemock.New[[]byte](), time.Minute)
+	var calls atomic.Int32
+
+	_, err := referenceCache.RetrieveReferences(ctx, "https://example.com/org/repo.git", countingList(&calls))
+	require.NoError(t, err)
+	require.NoError(t, referenceCache.Invalidate(ctx, "https://example.com/org/repo"))
+	_, err = referenceCache.RetrieveReferences(ctx, "https://example.com/org/repo.git", countingList(&calls))
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestGitReferenceCache_RetrieveReferences_SingleFlight(t *testing.T) {
+	ctx := context.Background()
+	referenceCache := NewGitReferenceCache(cachemock.New[[]byte](), time.Minute)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	list := func(context.Context) ([]*plumbing.Reference, error) {
+		calls.Add(1)
+		<-release
+		return testReferences(), nil
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			references, err := referenceCache.RetrieveReferences(ctx, "https://example.com/org/repo.git", list)
+			assert.NoError(t, err)
+			assert.Len(t, references, 3)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestGitReferenceCache_RetrieveReferences_Errors(t *testing.T) {
+	ctx := context.Background()
+	referenceCache := NewGitReferenceCache(cachemock.New[[]byte](), time.Minute)
+	var calls atomic.Int32
+	failingList := func(context.Context) ([]*plumbing.Reference, error) {
+		calls.Add(1)
+		return nil, errors.New("remote unavailable")
+	}
+
+	for range 2 {
+		_, err := referenceCache.RetrieveReferences(ctx, "https://example.com/org/repo.git", failingList)
+		assert.Error(t, err)
+	}
+	// errors are not cached
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestGitReferenceCache_RetrieveReferences_Disabled(t *testing.T) {
+	ctx := context.Background()
+	referenceCache := NewGitReferenceCache(cachemock.New[[]byte](), 0)
+	var calls atomic.Int32
+
+	for range 2 {
+		_, err := referenceCache.RetrieveReferences(ctx, "https://example.com/org/repo.git", countingList(&calls))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), calls.Load())
+}
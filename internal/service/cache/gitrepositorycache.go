@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/Roshick/manifest-maestro/pkg/filesystem"
@@ -11,24 +13,47 @@ import (
 	"github.com/go-git/go-git/v5"
 
 	"github.com/Roshick/go-autumn-synchronisation/pkg/cache"
+	"github.com/Roshick/manifest-maestro/internal/credentials"
 	aulogging "github.com/StephanHCB/go-autumn-logging"
 )
 
 type Git interface {
 	CloneCommit(context.Context, string, string) (*git.Repository, error)
 
+	ClonePaths(ctx context.Context, repositoryURL string, commitHash string, paths []string) (*git.Repository, error)
+
 	ToHash(ctx context.Context, repositoryURL string, gitReference string) (string, error)
 }
 
+// GitArchive downloads repositories as tarballs without cloning them. Repositories it does not support are
+// reported with false.
+type GitArchive interface {
+	Supports(ctx context.Context, repositoryURL string) (bool, error)
+
+	DownloadTarball(ctx context.Context, repositoryURL string, commitHash string) ([]byte, error)
+}
+
 type GitRepositoryCache struct {
-	git   Git
-	cache cache.Cache[[]byte]
+	git             Git
+	archive         GitArchive
+	cache           cache.Cache[[]byte]
+	fileSystemCache *FileSystemCache
+	sparseFetch     bool
 }
 
-func NewGitRepositoryCache(git Git, cache cache.Cache[[]byte]) *GitRepositoryCache {
+// NewGitRepositoryCache creates a cache of repository tarballs. Whole repositories are downloaded via the archive
+// if it supports them, and cloned otherwise; archive may be nil. Archives and clones differ in content, so they are
+// cached under different keys. With sparseFetch, subtrees of a repository are
+// fetched and cached on their own, instead of fetching and caching the whole repository once per commit.
+func NewGitRepositoryCache(
+	git Git, archive GitArchive, cache cache.Cache[[]byte], fileSystemCache *FileSystemCache, sparseFetch bool,
+) *GitRepositoryCache {
 	return &GitRepositoryCache{
-		git:   git,
-		cache: cache,
+		git:             git,
+		archive:         archive,
+		cache:           cache,
+		fileSystemCache: fileSystemCache,
+		sparseFetch:     sparseFetch,
 	}
 }
 
@@ -39,8 +64,23 @@ func (c *GitRepositoryCache) RetrieveRepository(
 	if err != nil {
 		return nil, err
 	}
+	return c.retrieveRepository(ctx, repositoryURL, commitHash)
+}
 
-	key := c.cacheKey(repositoryURL, commitHash)
+// PrefetchRepository caches the whole repository at the commit, unless it is cached already. Subtrees fetched on
+// their own with sparseFetch are not prefetched.
+func (c *GitRepositoryCache) PrefetchRepository(ctx context.Context, repositoryURL string, commitHash string) error {
+	_, err := c.retrieveRepository(ctx, repositoryURL, commitHash)
+	return err
+}
+
+func (c *GitRepositoryCache) retrieveRepository(
+	ctx context.Context, repositoryURL string, commitHash string,
+) ([]byte, error) {
+	key, archived, err := c.repositoryCacheKey(ctx, repositoryURL, commitHash)
+	if err != nil {
+		return nil, err
+	}
 	cached, err := c.cache.Get(ctx, key)
 	if err != nil {
 		return nil, err
@@ -50,7 +90,7 @@ func (c *GitRepositoryCache) RetrieveRepository(
 		return *cached, nil
 	}
 	aulogging.Logger.Ctx(ctx).Info().Printf("cache miss for git repository with key '%s', retrieving from remote", key)
-	return c.refreshRepository(ctx, repositoryURL, commitHash)
+	return c.refreshRepository(ctx, repositoryURL, commitHash, key, archived)
 }
 
 func (c *GitRepositoryCache) RetrieveRepositoryToFileSystem(
@@ -66,14 +106,191 @@ func (c *GitRepositoryCache) RetrieveRepositoryToFileSystem(
 	return nil
 }
 
+// RetrieveRepositoryFileSystem returns the extracted repository. The file system is shared with other requests
+// for the same commit and must not be mutated, wrap it with filesystem.NewOverlay instead.
+func (c *GitRepositoryCache) RetrieveRepositoryFileSystem(
+	ctx context.Context, repositoryURL string, gitReference string,
+) (*filesystem.FileSystem, error) {
+	commitHash, err := c.git.ToHash(ctx, repositoryURL, gitReference)
+	if err != nil {
+		return nil, err
+	}
+
+	key, _, err := c.repositoryCacheKey(ctx, repositoryURL, commitHash)
+	if err != nil {
+		return nil, err
+	}
+	return c.fileSystemCache.Retrieve(ctx, key, func(ctx context.Context, fileSystem *filesystem.FileSystem) error {
+		tarball, innerErr := c.retrieveRepository(ctx, repositoryURL, commitHash)
+		if innerErr != nil {
+			return innerErr
+		}
+		return targz.Extract(ctx, fileSystem, bytes.NewBuffer(tarball), fileSystem.Root)
+	})
+}
+
+// RetrieveRepositorySubtreeFileSystem returns the repository with only the given slash-separated paths extracted,
+// relative to the repository root. After each extraction, scan reports all paths the extracted files depend on,
+// e.g. sibling directories they reference. Paths not extracted yet are extracted into the same file system, until
+// scan reports no further paths. The resulting tree is cached under both the requested and the final paths, so
+// later requests skip the scan rounds. Like RetrieveRepositoryFileSystem, the file system is shared and must not be
+// mutated.
+func (c *GitRepositoryCache) RetrieveRepositorySubtreeFileSystem(
+	ctx context.Context, repositoryURL string, gitReference string, paths []string, scan PathScan,
+) (*filesystem.FileSystem, error) {
+	commitHash, err := c.git.ToHash(ctx, repositoryURL, gitReference)
+	if err != nil {
+		return nil, err
+	}
+
+	// trees cached under the requested paths may contain the paths their scan added, which are cached on their own
+	paths = NormalizePaths(paths)
+	for {
+		fileSystem := c.fileSystemCache.get(c.subtreeCacheKey(ctx, repositoryURL, commitHash, paths))
+		if fileSystem == nil {
+			break
+		}
+		if scan == nil {
+			return fileSystem, nil
+		}
+		extendedPaths, innerErr := extendPaths(fileSystem, paths, scan)
+		if innerErr != nil {
+			return nil, innerErr
+		}
+		if slices.Equal(paths, extendedPaths) {
+			return fileSystem, nil
+		}
+		paths = extendedPaths
+	}
+
+	var finalPaths []string
+	key := c.subtreeCacheKey(ctx, repositoryURL, commitHash, paths)
+	fileSystem, err := c.fileSystemCache.Retrieve(ctx, key, func(ctx context.Context, fileSystem *filesystem.FileSystem) error {
+		var extractErr error
+		finalPaths, extractErr = c.extractSubtree(ctx, repositoryURL, commitHash, paths, scan, fileSystem)
+		return extractErr
+	})
+	if err != nil {
+		return nil, err
+	}
+	if finalPaths != nil && !slices.Equal(paths, finalPaths) {
+		c.fileSystemCache.add(ctx, c.subtreeCacheKey(ctx, repositoryURL, commitHash, finalPaths), fileSystem)
+	}
+	return fileSystem, nil
+}
+
+// extractSubtree extracts the paths into the file system and, in further rounds, the paths scan adds, fetching only
+// the paths not extracted yet. It returns all extracted paths.
+func (c *GitRepositoryCache) extractSubtree(
+	ctx context.Context,
+	repositoryURL string,
+	commitHash string,
+	paths []string,
+	scan PathScan,
+	fileSystem *filesystem.FileSystem,
+) ([]string, error) {
+	var tarball []byte
+	var extractedPaths []string
+	for {
+		newPaths := uncoveredPaths(paths, extractedPaths)
+		switch {
+		case c.sparseFetch && extractedPaths == nil:
+			subtreeTarball, err := c.retrieveRepositorySubtree(ctx, repositoryURL, commitHash, paths)
+			if err != nil {
+				return nil, err
+			}
+			if err = targz.Extract(ctx, fileSystem, bytes.NewBuffer(subtreeTarball), fileSystem.Root); err != nil {
+				return nil, err
+			}
+		case c.sparseFetch:
+			// only the first round is cached, the paths added by scan are cached as part of the final tree
+			repo, err := c.git.ClonePaths(ctx, repositoryURL, commitHash, newPaths)
+			if err != nil {
+				return nil, err
+			}
+			subtreeTarball, err := c.compressWorktree(ctx, repo)
+			if err != nil {
+				return nil, err
+			}
+			if err = targz.Extract(ctx, fileSystem, bytes.NewBuffer(subtreeTarball), fileSystem.Root); err != nil {
+				return nil, err
+			}
+		default:
+			if tarball == nil {
+				var err error
+				if tarball, err = c.retrieveRepository(ctx, repositoryURL, commitHash); err != nil {
+					return nil, err
+				}
+			}
+			if err := targz.ExtractPaths(ctx, fileSystem, bytes.NewBuffer(tarball), fileSystem.Root, newPaths); err != nil {
+				return nil, err
+			}
+		}
+		extractedPaths = paths
+		if scan == nil {
+			return paths, nil
+		}
+
+		extendedPaths, err := extendPaths(fileSystem, paths, scan)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Equal(paths, extendedPaths) {
+			return paths, nil
+		}
+		aulogging.Logger.Ctx(ctx).Debug().Printf(
+			"extending extracted paths of git repository '%s' to %v", repositoryURL, extendedPaths)
+		paths = extendedPaths
+	}
+}
+
+func extendPaths(fileSystem *filesystem.FileSystem, paths []string, scan PathScan) ([]string, error) {
+	requiredPaths, err := scan(fileSystem)
+	if err != nil {
+		return nil, err
+	}
+	return NormalizePaths(append(slices.Clone(paths), requiredPaths...)), nil
+}
+
+func (c *GitRepositoryCache) retrieveRepositorySubtree(
+	ctx context.Context, repositoryURL string, commitHash string, paths []string,
+) ([]byte, error) {
+	key := c.subtreeCacheKey(ctx, repositoryURL, commitHash, paths)
+	cached, err := c.cache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		aulogging.Logger.Ctx(ctx).Info().Printf("cache hit for git repository with key '%s'", key)
+		return *cached, nil
+	}
+	aulogging.Logger.Ctx(ctx).Info().Printf("cache miss for git repository with key '%s', retrieving from remote", key)
+
+	repo, err := c.git.ClonePaths(ctx, repositoryURL, commitHash, paths)
+	if err != nil {
+		return nil, err
+	}
+	tarball, err := c.compressWorktree(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.cache.Set(ctx, key, tarball, 15*time.Minute); err != nil {
+		aulogging.Logger.Ctx(ctx).Warn().WithErr(err).Printf("failed to cache git repository with key '%s'", key)
+	} else {
+		aulogging.Logger.Ctx(ctx).Info().Printf("successfully cached git repository with key '%s'", key)
+	}
+	return tarball, nil
+}
+
 func (c *GitRepositoryCache) refreshRepository(
 	ctx context.Context,
 	repositoryURL string,
 	commitHash string,
+	key string,
+	archived bool,
 ) ([]byte, error) {
 
-	key := c.cacheKey(repositoryURL, commitHash)
-	tarball, err := c.fetchAsTarball(ctx, repositoryURL, commitHash)
+	tarball, err := c.fetchAsTarball(ctx, repositoryURL, commitHash, archived)
 	if err != nil {
 		return nil, err
 	}
@@ -86,16 +303,26 @@ func (c *GitRepositoryCache) refreshRepository(
 	return tarball, nil
 }
 
+// fetchAsTarball downloads the archive of the commit or compresses the worktree of the commit, including submodules
+// and LFS objects if Git resolves them. Failed downloads are not retried as clone, whose content would differ.
 func (c *GitRepositoryCache) fetchAsTarball(
 	ctx context.Context,
 	repositoryURL string,
 	commitHash string,
+	archived bool,
 ) ([]byte, error) {
+	if archived {
+		return c.archive.DownloadTarball(ctx, repositoryURL, commitHash)
+	}
+
 	repo, err := c.git.CloneCommit(ctx, repositoryURL, commitHash)
 	if err != nil {
 		return nil, err
 	}
+	return c.compressWorktree(ctx, repo)
+}
 
+func (c *GitRepositoryCache) compressWorktree(ctx context.Context, repo *git.Repository) ([]byte, error) {
 	tree, err := repo.Worktree()
 	if err != nil {
 		return nil, err
@@ -108,6 +335,33 @@ func (c *GitRepositoryCache) fetchAsTarball(
 	return repoBuffer.Bytes(), nil
 }
 
-func (c *GitRepositoryCache) cacheKey(repositoryURL string, gitReference string) string {
-	return fmt.Sprintf("%s|%s", repositoryURL, gitReference)
+func (c *GitRepositoryCache) subtreeCacheKey(
+	ctx context.Context, repositoryURL string, commitHash string, paths []string,
+) string {
+	return fmt.Sprintf("%s|%s", c.cacheKey(ctx, repositoryURL, commitHash), strings.Join(paths, ","))
+}
+
+// repositoryCacheKey returns the key of the whole repository and whether it is downloaded via the archive.
+func (c *GitRepositoryCache) repositoryCacheKey(
+	ctx context.Context, repositoryURL string, commitHash string,
+) (string, bool, error) {
+	key := c.cacheKey(ctx, repositoryURL, commitHash)
+	if c.archive == nil {
+		return key, false, nil
+	}
+	archived, err := c.archive.Supports(ctx, repositoryURL)
+	if err != nil {
+		return "", false, err
+	}
+	if archived {
+		return key + "|archive", true, nil
+	}
+	return key, false, nil
+}
+
+// cacheKey identifies the repository like the reference cache does, so commits cached for one URL of a repository,
+// e.g. prefetched for its clone URL, are served for all of its URLs. It is partitioned for checkouts with request credentials for any host, which includes
+// the submodules of the repository.
+func (c *GitRepositoryCache) cacheKey(ctx context.Context, repositoryURL string, gitReference string) string {
+	return credentials.GitCheckoutCacheKey(ctx, fmt.Sprintf("%s|%s", gitRepositoryKey(repositoryURL), gitReference))
 }
@@ -1,10 +1,13 @@
 package cache
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+	"github.com/Roshick/manifest-maestro/pkg/targz"
 	"github.com/Roshick/manifest-maestro/test/mock/cachemock"
 	"github.com/Roshick/manifest-maestro/test/mock/gitmock"
 	"github.com/go-git/go-git/v5"
@@ -24,7 +27,7 @@ func TestGitRepositoryCache_RetrieveRepository_CacheMiss(t *testing.T) {
 		})
 	cacheMock := cachemock.New[[]byte]()
 
-	gitRepoCache := NewGitRepositoryCache(gitMock, cacheMock)
+	gitRepoCache := NewGitRepositoryCache(gitMock, nil, cacheMock, NewFileSystemCache(0), false)
 
 	tarball, err := gitRepoCache.RetrieveRepository(ctx, "https://example.com/repo.git", "refs/heads/main")
 	require.NoError(t, err)
@@ -41,9 +44,9 @@ func TestGitRepositoryCache_RetrieveRepository_CacheHit(t *testing.T) {
 	cacheMock := cachemock.New[[]byte]()
 
 	// Pre-populate cache
-	_ = cacheMock.Set(ctx, "https://example.com/repo.git|abc123commithashthatisfortycharactersss", []byte("cached-tarball"), 0)
+	_ = cacheMock.Set(ctx, "example.com/repo|abc123commithashthatisfortycharactersss", []byte("cached-tarball"), 0)
 
-	gitRepoCache := NewGitRepositoryCache(gitMock, cacheMock)
+	gitRepoCache := NewGitRepositoryCache(gitMock, nil, cacheMock, NewFileSystemCache(0), false)
 
 	tarball, err := gitRepoCache.RetrieveRepository(ctx, "https://example.com/repo.git", "refs/heads/main")
 	require.NoError(t, err)
@@ -53,6 +56,27 @@ func TestGitRepositoryCache_RetrieveRepository_CacheHit(t *testing.T) {
 	assert.Equal(t, int32(0), gitMock.CloneCommitCallCount.Load(), "CloneCommit should not be called on cache hit")
 }
 
+func TestGitRepositoryCache_PrefetchRepository_ServedForAllRepositoryURLs(t *testing.T) {
+	ctx := context.Background()
+
+	gitMock := gitmock.NewMock().
+		WithToHash(func(_ context.Context, _ string, ref string) (string, error) {
+			return "abc123commithashthatisfortycharactersss", nil
+		}).
+		WithCloneCommit(func(_ context.Context, _ string, _ string) (*git.Repository, error) {
+			return gitmock.CreateRepoFromDir("../../../test/resources/mocks/git-repositories/test")
+		})
+	gitRepoCache := NewGitRepositoryCache(gitMock, nil, cachemock.New[[]byte](), NewFileSystemCache(0), false)
+
+	require.NoError(t, gitRepoCache.PrefetchRepository(
+		ctx, "https://example.com/org/repo.git", "abc123commithashthatisfortycharactersss"))
+	for _, repositoryURL := range []string{"https://example.com/org/repo", "git@example.com:org/repo.git"} {
+		_, err := gitRepoCache.RetrieveRepository(ctx, repositoryURL, "refs/heads/main")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), gitMock.CloneCommitCallCount.Load())
+}
+
 func TestGitRepositoryCache_RetrieveRepository_ToHashCalledOnce(t *testing.T) {
 	ctx := context.Background()
 
@@ -65,7 +89,7 @@ func TestGitRepositoryCache_RetrieveRepository_ToHashCalledOnce(t *testing.T) {
 		})
 	cacheMock := cachemock.New[[]byte]()
 
-	gitRepoCache := NewGitRepositoryCache(gitMock, cacheMock)
+	gitRepoCache := NewGitRepositoryCache(gitMock, nil, cacheMock, NewFileSystemCache(0), false)
 
 	_, err := gitRepoCache.RetrieveRepository(ctx, "https://example.com/repo.git", "refs/heads/main")
 	require.NoError(t, err)
@@ -88,7 +112,7 @@ func TestGitRepositoryCache_RetrieveRepositoryToFileSystem_ToHashCallCount(t *te
 		})
 	cacheMock := cachemock.New[[]byte]()
 
-	gitRepoCache := NewGitRepositoryCache(gitMock, cacheMock)
+	gitRepoCache := NewGitRepositoryCache(gitMock, nil, cacheMock, NewFileSystemCache(0), false)
 
 	fs := filesystem.New()
 	err := gitRepoCache.RetrieveRepositoryToFileSystem(ctx, "https://example.com/repo.git", "refs/heads/main", fs)
@@ -115,7 +139,7 @@ func TestGitRepositoryCache_RetrieveRepositoryToFileSystem_CacheHit(t *testing.T
 		})
 	cacheMock := cachemock.New[[]byte]()
 
-	gitRepoCache := NewGitRepositoryCache(gitMock, cacheMock)
+	gitRepoCache := NewGitRepositoryCache(gitMock, nil, cacheMock, NewFileSystemCache(0), false)
 
 	// First call: cache miss, should clone
 	fs1 := filesystem.New()
@@ -133,5 +157,192 @@ func TestGitRepositoryCache_RetrieveRepositoryToFileSystem_CacheHit(t *testing.T
 	assert.True(t, fs2.Exists(fs2.Join(fs2.Root, "Chart.yaml")), "Chart.yaml should exist in second filesystem")
 }
 
+func TestGitRepositoryCache_RetrieveRepositoryFileSystem_SharesExtractedTree(t *testing.T) {
+	ctx := context.Background()
+
+	gitMock := gitmock.NewMock().
+		WithToHash(func(_ context.Context, _ string, ref string) (string, error) {
+			return "abc123commithashthatisfortycharactersss", nil
+		}).
+		WithCloneCommit(func(_ context.Context, _ string, _ string) (*git.Repository, error) {
+			return gitmock.CreateRepoFromDir("../../../test/resources/mocks/git-repositories/test")
+		})
+	cacheMock := cachemock.New[[]byte]()
+
+	gitRepoCache := NewGitRepositoryCache(gitMock, nil, cacheMock, NewFileSystemCache(64<<20), false)
+
+	fs1, err := gitRepoCache.RetrieveRepositoryFileSystem(ctx, "https://example.com/repo.git", "refs/heads/main")
+	require.NoError(t, err)
+	assert.True(t, fs1.Exists(fs1.Join(fs1.Root, "Chart.yaml")), "Chart.yaml should exist in extracted filesystem")
+
+	fs2, err := gitRepoCache.RetrieveRepositoryFileSystem(ctx, "https://example.com/repo.git", "refs/tags/v1")
+	require.NoError(t, err)
+	assert.Same(t, fs1, fs2, "references resolving to the same commit should share the extracted tree")
+	assert.Equal(t, int32(1), gitMock.CloneCommitCallCount.Load())
+}
+
+func TestGitRepositoryCache_RetrieveRepositorySubtreeFileSystem_SparseFetch(t *testing.T) {
+	ctx := context.Background()
+
+	gitMock := gitmock.NewMock().
+		WithToHash(func(_ context.Context, _ string, ref string) (string, error) {
+			return "abc123commithashthatisfortycharactersss", nil
+		}).
+		WithCloneCommit(func(_ context.Context, _ string, _ string) (*git.Repository, error) {
+			return gitmock.CreateRepoFromDir("../../../test/resources/mocks/git-repositories/test")
+		})
+	cacheMock := cachemock.New[[]byte]()
+
+	gitRepoCache := NewGitRepositoryCache(gitMock, nil, cacheMock, NewFileSystemCache(64<<20), true)
+
+	fs, err := gitRepoCache.RetrieveRepositorySubtreeFileSystem(
+		ctx, "https://example.com/repo.git", "refs/heads/main", []string{"templates"}, nil,
+	)
+	require.NoError(t, err)
+	assert.True(t, fs.Exists(fs.Join(fs.Root, "templates")), "templates should be extracted")
+	assert.False(t, fs.Exists(fs.Join(fs.Root, "Chart.yaml")), "Chart.yaml should not be extracted")
+	assert.Equal(t, int32(1), gitMock.ClonePathsCallCount.Load())
+	assert.Equal(t, int32(0), gitMock.CloneCommitCallCount.Load(), "the whole repository should not be cloned")
+
+	cached, err := cacheMock.Get(ctx, "example.com/repo|abc123commithashthatisfortycharactersss|templates")
+	require.NoError(t, err)
+	assert.NotNil(t, cached, "the subtree should be cached under a key including its paths")
+}
+
+func TestGitRepositoryCache_RetrieveRepositorySubtreeFileSystem_ScanRounds(t *testing.T) {
+	ctx := context.Background()
+
+	var clonedPaths [][]string
+	gitMock := gitmock.NewMock().
+		WithToHash(func(_ context.Context, _ string, ref string) (string, error) {
+			return "abc123commithashthatisfortycharactersss", nil
+		}).
+		WithClonePaths(func(_ context.Context, _ string, _ string, paths []string) (*git.Repository, error) {
+			clonedPaths = append(clonedPaths, paths)
+			return gitmock.CreateRepoFromDir("../../../test/resources/mocks/git-repositories/test")
+		})
+	cacheMock := cachemock.New[[]byte]()
+	scans := 0
+	scan := func(_ *filesystem.FileSystem) ([]string, error) {
+		scans++
+		return []string{"Chart.yaml"}, nil
+	}
+
+	gitRepoCache := NewGitRepositoryCache(gitMock, nil, cacheMock, NewFileSystemCache(64<<20), true)
 
+	fs, err := gitRepoCache.RetrieveRepositorySubtreeFileSystem(
+		ctx, "https://example.com/repo.git", "refs/heads/main", []string{"templates"}, scan,
+	)
+	require.NoError(t, err)
+	assert.True(t, fs.Exists(fs.Join(fs.Root, "Chart.yaml")))
+	// the second round only fetches the path added by the scan into the same file system
+	assert.Equal(t, [][]string{{"templates"}, {"Chart.yaml"}}, clonedPaths)
+	keys, err := cacheMock.Keys(ctx)
+	require.NoError(t, err)
+	assert.Len(t, keys, 1, "only the first round should be cached as tarball")
 
+	scans = 0
+	cachedFS, err := gitRepoCache.RetrieveRepositorySubtreeFileSystem(
+		ctx, "https://example.com/repo.git", "refs/heads/main", []string{"templates"}, scan,
+	)
+	require.NoError(t, err)
+	assert.Same(t, fs, cachedFS)
+	assert.Len(t, clonedPaths, 2, "the extended tree should be served from the cache")
+	assert.Equal(t, 2, scans)
+}
+
+type fakeGitArchive struct {
+	tarball   []byte
+	supported bool
+	err       error
+}
+
+func (a *fakeGitArchive) Supports(_ context.Context, _ string) (bool, error) {
+	return a.supported, nil
+}
+
+func (a *fakeGitArchive) DownloadTarball(_ context.Context, _ string, _ string) ([]byte, error) {
+	return a.tarball, a.err
+}
+
+func TestGitRepositoryCache_RetrieveRepository_Archive(t *testing.T) {
+	testCases := []struct {
+		name           string
+		archive        *fakeGitArchive
+		expectedErr    bool
+		expectedClones int32
+	}{
+		{name: "downloaded", archive: &fakeGitArchive{tarball: []byte("archive-tarball"), supported: true}},
+		{name: "unsupported", archive: &fakeGitArchive{}, expectedClones: 1},
+		{name: "failed", archive: &fakeGitArchive{supported: true, err: errors.New("rate limited")}, expectedErr: true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			gitMock := gitmock.NewMock().
+				WithToHash(func(_ context.Context, _ string, ref string) (string, error) {
+					return "abc123commithashthatisfortycharactersss", nil
+				}).
+				WithCloneCommit(func(_ context.Context, _ string, _ string) (*git.Repository, error) {
+					return gitmock.CreateRepoFromDir("../../../test/resources/mocks/git-repositories/test")
+				})
+			gitRepoCache := NewGitRepositoryCache(
+				gitMock, testCase.archive, cachemock.New[[]byte](), NewFileSystemCache(0), false,
+			)
+
+			tarball, err := gitRepoCache.RetrieveRepository(ctx, "https://example.com/repo.git", "refs/heads/main")
+			switch {
+			case testCase.expectedErr:
+				require.Error(t, err, "failed downloads must not fall back to clones, whose content differs")
+			case testCase.expectedClones == 0:
+				require.NoError(t, err)
+				assert.Equal(t, []byte("archive-tarball"), tarball)
+			default:
+				require.NoError(t, err)
+				assert.NotEmpty(t, tarball)
+			}
+			assert.Equal(t, testCase.expectedClones, gitMock.CloneCommitCallCount.Load())
+		})
+	}
+}
+
+// GitHub applies the export-ignore and export-subst Git attributes to archives, a clone does not. The content of a
+// commit therefore depends on whether it was downloaded or cloned, so both are cached under different keys.
+func TestGitRepositoryCache_RetrieveRepositoryFileSystem_ArchiveAndCloneAreCachedSeparately(t *testing.T) {
+	archiveFileSystem := filesystem.New()
+	require.NoError(t, archiveFileSystem.WriteFile("/Chart.yaml", []byte("name: test\n")))
+	archiveTarball := new(bytes.Buffer)
+	require.NoError(t, targz.Compress(context.Background(), archiveFileSystem, "/", "", archiveTarball))
+
+	gitMock := gitmock.NewMock().
+		WithToHash(func(_ context.Context, _ string, _ string) (string, error) {
+			return "abc123commithashthatisfortycharactersss", nil
+		}).
+		WithCloneCommit(func(_ context.Context, _ string, _ string) (*git.Repository, error) {
+			return gitmock.CreateRepoFromDir("../../../test/resources/mocks/git-repositories/test")
+		})
+	byteCache := cachemock.New[[]byte]()
+	archive := &fakeGitArchive{tarball: archiveTarball.Bytes(), supported: true}
+
+	for _, testCase := range []struct {
+		name            string
+		archive         GitArchive
+		expectedIgnored bool
+	}{
+		{name: "downloaded", archive: archive},
+		{name: "cloned", expectedIgnored: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			gitRepoCache := NewGitRepositoryCache(gitMock, testCase.archive, byteCache, NewFileSystemCache(0), false)
+
+			fileSystem, err := gitRepoCache.RetrieveRepositoryFileSystem(
+				context.Background(), "https://example.com/repo.git", "refs/heads/main")
+			require.NoError(t, err)
+			assert.True(t, fileSystem.Exists("/Chart.yaml"))
+			assert.Equal(t, testCase.expectedIgnored, fileSystem.Exists("/README.md"),
+				"files marked export-ignore are only part of clones")
+		})
+	}
+	assert.Equal(t, int32(1), gitMock.CloneCommitCallCount.Load())
+}
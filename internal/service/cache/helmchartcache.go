@@ -3,6 +3,7 @@ package cache
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"net/url"
 	"strings"
@@ -10,49 +11,71 @@ import (
 
 	"github.com/Roshick/go-autumn-synchronisation/pkg/cache"
 	openapi "github.com/Roshick/manifest-maestro-api"
+	"github.com/Roshick/manifest-maestro/internal/credentials"
 	"github.com/Roshick/manifest-maestro/internal/repository/helmremote"
 	"github.com/Roshick/manifest-maestro/internal/utils"
 	"github.com/Roshick/manifest-maestro/pkg/filesystem"
 	"github.com/Roshick/manifest-maestro/pkg/targz"
 	aulogging "github.com/StephanHCB/go-autumn-logging"
+	"github.com/opencontainers/go-digest"
 )
 
 type HelmChartRemote interface {
 	GetChart(context.Context, url.URL) ([]byte, error)
+	ResolveChartDigest(context.Context, url.URL) (string, error)
+}
+
+// HelmChartURLReference selects a packaged chart by the URL of its archive, for charts published without a
+// repository index, e.g. as release assets. The archive is retrieved with the provider of the URL host, like charts
+// of repositories.
+type HelmChartURLReference struct {
+	URL string `json:"url"`
+	// SHA256 is the expected hex-encoded checksum of the archive, optionally prefixed by 'sha256:'. If set, archives
+	// with a different checksum are rejected.
+	SHA256 *string `json:"sha256,omitempty"`
 }
 
 type HelmChartCache struct {
-	helmRemote HelmChartRemote
-	indexCache *HelmIndexCache
-	cache      cache.Cache[[]byte]
+	helmRemote      HelmChartRemote
+	indexCache      *HelmIndexCache
+	cache           cache.Cache[[]byte]
+	fileSystemCache *FileSystemCache
 }
 
 func NewHelmChartCache(
 	helmRemote HelmChartRemote,
 	indexCache *HelmIndexCache,
 	cache cache.Cache[[]byte],
+	fileSystemCache *FileSystemCache,
 ) *HelmChartCache {
 	return &HelmChartCache{
-		helmRemote: helmRemote,
-		indexCache: indexCache,
-		cache:      cache,
+		helmRemote:      helmRemote,
+		indexCache:      indexCache,
+		cache:           cache,
+		fileSystemCache: fileSystemCache,
 	}
 }
 
+// RetrieveChart returns the chart archive and, for OCI charts, the digest of the chart manifest. The chart version of
+// OCI charts is either a tag, a digest like 'sha256:<hex>' or both, like '1.0.0@sha256:<hex>', in which case the tag
+// is ignored.
 func (c *HelmChartCache) RetrieveChart(
 	ctx context.Context,
 	chartReference openapi.HelmChartRepositoryChartReference,
-) ([]byte, error) {
+) ([]byte, string, error) {
 	if strings.HasPrefix(chartReference.RepositoryURL, "https://") ||
-		strings.HasPrefix(chartReference.RepositoryURL, "http://") {
-		return c.retrieveHelmChartViaHTTP(ctx, chartReference)
+		strings.HasPrefix(chartReference.RepositoryURL, "http://") ||
+		strings.HasPrefix(chartReference.RepositoryURL, "s3://") ||
+		strings.HasPrefix(chartReference.RepositoryURL, "s3+http://") {
+		chartBytes, err := c.retrieveHelmChartViaHTTP(ctx, chartReference)
+		return chartBytes, "", err
 	} else if strings.HasPrefix(
 		chartReference.RepositoryURL,
 		"oci://",
 	) {
 		return c.retrieveHelmChartViaOCI(ctx, chartReference)
 	}
-	return nil, NewInvalidHelmRepositoryURLError(chartReference.RepositoryURL)
+	return nil, "", NewInvalidHelmRepositoryURLError(chartReference.RepositoryURL)
 }
 
 func (c *HelmChartCache) RetrieveChartToFileSystem(
@@ -60,7 +83,7 @@ func (c *HelmChartCache) RetrieveChartToFileSystem(
 	chartReference openapi.HelmChartRepositoryChartReference,
 	fileSystem *filesystem.FileSystem,
 ) error {
-	tarball, err := c.RetrieveChart(ctx, chartReference)
+	tarball, _, err := c.RetrieveChart(ctx, chartReference)
 	if err != nil {
 		return err
 	}
@@ -70,49 +93,165 @@ func (c *HelmChartCache) RetrieveChartToFileSystem(
 	return nil
 }
 
-func (c *HelmChartCache) retrieveHelmChartViaOCI(
+// RetrieveChartFileSystem returns the extracted chart and, for OCI charts, the digest of the chart manifest. The file
+// system is shared with other requests for the same chart archive and must not be mutated, wrap it with
+// filesystem.NewOverlay instead.
+func (c *HelmChartCache) RetrieveChartFileSystem(
 	ctx context.Context,
 	chartReference openapi.HelmChartRepositoryChartReference,
+) (*filesystem.FileSystem, string, error) {
+	tarball, chartDigest, err := c.RetrieveChart(ctx, chartReference)
+	if err != nil {
+		return nil, "", err
+	}
+	fileSystem, err := c.extractChart(ctx, tarball)
+	if err != nil {
+		return nil, "", err
+	}
+	return fileSystem, chartDigest, nil
+}
+
+// RetrieveChartFromURL returns the chart archive at the URL of the reference. Archives with an expected checksum are
+// cached by URL and checksum, all others only briefly by URL.
+func (c *HelmChartCache) RetrieveChartFromURL(
+	ctx context.Context,
+	chartReference HelmChartURLReference,
 ) ([]byte, error) {
+	parsedURL, err := url.Parse(chartReference.URL)
+	if err != nil {
+		return nil, NewInvalidHelmChartURLError(chartReference.URL)
+	}
+	switch parsedURL.Scheme {
+	case "https", "http", "s3", "s3+http":
+	default:
+		return nil, NewInvalidHelmChartURLError(chartReference.URL)
+	}
+
+	expectedChecksum := strings.ToLower(strings.TrimPrefix(utils.DefaultIfNil(chartReference.SHA256, ""), "sha256:"))
+	cacheKey, ttl := parsedURL.String(), 5*time.Minute
+	if expectedChecksum != "" {
+		cacheKey, ttl = fmt.Sprintf("%s|sha256:%s", parsedURL.String(), expectedChecksum), 15*time.Minute
+	}
+	cacheKey = credentials.HelmCacheKey(ctx, parsedURL.String(), cacheKey)
+	cached, err := c.cache.Get(ctx, cacheKey)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		aulogging.Logger.Ctx(ctx).Info().Printf("cache hit for helm chart with key '%s'", cacheKey)
+		return *cached, nil
+	}
+
+	aulogging.Logger.Ctx(ctx).Info().Printf("cache miss for helm chart with key '%s', retrieving from remote", cacheKey)
+	chartBytes, err := c.helmRemote.GetChart(ctx, *parsedURL)
+	if err != nil {
+		return nil, err
+	}
+	if actualChecksum := fmt.Sprintf("%x", sha256.Sum256(chartBytes)); expectedChecksum != "" &&
+		actualChecksum != expectedChecksum {
+		return nil, NewHelmChartChecksumMismatchError(chartReference.URL, expectedChecksum, actualChecksum)
+	}
+
+	if err = c.cache.Set(ctx, cacheKey, chartBytes, ttl); err != nil {
+		aulogging.Logger.Ctx(ctx).Warn().WithErr(err).Printf("failed to cache helm chart with key '%s'", cacheKey)
+	} else {
+		aulogging.Logger.Ctx(ctx).Info().Printf("successfully cached helm chart with key '%s'", cacheKey)
+	}
+	return chartBytes, nil
+}
+
+// RetrieveChartFromURLFileSystem returns the extracted chart archive at the URL of the reference. The file system is
+// shared like the one of RetrieveChartFileSystem.
+func (c *HelmChartCache) RetrieveChartFromURLFileSystem(
+	ctx context.Context,
+	chartReference HelmChartURLReference,
+) (*filesystem.FileSystem, error) {
+	tarball, err := c.RetrieveChartFromURL(ctx, chartReference)
+	if err != nil {
+		return nil, err
+	}
+	return c.extractChart(ctx, tarball)
+}
+
+func (c *HelmChartCache) extractChart(ctx context.Context, tarball []byte) (*filesystem.FileSystem, error) {
+	// not every chart archive carries a digest, so the extracted chart is keyed by the digest of the archive itself
+	key := fmt.Sprintf("sha256:%x", sha256.Sum256(tarball))
+	return c.fileSystemCache.Retrieve(ctx, key, func(ctx context.Context, fileSystem *filesystem.FileSystem) error {
+		return targz.Extract(ctx, fileSystem, bytes.NewBuffer(tarball), fileSystem.Root)
+	})
+}
+
+// retrieveHelmChartViaOCI resolves tags to the digest of the chart manifest before looking up the cache, as tags are
+// mutable while digests are not.
+func (c *HelmChartCache) retrieveHelmChartViaOCI(
+	ctx context.Context,
+	chartReference openapi.HelmChartRepositoryChartReference,
+) ([]byte, string, error) {
 	chartURL, err := url.JoinPath(chartReference.RepositoryURL, chartReference.ChartName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to construct chart url: %w", err)
+		return nil, "", fmt.Errorf("failed to construct chart url: %w", err)
 	}
 
 	parsedURL, err := url.Parse(chartURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse chart url '%s': %w", chartURL, err)
+		return nil, "", fmt.Errorf("failed to parse chart url '%s': %w", chartURL, err)
 	}
 	if parsedURL == nil {
-		return nil, fmt.Errorf("failed to parse chart url '%s': parsed url is nil", chartURL)
+		return nil, "", fmt.Errorf("failed to parse chart url '%s': parsed url is nil", chartURL)
 	}
 
-	if chartReference.ChartVersion != nil {
-		parsedURL.Path = fmt.Sprintf("%s:%s", parsedURL.Path, *chartReference.ChartVersion)
+	tag, chartDigest, err := parseOCIChartVersion(utils.DefaultIfNil(chartReference.ChartVersion, ""))
+	if err != nil {
+		return nil, "", err
+	}
+	if chartDigest == "" {
+		tagURL := *parsedURL
+		tagURL.Path = fmt.Sprintf("%s:%s", parsedURL.Path, tag)
+		chartDigest, err = c.helmRemote.ResolveChartDigest(ctx, tagURL)
+		if err != nil {
+			return nil, "", err
+		}
+		aulogging.Logger.Ctx(ctx).Debug().Printf("resolved helm chart '%s' to digest '%s'", tagURL.String(), chartDigest)
 	}
+	parsedURL.Path = fmt.Sprintf("%s@%s", parsedURL.Path, chartDigest)
 
-	cacheKey := parsedURL.String()
+	cacheKey := credentials.HelmCacheKey(ctx, parsedURL.String(), parsedURL.String())
 	cached, err := c.cache.Get(ctx, cacheKey)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	if cached != nil {
 		aulogging.Logger.Ctx(ctx).Info().Printf("cache hit for helm chart with key '%s'", cacheKey)
-		return *cached, nil
+		return *cached, chartDigest, nil
 	}
 
 	aulogging.Logger.Ctx(ctx).Info().Printf("cache miss for helm chart with key '%s', retrieving from remote", cacheKey)
 	chartBytes, err := c.helmRemote.GetChart(ctx, *parsedURL)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	if err = c.cache.Set(ctx, cacheKey, chartBytes, 5*time.Minute); err != nil {
+	if err = c.cache.Set(ctx, cacheKey, chartBytes, 15*time.Minute); err != nil {
 		aulogging.Logger.Ctx(ctx).Warn().WithErr(err).Printf("failed to cache helm chart with key '%s'", cacheKey)
 	} else {
 		aulogging.Logger.Ctx(ctx).Info().Printf("successfully cached helm chart with key '%s'", cacheKey)
 	}
-	return chartBytes, nil
+	return chartBytes, chartDigest, nil
+}
+
+// parseOCIChartVersion splits the chart version into the tag and the digest. Like Helm, '+' of semantic versions is
+// replaced by '_', which is not allowed in tags.
+func parseOCIChartVersion(chartVersion string) (string, string, error) {
+	tag, chartDigest, found := strings.Cut(chartVersion, "@")
+	if !found && strings.Contains(chartVersion, ":") {
+		tag, chartDigest = "", chartVersion
+	}
+	if chartDigest != "" {
+		if _, err := digest.Parse(chartDigest); err != nil {
+			return "", "", NewInvalidHelmChartVersionError(chartVersion, err.Error())
+		}
+	}
+	return strings.ReplaceAll(tag, "+", "_"), chartDigest, nil
 }
 
 func (c *HelmChartCache) retrieveHelmChartViaHTTP(
@@ -151,7 +290,8 @@ func (c *HelmChartCache) retrieveHelmChartViaHTTP(
 		return nil, fmt.Errorf("failed to parse chart url '%s': parsed url is nil", chartURL)
 	}
 
-	cacheKey := fmt.Sprintf("%s|%s", parsedURL.String(), chartEntry.Digest)
+	cacheKey := credentials.HelmCacheKey(
+		ctx, parsedURL.String(), fmt.Sprintf("%s|%s", parsedURL.String(), chartEntry.Digest))
 	cached, err := c.cache.Get(ctx, cacheKey)
 	if err != nil {
 		return nil, err
@@ -3,9 +3,12 @@ package cache
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"fmt"
 	"testing"
 
 	openapi "github.com/Roshick/manifest-maestro-api"
+	"github.com/Roshick/manifest-maestro/internal/credentials"
 	"github.com/Roshick/manifest-maestro/internal/utils"
 	"github.com/Roshick/manifest-maestro/pkg/filesystem"
 	"github.com/Roshick/manifest-maestro/pkg/targz"
@@ -22,9 +25,9 @@ func TestHelmChartCache_RetrieveChart_InvalidScheme(t *testing.T) {
 	chartCacheMock := cachemock.New[[]byte]()
 
 	indexCache := NewHelmIndexCache(indexMock, indexCacheMock)
-	chartCache := NewHelmChartCache(chartMock, indexCache, chartCacheMock)
+	chartCache := NewHelmChartCache(chartMock, indexCache, chartCacheMock, NewFileSystemCache(0))
 
-	_, err := chartCache.RetrieveChart(context.Background(), openapi.HelmChartRepositoryChartReference{
+	_, _, err := chartCache.RetrieveChart(context.Background(), openapi.HelmChartRepositoryChartReference{
 		RepositoryURL: "ftp://example.com/charts",
 		ChartName:     "mychart",
 		ChartVersion:  utils.Ptr("1.0.0"),
@@ -44,15 +47,16 @@ func TestHelmChartCache_RetrieveChart_OCI_CacheMiss(t *testing.T) {
 	chartCacheMock := cachemock.New[[]byte]()
 
 	indexCache := NewHelmIndexCache(indexMock, indexCacheMock)
-	chartCache := NewHelmChartCache(chartMock, indexCache, chartCacheMock)
+	chartCache := NewHelmChartCache(chartMock, indexCache, chartCacheMock, NewFileSystemCache(0))
 
-	chartBytes, err := chartCache.RetrieveChart(ctx, openapi.HelmChartRepositoryChartReference{
+	chartBytes, chartDigest, err := chartCache.RetrieveChart(ctx, openapi.HelmChartRepositoryChartReference{
 		RepositoryURL: "oci://example.com/charts",
 		ChartName:     "mychart",
 		ChartVersion:  utils.Ptr("1.0.0"),
 	})
 	require.NoError(t, err)
 	assert.Equal(t, []byte("chart-data"), chartBytes)
+	assert.Equal(t, helmremotemock.Digest([]byte("chart-data")), chartDigest)
 	assert.Equal(t, int32(1), chartMock.GetChartCallCount.Load())
 }
 
@@ -67,7 +71,7 @@ func TestHelmChartCache_RetrieveChart_OCI_CacheHit(t *testing.T) {
 	chartCacheMock := cachemock.New[[]byte]()
 
 	indexCache := NewHelmIndexCache(indexMock, indexCacheMock)
-	chartCache := NewHelmChartCache(chartMock, indexCache, chartCacheMock)
+	chartCache := NewHelmChartCache(chartMock, indexCache, chartCacheMock, NewFileSystemCache(0))
 
 	ref := openapi.HelmChartRepositoryChartReference{
 		RepositoryURL: "oci://example.com/charts",
@@ -76,11 +80,11 @@ func TestHelmChartCache_RetrieveChart_OCI_CacheHit(t *testing.T) {
 	}
 
 	// First call: cache miss
-	_, err := chartCache.RetrieveChart(ctx, ref)
+	_, _, err := chartCache.RetrieveChart(ctx, ref)
 	require.NoError(t, err)
 
 	// Second call: cache hit
-	chartBytes, err := chartCache.RetrieveChart(ctx, ref)
+	chartBytes, _, err := chartCache.RetrieveChart(ctx, ref)
 	require.NoError(t, err)
 	assert.Equal(t, []byte("chart-data"), chartBytes)
 
@@ -88,6 +92,91 @@ func TestHelmChartCache_RetrieveChart_OCI_CacheHit(t *testing.T) {
 	assert.Equal(t, int32(1), chartMock.GetChartCallCount.Load())
 }
 
+func TestHelmChartCache_RetrieveChart_OCI_RequestCredentials(t *testing.T) {
+	chartMock := helmremotemock.NewChartMock()
+	chartMock.AddChart("oci://example.com/charts/mychart:1.0.0", []byte("chart-data"))
+
+	indexCache := NewHelmIndexCache(helmremotemock.NewIndexMock(), cachemock.New[[]byte]())
+	chartCache := NewHelmChartCache(chartMock, indexCache, cachemock.New[[]byte](), NewFileSystemCache(0))
+
+	ref := openapi.HelmChartRepositoryChartReference{
+		RepositoryURL: "oci://example.com/charts",
+		ChartName:     "mychart",
+		ChartVersion:  utils.Ptr("1.0.0"),
+	}
+	ctx := credentials.NewContext(context.Background(), &credentials.Credentials{
+		Helm: map[string]credentials.HelmCredential{"example.com": {Username: "user", Password: "token"}},
+	})
+	for range 2 {
+		_, _, err := chartCache.RetrieveChart(ctx, ref)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), chartMock.GetChartCallCount.Load())
+
+	// charts fetched with request credentials are not served to requests without them
+	_, _, err := chartCache.RetrieveChart(context.Background(), ref)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), chartMock.GetChartCallCount.Load())
+}
+
+func TestHelmChartCache_RetrieveChart_OCI_TagMoved(t *testing.T) {
+	ctx := context.Background()
+
+	chartMock := helmremotemock.NewChartMock()
+	chartMock.AddChart("oci://example.com/charts/mychart:1.0.0", []byte("chart-data"))
+
+	indexCache := NewHelmIndexCache(helmremotemock.NewIndexMock(), cachemock.New[[]byte]())
+	chartCache := NewHelmChartCache(chartMock, indexCache, cachemock.New[[]byte](), NewFileSystemCache(0))
+
+	ref := openapi.HelmChartRepositoryChartReference{
+		RepositoryURL: "oci://example.com/charts",
+		ChartName:     "mychart",
+		ChartVersion:  utils.Ptr("1.0.0"),
+	}
+	_, _, err := chartCache.RetrieveChart(ctx, ref)
+	require.NoError(t, err)
+
+	// the tag is resolved on every retrieval, so a moved tag is not served from the cache
+	chartMock.AddChart("oci://example.com/charts/mychart:1.0.0", []byte("moved-chart-data"))
+	chartBytes, chartDigest, err := chartCache.RetrieveChart(ctx, ref)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("moved-chart-data"), chartBytes)
+	assert.Equal(t, helmremotemock.Digest([]byte("moved-chart-data")), chartDigest)
+	assert.Equal(t, int32(2), chartMock.ResolveChartDigestCallCount.Load())
+	assert.Equal(t, int32(2), chartMock.GetChartCallCount.Load())
+}
+
+func TestHelmChartCache_RetrieveChart_OCI_Digest(t *testing.T) {
+	ctx := context.Background()
+
+	chartMock := helmremotemock.NewChartMock()
+	chartMock.AddChart("oci://example.com/charts/mychart:1.0.0", []byte("chart-data"))
+	chartDigest := helmremotemock.Digest([]byte("chart-data"))
+
+	indexCache := NewHelmIndexCache(helmremotemock.NewIndexMock(), cachemock.New[[]byte]())
+	chartCache := NewHelmChartCache(chartMock, indexCache, cachemock.New[[]byte](), NewFileSystemCache(0))
+
+	for _, chartVersion := range []string{chartDigest, "0.0.1@" + chartDigest} {
+		chartBytes, resolvedDigest, err := chartCache.RetrieveChart(ctx, openapi.HelmChartRepositoryChartReference{
+			RepositoryURL: "oci://example.com/charts",
+			ChartName:     "mychart",
+			ChartVersion:  utils.Ptr(chartVersion),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []byte("chart-data"), chartBytes)
+		assert.Equal(t, chartDigest, resolvedDigest)
+	}
+	assert.Equal(t, int32(0), chartMock.ResolveChartDigestCallCount.Load())
+	assert.Equal(t, int32(1), chartMock.GetChartCallCount.Load())
+
+	_, _, err := chartCache.RetrieveChart(ctx, openapi.HelmChartRepositoryChartReference{
+		RepositoryURL: "oci://example.com/charts",
+		ChartName:     "mychart",
+		ChartVersion:  utils.Ptr("1.0.0@sha256:invalid"),
+	})
+	assert.ErrorAs(t, err, new(*InvalidHelmChartVersionError))
+}
+
 func TestHelmChartCache_RetrieveChartToFileSystem(t *testing.T) {
 	ctx := context.Background()
 
@@ -102,7 +191,7 @@ func TestHelmChartCache_RetrieveChartToFileSystem(t *testing.T) {
 	chartCacheMock := cachemock.New[[]byte]()
 
 	indexCache := NewHelmIndexCache(indexMock, indexCacheMock)
-	chartCache := NewHelmChartCache(chartMock, indexCache, chartCacheMock)
+	chartCache := NewHelmChartCache(chartMock, indexCache, chartCacheMock, NewFileSystemCache(0))
 
 	destFS := filesystem.New()
 	err := chartCache.RetrieveChartToFileSystem(ctx, openapi.HelmChartRepositoryChartReference{
@@ -138,9 +227,9 @@ entries:
 	chartCacheMock := cachemock.New[[]byte]()
 
 	indexCache := NewHelmIndexCache(indexMock, indexCacheMock)
-	chartCache := NewHelmChartCache(chartMock, indexCache, chartCacheMock)
+	chartCache := NewHelmChartCache(chartMock, indexCache, chartCacheMock, NewFileSystemCache(0))
 
-	chartBytes, err := chartCache.RetrieveChart(ctx, openapi.HelmChartRepositoryChartReference{
+	chartBytes, _, err := chartCache.RetrieveChart(ctx, openapi.HelmChartRepositoryChartReference{
 		RepositoryURL: "https://example.com/charts",
 		ChartName:     "mychart",
 		ChartVersion:  utils.Ptr("1.0.0"),
@@ -149,6 +238,34 @@ entries:
 	assert.Equal(t, []byte("http-chart-data"), chartBytes)
 }
 
+func TestHelmChartCache_RetrieveChartFromURL(t *testing.T) {
+	ctx := context.Background()
+
+	chartMock := helmremotemock.NewChartMock()
+	chartMock.AddChart("https://example.com/releases/download/v1.0.0/mychart-1.0.0.tgz", []byte("chart-data"))
+
+	indexCache := NewHelmIndexCache(helmremotemock.NewIndexMock(), cachemock.New[[]byte]())
+	chartCache := NewHelmChartCache(chartMock, indexCache, cachemock.New[[]byte](), NewFileSystemCache(0))
+
+	reference := HelmChartURLReference{
+		URL:    "https://example.com/releases/download/v1.0.0/mychart-1.0.0.tgz",
+		SHA256: utils.Ptr(fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("chart-data")))),
+	}
+	for range 2 {
+		chartBytes, err := chartCache.RetrieveChartFromURL(ctx, reference)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("chart-data"), chartBytes)
+	}
+	assert.Equal(t, int32(1), chartMock.GetChartCallCount.Load())
+
+	reference.SHA256 = utils.Ptr(fmt.Sprintf("%x", sha256.Sum256([]byte("other-chart-data"))))
+	_, err := chartCache.RetrieveChartFromURL(ctx, reference)
+	assert.ErrorAs(t, err, new(*HelmChartChecksumMismatchError))
+
+	_, err = chartCache.RetrieveChartFromURL(ctx, HelmChartURLReference{URL: "ftp://example.com/mychart-1.0.0.tgz"})
+	assert.ErrorAs(t, err, new(*InvalidHelmChartURLError))
+}
+
 // createTestChartTarball creates a minimal valid chart tarball.
 func createTestChartTarball(t *testing.T) []byte {
 	t.Helper()
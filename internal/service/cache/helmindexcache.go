@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/Roshick/go-autumn-synchronisation/pkg/cache"
+	"github.com/Roshick/manifest-maestro/internal/credentials"
 	aulogging "github.com/StephanHCB/go-autumn-logging"
 	"helm.sh/helm/v4/pkg/repo/v1"
 	"sigs.k8s.io/yaml"
@@ -38,7 +39,7 @@ func (c *HelmIndexCache) RetrieveIndex(ctx context.Context, repositoryURL string
 		return nil, fmt.Errorf("failed to parse repository url '%s': parsed url is nil", repositoryURL)
 	}
 
-	cacheKey := parsedURL.String()
+	cacheKey := credentials.HelmCacheKey(ctx, repositoryURL, parsedURL.String())
 	cached, err := c.cache.Get(ctx, cacheKey)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+)
+
+// PathScan reports the slash-separated paths, relative to the root of the file system, that the files extracted
+// so far depend on. Paths outside the root are ignored.
+type PathScan func(fileSystem *filesystem.FileSystem) ([]string, error)
+
+// NormalizePaths cleans the given paths, drops those outside the root and those already covered by a parent path,
+// and sorts the rest, so equal path sets always share the same cache key.
+func NormalizePaths(paths []string) []string {
+	cleanPaths := make([]string, 0, len(paths))
+	for _, p := range paths {
+		cleanPath := path.Clean(strings.TrimPrefix(p, "/"))
+		if cleanPath == ".." || strings.HasPrefix(cleanPath, "../") {
+			continue
+		}
+		cleanPaths = append(cleanPaths, cleanPath)
+	}
+	slices.Sort(cleanPaths)
+	cleanPaths = slices.Compact(cleanPaths)
+
+	normalizedPaths := make([]string, 0, len(cleanPaths))
+	for _, cleanPath := range cleanPaths {
+		covered := slices.ContainsFunc(cleanPaths, func(other string) bool {
+			return other != cleanPath && (other == "." || strings.HasPrefix(cleanPath, other+"/"))
+		})
+		if !covered {
+			normalizedPaths = append(normalizedPaths, cleanPath)
+		}
+	}
+	return normalizedPaths
+}
+
+// uncoveredPaths returns the normalized paths not located at or below any of the normalized covering paths.
+func uncoveredPaths(paths []string, coveringPaths []string) []string {
+	uncovered := make([]string, 0, len(paths))
+	for _, p := range paths {
+		covered := slices.ContainsFunc(coveringPaths, func(other string) bool {
+			return other == "." || other == p || strings.HasPrefix(p, other+"/")
+		})
+		if !covered {
+			uncovered = append(uncovered, p)
+		}
+	}
+	return uncovered
+}
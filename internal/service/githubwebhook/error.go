@@ -0,0 +1,39 @@
+package githubwebhook
+
+import "fmt"
+
+type SignatureInvalidError struct {
+	err error
+}
+
+func (e *SignatureInvalidError) Error() string {
+	return fmt.Sprintf("GitHub webhook signature is invalid: %v", e.err)
+}
+
+func (e *SignatureInvalidError) Unwrap() error {
+	return e.err
+}
+
+func NewSignatureInvalidError(err error) *SignatureInvalidError {
+	return &SignatureInvalidError{
+		err: err,
+	}
+}
+
+type PayloadInvalidError struct {
+	err error
+}
+
+func (e *PayloadInvalidError) Error() string {
+	return fmt.Sprintf("GitHub webhook payload is invalid: %v", e.err)
+}
+
+func (e *PayloadInvalidError) Unwrap() error {
+	return e.err
+}
+
+func NewPayloadInvalidError(err error) *PayloadInvalidError {
+	return &PayloadInvalidError{
+		err: err,
+	}
+}
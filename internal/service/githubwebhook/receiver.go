@@ -0,0 +1,186 @@
+package githubwebhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	aulogging "github.com/StephanHCB/go-autumn-logging"
+	"github.com/google/go-github/v90/github"
+)
+
+const (
+	// prefetchTimeout bounds the clone of a pushed commit, which runs after the delivery has been answered.
+	prefetchTimeout = 5 * time.Minute
+	// prefetchWorkers bounds the number of concurrent clones, so a burst of deliveries does not start a clone each.
+	prefetchWorkers = 2
+	// prefetchQueueSize bounds the pushed commits waiting for a worker, further commits are not prefetched.
+	prefetchQueueSize = 64
+
+	zeroCommitHash = "0000000000000000000000000000000000000000"
+)
+
+// sha256SignaturePrefix precedes the hex-encoded HMAC in the 'X-Hub-Signature-256' header.
+const sha256SignaturePrefix = "sha256="
+
+var (
+	errMissingRepository  = errors.New("repository clone url is missing")
+	errSignatureNotSHA256 = errors.New("signature is missing or not a sha256 signature")
+)
+
+type ReferenceCache interface {
+	Invalidate(ctx context.Context, repositoryURL string) error
+}
+
+type RepositoryCache interface {
+	PrefetchRepository(ctx context.Context, repositoryURL string, commitHash string) error
+}
+
+// Delivery is a webhook delivery as received from GitHub.
+type Delivery struct {
+	// ID is the unique id of the delivery, sent in the 'X-GitHub-Delivery' header.
+	ID string
+	// EventType is the type of the event, sent in the 'X-GitHub-Event' header, e.g. 'push'.
+	EventType string
+	// Signature is the HMAC signature of the body, sent in the 'X-Hub-Signature-256' header.
+	Signature   string
+	ContentType string
+	Body        []byte
+}
+
+// Receiver processes GitHub webhook deliveries. Push, create and delete events of branches and tags invalidate the
+// cached references of the repository, so renders resolve the new commits immediately. With prefetch, the commit of
+// a push is also cloned into the repository cache in the background by the workers started with Run, so the first
+// render after a merge does not pay the clone latency.
+type Receiver struct {
+	secret          []byte
+	referenceCache  ReferenceCache
+	repositoryCache RepositoryCache
+	prefetch        bool
+	prefetches      chan prefetchRequest
+}
+
+type prefetchRequest struct {
+	repositoryURL string
+	commitHash    string
+}
+
+func NewReceiver(
+	secret string, referenceCache ReferenceCache, repositoryCache RepositoryCache, prefetch bool,
+) *Receiver {
+	return &Receiver{
+		secret:          []byte(secret),
+		referenceCache:  referenceCache,
+		repositoryCache: repositoryCache,
+		prefetch:        prefetch,
+		prefetches:      make(chan prefetchRequest, prefetchQueueSize),
+	}
+}
+
+// Run prefetches the commits of received pushes until the context is done.
+func (r *Receiver) Run(ctx context.Context) {
+	var waitGroup sync.WaitGroup
+	for range prefetchWorkers {
+		waitGroup.Go(func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case request := <-r.prefetches:
+					r.prefetchRepository(ctx, request.repositoryURL, request.commitHash)
+				}
+			}
+		})
+	}
+	waitGroup.Wait()
+}
+
+// Receive validates the signature of the delivery and processes its event. Events of other types are ignored. Only
+// SHA-256 signatures are accepted, legacy SHA-1 signatures are rejected.
+func (r *Receiver) Receive(ctx context.Context, delivery Delivery) error {
+	if !strings.HasPrefix(delivery.Signature, sha256SignaturePrefix) {
+		return NewSignatureInvalidError(errSignatureNotSHA256)
+	}
+	payload, err := github.ValidatePayloadFromBody(
+		delivery.ContentType, bytes.NewReader(delivery.Body), delivery.Signature, r.secret,
+	)
+	if err != nil {
+		return NewSignatureInvalidError(err)
+	}
+	if github.EventForType(delivery.EventType) == nil {
+		aulogging.Logger.Ctx(ctx).Debug().Printf("ignoring github webhook delivery '%s' of unknown event type '%s'",
+			delivery.ID, delivery.EventType)
+		return nil
+	}
+	event, err := github.ParseWebHook(delivery.EventType, payload)
+	if err != nil {
+		return NewPayloadInvalidError(err)
+	}
+
+	switch event := event.(type) {
+	case *github.PushEvent:
+		return r.receivePush(ctx, delivery.ID, event)
+	case *github.CreateEvent:
+		return r.receiveReferenceChange(ctx, delivery.ID, event.GetRefType(), event.GetRepo().GetCloneURL())
+	case *github.DeleteEvent:
+		return r.receiveReferenceChange(ctx, delivery.ID, event.GetRefType(), event.GetRepo().GetCloneURL())
+	default:
+		aulogging.Logger.Ctx(ctx).Debug().Printf("ignoring github webhook delivery '%s' of event type '%s'",
+			delivery.ID, delivery.EventType)
+		return nil
+	}
+}
+
+func (r *Receiver) receivePush(ctx context.Context, deliveryID string, event *github.PushEvent) error {
+	repositoryURL := event.GetRepo().GetCloneURL()
+	if repositoryURL == "" {
+		return NewPayloadInvalidError(errMissingRepository)
+	}
+	aulogging.Logger.Ctx(ctx).Info().Printf("github webhook delivery '%s': push of '%s' to '%s'",
+		deliveryID, event.GetRef(), repositoryURL)
+	if err := r.referenceCache.Invalidate(ctx, repositoryURL); err != nil {
+		return err
+	}
+
+	commitHash := event.GetAfter()
+	if !r.prefetch || event.GetDeleted() || commitHash == "" || commitHash == zeroCommitHash {
+		return nil
+	}
+	select {
+	case r.prefetches <- prefetchRequest{repositoryURL: repositoryURL, commitHash: commitHash}:
+	default:
+		aulogging.Logger.Ctx(ctx).Warn().Printf(
+			"github webhook delivery '%s': too many pending prefetches, not prefetching commit '%s' of '%s'",
+			deliveryID, commitHash, repositoryURL)
+	}
+	return nil
+}
+
+func (r *Receiver) receiveReferenceChange(
+	ctx context.Context, deliveryID string, refType string, repositoryURL string,
+) error {
+	if refType != "branch" && refType != "tag" {
+		return nil
+	}
+	if repositoryURL == "" {
+		return NewPayloadInvalidError(errMissingRepository)
+	}
+	aulogging.Logger.Ctx(ctx).Info().Printf("github webhook delivery '%s': %s changed in '%s'",
+		deliveryID, refType, repositoryURL)
+	return r.referenceCache.Invalidate(ctx, repositoryURL)
+}
+
+func (r *Receiver) prefetchRepository(ctx context.Context, repositoryURL string, commitHash string) {
+	ctx, cancel := context.WithTimeout(ctx, prefetchTimeout)
+	defer cancel()
+
+	if err := r.repositoryCache.PrefetchRepository(ctx, repositoryURL, commitHash); err != nil {
+		aulogging.Logger.Ctx(ctx).Warn().WithErr(err).Printf("failed to prefetch commit '%s' of git repository '%s'",
+			commitHash, repositoryURL)
+		return
+	}
+	aulogging.Logger.Ctx(ctx).Info().Printf("prefetched commit '%s' of git repository '%s'", commitHash, repositoryURL)
+}
@@ -0,0 +1,181 @@
+package githubwebhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "It's a Secret to Everybody"
+
+type fakeReferenceCache struct {
+	mutex       sync.Mutex
+	invalidated []string
+}
+
+func (c *fakeReferenceCache) Invalidate(_ context.Context, repositoryURL string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.invalidated = append(c.invalidated, repositoryURL)
+	return nil
+}
+
+type prefetch struct {
+	repositoryURL string
+	commitHash    string
+}
+
+type fakeRepositoryCache struct {
+	prefetches chan prefetch
+}
+
+func (c *fakeRepositoryCache) PrefetchRepository(_ context.Context, repositoryURL string, commitHash string) error {
+	c.prefetches <- prefetch{repositoryURL: repositoryURL, commitHash: commitHash}
+	return nil
+}
+
+func newTestReceiver(
+	t *testing.T, prefetchCommits bool,
+) (*Receiver, *fakeReferenceCache, *fakeRepositoryCache) {
+	t.Helper()
+	referenceCache := &fakeReferenceCache{}
+	repositoryCache := &fakeRepositoryCache{prefetches: make(chan prefetch, 1)}
+	receiver := NewReceiver(testSecret, referenceCache, repositoryCache, prefetchCommits)
+	go receiver.Run(t.Context())
+	return receiver, referenceCache, repositoryCache
+}
+
+func recordedDelivery(t *testing.T, eventType string, fileName string) Delivery {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", fileName))
+	require.NoError(t, err)
+	return Delivery{
+		ID:          "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+		EventType:   eventType,
+		Signature:   sign(body),
+		ContentType: "application/json",
+		Body:        body,
+	}
+}
+
+func sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestReceiver_Receive_Push(t *testing.T) {
+	receiver, referenceCache, repositoryCache := newTestReceiver(t, true)
+
+	require.NoError(t, receiver.Receive(context.Background(), recordedDelivery(t, "push", "push.json")))
+
+	assert.Equal(t, []string{"https://github.com/example-org/deployments.git"}, referenceCache.invalidated)
+	select {
+	case prefetched := <-repositoryCache.prefetches:
+		assert.Equal(t, prefetch{
+			repositoryURL: "https://github.com/example-org/deployments.git",
+			commitHash:    "0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c",
+		}, prefetched)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pushed commit was not prefetched")
+	}
+}
+
+func TestReceiver_Receive_PushWithoutPrefetch(t *testing.T) {
+	receiver, referenceCache, repositoryCache := newTestReceiver(t, false)
+
+	require.NoError(t, receiver.Receive(context.Background(), recordedDelivery(t, "push", "push.json")))
+
+	assert.Equal(t, []string{"https://github.com/example-org/deployments.git"}, referenceCache.invalidated)
+	select {
+	case <-repositoryCache.prefetches:
+		t.Fatal("pushed commit must not be prefetched")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestReceiver_Receive_DeletedTag(t *testing.T) {
+	receiver, referenceCache, repositoryCache := newTestReceiver(t, true)
+
+	require.NoError(t, receiver.Receive(context.Background(), recordedDelivery(t, "push", "push-tag-deleted.json")))
+
+	assert.Equal(t, []string{"https://github.com/example-org/deployments.git"}, referenceCache.invalidated)
+	select {
+	case <-repositoryCache.prefetches:
+		t.Fatal("deleted reference must not be prefetched")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestReceiver_Receive_CreateTag(t *testing.T) {
+	receiver, referenceCache, _ := newTestReceiver(t, true)
+
+	require.NoError(t, receiver.Receive(context.Background(), recordedDelivery(t, "create", "create-tag.json")))
+
+	assert.Equal(t, []string{"https://github.com/example-org/deployments.git"}, referenceCache.invalidated)
+}
+
+func TestReceiver_Receive_IgnoredEvents(t *testing.T) {
+	receiver, referenceCache, _ := newTestReceiver(t, true)
+
+	require.NoError(t, receiver.Receive(context.Background(), recordedDelivery(t, "ping", "ping.json")))
+	require.NoError(t, receiver.Receive(context.Background(), recordedDelivery(t, "unknown-event", "ping.json")))
+
+	assert.Empty(t, referenceCache.invalidated)
+}
+
+func TestReceiver_Receive_InvalidSignature(t *testing.T) {
+	receiver, referenceCache, _ := newTestReceiver(t, true)
+
+	tampered := recordedDelivery(t, "push", "push.json")
+	tampered.Body = append(tampered.Body, ' ')
+	missing := recordedDelivery(t, "push", "push.json")
+	missing.Signature = ""
+	sha1Signed := recordedDelivery(t, "push", "push.json")
+	mac := hmac.New(sha1.New, []byte(testSecret))
+	mac.Write(sha1Signed.Body)
+	sha1Signed.Signature = "sha1=" + hex.EncodeToString(mac.Sum(nil))
+
+	for _, delivery := range []Delivery{tampered, missing, sha1Signed} {
+		err := receiver.Receive(context.Background(), delivery)
+		assert.True(t, errors.As(err, new(*SignatureInvalidError)))
+	}
+	assert.Empty(t, referenceCache.invalidated)
+}
+
+func TestReceiver_Receive_InvalidPayload(t *testing.T) {
+	receiver, _, _ := newTestReceiver(t, true)
+
+	body := []byte(`{"ref": 42}`)
+	err := receiver.Receive(context.Background(), Delivery{
+		EventType:   "push",
+		Signature:   sign(body),
+		ContentType: "application/json",
+		Body:        body,
+	})
+	assert.True(t, errors.As(err, new(*PayloadInvalidError)))
+}
+
+func TestReceiver_Receive_PushesBeyondPrefetchQueueAreSkipped(t *testing.T) {
+	referenceCache := &fakeReferenceCache{}
+	repositoryCache := &fakeRepositoryCache{prefetches: make(chan prefetch, prefetchQueueSize+1)}
+	// without running workers, no prefetch leaves the queue
+	receiver := NewReceiver(testSecret, referenceCache, repositoryCache, true)
+
+	for range prefetchQueueSize + 1 {
+		require.NoError(t, receiver.Receive(context.Background(), recordedDelivery(t, "push", "push.json")))
+	}
+	assert.Len(t, receiver.prefetches, prefetchQueueSize)
+	assert.Len(t, referenceCache.invalidated, prefetchQueueSize+1)
+}
@@ -0,0 +1,17 @@
+package gitreference
+
+import "fmt"
+
+type ReferenceRequestInvalidError struct {
+	reason string
+}
+
+func (e *ReferenceRequestInvalidError) Error() string {
+	return fmt.Sprintf("Git reference request is invalid: %s", e.reason)
+}
+
+func NewReferenceRequestInvalidError(reason string) *ReferenceRequestInvalidError {
+	return &ReferenceRequestInvalidError{
+		reason: reason,
+	}
+}
@@ -0,0 +1,224 @@
+package gitreference
+
+import (
+	"context"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	augit "github.com/Roshick/manifest-maestro/internal/repository/git"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+type Git interface {
+	ResolveReference(ctx context.Context, repositoryURL string, gitReference string) (*augit.ResolvedReference, error)
+
+	RemoteReferences(ctx context.Context, repositoryURL string) ([]*plumbing.Reference, error)
+
+	CommitMetadata(ctx context.Context, repositoryURL string, commitHash string) (*augit.CommitMetadata, error)
+}
+
+type ReferenceCache interface {
+	Invalidate(ctx context.Context, repositoryURL string) error
+}
+
+type ReferenceKind string
+
+const (
+	ReferenceKindBranch ReferenceKind = "BRANCH"
+	ReferenceKindTag    ReferenceKind = "TAG"
+)
+
+type ResolvedReference struct {
+	// Reference is the full name of the resolved reference, or the commit hash if a commit was requested.
+	Reference  string  `json:"reference"`
+	CommitHash string  `json:"commitHash"`
+	Commit     *Commit `json:"commit,omitempty"`
+}
+
+type Commit struct {
+	AuthorName     string    `json:"authorName"`
+	AuthorEmail    string    `json:"authorEmail"`
+	AuthorDate     time.Time `json:"authorDate"`
+	CommitterName  string    `json:"committerName"`
+	CommitterEmail string    `json:"committerEmail"`
+	CommitterDate  time.Time `json:"committerDate"`
+	Message        string    `json:"message"`
+}
+
+type Reference struct {
+	// Name is the short name of the branch or tag, e.g. 'main' or 'v1.2.3'.
+	Name string `json:"name"`
+	// FullName is the full name of the reference, e.g. 'refs/heads/main'.
+	FullName   string        `json:"fullName"`
+	Kind       ReferenceKind `json:"kind"`
+	CommitHash string        `json:"commitHash"`
+}
+
+type ReferenceFilter struct {
+	// Kinds restricts the references to branches or tags, all kinds are listed if empty.
+	Kinds []ReferenceKind `json:"kinds,omitempty"`
+	// Pattern is a glob pattern the short name must match, e.g. 'release/*' or 'v1.*'.
+	Pattern *string `json:"pattern,omitempty"`
+	// VersionRange is a semantic version range the short name must satisfy, e.g. '>=2.3 <3'. Implies tags only.
+	VersionRange *string `json:"versionRange,omitempty"`
+}
+
+type ReferenceResolver struct {
+	git            Git
+	referenceCache ReferenceCache
+}
+
+func NewReferenceResolver(git Git, referenceCache ReferenceCache) *ReferenceResolver {
+	return &ReferenceResolver{
+		git:            git,
+		referenceCache: referenceCache,
+	}
+}
+
+// ResolveReference resolves the reference like renders do and, if includeCommit is set, fetches the metadata of
+// the commit it points to.
+func (r *ReferenceResolver) ResolveReference(
+	ctx context.Context, repositoryURL string, gitReference string, includeCommit bool,
+) (*ResolvedReference, error) {
+	if strings.TrimSpace(repositoryURL) == "" || strings.TrimSpace(gitReference) == "" {
+		return nil, NewReferenceRequestInvalidError("repository url and reference must not be empty")
+	}
+
+	resolved, err := r.git.ResolveReference(ctx, repositoryURL, gitReference)
+	if err != nil {
+		return nil, err
+	}
+	result := &ResolvedReference{
+		Reference:  resolved.Reference,
+		CommitHash: resolved.CommitHash,
+	}
+	if !includeCommit {
+		return result, nil
+	}
+
+	metadata, err := r.git.CommitMetadata(ctx, repositoryURL, resolved.CommitHash)
+	if err != nil {
+		return nil, err
+	}
+	result.Commit = &Commit{
+		AuthorName:     metadata.Author.Name,
+		AuthorEmail:    metadata.Author.Email,
+		AuthorDate:     metadata.Author.When.UTC(),
+		CommitterName:  metadata.Committer.Name,
+		CommitterEmail: metadata.Committer.Email,
+		CommitterDate:  metadata.Committer.When.UTC(),
+		Message:        metadata.Message,
+	}
+	return result, nil
+}
+
+// ListReferences lists the branches and tags of the repository matching the filter, sorted by kind and name.
+// Annotated tags are reported with the commit they point to.
+func (r *ReferenceResolver) ListReferences(
+	ctx context.Context, repositoryURL string, filter *ReferenceFilter,
+) ([]Reference, error) {
+	if strings.TrimSpace(repositoryURL) == "" {
+		return nil, NewReferenceRequestInvalidError("repository url must not be empty")
+	}
+	matches, err := newReferenceMatcher(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	remoteReferences, err := r.git.RemoteReferences(ctx, repositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	peeled := make(map[string]string)
+	for _, remoteReference := range remoteReferences {
+		if name, found := strings.CutSuffix(remoteReference.Name().String(), "^{}"); found {
+			peeled[name] = remoteReference.Hash().String()
+		}
+	}
+
+	references := make([]Reference, 0)
+	for _, remoteReference := range remoteReferences {
+		if remoteReference.Type() != plumbing.HashReference {
+			continue
+		}
+		reference := Reference{
+			Name:       remoteReference.Name().Short(),
+			FullName:   remoteReference.Name().String(),
+			CommitHash: remoteReference.Hash().String(),
+		}
+		switch {
+		case remoteReference.Name().IsBranch():
+			reference.Kind = ReferenceKindBranch
+		case remoteReference.Name().IsTag() && !strings.HasSuffix(reference.FullName, "^{}"):
+			reference.Kind = ReferenceKindTag
+			if commitHash, ok := peeled[reference.FullName]; ok {
+				reference.CommitHash = commitHash
+			}
+		default:
+			continue
+		}
+		if matches(reference) {
+			references = append(references, reference)
+		}
+	}
+	slices.SortFunc(references, func(a Reference, b Reference) int {
+		return strings.Compare(a.FullName, b.FullName)
+	})
+	return references, nil
+}
+
+// InvalidateReferences drops the cached references of the repository, so the next resolution sees the current
+// state of the remote.
+func (r *ReferenceResolver) InvalidateReferences(ctx context.Context, repositoryURL string) error {
+	if strings.TrimSpace(repositoryURL) == "" {
+		return NewReferenceRequestInvalidError("repository url must not be empty")
+	}
+	return r.referenceCache.Invalidate(ctx, repositoryURL)
+}
+
+func newReferenceMatcher(filter *ReferenceFilter) (func(Reference) bool, error) {
+	if filter == nil {
+		return func(Reference) bool { return true }, nil
+	}
+
+	kinds := filter.Kinds
+	var constraints *semver.Constraints
+	if filter.VersionRange != nil {
+		var err error
+		if constraints, err = semver.NewConstraint(*filter.VersionRange); err != nil {
+			return nil, NewReferenceRequestInvalidError("invalid version range: " + err.Error())
+		}
+		kinds = []ReferenceKind{ReferenceKindTag}
+	}
+	for _, kind := range kinds {
+		if kind != ReferenceKindBranch && kind != ReferenceKindTag {
+			return nil, NewReferenceRequestInvalidError("unsupported reference kind '" + string(kind) + "'")
+		}
+	}
+	if filter.Pattern != nil {
+		if _, err := path.Match(*filter.Pattern, ""); err != nil {
+			return nil, NewReferenceRequestInvalidError("invalid pattern: " + err.Error())
+		}
+	}
+
+	return func(reference Reference) bool {
+		if len(kinds) > 0 && !slices.Contains(kinds, reference.Kind) {
+			return false
+		}
+		if filter.Pattern != nil {
+			if matched, _ := path.Match(*filter.Pattern, reference.Name); !matched {
+				return false
+			}
+		}
+		if constraints != nil {
+			version, err := semver.NewVersion(reference.Name)
+			if err != nil || !constraints.Check(version) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
@@ -0,0 +1,178 @@
+package gitreference
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	augit "github.com/Roshick/manifest-maestro/internal/repository/git"
+	"github.com/Roshick/manifest-maestro/internal/utils"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	mainCommit    = "1111111111111111111111111111111111111111"
+	tagCommit     = "2222222222222222222222222222222222222222"
+	tagObject     = "3333333333333333333333333333333333333333"
+	releaseCommit = "4444444444444444444444444444444444444444"
+)
+
+type fakeGit struct {
+	references     []*plumbing.Reference
+	commitRequests int
+}
+
+func (g *fakeGit) ResolveReference(
+	_ context.Context, repositoryURL string, gitReference string,
+) (*augit.ResolvedReference, error) {
+	if gitReference == "main" {
+		return &augit.ResolvedReference{Reference: "refs/heads/main", CommitHash: mainCommit}, nil
+	}
+	return nil, augit.NewRepositoryReferenceNotFoundError(repositoryURL, gitReference)
+}
+
+func (g *fakeGit) RemoteReferences(_ context.Context, _ string) ([]*plumbing.Reference, error) {
+	return g.references, nil
+}
+
+func (g *fakeGit) CommitMetadata(
+	_ context.Context, _ string, commitHash string,
+) (*augit.CommitMetadata, error) {
+	g.commitRequests++
+	when := time.Date(2024, 5, 6, 7, 8, 9, 0, time.FixedZone("CEST", 2*60*60))
+	return &augit.CommitMetadata{
+		Hash:      commitHash,
+		Author:    augit.Signature{Name: "author", Email: "author@example.com", When: when},
+		Committer: augit.Signature{Name: "committer", Email: "committer@example.com", When: when.Add(time.Hour)},
+		Message:   "initial commit\n",
+	}, nil
+}
+
+type fakeReferenceCache struct {
+	invalidated []string
+}
+
+func (c *fakeReferenceCache) Invalidate(_ context.Context, repositoryURL string) error {
+	c.invalidated = append(c.invalidated, repositoryURL)
+	return nil
+}
+
+func newFakeGit() *fakeGit {
+	return &fakeGit{
+		references: []*plumbing.Reference{
+			plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/main"),
+			plumbing.NewHashReference("refs/heads/main", plumbing.NewHash(mainCommit)),
+			plumbing.NewHashReference("refs/heads/release/1.x", plumbing.NewHash(releaseCommit)),
+			plumbing.NewHashReference("refs/tags/v1.0.0", plumbing.NewHash(tagObject)),
+			plumbing.NewHashReference("refs/tags/v1.0.0^{}", plumbing.NewHash(tagCommit)),
+			plumbing.NewHashReference("refs/tags/v2.0.0", plumbing.NewHash(mainCommit)),
+			plumbing.NewHashReference("refs/pull/1/head", plumbing.NewHash(releaseCommit)),
+		},
+	}
+}
+
+func TestReferenceResolver_ResolveReference(t *testing.T) {
+	git := newFakeGit()
+	resolver := NewReferenceResolver(git, &fakeReferenceCache{})
+
+	resolved, err := resolver.ResolveReference(context.Background(), "https://example.com/repo.git", "main", true)
+	require.NoError(t, err)
+	assert.Equal(t, "refs/heads/main", resolved.Reference)
+	assert.Equal(t, mainCommit, resolved.CommitHash)
+	require.NotNil(t, resolved.Commit)
+	assert.Equal(t, "author", resolved.Commit.AuthorName)
+	assert.Equal(t, "committer@example.com", resolved.Commit.CommitterEmail)
+	assert.Equal(t, time.Date(2024, 5, 6, 6, 8, 9, 0, time.UTC), resolved.Commit.CommitterDate)
+	assert.Equal(t, "initial commit\n", resolved.Commit.Message)
+
+	resolved, err = resolver.ResolveReference(context.Background(), "https://example.com/repo.git", "main", false)
+	require.NoError(t, err)
+	assert.Nil(t, resolved.Commit)
+	assert.Equal(t, 1, git.commitRequests)
+}
+
+func TestReferenceResolver_ResolveReference_Errors(t *testing.T) {
+	resolver := NewReferenceResolver(newFakeGit(), &fakeReferenceCache{})
+
+	_, err := resolver.ResolveReference(context.Background(), "https://example.com/repo.git", "", true)
+	assert.True(t, errors.As(err, new(*ReferenceRequestInvalidError)))
+
+	_, err = resolver.ResolveReference(context.Background(), "https://example.com/repo.git", "missing", true)
+	assert.True(t, errors.As(err, new(*augit.RepositoryReferenceNotFoundError)))
+}
+
+func TestReferenceResolver_ListReferences(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filter   *ReferenceFilter
+		expected []Reference
+	}{
+		{
+			name: "all",
+			expected: []Reference{
+				{Name: "main", FullName: "refs/heads/main", Kind: ReferenceKindBranch, CommitHash: mainCommit},
+				{Name: "release/1.x", FullName: "refs/heads/release/1.x", Kind: ReferenceKindBranch, CommitHash: releaseCommit},
+				{Name: "v1.0.0", FullName: "refs/tags/v1.0.0", Kind: ReferenceKindTag, CommitHash: tagCommit},
+				{Name: "v2.0.0", FullName: "refs/tags/v2.0.0", Kind: ReferenceKindTag, CommitHash: mainCommit},
+			},
+		},
+		{
+			name:   "branches",
+			filter: &ReferenceFilter{Kinds: []ReferenceKind{ReferenceKindBranch}},
+			expected: []Reference{
+				{Name: "main", FullName: "refs/heads/main", Kind: ReferenceKindBranch, CommitHash: mainCommit},
+				{Name: "release/1.x", FullName: "refs/heads/release/1.x", Kind: ReferenceKindBranch, CommitHash: releaseCommit},
+			},
+		},
+		{
+			name:   "pattern",
+			filter: &ReferenceFilter{Pattern: utils.Ptr("release/*")},
+			expected: []Reference{
+				{Name: "release/1.x", FullName: "refs/heads/release/1.x", Kind: ReferenceKindBranch, CommitHash: releaseCommit},
+			},
+		},
+		{
+			name:   "version range",
+			filter: &ReferenceFilter{VersionRange: utils.Ptr("<2")},
+			expected: []Reference{
+				{Name: "v1.0.0", FullName: "refs/tags/v1.0.0", Kind: ReferenceKindTag, CommitHash: tagCommit},
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			resolver := NewReferenceResolver(newFakeGit(), &fakeReferenceCache{})
+
+			references, err := resolver.ListReferences(context.Background(), "https://example.com/repo.git", testCase.filter)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, references)
+		})
+	}
+}
+
+func TestReferenceResolver_ListReferences_InvalidFilter(t *testing.T) {
+	resolver := NewReferenceResolver(newFakeGit(), &fakeReferenceCache{})
+
+	for _, filter := range []*ReferenceFilter{
+		{Kinds: []ReferenceKind{"COMMIT"}},
+		{Pattern: utils.Ptr("[")},
+		{VersionRange: utils.Ptr("not a version")},
+	} {
+		_, err := resolver.ListReferences(context.Background(), "https://example.com/repo.git", filter)
+		assert.True(t, errors.As(err, new(*ReferenceRequestInvalidError)))
+	}
+}
+
+func TestReferenceResolver_InvalidateReferences(t *testing.T) {
+	referenceCache := &fakeReferenceCache{}
+	resolver := NewReferenceResolver(newFakeGit(), referenceCache)
+
+	require.NoError(t, resolver.InvalidateReferences(context.Background(), "https://example.com/repo.git"))
+	assert.Equal(t, []string{"https://example.com/repo.git"}, referenceCache.invalidated)
+
+	err := resolver.InvalidateReferences(context.Background(), " ")
+	assert.True(t, errors.As(err, new(*ReferenceRequestInvalidError)))
+}
@@ -15,6 +15,8 @@ type Chart struct {
 	chart      *chart.Chart
 	fileSystem *filesystem.FileSystem
 	targetPath string
+	// digest of the chart manifest, only known for charts retrieved from OCI registries
+	digest string
 }
 
 func (c *Chart) DefaultValues() map[string]any {
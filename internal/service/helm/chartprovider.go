@@ -5,13 +5,18 @@ import (
 	"context"
 	"fmt"
 	"io/fs"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
 
 	openapi "github.com/Roshick/manifest-maestro-api"
+	"github.com/Roshick/manifest-maestro/internal/service/bucket"
 	"github.com/Roshick/manifest-maestro/internal/service/cache"
+	"github.com/Roshick/manifest-maestro/internal/service/localpath"
+	"github.com/Roshick/manifest-maestro/internal/service/upload"
 	"github.com/Roshick/manifest-maestro/internal/utils"
+	pkgarchive "github.com/Roshick/manifest-maestro/pkg/archive"
 	"github.com/Roshick/manifest-maestro/pkg/filesystem"
 	aulogging "github.com/StephanHCB/go-autumn-logging"
 	"golang.org/x/sync/errgroup"
@@ -28,51 +33,129 @@ const (
 type ChartProvider struct {
 	helmChartCache     *cache.HelmChartCache
 	gitRepositoryCache *cache.GitRepositoryCache
+	localPathSource    *localpath.Source
+	bucketSource       *bucket.Source
 }
 
 func NewChartProvider(
 	helmChartCache *cache.HelmChartCache,
 	gitRepositoryCache *cache.GitRepositoryCache,
+	localPathSource *localpath.Source,
+	bucketSource *bucket.Source,
 ) *ChartProvider {
 	return &ChartProvider{
 		helmChartCache:     helmChartCache,
 		gitRepositoryCache: gitRepositoryCache,
+		localPathSource:    localPathSource,
+		bucketSource:       bucketSource,
 	}
 }
 
 func (p *ChartProvider) GetHelmChart(
 	ctx context.Context,
-	abstractReference openapi.HelmChartReference,
+	abstractReference ChartReference,
 ) (*Chart, error) {
+	if reference := abstractReference.LocalPathReference; reference != nil {
+		return p.getHelmChartFromLocalPathReference(ctx, *reference)
+	}
+	if reference := abstractReference.BucketReference; reference != nil {
+		return p.getHelmChartFromBucketReference(ctx, *reference)
+	}
 	if reference := abstractReference.HelmChartRepositoryChartReference; reference != nil {
 		return p.getHelmChartFromHelmRepositoryChartReference(ctx, *reference)
 	}
+	if reference := abstractReference.HelmChartURLReference; reference != nil {
+		return p.getHelmChartFromHelmChartURLReference(ctx, *reference)
+	}
 	if reference := abstractReference.GitRepositoryPathReference; reference != nil {
 		return p.getHelmChartFromGitRepositoryPathReference(ctx, *reference)
 	}
 	return nil, NewChartReferenceInvalidError()
 }
 
+// GetHelmChartFromArchive builds the chart from an uploaded gzip-compressed tarball or zip archive, e.g. a packaged
+// chart, located at the slash-separated path of the archive. Without path, the archive root or, for packaged charts,
+// its single top-level directory is used.
+func (p *ChartProvider) GetHelmChartFromArchive(
+	ctx context.Context,
+	content []byte,
+	archivePath string,
+) (*Chart, error) {
+	fileSystem, targetPath, err := upload.Extract(ctx, content, archivePath, chartFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	helmChart, err := p.buildChart(ctx, fileSystem, targetPath)
+	if err != nil {
+		return nil, NewChartBuildError(err)
+	}
+	return helmChart, nil
+}
+
 func (p *ChartProvider) getHelmChartFromGitRepositoryPathReference(
 	ctx context.Context,
 	reference openapi.GitRepositoryPathReference,
 ) (*Chart, error) {
-	fileSystem := filesystem.New()
+	if !utils.IsEmpty(reference.Path) && path.IsAbs(*reference.Path) {
+		return nil, fmt.Errorf("git source path cannot be absolute")
+	}
+
+	var fileSystem *filesystem.FileSystem
+	var err error
+	if utils.IsEmpty(reference.Path) {
+		fileSystem, err = p.gitRepositoryCache.RetrieveRepositoryFileSystem(
+			ctx,
+			reference.RepositoryURL,
+			reference.Reference,
+		)
+	} else {
+		// only the chart and its local dependencies are extracted from the repository
+		fileSystem, err = p.gitRepositoryCache.RetrieveRepositorySubtreeFileSystem(
+			ctx,
+			reference.RepositoryURL,
+			reference.Reference,
+			[]string{path.Join("/", *reference.Path)},
+			scanChartPaths,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
 
 	targetPath := fileSystem.Root
 	if !utils.IsEmpty(reference.Path) {
-		if fileSystem.IsAbs(*reference.Path) {
-			return nil, fmt.Errorf("git source path cannot be absolute")
-		}
 		targetPath = fileSystem.Join(targetPath, *reference.Path)
 	}
 
-	err := p.gitRepositoryCache.RetrieveRepositoryToFileSystem(
-		ctx,
-		reference.RepositoryURL,
-		reference.Reference,
-		fileSystem,
-	)
+	helmChart, err := p.buildChart(ctx, fileSystem, targetPath)
+	if err != nil {
+		return nil, NewChartBuildError(err)
+	}
+	return helmChart, nil
+}
+
+func (p *ChartProvider) getHelmChartFromLocalPathReference(
+	ctx context.Context,
+	reference localpath.Reference,
+) (*Chart, error) {
+	fileSystem, targetPath, err := p.localPathSource.RetrieveFileSystem(ctx, reference, scanChartPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	helmChart, err := p.buildChart(ctx, fileSystem, targetPath)
+	if err != nil {
+		return nil, NewChartBuildError(err)
+	}
+	return helmChart, nil
+}
+
+func (p *ChartProvider) getHelmChartFromBucketReference(
+	ctx context.Context,
+	reference bucket.Reference,
+) (*Chart, error) {
+	fileSystem, targetPath, err := p.bucketSource.RetrieveFileSystem(ctx, reference, chartFileName)
 	if err != nil {
 		return nil, err
 	}
@@ -88,9 +171,7 @@ func (p *ChartProvider) getHelmChartFromHelmRepositoryChartReference(
 	ctx context.Context,
 	reference openapi.HelmChartRepositoryChartReference,
 ) (*Chart, error) {
-	fileSystem := filesystem.New()
-
-	err := p.helmChartCache.RetrieveChartToFileSystem(ctx, reference, fileSystem)
+	fileSystem, chartDigest, err := p.helmChartCache.RetrieveChartFileSystem(ctx, reference)
 	if err != nil {
 		return nil, err
 	}
@@ -100,6 +181,24 @@ func (p *ChartProvider) getHelmChartFromHelmRepositoryChartReference(
 	if err != nil {
 		return nil, NewChartBuildError(err)
 	}
+	helmChart.digest = chartDigest
+	return helmChart, nil
+}
+
+func (p *ChartProvider) getHelmChartFromHelmChartURLReference(
+	ctx context.Context,
+	reference cache.HelmChartURLReference,
+) (*Chart, error) {
+	fileSystem, err := p.helmChartCache.RetrieveChartFromURLFileSystem(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	targetPath := pkgarchive.Root(fileSystem, fileSystem.Root, chartFileName)
+	helmChart, err := p.buildChart(ctx, fileSystem, targetPath)
+	if err != nil {
+		return nil, NewChartBuildError(err)
+	}
 	return helmChart, nil
 }
 
@@ -110,6 +209,9 @@ func (p *ChartProvider) buildChart(
 ) (*Chart, error) {
 	aulogging.Logger.Ctx(ctx).Info().Printf("building chart at %s", targetPath)
 
+	// building a chart creates its charts directory, which must not leak into the source file system
+	fileSystem = filesystem.NewOverlay(fileSystem)
+
 	helmChart, err := p.loadChart(ctx, fileSystem, targetPath)
 	if err != nil {
 		return nil, err
@@ -173,7 +275,7 @@ func (p *ChartProvider) buildChart(
 		for _, rd := range remoteDeps {
 			dep := rd
 			g.Go(func() error {
-				chartBytes, innerErr := p.helmChartCache.RetrieveChart(gCtx, openapi.HelmChartRepositoryChartReference{
+				chartBytes, _, innerErr := p.helmChartCache.RetrieveChart(gCtx, openapi.HelmChartRepositoryChartReference{
 					RepositoryURL: dep.dependency.Repository,
 					ChartName:     dep.dependency.Name,
 					ChartVersion:  utils.Ptr(dep.dependency.Version),
@@ -5,16 +5,23 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	openapi "github.com/Roshick/manifest-maestro-api"
+	"github.com/Roshick/manifest-maestro/internal/repository/helmremote"
+	"github.com/Roshick/manifest-maestro/internal/repository/s3"
+	"github.com/Roshick/manifest-maestro/internal/service/bucket"
 	"github.com/Roshick/manifest-maestro/internal/service/cache"
+	"github.com/Roshick/manifest-maestro/internal/service/localpath"
+	"github.com/Roshick/manifest-maestro/internal/service/upload"
 	"github.com/Roshick/manifest-maestro/internal/utils"
 	"github.com/Roshick/manifest-maestro/pkg/filesystem"
 	"github.com/Roshick/manifest-maestro/pkg/targz"
 	"github.com/Roshick/manifest-maestro/test/mock/cachemock"
 	"github.com/Roshick/manifest-maestro/test/mock/gitmock"
 	"github.com/Roshick/manifest-maestro/test/mock/helmremotemock"
+	"github.com/Roshick/manifest-maestro/test/mock/s3mock"
 	"github.com/go-git/go-git/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -32,7 +39,7 @@ func setupChartProvider(t *testing.T) (*ChartProvider, *helmremotemock.ChartMock
 		})
 
 	gitCacheMock := cachemock.New[[]byte]()
-	gitRepoCache := cache.NewGitRepositoryCache(gitMock, gitCacheMock)
+	gitRepoCache := cache.NewGitRepositoryCache(gitMock, nil, gitCacheMock, cache.NewFileSystemCache(0), false)
 
 	chartRemoteMock := helmremotemock.NewChartMock()
 	indexRemoteMock := helmremotemock.NewIndexMock()
@@ -40,16 +47,16 @@ func setupChartProvider(t *testing.T) (*ChartProvider, *helmremotemock.ChartMock
 	chartCacheMock := cachemock.New[[]byte]()
 
 	indexCache := cache.NewHelmIndexCache(indexRemoteMock, indexCacheMock)
-	helmChartCache := cache.NewHelmChartCache(chartRemoteMock, indexCache, chartCacheMock)
+	helmChartCache := cache.NewHelmChartCache(chartRemoteMock, indexCache, chartCacheMock, cache.NewFileSystemCache(0))
 
-	provider := NewChartProvider(helmChartCache, gitRepoCache)
+	provider := NewChartProvider(helmChartCache, gitRepoCache, nil, nil)
 	return provider, chartRemoteMock, gitMock
 }
 
 func TestChartProvider_GetHelmChart_InvalidReference(t *testing.T) {
 	provider, _, _ := setupChartProvider(t)
 
-	_, err := provider.GetHelmChart(context.Background(), openapi.HelmChartReference{})
+	_, err := provider.GetHelmChart(context.Background(), ChartReference{})
 	assert.Error(t, err)
 	assert.IsType(t, &ChartReferenceInvalidError{}, err)
 }
@@ -69,23 +76,23 @@ func TestChartProvider_GetHelmChart_GitReference_NoDependencies(t *testing.T) {
 		})
 
 	gitCacheMock := cachemock.New[[]byte]()
-	gitRepoCache := cache.NewGitRepositoryCache(gitMock, gitCacheMock)
+	gitRepoCache := cache.NewGitRepositoryCache(gitMock, nil, gitCacheMock, cache.NewFileSystemCache(0), false)
 
 	chartRemoteMock := helmremotemock.NewChartMock()
 	indexRemoteMock := helmremotemock.NewIndexMock()
 	indexCacheMock := cachemock.New[[]byte]()
 	chartCacheMock := cachemock.New[[]byte]()
 	indexCache := cache.NewHelmIndexCache(indexRemoteMock, indexCacheMock)
-	helmChartCache := cache.NewHelmChartCache(chartRemoteMock, indexCache, chartCacheMock)
+	helmChartCache := cache.NewHelmChartCache(chartRemoteMock, indexCache, chartCacheMock, cache.NewFileSystemCache(0))
 
-	provider := NewChartProvider(helmChartCache, gitRepoCache)
+	provider := NewChartProvider(helmChartCache, gitRepoCache, nil, nil)
 
-	chart, err := provider.GetHelmChart(ctx, openapi.HelmChartReference{
+	chart, err := provider.GetHelmChart(ctx, ChartReference{HelmChartReference: openapi.HelmChartReference{
 		GitRepositoryPathReference: &openapi.GitRepositoryPathReference{
 			RepositoryURL: "https://example.com/repo.git",
 			Reference:     "refs/heads/main",
 		},
-	})
+	}})
 	require.NoError(t, err)
 	require.NotNil(t, chart)
 
@@ -94,6 +101,181 @@ func TestChartProvider_GetHelmChart_GitReference_NoDependencies(t *testing.T) {
 	assert.Equal(t, "0.1.0", metadata.Version)
 }
 
+func TestChartProvider_GetHelmChart_GitReference_ExtractsOnlyChartAndLocalDependencies(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir := t.TempDir()
+	for _, dir := range []string{"app", "common", "unrelated"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "charts", dir), 0755))
+	}
+	writeChartToDir(t, filepath.Join(tmpDir, "charts", "app"), "app", "0.1.0", []chartDep{
+		{Name: "common", Version: "0.2.0", Repository: "file://../common"},
+	})
+	writeChartToDir(t, filepath.Join(tmpDir, "charts", "common"), "common", "0.2.0", nil)
+	writeChartToDir(t, filepath.Join(tmpDir, "charts", "unrelated"), "unrelated", "0.3.0", nil)
+
+	gitMock := gitmock.NewMock().
+		WithToHash(func(_ context.Context, _ string, _ string) (string, error) {
+			return "abc123commithashthatisfortycharactersss", nil
+		}).
+		WithCloneCommit(func(_ context.Context, _ string, _ string) (*git.Repository, error) {
+			return gitmock.CreateRepoFromDir(tmpDir)
+		})
+
+	gitCacheMock := cachemock.New[[]byte]()
+	gitRepoCache := cache.NewGitRepositoryCache(gitMock, nil, gitCacheMock, cache.NewFileSystemCache(64<<20), false)
+
+	indexCache := cache.NewHelmIndexCache(helmremotemock.NewIndexMock(), cachemock.New[[]byte]())
+	helmChartCache := cache.NewHelmChartCache(
+		helmremotemock.NewChartMock(), indexCache, cachemock.New[[]byte](), cache.NewFileSystemCache(0),
+	)
+
+	provider := NewChartProvider(helmChartCache, gitRepoCache, nil, nil)
+
+	chart, err := provider.GetHelmChart(ctx, ChartReference{HelmChartReference: openapi.HelmChartReference{
+		GitRepositoryPathReference: &openapi.GitRepositoryPathReference{
+			RepositoryURL: "https://example.com/repo.git",
+			Reference:     "refs/heads/main",
+			Path:          utils.Ptr("charts/app"),
+		},
+	}})
+	require.NoError(t, err)
+	require.NotNil(t, chart)
+
+	assert.Equal(t, "app", chart.Metadata().Name)
+	require.Len(t, chart.chart.Dependencies(), 1)
+	assert.Equal(t, "common", chart.chart.Dependencies()[0].Name())
+	assert.False(t, chart.fileSystem.Exists("/charts/unrelated"), "unrelated charts should not be extracted")
+	assert.Equal(t, int32(1), gitMock.CloneCommitCallCount.Load())
+}
+
+func TestChartProvider_GetHelmChart_LocalPathReference(t *testing.T) {
+	ctx := context.Background()
+
+	baseDir := t.TempDir()
+	for _, dir := range []string{"app", "common", "unrelated"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(baseDir, "charts", dir), 0755))
+	}
+	writeChartToDir(t, filepath.Join(baseDir, "charts", "app"), "app", "0.1.0", []chartDep{
+		{Name: "common", Version: "0.2.0", Repository: "file://../common"},
+	})
+	writeChartToDir(t, filepath.Join(baseDir, "charts", "common"), "common", "0.2.0", nil)
+	writeChartToDir(t, filepath.Join(baseDir, "charts", "unrelated"), "unrelated", "0.3.0", nil)
+
+	localPathSource, err := localpath.NewSource([]string{baseDir})
+	require.NoError(t, err)
+	indexCache := cache.NewHelmIndexCache(helmremotemock.NewIndexMock(), cachemock.New[[]byte]())
+	helmChartCache := cache.NewHelmChartCache(
+		helmremotemock.NewChartMock(), indexCache, cachemock.New[[]byte](), cache.NewFileSystemCache(0),
+	)
+	provider := NewChartProvider(helmChartCache, nil, localPathSource, nil)
+
+	chart, err := provider.GetHelmChart(ctx, ChartReference{
+		LocalPathReference: &localpath.Reference{Path: filepath.Join(baseDir, "charts", "app")},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "app", chart.Metadata().Name)
+	require.Len(t, chart.chart.Dependencies(), 1)
+	assert.Equal(t, "common", chart.chart.Dependencies()[0].Name())
+	assert.False(t, chart.fileSystem.Exists("/charts/unrelated"), "unrelated charts should not be loaded")
+
+	_, err = provider.GetHelmChart(ctx, ChartReference{
+		LocalPathReference: &localpath.Reference{Path: t.TempDir()},
+	})
+	assert.ErrorAs(t, err, new(*localpath.PathNotAllowedError))
+}
+
+func TestChartProvider_GetHelmChart_Bucket(t *testing.T) {
+	ctx := context.Background()
+	server := s3mock.New("")
+	defer server.Close()
+	server.PutObject("charts", "stable/app-1.0.0.tgz", createChartTarball(t, "app", "1.0.0", nil))
+	server.PutObject("charts", "stable/index.yaml", []byte(`apiVersion: v1
+entries:
+  app:
+  - name: app
+    version: 1.0.0
+    urls:
+    - app-1.0.0.tgz
+`))
+
+	objectStorage := s3.New(nil, []string{strings.TrimPrefix(server.URL, "http://")}, nil)
+	remote, err := helmremote.New(nil, nil, objectStorage, nil)
+	require.NoError(t, err)
+	indexCache := cache.NewHelmIndexCache(remote, cachemock.New[[]byte]())
+	helmChartCache := cache.NewHelmChartCache(remote, indexCache, cachemock.New[[]byte](), cache.NewFileSystemCache(0))
+	bucketSource := bucket.NewSource(objectStorage, cachemock.New[[]byte](), cache.NewFileSystemCache(0))
+	provider := NewChartProvider(helmChartCache, nil, nil, bucketSource)
+
+	chart, err := provider.GetHelmChart(ctx, ChartReference{
+		BucketReference: &bucket.Reference{Endpoint: server.URL, Bucket: "charts", Key: "stable/app-1.0.0.tgz"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "app", chart.Metadata().Name)
+
+	repositoryURL := "s3+http://" + strings.TrimPrefix(server.URL, "http://") + "/charts/stable"
+	chart, err = provider.GetHelmChart(ctx, ChartReference{HelmChartReference: openapi.HelmChartReference{
+		HelmChartRepositoryChartReference: &openapi.HelmChartRepositoryChartReference{
+			RepositoryURL: repositoryURL,
+			ChartName:     "app",
+			ChartVersion:  utils.Ptr("1.0.0"),
+		},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", chart.Metadata().Version)
+
+	_, err = provider.GetHelmChart(ctx, ChartReference{HelmChartReference: openapi.HelmChartReference{
+		HelmChartRepositoryChartReference: &openapi.HelmChartRepositoryChartReference{
+			RepositoryURL: repositoryURL + "-missing",
+			ChartName:     "app",
+		},
+	}})
+	assert.ErrorAs(t, err, new(*helmremote.RepositoryNotFoundError))
+}
+
+func TestChartProvider_GetHelmChart_HelmChartURLReference(t *testing.T) {
+	ctx := context.Background()
+
+	tarball := createChartTarball(t, "vendored", "0.3.0", []chartDep{
+		{Name: "dep-chart", Version: "2.0.0", Repository: "oci://example.com/deps"},
+	})
+
+	chartRemoteMock := helmremotemock.NewChartMock()
+	chartRemoteMock.AddChart("https://github.com/vendor/charts/releases/download/v0.3.0/vendored-0.3.0.tgz", tarball)
+	chartRemoteMock.AddChart("oci://example.com/deps/dep-chart:2.0.0", createChartTarball(t, "dep-chart", "2.0.0", nil))
+
+	indexCache := cache.NewHelmIndexCache(helmremotemock.NewIndexMock(), cachemock.New[[]byte]())
+	helmChartCache := cache.NewHelmChartCache(
+		chartRemoteMock, indexCache, cachemock.New[[]byte](), cache.NewFileSystemCache(0))
+	provider := NewChartProvider(helmChartCache, nil, nil, nil)
+
+	chart, err := provider.GetHelmChart(ctx, ChartReference{HelmChartURLReference: &cache.HelmChartURLReference{
+		URL: "https://github.com/vendor/charts/releases/download/v0.3.0/vendored-0.3.0.tgz",
+	}})
+	require.NoError(t, err)
+	metadata := chart.Metadata()
+	assert.Equal(t, "vendored", metadata.Name)
+	assert.Equal(t, "0.3.0", metadata.Version)
+	require.Len(t, metadata.Dependencies, 1)
+	assert.Equal(t, "dep-chart", metadata.Dependencies[0].Name)
+}
+
+func TestChartProvider_GetHelmChartFromArchive(t *testing.T) {
+	ctx := context.Background()
+
+	provider, _, gitMock := setupChartProvider(t)
+
+	chart, err := provider.GetHelmChartFromArchive(ctx, createChartTarball(t, "unpublished", "0.1.0", nil), "")
+	require.NoError(t, err)
+	assert.Equal(t, "unpublished", chart.Metadata().Name)
+	assert.Equal(t, "0.1.0", chart.Metadata().Version)
+	assert.Equal(t, int32(0), gitMock.CloneCommitCallCount.Load())
+
+	_, err = provider.GetHelmChartFromArchive(ctx, []byte("not an archive"), "")
+	assert.ErrorAs(t, err, new(*upload.ArchiveInvalidError))
+}
+
 func TestChartProvider_GetHelmChart_HelmRepoReference_NoDependencies(t *testing.T) {
 	ctx := context.Background()
 
@@ -109,24 +291,25 @@ func TestChartProvider_GetHelmChart_HelmRepoReference_NoDependencies(t *testing.
 	gitMock := gitmock.NewMock()
 
 	indexCache := cache.NewHelmIndexCache(indexRemoteMock, indexCacheMock)
-	helmChartCache := cache.NewHelmChartCache(chartRemoteMock, indexCache, chartCacheMock)
-	gitRepoCache := cache.NewGitRepositoryCache(gitMock, gitCacheMock)
+	helmChartCache := cache.NewHelmChartCache(chartRemoteMock, indexCache, chartCacheMock, cache.NewFileSystemCache(0))
+	gitRepoCache := cache.NewGitRepositoryCache(gitMock, nil, gitCacheMock, cache.NewFileSystemCache(0), false)
 
-	provider := NewChartProvider(helmChartCache, gitRepoCache)
+	provider := NewChartProvider(helmChartCache, gitRepoCache, nil, nil)
 
-	chart, err := provider.GetHelmChart(ctx, openapi.HelmChartReference{
+	chart, err := provider.GetHelmChart(ctx, ChartReference{HelmChartReference: openapi.HelmChartReference{
 		HelmChartRepositoryChartReference: &openapi.HelmChartRepositoryChartReference{
 			RepositoryURL: "oci://example.com/charts",
 			ChartName:     "mychart",
 			ChartVersion:  utils.Ptr("1.0.0"),
 		},
-	})
+	}})
 	require.NoError(t, err)
 	require.NotNil(t, chart)
 
 	metadata := chart.Metadata()
 	assert.Equal(t, "mychart", metadata.Name)
 	assert.Equal(t, "1.0.0", metadata.Version)
+	assert.Equal(t, helmremotemock.Digest(tarball), chart.digest)
 }
 
 func TestChartProvider_GetHelmChart_WithDependencies(t *testing.T) {
@@ -148,18 +331,18 @@ func TestChartProvider_GetHelmChart_WithDependencies(t *testing.T) {
 	gitMock := gitmock.NewMock()
 
 	indexCache := cache.NewHelmIndexCache(indexRemoteMock, indexCacheMock)
-	helmChartCache := cache.NewHelmChartCache(chartRemoteMock, indexCache, chartCacheMock)
-	gitRepoCache := cache.NewGitRepositoryCache(gitMock, gitCacheMock)
+	helmChartCache := cache.NewHelmChartCache(chartRemoteMock, indexCache, chartCacheMock, cache.NewFileSystemCache(0))
+	gitRepoCache := cache.NewGitRepositoryCache(gitMock, nil, gitCacheMock, cache.NewFileSystemCache(0), false)
 
-	provider := NewChartProvider(helmChartCache, gitRepoCache)
+	provider := NewChartProvider(helmChartCache, gitRepoCache, nil, nil)
 
-	chart, err := provider.GetHelmChart(ctx, openapi.HelmChartReference{
+	chart, err := provider.GetHelmChart(ctx, ChartReference{HelmChartReference: openapi.HelmChartReference{
 		HelmChartRepositoryChartReference: &openapi.HelmChartRepositoryChartReference{
 			RepositoryURL: "oci://example.com/charts",
 			ChartName:     "main-chart",
 			ChartVersion:  utils.Ptr("1.0.0"),
 		},
-	})
+	}})
 	require.NoError(t, err)
 	require.NotNil(t, chart)
 
@@ -196,18 +379,18 @@ func TestChartProvider_GetHelmChart_MultipleDependencies(t *testing.T) {
 	gitMock := gitmock.NewMock()
 
 	indexCache := cache.NewHelmIndexCache(indexRemoteMock, indexCacheMock)
-	helmChartCache := cache.NewHelmChartCache(chartRemoteMock, indexCache, chartCacheMock)
-	gitRepoCache := cache.NewGitRepositoryCache(gitMock, gitCacheMock)
+	helmChartCache := cache.NewHelmChartCache(chartRemoteMock, indexCache, chartCacheMock, cache.NewFileSystemCache(0))
+	gitRepoCache := cache.NewGitRepositoryCache(gitMock, nil, gitCacheMock, cache.NewFileSystemCache(0), false)
 
-	provider := NewChartProvider(helmChartCache, gitRepoCache)
+	provider := NewChartProvider(helmChartCache, gitRepoCache, nil, nil)
 
-	chart, err := provider.GetHelmChart(ctx, openapi.HelmChartReference{
+	chart, err := provider.GetHelmChart(ctx, ChartReference{HelmChartReference: openapi.HelmChartReference{
 		HelmChartRepositoryChartReference: &openapi.HelmChartRepositoryChartReference{
 			RepositoryURL: "oci://example.com/charts",
 			ChartName:     "main",
 			ChartVersion:  utils.Ptr("1.0.0"),
 		},
-	})
+	}})
 	require.NoError(t, err)
 	require.NotNil(t, chart)
 
@@ -35,7 +35,7 @@ func (r *ChartRenderer) Render(
 	ctx context.Context,
 	helmChart *Chart,
 	parameters *openapi.HelmRenderParameters,
-) ([]openapi.Manifest, *openapi.HelmRenderMetadata, error) {
+) ([]openapi.Manifest, *RenderMetadata, error) {
 	manifests, metadata, err := r.render(ctx, helmChart, parameters)
 	if err != nil {
 		return nil, nil, NewChartRenderError(err)
@@ -47,7 +47,7 @@ func (r *ChartRenderer) render(
 	ctx context.Context,
 	helmChart *Chart,
 	parameters *openapi.HelmRenderParameters,
-) ([]openapi.Manifest, *openapi.HelmRenderMetadata, error) {
+) ([]openapi.Manifest, *RenderMetadata, error) {
 	actualParameters := openapi.HelmRenderParameters{}
 	if parameters != nil {
 		actualParameters = *parameters
@@ -85,14 +85,19 @@ func (r *ChartRenderer) render(
 			mergedValues = valuesCopy.(common.Values).AsMap()
 		}
 	}
-	metadata := &openapi.HelmRenderMetadata{
-		ReleaseName:   options.Name,
-		Namespace:     options.Namespace,
-		ApiVersions:   capabilities.APIVersions,
-		KubeVersion:   capabilities.KubeVersion.String(),
-		HelmVersion:   capabilities.HelmVersion.Version,
-		MergedValues:  mergedValues,
-		ChartMetadata: helmChart.Metadata(),
+	metadata := &RenderMetadata{
+		HelmRenderMetadata: openapi.HelmRenderMetadata{
+			ReleaseName:   options.Name,
+			Namespace:     options.Namespace,
+			ApiVersions:   capabilities.APIVersions,
+			KubeVersion:   capabilities.KubeVersion.String(),
+			HelmVersion:   capabilities.HelmVersion.Version,
+			MergedValues:  mergedValues,
+			ChartMetadata: helmChart.Metadata(),
+		},
+	}
+	if helmChart.digest != "" {
+		metadata.ChartDigest = utils.Ptr(helmChart.digest)
 	}
 
 	var renderEngine engine.Engine
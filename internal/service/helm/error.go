@@ -5,7 +5,8 @@ import "fmt"
 type ChartReferenceInvalidError struct{}
 
 func (e *ChartReferenceInvalidError) Error() string {
-	return "Helm chart reference is neither a valid Helm chart repository nor a Git repository path chart reference"
+	return "Helm chart reference is neither a valid Helm chart repository, Helm chart URL, Git repository path, local path " +
+		"nor bucket chart reference"
 }
 
 func NewChartReferenceInvalidError() *ChartReferenceInvalidError {
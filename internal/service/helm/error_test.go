@@ -29,5 +29,6 @@ func TestChartRenderError_Unwrap(t *testing.T) {
 
 func TestChartReferenceInvalidError(t *testing.T) {
 	err := NewChartReferenceInvalidError()
-	assert.NotEmpty(t, err.Error())
+	assert.Equal(t, "Helm chart reference is neither a valid Helm chart repository, Helm chart URL, Git repository "+
+		"path, local path nor bucket chart reference", err.Error())
 }
@@ -0,0 +1,13 @@
+package helm
+
+import (
+	openapi "github.com/Roshick/manifest-maestro-api"
+)
+
+type RenderMetadata struct {
+	openapi.HelmRenderMetadata
+
+	// ChartDigest is the digest of the manifest of charts retrieved from OCI registries, which pins the rendered chart
+	// even if it was referenced by tag.
+	ChartDigest *string `json:"chartDigest,omitempty"`
+}
@@ -0,0 +1,51 @@
+package helm
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+	chart "helm.sh/helm/v4/pkg/chart/v2"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	chartFileName        = "Chart.yaml"
+	requirementsFileName = "requirements.yaml"
+)
+
+// scanChartPaths reports the local 'file://' dependencies of all charts of the file system, so they can be
+// extracted along with the chart itself.
+func scanChartPaths(fileSystem *filesystem.FileSystem) ([]string, error) {
+	paths := make([]string, 0)
+	err := fileSystem.Walk(fileSystem.Root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || (info.Name() != chartFileName && info.Name() != requirementsFileName) {
+			return nil
+		}
+
+		fileContent, err := fileSystem.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		metadata := struct {
+			Dependencies []*chart.Dependency `json:"dependencies"`
+		}{}
+		if err = yaml.Unmarshal(fileContent, &metadata); err != nil {
+			// invalid charts are reported when loading them
+			return nil
+		}
+
+		chartDir := strings.TrimPrefix(fileSystem.Dir(filePath), fileSystem.Root)
+		for _, dependency := range metadata.Dependencies {
+			if dependency != nil && strings.HasPrefix(dependency.Repository, "file://") {
+				paths = append(paths, path.Join(chartDir, strings.TrimPrefix(dependency.Repository, "file://")))
+			}
+		}
+		return nil
+	})
+	return paths, err
+}
@@ -0,0 +1,26 @@
+package helm
+
+import (
+	openapi "github.com/Roshick/manifest-maestro-api"
+	"github.com/Roshick/manifest-maestro/internal/service/bucket"
+	"github.com/Roshick/manifest-maestro/internal/service/cache"
+	"github.com/Roshick/manifest-maestro/internal/service/localpath"
+)
+
+// ChartReference extends the API chart reference by charts located on the local file system, in a bucket or at the URL
+// of a chart archive.
+type ChartReference struct {
+	openapi.HelmChartReference
+
+	// LocalPathReference selects the directory of a chart in one of the allowed local base directories. Local
+	// 'file://' dependencies are loaded as long as they are located in the same base directory.
+	LocalPathReference *localpath.Reference `json:"localPathReference,omitempty"`
+
+	// BucketReference selects a packaged chart or the directory of a chart in a bucket. Local 'file://' dependencies
+	// are loaded as long as they are located in the same archive or below the same prefix.
+	BucketReference *bucket.Reference `json:"bucketReference,omitempty"`
+
+	// HelmChartURLReference selects a packaged chart published without a repository index. Its dependencies are
+	// resolved like the ones of charts of repositories.
+	HelmChartURLReference *cache.HelmChartURLReference `json:"helmChartURLReference,omitempty"`
+}
@@ -0,0 +1,117 @@
+package kustomize
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	openapi "github.com/Roshick/manifest-maestro-api"
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/yaml"
+)
+
+func injectManifests(
+	fileSystem *filesystem.FileSystem,
+	targetPath string,
+	injection openapi.KustomizeManifestInjection,
+) error {
+	if injection.FileName == "" {
+		return errors.New("filename cannot be empty")
+	}
+	if strings.Contains(injection.FileName, fileSystem.Separator) {
+		return fmt.Errorf("filename cannot contain %s", fileSystem.Separator)
+	}
+
+	yamlDocs := make([]string, 0)
+	for _, manifest := range injection.Manifests {
+		yamlBytes, err := yaml.Marshal(manifest.Content)
+		if err != nil {
+			return err
+		}
+		yamlDocs = append(yamlDocs, string(yamlBytes))
+	}
+	fileContent := []byte(strings.Join(yamlDocs, "---\n"))
+
+	return fileSystem.WriteFile(fileSystem.Join(targetPath, injection.FileName), fileContent)
+}
+
+func injectFile(
+	fileSystem *filesystem.FileSystem,
+	targetPath string,
+	injection FileInjection,
+) error {
+	if injection.Path == "" {
+		return errors.New("file path cannot be empty")
+	}
+	if fileSystem.IsAbs(injection.Path) {
+		return fmt.Errorf("file path '%s' cannot be absolute", injection.Path)
+	}
+	if relativePath := fileSystem.Join(injection.Path); relativePath == ".." ||
+		strings.HasPrefix(relativePath, ".."+fileSystem.Separator) {
+		return fmt.Errorf("file path '%s' escapes target directory", injection.Path)
+	}
+	filePath := fileSystem.Join(targetPath, injection.Path)
+	if injection.Content != nil && injection.Data != nil {
+		return fmt.Errorf("file '%s' cannot have both content and data", injection.Path)
+	}
+
+	fileContent := injection.Data
+	if injection.Content != nil {
+		fileContent = []byte(*injection.Content)
+	}
+
+	if err := fileSystem.MkdirAll(fileSystem.Dir(filePath)); err != nil {
+		return err
+	}
+	return fileSystem.WriteFile(filePath, fileContent)
+}
+
+func injectComponent(
+	fileSystem *filesystem.FileSystem,
+	targetPath string,
+	injection ComponentInjection,
+) error {
+	if injection.Name == "" {
+		return errors.New("component name cannot be empty")
+	}
+	if strings.Contains(injection.Name, fileSystem.Separator) {
+		return fmt.Errorf("component name cannot contain %s", fileSystem.Separator)
+	}
+
+	componentPath := fileSystem.Join(targetPath, injection.Name)
+	if fileSystem.Exists(componentPath) {
+		return fmt.Errorf("component '%s' already exists", injection.Name)
+	}
+	if err := fileSystem.MkdirAll(componentPath); err != nil {
+		return err
+	}
+
+	resources := make([]any, 0, len(injection.ManifestInjections))
+	for _, manifestInjection := range injection.ManifestInjections {
+		if err := injectManifests(fileSystem, componentPath, manifestInjection); err != nil {
+			return err
+		}
+		resources = append(resources, manifestInjection.FileName)
+	}
+	for _, fileInjection := range injection.FileInjections {
+		if err := injectFile(fileSystem, componentPath, fileInjection); err != nil {
+			return err
+		}
+	}
+
+	componentKustomization := injection.Kustomization
+	if componentKustomization == nil {
+		componentKustomization = map[string]any{
+			"apiVersion": types.ComponentVersion,
+			"kind":       types.ComponentKind,
+			"resources":  resources,
+		}
+	}
+	fileContent, err := yaml.Marshal(componentKustomization)
+	if err != nil {
+		return err
+	}
+	return fileSystem.WriteFile(fileSystem.Join(componentPath, konfig.DefaultKustomizationFileName()), fileContent)
+}
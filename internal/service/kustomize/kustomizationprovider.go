@@ -3,54 +3,142 @@ package kustomize
 import (
 	"context"
 	"fmt"
+	"path"
 
 	openapi "github.com/Roshick/manifest-maestro-api"
+	"github.com/Roshick/manifest-maestro/internal/service/bucket"
 	"github.com/Roshick/manifest-maestro/internal/service/cache"
+	"github.com/Roshick/manifest-maestro/internal/service/localpath"
+	"github.com/Roshick/manifest-maestro/internal/service/ociartifact"
+	"github.com/Roshick/manifest-maestro/internal/service/upload"
 	"github.com/Roshick/manifest-maestro/internal/utils"
 	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+	"sigs.k8s.io/kustomize/api/konfig"
 )
 
 type KustomizationProvider struct {
 	gitRepositoryCache *cache.GitRepositoryCache
+	localPathSource    *localpath.Source
+	bucketSource       *bucket.Source
+	ociArtifactSource  *ociartifact.Source
 }
 
-func NewKustomizationProvider(gitRepositoryCache *cache.GitRepositoryCache) *KustomizationProvider {
+func NewKustomizationProvider(
+	gitRepositoryCache *cache.GitRepositoryCache,
+	localPathSource *localpath.Source,
+	bucketSource *bucket.Source,
+	ociArtifactSource *ociartifact.Source,
+) *KustomizationProvider {
 	return &KustomizationProvider{
 		gitRepositoryCache: gitRepositoryCache,
+		localPathSource:    localPathSource,
+		bucketSource:       bucketSource,
+		ociArtifactSource:  ociArtifactSource,
 	}
 }
 
 func (p *KustomizationProvider) GetKustomization(
 	ctx context.Context,
-	abstractReference openapi.GitRepositoryPathReference,
+	abstractReference KustomizationReference,
 ) (*Kustomization, error) {
-	return p.getKustomizationFromGitRepositoryPathReference(ctx, abstractReference)
+	if reference := abstractReference.LocalPathReference; reference != nil {
+		return p.getKustomizationFromLocalPathReference(ctx, *reference)
+	}
+	if reference := abstractReference.BucketReference; reference != nil {
+		return p.getKustomizationFromBucketReference(ctx, *reference)
+	}
+	if reference := abstractReference.OCIArtifactReference; reference != nil {
+		return p.getKustomizationFromOCIArtifactReference(ctx, *reference)
+	}
+	return p.getKustomizationFromGitRepositoryPathReference(ctx, abstractReference.GitRepositoryPathReference)
+}
+
+// GetKustomizationFromArchive returns the kustomization of an uploaded gzip-compressed tarball or zip archive,
+// located at the slash-separated path of the archive. Without path, the archive root or, if it contains no
+// kustomization but a single directory, that directory is used.
+func (p *KustomizationProvider) GetKustomizationFromArchive(
+	ctx context.Context,
+	content []byte,
+	archivePath string,
+) (*Kustomization, error) {
+	markers := konfig.RecognizedKustomizationFileNames()
+	fileSystem, targetPath, err := upload.Extract(ctx, content, archivePath, markers...)
+	if err != nil {
+		return nil, err
+	}
+	return p.buildKustomization(ctx, fileSystem, targetPath)
+}
+
+func (p *KustomizationProvider) getKustomizationFromLocalPathReference(
+	ctx context.Context,
+	reference localpath.Reference,
+) (*Kustomization, error) {
+	fileSystem, targetPath, err := p.localPathSource.RetrieveFileSystem(ctx, reference, scanKustomizationPaths)
+	if err != nil {
+		return nil, err
+	}
+	return p.buildKustomization(ctx, fileSystem, targetPath)
+}
+
+func (p *KustomizationProvider) getKustomizationFromBucketReference(
+	ctx context.Context,
+	reference bucket.Reference,
+) (*Kustomization, error) {
+	markers := konfig.RecognizedKustomizationFileNames()
+	fileSystem, targetPath, err := p.bucketSource.RetrieveFileSystem(ctx, reference, markers...)
+	if err != nil {
+		return nil, err
+	}
+	return p.buildKustomization(ctx, fileSystem, targetPath)
+}
+
+func (p *KustomizationProvider) getKustomizationFromOCIArtifactReference(
+	ctx context.Context,
+	reference ociartifact.Reference,
+) (*Kustomization, error) {
+	markers := konfig.RecognizedKustomizationFileNames()
+	fileSystem, targetPath, err := p.ociArtifactSource.RetrieveFileSystem(ctx, reference, markers...)
+	if err != nil {
+		return nil, err
+	}
+	return p.buildKustomization(ctx, fileSystem, targetPath)
 }
 
 func (p *KustomizationProvider) getKustomizationFromGitRepositoryPathReference(
 	ctx context.Context,
 	reference openapi.GitRepositoryPathReference,
 ) (*Kustomization, error) {
-	fileSystem := filesystem.New()
-
-	targetPath := fileSystem.Root
-	if !utils.IsEmpty(reference.Path) {
-		if fileSystem.IsAbs(*reference.Path) {
-			return nil, fmt.Errorf("git source path cannot be absolute")
-		}
-		targetPath = fileSystem.Join(targetPath, *reference.Path)
+	if !utils.IsEmpty(reference.Path) && path.IsAbs(*reference.Path) {
+		return nil, fmt.Errorf("git source path cannot be absolute")
 	}
 
-	err := p.gitRepositoryCache.RetrieveRepositoryToFileSystem(
-		ctx,
-		reference.RepositoryURL,
-		reference.Reference,
-		fileSystem,
-	)
+	var fileSystem *filesystem.FileSystem
+	var err error
+	if utils.IsEmpty(reference.Path) {
+		fileSystem, err = p.gitRepositoryCache.RetrieveRepositoryFileSystem(
+			ctx,
+			reference.RepositoryURL,
+			reference.Reference,
+		)
+	} else {
+		// only the kustomization and whatever it references is extracted from the repository
+		fileSystem, err = p.gitRepositoryCache.RetrieveRepositorySubtreeFileSystem(
+			ctx,
+			reference.RepositoryURL,
+			reference.Reference,
+			[]string{path.Join("/", *reference.Path)},
+			scanKustomizationPaths,
+		)
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	targetPath := fileSystem.Root
+	if !utils.IsEmpty(reference.Path) {
+		targetPath = fileSystem.Join(targetPath, *reference.Path)
+	}
+
 	return p.buildKustomization(ctx, fileSystem, targetPath)
 }
 
@@ -59,8 +147,9 @@ func (p *KustomizationProvider) buildKustomization(
 	fileSystem *filesystem.FileSystem,
 	targetPath string,
 ) (*Kustomization, error) {
+	// renders inject files into the kustomization, which must neither leak into other renders nor into the source
 	return &Kustomization{
-		fileSystem: fileSystem,
+		fileSystem: filesystem.NewOverlay(fileSystem),
 		targetPath: targetPath,
 	}, nil
 }
@@ -2,15 +2,33 @@ package kustomize
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"path/filepath"
+	"slices"
 	"strings"
 
 	openapi "github.com/Roshick/manifest-maestro-api"
+	"github.com/Roshick/manifest-maestro/internal/utils"
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+	"sigs.k8s.io/kustomize/api/konfig"
 	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/api/types"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
 	"sigs.k8s.io/yaml"
 )
 
+const (
+	buildMetadataField = "buildMetadata"
+	resourcesField     = "resources"
+	componentsField    = "components"
+	sortOptionsField   = "sortOptions"
+	openAPIField       = "openapi"
+
+	// wrapperMountPath is where the file system is mounted below the generated wrapper kustomization
+	wrapperMountPath = "/source"
+)
+
 type KustomizationRenderer struct{}
 
 func NewKustomizationRenderer() *KustomizationRenderer {
@@ -20,7 +38,7 @@ func NewKustomizationRenderer() *KustomizationRenderer {
 func (k *KustomizationRenderer) Render(
 	ctx context.Context,
 	kustomization *Kustomization,
-	parameters *openapi.KustomizeRenderParameters,
+	parameters *RenderParameters,
 ) ([]openapi.Manifest, error) {
 	manifest, err := k.render(ctx, kustomization, parameters)
 	if err != nil {
@@ -32,48 +50,79 @@ func (k *KustomizationRenderer) Render(
 func (k *KustomizationRenderer) render(
 	_ context.Context,
 	kustomization *Kustomization,
-	parameters *openapi.KustomizeRenderParameters,
+	parameters *RenderParameters,
 ) ([]openapi.Manifest, error) {
-	actualParameters := openapi.KustomizeRenderParameters{}
+	actualParameters := RenderParameters{}
 	if parameters != nil {
 		actualParameters = *parameters
 	}
+	fileSystem := kustomization.fileSystem
 
 	kustomizer := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
 
+	for _, injection := range actualParameters.FileInjections {
+		if err := injectFile(fileSystem, kustomization.targetPath, injection); err != nil {
+			return nil, err
+		}
+	}
+
+	resources := make([]string, 0, len(actualParameters.ManifestInjections))
 	for _, injection := range actualParameters.ManifestInjections {
-		if injection.FileName == "" {
-			return nil, errors.New("filename cannot be empty")
+		if err := injectManifests(fileSystem, kustomization.targetPath, injection); err != nil {
+			return nil, err
 		}
-		if strings.Contains(injection.FileName, kustomization.fileSystem.Separator) {
-			return nil, fmt.Errorf("filename cannot contain %s", kustomization.fileSystem.Separator)
+		resources = append(resources, injection.FileName)
+	}
+
+	components := make([]string, 0, len(actualParameters.ComponentInjections))
+	for _, injection := range actualParameters.ComponentInjections {
+		if err := injectComponent(fileSystem, kustomization.targetPath, injection); err != nil {
+			return nil, err
 		}
+		components = append(components, injection.Name)
+	}
 
-		yamlDocs := make([]string, 0)
-		for _, manifest := range injection.Manifests {
-			yamlBytes, innerErr := yaml.Marshal(manifest.Content)
-			if innerErr != nil {
-				return nil, innerErr
-			}
-			yamlDocs = append(yamlDocs, string(yamlBytes))
+	if utils.DefaultIfNil(actualParameters.GenerateKustomization, false) {
+		if err := generateKustomization(fileSystem, kustomization.targetPath, resources, components); err != nil {
+			return nil, err
 		}
-		fileContent := []byte(strings.Join(yamlDocs, "---\n"))
+	}
+	kustomizationContent, err := readKustomization(fileSystem, kustomization.targetPath)
+	if err != nil {
+		return nil, err
+	}
 
-		if err := kustomization.fileSystem.WriteFile(
-			kustomization.fileSystem.Join(kustomization.targetPath, injection.FileName),
-			fileContent,
-		); err != nil {
+	renderFileSystem, renderPath, basePath := fileSystem, kustomization.targetPath, ""
+	if kustomizationContent != nil {
+		renderFileSystem, basePath, err = wrapKustomization(fileSystem, kustomization.targetPath, kustomizationContent)
+		if err != nil {
 			return nil, err
 		}
+		renderPath = renderFileSystem.Root
 	}
+	keepOriginAnnotations := utils.DefaultIfNil(actualParameters.KeepOriginAnnotations, false) ||
+		slices.Contains(buildMetadataOf(kustomizationContent), types.OriginAnnotations)
 
-	manifests, err := kustomizer.Run(kustomization.fileSystem, kustomization.targetPath)
+	manifests, err := kustomizer.Run(renderFileSystem, renderPath)
 	if err != nil {
 		return nil, err
 	}
 
 	parsedManifests := make([]openapi.Manifest, 0)
 	for _, content := range manifests.Resources() {
+		origin, innerErr := content.GetOrigin()
+		if innerErr != nil {
+			return nil, innerErr
+		}
+		origin = relativeOrigin(origin, basePath)
+		innerErr = content.SetOrigin(nil)
+		if innerErr == nil && keepOriginAnnotations {
+			innerErr = content.SetOrigin(origin)
+		}
+		if innerErr != nil {
+			return nil, innerErr
+		}
+
 		contentBytes, innerErr := content.AsYAML()
 		if innerErr != nil {
 			return nil, innerErr
@@ -86,8 +135,209 @@ func (k *KustomizationRenderer) render(
 			continue
 		}
 		parsedManifests = append(parsedManifests, openapi.Manifest{
+			Source:  originToSource(origin),
 			Content: parsedContent,
 		})
 	}
 	return parsedManifests, nil
 }
+
+// readKustomization parses the kustomization at the given path, it returns nil if the path contains none.
+func readKustomization(fileSystem *filesystem.FileSystem, kustomizationPath string) (map[string]any, error) {
+	filePath := findKustomizationFile(fileSystem, kustomizationPath)
+	if filePath == "" {
+		return nil, nil
+	}
+
+	fileContent, err := fileSystem.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	parsedContent := make(map[string]any)
+	if err = yaml.Unmarshal(fileContent, &parsedContent); err != nil {
+		return nil, err
+	}
+	if parsedContent == nil {
+		parsedContent = make(map[string]any)
+	}
+	return parsedContent, nil
+}
+
+func findKustomizationFile(fileSystem *filesystem.FileSystem, kustomizationPath string) string {
+	for _, fileName := range konfig.RecognizedKustomizationFileNames() {
+		candidatePath := fileSystem.Join(kustomizationPath, fileName)
+		if fileSystem.Exists(candidatePath) {
+			return candidatePath
+		}
+	}
+	return ""
+}
+
+// generateKustomization references the given resources and components from the kustomization at the given path
+// unless already listed, leaving its comments, key order and list indentation intact. If the path contains no
+// kustomization but there is something to reference, a kustomization is generated.
+func generateKustomization(
+	fileSystem *filesystem.FileSystem,
+	kustomizationPath string,
+	resources []string,
+	components []string,
+) error {
+	if len(resources) == 0 && len(components) == 0 {
+		return nil
+	}
+
+	var fileContent []byte
+	filePath := findKustomizationFile(fileSystem, kustomizationPath)
+	if filePath != "" {
+		var err error
+		if fileContent, err = fileSystem.ReadFile(filePath); err != nil {
+			return err
+		}
+	} else {
+		filePath = fileSystem.Join(kustomizationPath, konfig.DefaultKustomizationFileName())
+	}
+	if len(strings.TrimSpace(string(fileContent))) == 0 {
+		fileContent = fmt.Appendf(nil, "apiVersion: %s\nkind: %s\n", types.KustomizationVersion, types.KustomizationKind)
+	}
+
+	node, err := kyaml.Parse(string(fileContent))
+	if err != nil {
+		return err
+	}
+	if err = appendMissing(node, resourcesField, resources); err != nil {
+		return err
+	}
+	if err = appendMissing(node, componentsField, components); err != nil {
+		return err
+	}
+	amendedContent, err := kyaml.MarshalWithOptions(node.Document(), &kyaml.EncoderOptions{
+		SeqIndent: kyaml.SequenceIndentStyle(kyaml.DeriveSeqIndentStyle(string(fileContent))),
+	})
+	if err != nil {
+		return err
+	}
+	return fileSystem.WriteFile(filePath, amendedContent)
+}
+
+func appendMissing(node *kyaml.RNode, field string, values []string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	sequence, err := node.Pipe(kyaml.LookupCreate(kyaml.SequenceNode, field))
+	if err != nil {
+		return err
+	}
+	existing := make([]string, 0, len(sequence.Content()))
+	for _, element := range sequence.Content() {
+		existing = append(existing, element.Value)
+	}
+	for _, value := range values {
+		if slices.Contains(existing, value) {
+			continue
+		}
+		if err = sequence.PipeE(kyaml.Append(kyaml.NewScalarRNode(value).YNode())); err != nil {
+			return err
+		}
+		existing = append(existing, value)
+	}
+	return nil
+}
+
+// wrapKustomization mounts the file system below a generated wrapper kustomization, which references the
+// kustomization at the given path as its only resource and makes Kustomize annotate every resource with the file it
+// originated from. Options that Kustomize only reads from the top-level kustomization are copied into the wrapper.
+// It returns the mount and the path of the kustomization relative to the wrapper, which prefixes all origins.
+func wrapKustomization(
+	fileSystem *filesystem.FileSystem,
+	kustomizationPath string,
+	kustomizationContent map[string]any,
+) (*filesystem.FileSystem, string, error) {
+	relativePath, err := filepath.Rel(fileSystem.Root, kustomizationPath)
+	if err != nil {
+		return nil, "", err
+	}
+	basePath := filepath.Join(strings.TrimPrefix(wrapperMountPath, string(filepath.Separator)), relativePath)
+
+	buildMetadata := buildMetadataOf(kustomizationContent)
+	if !slices.Contains(buildMetadata, types.OriginAnnotations) {
+		buildMetadata = append(buildMetadata, types.OriginAnnotations)
+	}
+	wrapperContent := map[string]any{
+		"apiVersion":       types.KustomizationVersion,
+		"kind":             types.KustomizationKind,
+		resourcesField:     []string{basePath},
+		buildMetadataField: buildMetadata,
+	}
+	if sortOptions, ok := kustomizationContent[sortOptionsField]; ok {
+		wrapperContent[sortOptionsField] = sortOptions
+	}
+	if openAPI, ok := kustomizationContent[openAPIField].(map[string]any); ok {
+		if schemaPath, isString := openAPI["path"].(string); isString && !filepath.IsAbs(schemaPath) {
+			openAPI["path"] = filepath.Join(basePath, schemaPath)
+		}
+		wrapperContent[openAPIField] = openAPI
+	}
+
+	fileContent, err := yaml.Marshal(wrapperContent)
+	if err != nil {
+		return nil, "", err
+	}
+	wrapper := filesystem.NewMount(fileSystem, wrapperMountPath)
+	wrapperFilePath := wrapper.Join(wrapper.Root, konfig.DefaultKustomizationFileName())
+	if err = wrapper.WriteFile(wrapperFilePath, fileContent); err != nil {
+		return nil, "", err
+	}
+	return wrapper, basePath, nil
+}
+
+func buildMetadataOf(kustomizationContent map[string]any) []string {
+	values, _ := kustomizationContent[buildMetadataField].([]any)
+	buildMetadata := make([]string, 0, len(values))
+	for _, value := range values {
+		if stringValue, ok := value.(string); ok {
+			buildMetadata = append(buildMetadata, stringValue)
+		}
+	}
+	return buildMetadata
+}
+
+// relativeOrigin makes the paths of a local origin relative to the wrapped kustomization again.
+func relativeOrigin(origin *resource.Origin, basePath string) *resource.Origin {
+	if origin == nil || origin.Repo != "" || basePath == "" {
+		return origin
+	}
+
+	relativeCopy := origin.Copy()
+	for _, path := range []*string{&relativeCopy.Path, &relativeCopy.ConfiguredIn} {
+		if *path == "" {
+			continue
+		}
+		if relativePath, err := filepath.Rel(basePath, *path); err == nil {
+			*path = relativePath
+		}
+	}
+	return &relativeCopy
+}
+
+// originToSource formats a Kustomize origin as the file path a resource came from. Resources of remote bases are
+// prefixed with their repository and suffixed with their reference, following Kustomize's remote URL notation.
+func originToSource(origin *resource.Origin) *string {
+	if origin == nil {
+		return nil
+	}
+
+	source := origin.Path
+	if source == "" {
+		source = origin.ConfiguredIn
+	}
+	if source == "" {
+		return nil
+	}
+	if origin.Repo != "" {
+		source = fmt.Sprintf("%s//%s", origin.Repo, source)
+		if origin.Ref != "" {
+			source = fmt.Sprintf("%s?ref=%s", source, origin.Ref)
+		}
+	}
+	return utils.Ptr(source)
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	openapi "github.com/Roshick/manifest-maestro-api"
+	"github.com/Roshick/manifest-maestro/internal/utils"
 	"github.com/Roshick/manifest-maestro/pkg/filesystem"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -56,7 +57,7 @@ metadata:
 `,
 	})
 
-	parameters := &openapi.KustomizeRenderParameters{
+	parameters := &RenderParameters{KustomizeRenderParameters: openapi.KustomizeRenderParameters{
 		ManifestInjections: []openapi.KustomizeManifestInjection{
 			{
 				FileName: "injected.yaml",
@@ -71,7 +72,7 @@ metadata:
 				},
 			},
 		},
-	}
+	}}
 
 	renderer := NewKustomizationRenderer()
 	manifests, err := renderer.Render(t.Context(), kustomization, parameters)
@@ -91,11 +92,11 @@ func TestKustomizationRenderer_Render_EmptyInjectionFileName(t *testing.T) {
 		"kustomization.yaml": "resources: []\n",
 	})
 
-	parameters := &openapi.KustomizeRenderParameters{
+	parameters := &RenderParameters{KustomizeRenderParameters: openapi.KustomizeRenderParameters{
 		ManifestInjections: []openapi.KustomizeManifestInjection{
 			{FileName: ""},
 		},
-	}
+	}}
 
 	renderer := NewKustomizationRenderer()
 	_, err := renderer.Render(t.Context(), kustomization, parameters)
@@ -111,11 +112,11 @@ func TestKustomizationRenderer_Render_InjectionFileNameWithSeparator(t *testing.
 		"kustomization.yaml": "resources: []\n",
 	})
 
-	parameters := &openapi.KustomizeRenderParameters{
+	parameters := &RenderParameters{KustomizeRenderParameters: openapi.KustomizeRenderParameters{
 		ManifestInjections: []openapi.KustomizeManifestInjection{
 			{FileName: "subdir/injected.yaml"},
 		},
-	}
+	}}
 
 	renderer := NewKustomizationRenderer()
 	_, err := renderer.Render(t.Context(), kustomization, parameters)
@@ -133,3 +134,348 @@ func TestKustomizationRenderer_Render_MissingKustomizationFile(t *testing.T) {
 	_, ok := errors.AsType[*KustomizationRenderError](err)
 	assert.True(t, ok)
 }
+
+func TestKustomizationRenderer_Render_Source(t *testing.T) {
+	kustomization := newTestKustomization(t, map[string]string{
+		"kustomization.yaml": `resources:
+  - base
+  - service.yaml
+`,
+		"service.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  name: test-service
+`,
+		"base/kustomization.yaml": `resources:
+  - deployment.yaml
+`,
+		"base/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test-deployment
+  annotations:
+    example.com/keep: "true"
+`,
+	})
+
+	renderer := NewKustomizationRenderer()
+	manifests, err := renderer.Render(t.Context(), kustomization, nil)
+	require.NoError(t, err)
+	require.Len(t, manifests, 2)
+
+	sources := make(map[string]string)
+	for _, manifest := range manifests {
+		require.NotNil(t, manifest.Source)
+		sources[manifest.Content["kind"].(string)] = *manifest.Source
+
+		metadata := manifest.Content["metadata"].(map[string]any)
+		annotations, _ := metadata["annotations"].(map[string]any)
+		assert.NotContains(t, annotations, "config.kubernetes.io/origin")
+	}
+	assert.Equal(t, "base/deployment.yaml", sources["Deployment"])
+	assert.Equal(t, "service.yaml", sources["Service"])
+
+	for _, manifest := range manifests {
+		if manifest.Content["kind"] == "Deployment" {
+			metadata := manifest.Content["metadata"].(map[string]any)
+			assert.Equal(t, map[string]any{"example.com/keep": "true"}, metadata["annotations"])
+		}
+	}
+}
+
+func TestKustomizationRenderer_Render_SourceWithRequestedOriginAnnotations(t *testing.T) {
+	kustomization := newTestKustomization(t, map[string]string{
+		"kustomization.yaml": `buildMetadata:
+  - originAnnotations
+resources:
+  - deployment.yaml
+`,
+		"deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test-deployment
+`,
+	})
+
+	renderer := NewKustomizationRenderer()
+	manifests, err := renderer.Render(t.Context(), kustomization, nil)
+	require.NoError(t, err)
+	require.Len(t, manifests, 1)
+	require.NotNil(t, manifests[0].Source)
+	assert.Equal(t, "deployment.yaml", *manifests[0].Source)
+
+	metadata := manifests[0].Content["metadata"].(map[string]any)
+	assert.Contains(t, metadata["annotations"], "config.kubernetes.io/origin")
+}
+
+func TestKustomizationRenderer_Render_SourceWithKeptOriginAnnotations(t *testing.T) {
+	kustomization := newTestKustomization(t, map[string]string{
+		"overlay/kustomization.yaml": `# overlay of the base
+resources:
+  - ../base
+namePrefix: dev-
+`,
+		"base/kustomization.yaml": `resources:
+  - deployment.yaml
+`,
+		"base/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test-deployment
+`,
+	})
+	kustomization.targetPath = kustomization.fileSystem.Join(kustomization.fileSystem.Root, "overlay")
+
+	renderer := NewKustomizationRenderer()
+	manifests, err := renderer.Render(t.Context(), kustomization, &RenderParameters{
+		KeepOriginAnnotations: utils.Ptr(true),
+	})
+	require.NoError(t, err)
+	require.Len(t, manifests, 1)
+	require.NotNil(t, manifests[0].Source)
+	assert.Equal(t, "../base/deployment.yaml", *manifests[0].Source)
+
+	metadata := manifests[0].Content["metadata"].(map[string]any)
+	assert.Equal(t, "dev-test-deployment", metadata["name"])
+	assert.Equal(t, map[string]any{"config.kubernetes.io/origin": "path: ../base/deployment.yaml\n"}, metadata["annotations"])
+
+	content, err := kustomization.fileSystem.ReadFile("/overlay/kustomization.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, `# overlay of the base
+resources:
+  - ../base
+namePrefix: dev-
+`, string(content))
+}
+
+func TestKustomizationRenderer_Render_SortOptionsOfKustomization(t *testing.T) {
+	kustomization := newTestKustomization(t, map[string]string{
+		"kustomization.yaml": `sortOptions:
+  order: fifo
+resources:
+  - service.yaml
+  - namespace.yaml
+`,
+		"service.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  name: test-service
+`,
+		"namespace.yaml": `apiVersion: v1
+kind: Namespace
+metadata:
+  name: test-namespace
+`,
+	})
+
+	renderer := NewKustomizationRenderer()
+	manifests, err := renderer.Render(t.Context(), kustomization, nil)
+	require.NoError(t, err)
+	require.Len(t, manifests, 2)
+	assert.Equal(t, "Service", manifests[0].Content["kind"])
+	assert.Equal(t, "Namespace", manifests[1].Content["kind"])
+}
+
+func TestKustomizationRenderer_Render_WithFileInjection(t *testing.T) {
+	kustomization := newTestKustomization(t, map[string]string{
+		"kustomization.yaml": `configMapGenerator:
+  - name: build-config
+    envs:
+      - config/build.env
+    files:
+      - certs/ca.crt
+generatorOptions:
+  disableNameSuffixHash: true
+`,
+	})
+
+	parameters := &RenderParameters{
+		FileInjections: []FileInjection{
+			{Path: "config/build.env", Content: utils.Ptr("VERSION=1.2.3\n")},
+			{Path: "certs/ca.crt", Data: []byte("certificate")},
+		},
+	}
+
+	renderer := NewKustomizationRenderer()
+	manifests, err := renderer.Render(t.Context(), kustomization, parameters)
+	require.NoError(t, err)
+	require.Len(t, manifests, 1)
+	assert.Equal(t, map[string]any{"VERSION": "1.2.3", "ca.crt": "certificate"}, manifests[0].Content["data"])
+	require.NotNil(t, manifests[0].Source)
+	assert.Equal(t, "kustomization.yaml", *manifests[0].Source)
+}
+
+func TestKustomizationRenderer_Render_FileInjectionEscapingRoot(t *testing.T) {
+	kustomization := newTestKustomization(t, map[string]string{
+		"kustomization.yaml": "resources: []\n",
+	})
+
+	parameters := &RenderParameters{
+		FileInjections: []FileInjection{
+			{Path: "../outside.env", Content: utils.Ptr("")},
+		},
+	}
+
+	renderer := NewKustomizationRenderer()
+	_, err := renderer.Render(t.Context(), kustomization, parameters)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "escapes target directory")
+}
+
+func TestKustomizationRenderer_Render_WithComponentInjection(t *testing.T) {
+	kustomization := newTestKustomization(t, map[string]string{
+		"kustomization.yaml": `resources:
+  - deployment.yaml
+components:
+  - monitoring
+`,
+		"deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test-deployment
+`,
+	})
+
+	parameters := &RenderParameters{
+		ComponentInjections: []ComponentInjection{
+			{
+				Name: "monitoring",
+				ManifestInjections: []openapi.KustomizeManifestInjection{
+					{
+						FileName: "service-monitor.yaml",
+						Manifests: []openapi.Manifest{
+							{
+								Content: map[string]any{
+									"apiVersion": "monitoring.coreos.com/v1",
+									"kind":       "ServiceMonitor",
+									"metadata":   map[string]any{"name": "test-monitor"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	renderer := NewKustomizationRenderer()
+	manifests, err := renderer.Render(t.Context(), kustomization, parameters)
+	require.NoError(t, err)
+	require.Len(t, manifests, 2)
+
+	sources := make(map[string]string)
+	for _, manifest := range manifests {
+		require.NotNil(t, manifest.Source)
+		sources[manifest.Content["kind"].(string)] = *manifest.Source
+	}
+	assert.Equal(t, "deployment.yaml", sources["Deployment"])
+	assert.Equal(t, "monitoring/service-monitor.yaml", sources["ServiceMonitor"])
+}
+
+func TestKustomizationRenderer_Render_WithReferencedInjections(t *testing.T) {
+	kustomization := newTestKustomization(t, map[string]string{
+		"kustomization.yaml": `# injected manifests are referenced by the renderer
+resources:
+  - deployment.yaml # the application
+generatorOptions:
+  disableNameSuffixHash: true
+`,
+		"deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test-deployment
+`,
+	})
+
+	parameters := &RenderParameters{
+		KustomizeRenderParameters: openapi.KustomizeRenderParameters{
+			ManifestInjections: []openapi.KustomizeManifestInjection{
+				{
+					FileName: "injected.yaml",
+					Manifests: []openapi.Manifest{
+						{
+							Content: map[string]any{
+								"apiVersion": "v1",
+								"kind":       "ConfigMap",
+								"metadata":   map[string]any{"name": "injected-config"},
+							},
+						},
+					},
+				},
+			},
+		},
+		ComponentInjections: []ComponentInjection{
+			{
+				Name: "labels",
+				Kustomization: map[string]any{
+					"apiVersion": "kustomize.config.k8s.io/v1alpha1",
+					"kind":       "Component",
+					"commonLabels": map[string]any{
+						"injected": "true",
+					},
+				},
+			},
+		},
+		GenerateKustomization: utils.Ptr(true),
+	}
+
+	renderer := NewKustomizationRenderer()
+	manifests, err := renderer.Render(t.Context(), kustomization, parameters)
+	require.NoError(t, err)
+	require.Len(t, manifests, 2)
+
+	sources := make(map[string]string)
+	for _, manifest := range manifests {
+		require.NotNil(t, manifest.Source)
+		sources[manifest.Content["kind"].(string)] = *manifest.Source
+
+		metadata := manifest.Content["metadata"].(map[string]any)
+		assert.Equal(t, map[string]any{"injected": "true"}, metadata["labels"])
+	}
+	assert.Equal(t, "deployment.yaml", sources["Deployment"])
+	assert.Equal(t, "injected.yaml", sources["ConfigMap"])
+
+	content, err := kustomization.fileSystem.ReadFile("/kustomization.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, `# injected manifests are referenced by the renderer
+resources:
+  - deployment.yaml # the application
+  - injected.yaml
+generatorOptions:
+  disableNameSuffixHash: true
+components:
+  - labels
+`, string(content))
+}
+
+func TestKustomizationRenderer_Render_WithGeneratedKustomization(t *testing.T) {
+	kustomization := newTestKustomization(t, map[string]string{})
+
+	parameters := &RenderParameters{
+		KustomizeRenderParameters: openapi.KustomizeRenderParameters{
+			ManifestInjections: []openapi.KustomizeManifestInjection{
+				{
+					FileName: "injected.yaml",
+					Manifests: []openapi.Manifest{
+						{
+							Content: map[string]any{
+								"apiVersion": "v1",
+								"kind":       "ConfigMap",
+								"metadata":   map[string]any{"name": "injected-config"},
+							},
+						},
+					},
+				},
+			},
+		},
+		GenerateKustomization: utils.Ptr(true),
+	}
+
+	renderer := NewKustomizationRenderer()
+	manifests, err := renderer.Render(t.Context(), kustomization, parameters)
+	require.NoError(t, err)
+	require.Len(t, manifests, 1)
+	assert.Equal(t, "ConfigMap", manifests[0].Content["kind"])
+	require.NotNil(t, manifests[0].Source)
+	assert.Equal(t, "injected.yaml", *manifests[0].Source)
+}
@@ -0,0 +1,47 @@
+package kustomize
+
+import (
+	openapi "github.com/Roshick/manifest-maestro-api"
+)
+
+type RenderParameters struct {
+	openapi.KustomizeRenderParameters
+
+	// FileInjections are written relative to the kustomization root, e.g. to be consumed by a configMapGenerator
+	// or secretGenerator of the kustomization.
+	FileInjections []FileInjection `json:"fileInjections,omitempty"`
+
+	// ComponentInjections are written as Kustomize components into subdirectories of the kustomization root.
+	ComponentInjections []ComponentInjection `json:"componentInjections,omitempty"`
+
+	// GenerateKustomization references all injected manifests and components from the kustomization, so it does
+	// not have to list them itself. If the kustomization root contains no kustomization, one is generated.
+	GenerateKustomization *bool `json:"generateKustomization,omitempty"`
+
+	// KeepOriginAnnotations keeps the config.kubernetes.io/origin annotations, which Kustomize adds to report the
+	// source file of every resource, in the rendered manifests.
+	KeepOriginAnnotations *bool `json:"keepOriginAnnotations,omitempty"`
+}
+
+type FileInjection struct {
+	// Path of the file relative to the directory it is injected into, may contain subdirectories.
+	Path string `json:"path"`
+
+	// Content of a text file, mutually exclusive with Data.
+	Content *string `json:"content,omitempty"`
+
+	// Data of a binary file, base64 encoded in JSON, mutually exclusive with Content.
+	Data []byte `json:"data,omitempty"`
+}
+
+type ComponentInjection struct {
+	Name string `json:"name"`
+
+	// Kustomization of the component. If omitted, a component listing all manifest injections as resources is
+	// generated.
+	Kustomization map[string]any `json:"kustomization,omitempty"`
+
+	ManifestInjections []openapi.KustomizeManifestInjection `json:"manifestInjections,omitempty"`
+
+	FileInjections []FileInjection `json:"fileInjections,omitempty"`
+}
@@ -0,0 +1,101 @@
+package kustomize
+
+import (
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/yaml"
+)
+
+// scanKustomizationPaths reports the files and directories referenced by all kustomizations of the file system,
+// e.g. a '../base' resource, so they can be extracted along with the kustomization itself.
+func scanKustomizationPaths(fileSystem *filesystem.FileSystem) ([]string, error) {
+	paths := make([]string, 0)
+	err := fileSystem.Walk(fileSystem.Root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !slices.Contains(konfig.RecognizedKustomizationFileNames(), info.Name()) {
+			return nil
+		}
+
+		fileContent, err := fileSystem.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		kustomization := types.Kustomization{}
+		if err = yaml.Unmarshal(fileContent, &kustomization); err != nil {
+			// invalid kustomizations are reported by the renderer
+			return nil
+		}
+
+		kustomizationDir := strings.TrimPrefix(fileSystem.Dir(filePath), fileSystem.Root)
+		for _, reference := range kustomizationReferences(kustomization) {
+			if isLocalReference(reference) {
+				paths = append(paths, path.Join(kustomizationDir, reference))
+			}
+		}
+		return nil
+	})
+	return paths, err
+}
+
+func kustomizationReferences(kustomization types.Kustomization) []string {
+	references := make([]string, 0)
+	references = append(references, kustomization.Resources...)
+	references = append(references, kustomization.Components...)
+	references = append(references, kustomization.Bases...)
+	references = append(references, kustomization.Crds...)
+	references = append(references, kustomization.Configurations...)
+	references = append(references, kustomization.Generators...)
+	references = append(references, kustomization.Transformers...)
+	references = append(references, kustomization.Validators...)
+	for _, patch := range kustomization.PatchesStrategicMerge {
+		references = append(references, string(patch))
+	}
+	for _, patch := range slices.Concat(kustomization.Patches, kustomization.PatchesJson6902) {
+		references = append(references, patch.Path)
+	}
+	for _, replacement := range kustomization.Replacements {
+		references = append(references, replacement.Path)
+	}
+	if openAPIPath, ok := kustomization.OpenAPI["path"]; ok {
+		references = append(references, openAPIPath)
+	}
+
+	kvPairSources := make([]types.KvPairSources, 0)
+	for _, generator := range kustomization.ConfigMapGenerator {
+		kvPairSources = append(kvPairSources, generator.KvPairSources)
+	}
+	for _, generator := range kustomization.SecretGenerator {
+		kvPairSources = append(kvPairSources, generator.KvPairSources)
+	}
+	for _, sources := range kvPairSources {
+		for _, fileSource := range sources.FileSources {
+			// file sources take the form [{key}=]{path}
+			_, filePath, found := strings.Cut(fileSource, "=")
+			if !found {
+				filePath = fileSource
+			}
+			references = append(references, filePath)
+		}
+		references = append(references, sources.EnvSources...)
+		references = append(references, sources.EnvSource)
+	}
+	return references
+}
+
+// isLocalReference filters out empty and inline references as well as remote ones, such as URLs and remote bases
+// like 'github.com/org/repo//base?ref=v1'.
+func isLocalReference(reference string) bool {
+	return reference != "" &&
+		!strings.Contains(reference, "\n") &&
+		!strings.Contains(reference, "//") &&
+		!strings.Contains(reference, "?") &&
+		!path.IsAbs(reference)
+}
@@ -0,0 +1,47 @@
+package kustomize
+
+import (
+	"testing"
+
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanKustomizationPaths(t *testing.T) {
+	fileSystem := filesystem.New()
+	require.NoError(t, fileSystem.WriteFile("/overlays/prod/kustomization.yaml", []byte(`
+resources:
+  - ../../base
+  - deployment.yaml
+  - github.com/org/repo//base?ref=v1
+  - https://example.com/manifest.yaml
+components:
+  - ../../components/monitoring
+patches:
+  - path: ../../patches/replicas.yaml
+  - patch: |-
+      - op: replace
+        path: /spec/replicas
+        value: 3
+configMapGenerator:
+  - name: config
+    files:
+      - app.properties=../../config/app.properties
+    envs:
+      - ../../config/.env
+`)))
+	require.NoError(t, fileSystem.WriteFile("/base/kustomization.yaml", []byte("resources:\n  - service.yaml\n")))
+
+	paths, err := scanKustomizationPaths(fileSystem)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"base/service.yaml",
+		"base",
+		"overlays/prod/deployment.yaml",
+		"components/monitoring",
+		"patches/replicas.yaml",
+		"config/app.properties",
+		"config/.env",
+	}, paths)
+}
@@ -0,0 +1,27 @@
+package kustomize
+
+import (
+	openapi "github.com/Roshick/manifest-maestro-api"
+	"github.com/Roshick/manifest-maestro/internal/service/bucket"
+	"github.com/Roshick/manifest-maestro/internal/service/localpath"
+	"github.com/Roshick/manifest-maestro/internal/service/ociartifact"
+)
+
+// KustomizationReference extends the API Git repository path reference by kustomizations located on the local file
+// system, in a bucket or in an OCI artifact. The Git repository fields are ignored if any of the other references
+// is set.
+type KustomizationReference struct {
+	openapi.GitRepositoryPathReference
+
+	// LocalPathReference selects the directory of a kustomization in one of the allowed local base directories.
+	// Resources, components and patches outside the directory are loaded as long as they are located in the same
+	// base directory.
+	LocalPathReference *localpath.Reference `json:"localPathReference,omitempty"`
+
+	// BucketReference selects the directory of a kustomization in an archive or below a prefix of a bucket.
+	BucketReference *bucket.Reference `json:"bucketReference,omitempty"`
+
+	// OCIArtifactReference selects the directory of a kustomization in the layer of an OCI artifact, e.g. one pushed
+	// with 'flux push artifact'.
+	OCIArtifactReference *ociartifact.Reference `json:"ociArtifactReference,omitempty"`
+}
@@ -0,0 +1,31 @@
+package localpath
+
+import "fmt"
+
+type PathNotAllowedError struct {
+	path string
+}
+
+func (e *PathNotAllowedError) Error() string {
+	return fmt.Sprintf("local path '%s' is not located in any allowed base directory", e.path)
+}
+
+func NewPathNotAllowedError(path string) *PathNotAllowedError {
+	return &PathNotAllowedError{
+		path: path,
+	}
+}
+
+type PathNotFoundError struct {
+	path string
+}
+
+func (e *PathNotFoundError) Error() string {
+	return fmt.Sprintf("local path '%s' does not exist", e.path)
+}
+
+func NewPathNotFoundError(path string) *PathNotFoundError {
+	return &PathNotFoundError{
+		path: path,
+	}
+}
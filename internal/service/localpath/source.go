@@ -0,0 +1,199 @@
+package localpath
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Roshick/manifest-maestro/internal/service/cache"
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+	aulogging "github.com/StephanHCB/go-autumn-logging"
+)
+
+// Reference selects a directory on the local file system, e.g. a working copy or a mounted volume.
+type Reference struct {
+	// Path is absolute and must be located in one of the allowed base directories.
+	Path string `json:"path"`
+}
+
+// Source loads directories of the local file system, restricted to an allowlist of base directories. Nothing is
+// cached, so every retrieval reflects the current state of the files.
+type Source struct {
+	baseDirectories []string
+}
+
+// NewSource creates a source for directories located in the given absolute base directories. Without base
+// directories, all references are rejected.
+func NewSource(baseDirectories []string) (*Source, error) {
+	resolvedDirectories := make([]string, 0, len(baseDirectories))
+	for _, baseDirectory := range baseDirectories {
+		if !filepath.IsAbs(baseDirectory) {
+			return nil, fmt.Errorf("local path base directory '%s' is not absolute", baseDirectory)
+		}
+		resolvedDirectory, err := filepath.EvalSymlinks(baseDirectory)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve local path base directory '%s': %w", baseDirectory, err)
+		}
+		resolvedDirectories = append(resolvedDirectories, resolvedDirectory)
+	}
+	return &Source{
+		baseDirectories: resolvedDirectories,
+	}, nil
+}
+
+// RetrieveFileSystem loads the referenced directory into a file system whose root is the base directory containing
+// it, and returns the path of the directory within the file system. After each load, scan reports all paths the
+// loaded files depend on, which are loaded as well until scan reports no further paths, like for subtrees of Git
+// repositories. Paths and symbolic links resolving outside the base directory are rejected.
+func (s *Source) RetrieveFileSystem(
+	ctx context.Context, reference Reference, scan cache.PathScan,
+) (*filesystem.FileSystem, string, error) {
+	baseDirectory, relativePath, err := s.locate(reference.Path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	fileSystem := filesystem.New()
+	paths := []string{relativePath}
+	loadedPaths := make([]string, 0)
+	for {
+		for _, p := range paths {
+			if slices.Contains(loadedPaths, p) {
+				continue
+			}
+			if err = s.load(baseDirectory, p, fileSystem); err != nil {
+				return nil, "", err
+			}
+			loadedPaths = append(loadedPaths, p)
+		}
+		if scan == nil {
+			break
+		}
+
+		requiredPaths, innerErr := scan(fileSystem)
+		if innerErr != nil {
+			return nil, "", innerErr
+		}
+		extendedPaths := cache.NormalizePaths(append(slices.Clone(paths), requiredPaths...))
+		if slices.Equal(paths, extendedPaths) {
+			break
+		}
+		aulogging.Logger.Ctx(ctx).Debug().Printf(
+			"extending loaded paths of local path '%s' to %v", reference.Path, extendedPaths)
+		paths = extendedPaths
+	}
+	return fileSystem, fileSystem.Join(fileSystem.Root, filepath.FromSlash(relativePath)), nil
+}
+
+// locate returns the base directory containing the path and the slash-separated path relative to it. The path is
+// checked before and after resolving symbolic links, so the existence of paths outside the base directories is not
+// disclosed.
+func (s *Source) locate(path string) (string, string, error) {
+	if !filepath.IsAbs(path) {
+		return "", "", NewPathNotAllowedError(path)
+	}
+	if _, _, ok := s.baseDirectoryOf(filepath.Clean(path)); !ok {
+		return "", "", NewPathNotAllowedError(path)
+	}
+	resolvedPath, err := filepath.EvalSymlinks(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", "", NewPathNotFoundError(path)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	baseDirectory, relativePath, ok := s.baseDirectoryOf(resolvedPath)
+	if !ok {
+		return "", "", NewPathNotAllowedError(path)
+	}
+	return baseDirectory, relativePath, nil
+}
+
+func (s *Source) baseDirectoryOf(path string) (string, string, bool) {
+	for _, baseDirectory := range s.baseDirectories {
+		if relativePath, ok := within(baseDirectory, path); ok {
+			return baseDirectory, relativePath, true
+		}
+	}
+	return "", "", false
+}
+
+// load copies the files at or below the slash-separated path relative to the base directory into the file system.
+// Missing paths are skipped, like paths missing in Git repositories, and '.git' directories are never loaded. Like
+// the referenced path, the path is checked again after resolving symbolic links, as its parent directories may be
+// links resolving outside the base directory.
+func (s *Source) load(baseDirectory string, relativePath string, fileSystem *filesystem.FileSystem) error {
+	root := filepath.Join(baseDirectory, filepath.FromSlash(relativePath))
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, ok := within(baseDirectory, resolvedRoot); !ok {
+		return NewPathNotAllowedError(root)
+	}
+	return filepath.WalkDir(root, func(name string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		entryPath, ok := within(baseDirectory, name)
+		if !ok {
+			return fmt.Errorf("failed to load file '%s': path escapes base directory '%s'", name, baseDirectory)
+		}
+		targetPath := fileSystem.Join(fileSystem.Root, filepath.FromSlash(entryPath))
+
+		switch {
+		case dirEntry.IsDir():
+			if dirEntry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return fileSystem.MkdirAll(targetPath)
+		case dirEntry.Type()&fs.ModeSymlink != 0:
+			resolvedName, innerErr := filepath.EvalSymlinks(name)
+			if innerErr != nil {
+				return innerErr
+			}
+			if _, ok = within(baseDirectory, resolvedName); !ok {
+				return fmt.Errorf("failed to load file '%s': link escapes base directory '%s'", name, baseDirectory)
+			}
+			info, innerErr := os.Stat(resolvedName)
+			if innerErr != nil {
+				return innerErr
+			}
+			if !info.Mode().IsRegular() {
+				return fmt.Errorf("failed to load file '%s': links to directories are not supported", name)
+			}
+		case !dirEntry.Type().IsRegular():
+			return fmt.Errorf("failed to load file '%s' of unsupported type", name)
+		}
+
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if err = fileSystem.MkdirAll(fileSystem.Dir(targetPath)); err != nil {
+			return err
+		}
+		return fileSystem.WriteFile(targetPath, data)
+	})
+}
+
+// within returns the slash-separated path relative to the directory, if the path is located in it.
+func within(directory string, path string) (string, bool) {
+	relativePath, err := filepath.Rel(directory, path)
+	if err != nil {
+		return "", false
+	}
+	relativePath = filepath.ToSlash(relativePath)
+	if relativePath == ".." || strings.HasPrefix(relativePath, "../") {
+		return "", false
+	}
+	return relativePath, true
+}
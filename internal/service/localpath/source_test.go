@@ -0,0 +1,92 @@
+package localpath
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+}
+
+func TestSource_RetrieveFileSystem(t *testing.T) {
+	baseDir := t.TempDir()
+	writeFiles(t, baseDir, map[string]string{
+		"apps/web/kustomization.yaml": "resources:\n- ../../base\n",
+		"apps/web/.git/HEAD":          "ref: refs/heads/main\n",
+		"base/deployment.yaml":        "kind: Deployment\n",
+		"other/service.yaml":          "kind: Service\n",
+	})
+	source, err := NewSource([]string{baseDir})
+	require.NoError(t, err)
+
+	scan := func(_ *filesystem.FileSystem) ([]string, error) {
+		return []string{"base", "../outside"}, nil
+	}
+	fileSystem, targetPath, err := source.RetrieveFileSystem(context.Background(),
+		Reference{Path: filepath.Join(baseDir, "apps", "web")}, scan)
+	require.NoError(t, err)
+
+	assert.Equal(t, "/apps/web", targetPath)
+	assert.True(t, fileSystem.Exists("/apps/web/kustomization.yaml"))
+	assert.True(t, fileSystem.Exists("/base/deployment.yaml"))
+	assert.False(t, fileSystem.Exists("/other/service.yaml"))
+	assert.False(t, fileSystem.Exists("/apps/web/.git"))
+}
+
+func TestSource_RetrieveFileSystem_Rejected(t *testing.T) {
+	baseDir := t.TempDir()
+	outsideDir := t.TempDir()
+	writeFiles(t, baseDir, map[string]string{"apps/web/kustomization.yaml": "resources: []\n"})
+	writeFiles(t, outsideDir, map[string]string{"secret.yaml": "kind: Secret\n"})
+	require.NoError(t, os.Symlink(outsideDir, filepath.Join(baseDir, "outside")))
+	require.NoError(t, os.Symlink(filepath.Join(outsideDir, "secret.yaml"),
+		filepath.Join(baseDir, "apps", "web", "secret.yaml")))
+	source, err := NewSource([]string{baseDir})
+	require.NoError(t, err)
+
+	for _, path := range []string{
+		outsideDir,
+		"apps/web",
+		filepath.Join(baseDir, "..", filepath.Base(outsideDir)),
+		filepath.Join(baseDir, "outside"),
+	} {
+		_, _, err = source.RetrieveFileSystem(context.Background(), Reference{Path: path}, nil)
+		assert.ErrorAs(t, err, new(*PathNotAllowedError), path)
+	}
+
+	_, _, err = source.RetrieveFileSystem(context.Background(),
+		Reference{Path: filepath.Join(baseDir, "apps", "missing")}, nil)
+	assert.ErrorAs(t, err, new(*PathNotFoundError))
+
+	_, _, err = source.RetrieveFileSystem(context.Background(),
+		Reference{Path: filepath.Join(baseDir, "apps", "web")}, nil)
+	assert.ErrorContains(t, err, "link escapes base directory")
+}
+
+func TestSource_RetrieveFileSystem_ScannedPathBelowLinkOutsideBaseDirectory(t *testing.T) {
+	baseDir := t.TempDir()
+	outsideDir := t.TempDir()
+	writeFiles(t, baseDir, map[string]string{"apps/web/kustomization.yaml": "resources:\n- ../../link/sub\n"})
+	writeFiles(t, outsideDir, map[string]string{"sub/secret.yaml": "kind: Secret\n"})
+	require.NoError(t, os.Symlink(outsideDir, filepath.Join(baseDir, "link")))
+	source, err := NewSource([]string{baseDir})
+	require.NoError(t, err)
+
+	scan := func(_ *filesystem.FileSystem) ([]string, error) {
+		return []string{"link/sub"}, nil
+	}
+	_, _, err = source.RetrieveFileSystem(context.Background(),
+		Reference{Path: filepath.Join(baseDir, "apps", "web")}, scan)
+	assert.ErrorAs(t, err, new(*PathNotAllowedError))
+}
@@ -0,0 +1,55 @@
+package ociartifact
+
+import (
+	"fmt"
+	"strings"
+)
+
+type ReferenceInvalidError struct {
+	reason string
+}
+
+func (e *ReferenceInvalidError) Error() string {
+	return fmt.Sprintf("oci artifact reference is invalid: %s", e.reason)
+}
+
+func NewReferenceInvalidError(reason string) *ReferenceInvalidError {
+	return &ReferenceInvalidError{
+		reason: reason,
+	}
+}
+
+type ArtifactNotFoundError struct {
+	artifactURL string
+}
+
+func (e *ArtifactNotFoundError) Error() string {
+	return fmt.Sprintf("oci artifact '%s' does not exist", e.artifactURL)
+}
+
+func NewArtifactNotFoundError(repository string, reference string) *ArtifactNotFoundError {
+	// tags never contain colons, digests always do
+	separator := ":"
+	if strings.Contains(reference, ":") {
+		separator = "@"
+	}
+	return &ArtifactNotFoundError{
+		artifactURL: repository + separator + reference,
+	}
+}
+
+type ArtifactInvalidError struct {
+	artifactURL string
+	reason      string
+}
+
+func (e *ArtifactInvalidError) Error() string {
+	return fmt.Sprintf("oci artifact '%s' is invalid: %s", e.artifactURL, e.reason)
+}
+
+func NewArtifactInvalidError(artifactURL string, reason string) *ArtifactInvalidError {
+	return &ArtifactInvalidError{
+		artifactURL: artifactURL,
+		reason:      reason,
+	}
+}
@@ -0,0 +1,296 @@
+package ociartifact
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	aucache "github.com/Roshick/go-autumn-synchronisation/pkg/cache"
+	"github.com/Roshick/manifest-maestro/internal/credentials"
+	"github.com/Roshick/manifest-maestro/internal/repository/ociregistry"
+	"github.com/Roshick/manifest-maestro/internal/service/cache"
+	"github.com/Roshick/manifest-maestro/pkg/archive"
+	"github.com/Roshick/manifest-maestro/pkg/archive/limit"
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+	aulogging "github.com/StephanHCB/go-autumn-logging"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/errdef"
+	"oras.land/oras-go/v2/registry"
+)
+
+const (
+	// FluxContentMediaType is the layer media type of artifacts pushed with 'flux push artifact'.
+	FluxContentMediaType = "application/vnd.cncf.flux.content.v1.tar+gzip"
+
+	dockerManifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerLayerMediaType    = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+)
+
+// maxLayerSize caps the size of the selected layer, which is held in memory as a whole.
+const maxLayerSize int64 = 64 << 20
+
+// extractionLimits cap the content of the selected layer after decompression.
+var extractionLimits = limit.Limits{
+	MaxEntries: 10000,
+	MaxSize:    256 << 20,
+}
+
+// defaultLayerMediaTypes are the layer media types selected without an explicit media type, in order of preference.
+var defaultLayerMediaTypes = []string{FluxContentMediaType, ocispec.MediaTypeImageLayerGzip, dockerLayerMediaType}
+
+// Reference selects an OCI artifact whose layer is a gzip-compressed tarball, like the Flux OCIRepository source.
+// The artifact is selected by Digest, SemVer or Tag, in that order of precedence, and defaults to the 'latest' tag.
+type Reference struct {
+	// URL is the repository, e.g. 'oci://ghcr.io/org/manifests'.
+	URL    string `json:"url"`
+	Tag    string `json:"tag,omitempty"`
+	Digest string `json:"digest,omitempty"`
+	// SemVer is a semantic version range over the tags, resolving to the highest matching tag.
+	SemVer string `json:"semver,omitempty"`
+	// MediaType selects the first layer of this media type. Without media type, the first layer of a known
+	// gzip-compressed tarball media type is selected, preferring Flux content layers.
+	MediaType string `json:"mediaType,omitempty"`
+	// Path is the slash-separated directory relative to the root of the layer. Without path, the root is selected,
+	// unless it contains no marker file but a single directory.
+	Path string `json:"path,omitempty"`
+}
+
+type Registry interface {
+	Repository(ctx context.Context, repository string) (ociregistry.Repository, error)
+}
+
+// Source pulls OCI artifacts from registries. Tags and version ranges are resolved to manifest digests on every
+// retrieval, while layers are cached by their digest.
+type Source struct {
+	registry        Registry
+	allowedHosts    map[string]bool
+	cache           aucache.Cache[[]byte]
+	fileSystemCache *cache.FileSystemCache
+}
+
+// NewSource creates a source for artifacts of registries on the allowed hosts, including the port if any, e.g.
+// 'ghcr.io' or 'registry.example.com:5000'. Without allowed hosts, all references are rejected.
+func NewSource(
+	registry Registry, allowedHosts []string, cache aucache.Cache[[]byte], fileSystemCache *cache.FileSystemCache,
+) *Source {
+	normalizedAllowedHosts := make(map[string]bool, len(allowedHosts))
+	for _, host := range allowedHosts {
+		normalizedAllowedHosts[strings.ToLower(host)] = true
+	}
+	return &Source{
+		registry:        registry,
+		allowedHosts:    normalizedAllowedHosts,
+		cache:           cache,
+		fileSystemCache: fileSystemCache,
+	}
+}
+
+// RetrieveFileSystem returns the extracted layer of the artifact and the path of the selected directory within it.
+// The file system is shared with other requests for the same layer and must not be mutated, wrap it with
+// filesystem.NewOverlay instead.
+func (s *Source) RetrieveFileSystem(
+	ctx context.Context, reference Reference, markers ...string,
+) (*filesystem.FileSystem, string, error) {
+	if reference.URL == "" {
+		return nil, "", NewReferenceInvalidError("url is required")
+	}
+	if reference.Digest != "" {
+		if _, err := digest.Parse(reference.Digest); err != nil {
+			return nil, "", NewReferenceInvalidError(fmt.Sprintf("digest '%s' is invalid: %v", reference.Digest, err))
+		}
+	}
+	selectedPath := path.Clean(reference.Path)
+	if path.IsAbs(selectedPath) || selectedPath == ".." || strings.HasPrefix(selectedPath, "../") {
+		return nil, "", NewReferenceInvalidError(fmt.Sprintf("path '%s' is not relative", reference.Path))
+	}
+	repositoryReference, err := registry.ParseReference(strings.TrimPrefix(reference.URL, "oci://"))
+	if err != nil {
+		return nil, "", NewReferenceInvalidError(err.Error())
+	}
+	if !s.allowedHosts[strings.ToLower(repositoryReference.Registry)] {
+		return nil, "", NewReferenceInvalidError(
+			fmt.Sprintf("registry '%s' is not allowed", repositoryReference.Registry))
+	}
+
+	repository, err := s.registry.Repository(ctx, reference.URL)
+	if err != nil {
+		return nil, "", NewReferenceInvalidError(err.Error())
+	}
+	manifestDescriptor, err := s.resolve(ctx, repository, reference)
+	if err != nil {
+		return nil, "", err
+	}
+	artifactURL := fmt.Sprintf("%s@%s", strings.TrimPrefix(reference.URL, "oci://"), manifestDescriptor.Digest)
+
+	// artifacts pulled with request credentials are only served to requests with the same credentials
+	key := credentials.HelmCacheKey(ctx, reference.URL, fmt.Sprintf("%s|%s", artifactURL, reference.MediaType))
+	fileSystem, err := s.fileSystemCache.Retrieve(ctx, key, func(ctx context.Context, fileSystem *filesystem.FileSystem) error {
+		layer, innerErr := s.selectLayer(ctx, repository, manifestDescriptor, artifactURL, reference.MediaType)
+		if innerErr != nil {
+			return innerErr
+		}
+		layerKey := credentials.HelmCacheKey(
+			ctx, reference.URL, fmt.Sprintf("%s@%s", strings.TrimPrefix(reference.URL, "oci://"), layer.Digest))
+		data, innerErr := s.retrieveLayer(ctx, repository, layerKey, layer)
+		if innerErr != nil {
+			return innerErr
+		}
+		innerErr = archive.ExtractWithLimits(ctx, fileSystem, data, fileSystem.Root, extractionLimits)
+		if innerErr != nil {
+			return NewArtifactInvalidError(artifactURL, fmt.Sprintf("failed to extract layer: %v", innerErr))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if reference.Path == "" {
+		return fileSystem, archive.Root(fileSystem, fileSystem.Root, markers...), nil
+	}
+	targetPath := fileSystem.Join(fileSystem.Root, selectedPath)
+	if !fileSystem.IsDir(targetPath) {
+		return nil, "", NewReferenceInvalidError(fmt.Sprintf("path '%s' is no directory", reference.Path))
+	}
+	return fileSystem, targetPath, nil
+}
+
+// resolve returns the descriptor of the manifest selected by the reference.
+func (s *Source) resolve(
+	ctx context.Context, repository ociregistry.Repository, reference Reference,
+) (*ocispec.Descriptor, error) {
+	target := reference.Digest
+	if target == "" && reference.SemVer != "" {
+		tag, err := s.resolveVersionRange(ctx, repository, reference)
+		if err != nil {
+			return nil, err
+		}
+		target = tag
+	}
+	if target == "" {
+		target = reference.Tag
+	}
+	if target == "" {
+		target = "latest"
+	}
+
+	descriptor, err := repository.Resolve(ctx, target)
+	if errors.Is(err, errdef.ErrNotFound) {
+		return nil, NewArtifactNotFoundError(reference.URL, target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	aulogging.Logger.Ctx(ctx).Debug().Printf(
+		"resolved oci artifact '%s' at '%s' to '%s'", reference.URL, target, descriptor.Digest)
+	return &descriptor, nil
+}
+
+func (s *Source) resolveVersionRange(
+	ctx context.Context, repository ociregistry.Repository, reference Reference,
+) (string, error) {
+	constraints, err := semver.NewConstraint(reference.SemVer)
+	if err != nil {
+		return "", NewReferenceInvalidError(fmt.Sprintf("version range '%s' is invalid: %v", reference.SemVer, err))
+	}
+
+	var bestTag string
+	var bestVersion *semver.Version
+	err = repository.Tags(ctx, "", func(tags []string) error {
+		for _, tag := range tags {
+			version, innerErr := semver.NewVersion(tag)
+			if innerErr != nil || !constraints.Check(version) {
+				continue
+			}
+			if bestVersion == nil || version.GreaterThan(bestVersion) {
+				bestTag = tag
+				bestVersion = version
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if bestVersion == nil {
+		return "", NewArtifactNotFoundError(reference.URL, reference.SemVer)
+	}
+	return bestTag, nil
+}
+
+func (s *Source) selectLayer(
+	ctx context.Context,
+	repository ociregistry.Repository,
+	manifestDescriptor *ocispec.Descriptor,
+	artifactURL string,
+	mediaType string,
+) (*ocispec.Descriptor, error) {
+	if manifestDescriptor.MediaType != ocispec.MediaTypeImageManifest &&
+		manifestDescriptor.MediaType != dockerManifestMediaType {
+		return nil, NewArtifactInvalidError(artifactURL,
+			fmt.Sprintf("manifest media type '%s' is not supported", manifestDescriptor.MediaType))
+	}
+	data, err := content.FetchAll(ctx, repository, *manifestDescriptor)
+	if err != nil {
+		return nil, err
+	}
+	manifest := ocispec.Manifest{}
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return nil, NewArtifactInvalidError(artifactURL, fmt.Sprintf("failed to decode manifest: %v", err))
+	}
+
+	mediaTypes := defaultLayerMediaTypes
+	if mediaType != "" {
+		mediaTypes = []string{mediaType}
+	}
+	for _, candidate := range mediaTypes {
+		index := slices.IndexFunc(manifest.Layers, func(layer ocispec.Descriptor) bool {
+			return layer.MediaType == candidate
+		})
+		if index < 0 {
+			continue
+		}
+		if manifest.Layers[index].Size > maxLayerSize {
+			return nil, NewArtifactInvalidError(artifactURL,
+				fmt.Sprintf("layer is larger than %d bytes", maxLayerSize))
+		}
+		return &manifest.Layers[index], nil
+	}
+	return nil, NewArtifactInvalidError(artifactURL,
+		fmt.Sprintf("manifest has no layer of media type %s", strings.Join(mediaTypes, ", ")))
+}
+
+func (s *Source) retrieveLayer(
+	ctx context.Context, repository ociregistry.Repository, key string, layer *ocispec.Descriptor,
+) ([]byte, error) {
+	cached, err := s.cache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		aulogging.Logger.Ctx(ctx).Info().Printf("cache hit for oci artifact layer with key '%s'", key)
+		return *cached, nil
+	}
+	aulogging.Logger.Ctx(ctx).Info().Printf(
+		"cache miss for oci artifact layer with key '%s', retrieving from remote", key)
+
+	// the content is verified against the digest and the size of the layer
+	data, err := content.FetchAll(ctx, repository, *layer)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.cache.Set(ctx, key, data, 15*time.Minute); err != nil {
+		aulogging.Logger.Ctx(ctx).Warn().WithErr(err).Printf("failed to cache oci artifact layer with key '%s'", key)
+	} else {
+		aulogging.Logger.Ctx(ctx).Info().Printf("successfully cached oci artifact layer with key '%s'", key)
+	}
+	return data, nil
+}
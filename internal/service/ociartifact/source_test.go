@@ -0,0 +1,142 @@
+package ociartifact
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/Roshick/manifest-maestro/internal/service/cache"
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+	"github.com/Roshick/manifest-maestro/pkg/targz"
+	"github.com/Roshick/manifest-maestro/test/mock/cachemock"
+	"github.com/Roshick/manifest-maestro/test/mock/ocimock"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tarball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	fileSystem := filesystem.New()
+	for name, content := range files {
+		filePath := fileSystem.Join(fileSystem.Root, name)
+		require.NoError(t, fileSystem.MkdirAll(fileSystem.Dir(filePath)))
+		require.NoError(t, fileSystem.WriteFile(filePath, []byte(content)))
+	}
+	buffer := new(bytes.Buffer)
+	require.NoError(t, targz.Compress(context.Background(), fileSystem, fileSystem.Root, "", buffer))
+	return buffer.Bytes()
+}
+
+func TestSource_RetrieveFileSystem(t *testing.T) {
+	ctx := context.Background()
+	registry := ocimock.NewRegistry()
+	repository := "oci://registry.example.com/manifests"
+	firstDigest, err := registry.PushArtifact(ctx, repository, "1.0.0", FluxContentMediaType, tarball(t, map[string]string{
+		"overlays/dev/kustomization.yaml": "resources:\n- ../../base\n",
+		"base/deployment.yaml":            "kind: Deployment\n",
+	}))
+	require.NoError(t, err)
+	_, err = registry.PushArtifact(ctx, repository, "1.1.0", FluxContentMediaType, tarball(t, map[string]string{
+		"kustomization.yaml": "resources: []\n",
+	}))
+	require.NoError(t, err)
+	_, err = registry.PushArtifact(ctx, repository, "2.0.0", FluxContentMediaType, tarball(t, map[string]string{
+		"kustomization.yaml": "resources: []\n",
+	}))
+	require.NoError(t, err)
+	source := NewSource(registry, []string{"registry.example.com"}, cachemock.New[[]byte](), cache.NewFileSystemCache(0))
+
+	fileSystem, targetPath, err := source.RetrieveFileSystem(ctx,
+		Reference{URL: repository, Tag: "1.0.0", Path: "overlays/dev"}, "kustomization.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "/overlays/dev", targetPath)
+	assert.True(t, fileSystem.Exists("/base/deployment.yaml"))
+
+	fileSystem, _, err = source.RetrieveFileSystem(ctx,
+		Reference{URL: repository, Digest: firstDigest.String()}, "kustomization.yaml")
+	require.NoError(t, err)
+	assert.True(t, fileSystem.Exists("/base/deployment.yaml"))
+
+	fileSystem, targetPath, err = source.RetrieveFileSystem(ctx,
+		Reference{URL: repository, SemVer: "~1.0 || ^1.1", Tag: "2.0.0"}, "kustomization.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "/", targetPath)
+	assert.False(t, fileSystem.Exists("/base"))
+
+	// manifests are fetched for every retrieval, the layer of the first artifact is fetched only once
+	assert.Equal(t, int32(2+1+2), registry.FetchCallCount.Load())
+}
+
+func TestSource_RetrieveFileSystem_MediaTypes(t *testing.T) {
+	ctx := context.Background()
+	registry := ocimock.NewRegistry()
+	repository := "registry.example.com/manifests"
+	_, err := registry.PushArtifact(ctx, repository, "image", ocispec.MediaTypeImageLayerGzip,
+		tarball(t, map[string]string{"app/kustomization.yaml": "resources: []\n"}))
+	require.NoError(t, err)
+	_, err = registry.PushArtifact(ctx, repository, "chart", "application/vnd.cncf.helm.chart.content.v1.tar+gzip",
+		tarball(t, map[string]string{"app/Chart.yaml": "name: app\n"}))
+	require.NoError(t, err)
+	source := NewSource(registry, []string{"registry.example.com"}, cachemock.New[[]byte](), cache.NewFileSystemCache(0))
+
+	_, targetPath, err := source.RetrieveFileSystem(ctx, Reference{URL: repository, Tag: "image"}, "kustomization.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "/app", targetPath)
+
+	_, _, err = source.RetrieveFileSystem(ctx, Reference{URL: repository, Tag: "chart"})
+	assert.ErrorAs(t, err, new(*ArtifactInvalidError))
+
+	_, _, err = source.RetrieveFileSystem(ctx, Reference{URL: repository, Tag: "image", MediaType: FluxContentMediaType})
+	assert.ErrorAs(t, err, new(*ArtifactInvalidError))
+
+	_, targetPath, err = source.RetrieveFileSystem(ctx, Reference{
+		URL: repository, Tag: "chart", MediaType: "application/vnd.cncf.helm.chart.content.v1.tar+gzip",
+	}, "Chart.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "/app", targetPath)
+}
+
+func TestSource_RetrieveFileSystem_Invalid(t *testing.T) {
+	ctx := context.Background()
+	registry := ocimock.NewRegistry()
+	repository := "registry.example.com/manifests"
+	_, err := registry.PushArtifact(ctx, repository, "1.0.0", FluxContentMediaType,
+		tarball(t, map[string]string{"kustomization.yaml": "resources: []\n"}))
+	require.NoError(t, err)
+	source := NewSource(registry, []string{"registry.example.com"}, cachemock.New[[]byte](), cache.NewFileSystemCache(0))
+
+	for _, reference := range []Reference{
+		{Tag: "1.0.0"},
+		{URL: "oci://169.254.169.254/manifests", Tag: "1.0.0"},
+		{URL: repository, Digest: "sha256:invalid"},
+		{URL: repository, SemVer: "not a range"},
+		{URL: repository, Tag: "1.0.0", Path: "../outside"},
+		{URL: repository, Tag: "1.0.0", Path: "missing"},
+	} {
+		_, _, err = source.RetrieveFileSystem(ctx, reference)
+		assert.ErrorAs(t, err, new(*ReferenceInvalidError), reference)
+	}
+
+	for _, reference := range []Reference{
+		{URL: repository},
+		{URL: repository, Tag: "2.0.0"},
+		{URL: repository, SemVer: ">=2"},
+		{URL: repository, Digest: "sha256:0000000000000000000000000000000000000000000000000000000000000000"},
+	} {
+		_, _, err = source.RetrieveFileSystem(ctx, reference)
+		assert.ErrorAs(t, err, new(*ArtifactNotFoundError), reference)
+	}
+}
+
+func TestSource_RetrieveFileSystem_LayerTooLarge(t *testing.T) {
+	ctx := context.Background()
+	registry := ocimock.NewRegistry()
+	repository := "registry.example.com/manifests"
+	_, err := registry.PushArtifact(ctx, repository, "1.0.0", FluxContentMediaType, make([]byte, maxLayerSize+1))
+	require.NoError(t, err)
+	source := NewSource(registry, []string{"registry.example.com"}, cachemock.New[[]byte](), cache.NewFileSystemCache(0))
+
+	_, _, err = source.RetrieveFileSystem(ctx, Reference{URL: repository, Tag: "1.0.0"})
+	assert.ErrorAs(t, err, new(*ArtifactInvalidError))
+}
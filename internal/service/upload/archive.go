@@ -0,0 +1,43 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/Roshick/manifest-maestro/pkg/archive"
+	"github.com/Roshick/manifest-maestro/pkg/archive/limit"
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+)
+
+// extractionLimits cap the content of uploaded archives, which are limited to 32 MiB compressed only.
+var extractionLimits = limit.Limits{
+	MaxEntries: 10000,
+	MaxSize:    256 << 20,
+}
+
+// Extract extracts an uploaded gzip-compressed tarball or zip archive into a new file system, and returns the
+// directory selected by the slash-separated path relative to the archive root. Without path, the archive root is
+// selected, unless it contains none of the marker files but a single directory, like packaged Helm charts do.
+func Extract(
+	ctx context.Context, content []byte, selectedPath string, markers ...string,
+) (*filesystem.FileSystem, string, error) {
+	fileSystem := filesystem.New()
+	if err := archive.ExtractWithLimits(ctx, fileSystem, content, fileSystem.Root, extractionLimits); err != nil {
+		return nil, "", NewArchiveInvalidError(err)
+	}
+
+	if selectedPath != "" {
+		cleanPath := path.Clean(selectedPath)
+		if path.IsAbs(cleanPath) || cleanPath == ".." || strings.HasPrefix(cleanPath, "../") {
+			return nil, "", NewArchiveInvalidError(fmt.Errorf("path '%s' is not relative to the archive root", selectedPath))
+		}
+		targetPath := fileSystem.Join(fileSystem.Root, cleanPath)
+		if !fileSystem.IsDir(targetPath) {
+			return nil, "", NewArchiveInvalidError(fmt.Errorf("path '%s' is no directory of the archive", selectedPath))
+		}
+		return fileSystem, targetPath, nil
+	}
+	return fileSystem, archive.Root(fileSystem, fileSystem.Root, markers...), nil
+}
@@ -0,0 +1,132 @@
+package upload
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Roshick/manifest-maestro/pkg/archive/limit"
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+	"github.com/Roshick/manifest-maestro/pkg/targz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tarball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	fileSystem := filesystem.New()
+	for name, content := range files {
+		filePath := fileSystem.Join(fileSystem.Root, name)
+		require.NoError(t, fileSystem.MkdirAll(fileSystem.Dir(filePath)))
+		require.NoError(t, fileSystem.WriteFile(filePath, []byte(content)))
+	}
+	buffer := new(bytes.Buffer)
+	require.NoError(t, targz.Compress(context.Background(), fileSystem, fileSystem.Root, "", buffer))
+	return buffer.Bytes()
+}
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	buffer := new(bytes.Buffer)
+	zw := zip.NewWriter(buffer)
+	for name, content := range files {
+		writer, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = writer.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buffer.Bytes()
+}
+
+func TestExtract_PackagedChart(t *testing.T) {
+	content := tarball(t, map[string]string{
+		"app/Chart.yaml":        "name: app\n",
+		"app/templates/cm.yaml": "kind: ConfigMap\n",
+	})
+
+	fileSystem, targetPath, err := Extract(context.Background(), content, "", "Chart.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "/app", targetPath)
+	assert.True(t, fileSystem.Exists("/app/templates/cm.yaml"))
+}
+
+func TestExtract_Zip(t *testing.T) {
+	content := zipArchive(t, map[string]string{
+		"kustomization.yaml":              "resources:\n- base\n",
+		"base/deployment.yaml":            "kind: Deployment\n",
+		"overlays/dev/kustomization.yaml": "resources:\n- ../../base\n",
+	})
+
+	_, targetPath, err := Extract(context.Background(), content, "", "kustomization.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "/", targetPath)
+
+	fileSystem, targetPath, err := Extract(context.Background(), content, "overlays/dev", "kustomization.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "/overlays/dev", targetPath)
+	assert.True(t, fileSystem.Exists("/base/deployment.yaml"))
+}
+
+func TestExtract_Invalid(t *testing.T) {
+	content := tarball(t, map[string]string{"app/Chart.yaml": "name: app\n"})
+
+	for _, testCase := range []struct {
+		content []byte
+		path    string
+	}{
+		{content: []byte("plain text"), path: ""},
+		{content: content, path: "../app"},
+		{content: content, path: "/app"},
+		{content: content, path: "missing"},
+		{content: content, path: "app/Chart.yaml"},
+	} {
+		_, _, err := Extract(context.Background(), testCase.content, testCase.path, "Chart.yaml")
+		assert.ErrorAs(t, err, new(*ArchiveInvalidError), testCase.path)
+	}
+}
+
+func TestExtract_ExceedsLimits(t *testing.T) {
+	defaultLimits := extractionLimits
+	extractionLimits = limit.Limits{MaxEntries: 3, MaxSize: 1024}
+	t.Cleanup(func() { extractionLimits = defaultLimits })
+
+	testCases := []struct {
+		name    string
+		content []byte
+	}{
+		{
+			name:    "tarball bomb",
+			content: tarball(t, map[string]string{"Chart.yaml": "name: app\n", "zeros.yaml": strings.Repeat("0", 4096)}),
+		},
+		{
+			name:    "zip bomb",
+			content: zipArchive(t, map[string]string{"Chart.yaml": "name: app\n", "zeros.yaml": strings.Repeat("0", 4096)}),
+		},
+		{
+			name: "total size of small entries",
+			content: zipArchive(t, map[string]string{
+				"a.yaml": strings.Repeat("0", 512), "b.yaml": strings.Repeat("0", 512), "c.yaml": "0",
+			}),
+		},
+		{
+			name: "too many entries",
+			content: zipArchive(t, map[string]string{
+				"a.yaml": "a", "b.yaml": "b", "c.yaml": "c", "d.yaml": "d",
+			}),
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, _, err := Extract(context.Background(), testCase.content, "", "Chart.yaml")
+			assert.ErrorAs(t, err, new(*ArchiveInvalidError))
+			assert.ErrorIs(t, err, limit.ErrExceeded)
+		})
+	}
+
+	content := zipArchive(t, map[string]string{"a.yaml": strings.Repeat("0", 512), "b.yaml": strings.Repeat("0", 512)})
+	_, _, err := Extract(context.Background(), content, "", "Chart.yaml")
+	assert.NoError(t, err)
+}
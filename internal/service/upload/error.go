@@ -0,0 +1,21 @@
+package upload
+
+import "fmt"
+
+type ArchiveInvalidError struct {
+	err error
+}
+
+func (e *ArchiveInvalidError) Error() string {
+	return fmt.Sprintf("uploaded archive is invalid: %v", e.err)
+}
+
+func (e *ArchiveInvalidError) Unwrap() error {
+	return e.err
+}
+
+func NewArchiveInvalidError(err error) *ArchiveInvalidError {
+	return &ArchiveInvalidError{
+		err: err,
+	}
+}
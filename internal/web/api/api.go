@@ -0,0 +1,62 @@
+// Package api holds the actions served in addition to manifest-maestro-api: their request and response types and
+// the specification merged into the served openapi.yaml.
+package api
+
+import (
+	_ "embed"
+	"fmt"
+	"io/fs"
+
+	"sigs.k8s.io/yaml"
+)
+
+// SpecPath is the path of the specification within the file system of manifest-maestro-api.
+const SpecPath = "api/openapi.yaml"
+
+//go:embed openapi.yaml
+var supplement []byte
+
+// Spec returns the specification of manifest-maestro-api read from apiFS, extended by the paths and components of
+// the actions defined in this package. Entries of manifest-maestro-api take precedence.
+func Spec(apiFS fs.FS) ([]byte, error) {
+	upstreamContent, err := fs.ReadFile(apiFS, SpecPath)
+	if err != nil {
+		return nil, err
+	}
+	upstream := make(map[string]any)
+	if err = yaml.Unmarshal(upstreamContent, &upstream); err != nil {
+		return nil, fmt.Errorf("failed to parse '%s': %w", SpecPath, err)
+	}
+	extension := make(map[string]any)
+	if err = yaml.Unmarshal(supplement, &extension); err != nil {
+		return nil, fmt.Errorf("failed to parse specification supplement: %w", err)
+	}
+
+	mergeEntries(upstream, extension, "paths")
+	upstreamComponents := section(upstream, "components")
+	extensionComponents := section(extension, "components")
+	for name := range extensionComponents {
+		mergeEntries(upstreamComponents, extensionComponents, name)
+	}
+	return yaml.Marshal(upstream)
+}
+
+// mergeEntries adds the entries of the named section of extension that are missing in target.
+func mergeEntries(target map[string]any, extension map[string]any, name string) {
+	targetSection := section(target, name)
+	for key, value := range section(extension, name) {
+		if _, ok := targetSection[key]; !ok {
+			targetSection[key] = value
+		}
+	}
+}
+
+// section returns the named map of parent, creating it if missing.
+func section(parent map[string]any, name string) map[string]any {
+	if child, ok := parent[name].(map[string]any); ok {
+		return child
+	}
+	child := make(map[string]any)
+	parent[name] = child
+	return child
+}
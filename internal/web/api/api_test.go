@@ -0,0 +1,55 @@
+package api
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+)
+
+func TestSpec_MergesActionsIntoUpstreamSpecification(t *testing.T) {
+	apiFS := fstest.MapFS{SpecPath: &fstest.MapFile{Data: []byte(`
+openapi: 3.0.3
+paths:
+  /rest/api/v1/helm/actions/render-chart:
+    post:
+      operationId: helmActionsRenderChart
+components:
+  schemas:
+    Error:
+      type: object
+    GitReference:
+      description: upstream
+`)}}
+
+	content, err := Spec(apiFS)
+	require.NoError(t, err)
+	spec := make(map[string]any)
+	require.NoError(t, yaml.Unmarshal(content, &spec))
+
+	assert.Equal(t, "3.0.3", spec["openapi"])
+	paths := spec["paths"].(map[string]any)
+	for _, path := range []string{
+		"/rest/api/v1/helm/actions/render-chart",
+		"/rest/api/v1/helm/actions/render-chart-archive",
+		"/rest/api/v1/kustomize/actions/render-kustomization-archive",
+		"/rest/api/v1/git/actions/resolve-reference",
+		"/rest/api/v1/git/actions/list-references",
+		"/rest/api/v1/git/actions/invalidate-references",
+	} {
+		assert.Contains(t, paths, path)
+	}
+	components := spec["components"].(map[string]any)
+	schemas := components["schemas"].(map[string]any)
+	assert.Contains(t, schemas, "GitResolveReferenceAction")
+	assert.Contains(t, schemas, "Credentials")
+	assert.Equal(t, map[string]any{"description": "upstream"}, schemas["GitReference"])
+	assert.Contains(t, components["securitySchemes"], "invalidationToken")
+}
+
+func TestSpec_UpstreamSpecificationMissing(t *testing.T) {
+	_, err := Spec(fstest.MapFS{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"github.com/Roshick/manifest-maestro/internal/credentials"
+	"github.com/Roshick/manifest-maestro/internal/service/gitreference"
+)
+
+// The types in this file are the request and response bodies of the actions the served specification documents
+// in addition to manifest-maestro-api, see openapi.yaml.
+
+type GitResolveReferenceAction struct {
+	RepositoryURL string `json:"repositoryURL"`
+	Reference     string `json:"reference"`
+	// IncludeCommit fetches the author, dates and message of the commit, defaults to true.
+	IncludeCommit *bool                    `json:"includeCommit,omitempty"`
+	Credentials   *credentials.Credentials `json:"credentials,omitempty"`
+}
+
+type GitListReferencesAction struct {
+	RepositoryURL string                        `json:"repositoryURL"`
+	Filter        *gitreference.ReferenceFilter `json:"filter,omitempty"`
+	Credentials   *credentials.Credentials      `json:"credentials,omitempty"`
+}
+
+type GitListReferencesActionResponse struct {
+	References []gitreference.Reference `json:"references"`
+}
+
+type GitInvalidateReferencesAction struct {
+	RepositoryURL string `json:"repositoryURL"`
+	// Credentials select the references cached for requests with the same credentials.
+	Credentials *credentials.Credentials `json:"credentials,omitempty"`
+}
+
+// ArchiveUpload is a multipart request with the archive in the form field 'archive', the optional slash-separated
+// path of the chart or kustomization within the archive in 'path', the optional JSON render parameters in
+// 'parameters' and the optional JSON credentials for fetching remote dependencies in 'credentials'.
+type ArchiveUpload[P any] struct {
+	Archive     []byte
+	Path        string
+	Parameters  *P
+	Credentials *credentials.Credentials
+}
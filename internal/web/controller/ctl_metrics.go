@@ -10,29 +10,29 @@ import (
 )
 
 type MetricsController struct {
-	gitHubClient            *github.Client
-	gitHubAppID             int64
-	gitHubAppInstallationID int64
+	gitHubClient             *github.Client
+	gitHubAppID              int64
+	gitHubAppInstallationIDs func() []int64
 }
 
 func NewMetricsController(
 	gitHubClient *github.Client,
 	gitHubAppID int64,
-	gitHubAppInstallationID int64,
+	gitHubAppInstallationIDs func() []int64,
 ) *MetricsController {
 	return &MetricsController{
-		gitHubClient:            gitHubClient,
-		gitHubAppID:             gitHubAppID,
-		gitHubAppInstallationID: gitHubAppInstallationID,
+		gitHubClient:             gitHubClient,
+		gitHubAppID:              gitHubAppID,
+		gitHubAppInstallationIDs: gitHubAppInstallationIDs,
 	}
 }
 
 func (c *MetricsController) WireUp(_ context.Context, r chi.Router) {
 	r.Group(func(r chi.Router) {
 		r.Use(middleware.RecordGitHubRateLimitMetrics(middleware.RecordGitHubRateLimitMetricsOptions{
-			Client:            c.gitHubClient,
-			AppID:             c.gitHubAppID,
-			AppInstallationID: c.gitHubAppInstallationID,
+			Client:             c.gitHubClient,
+			AppID:              c.gitHubAppID,
+			AppInstallationIDs: c.gitHubAppInstallationIDs,
 		}))
 		r.Handle("/metrics", promhttp.Handler())
 	})
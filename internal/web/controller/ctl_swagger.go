@@ -3,23 +3,47 @@ package controller
 import (
 	"context"
 	"net/http"
+	"sync"
 
 	openapi "github.com/Roshick/manifest-maestro-api"
+	"github.com/Roshick/manifest-maestro/internal/utils"
+	"github.com/Roshick/manifest-maestro/internal/web/api"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
 	swagger "github.com/swaggo/http-swagger/v2"
 )
 
 func NewSwaggerController() *SwaggerController {
-	return &SwaggerController{}
+	return &SwaggerController{
+		spec: sync.OnceValues(func() ([]byte, error) {
+			return api.Spec(openapi.APIFs)
+		}),
+	}
 }
 
 type SwaggerController struct {
+	// spec is the specification of manifest-maestro-api extended by the actions of package api
+	spec func() ([]byte, error)
 }
 
 func (c *SwaggerController) WireUp(_ context.Context, r chi.Router) {
 	r.Handle("/index.html", http.RedirectHandler("/swagger-ui/index.html", http.StatusPermanentRedirect))
 	r.Route("/swagger-ui", func(r chi.Router) {
+		r.Get("/"+api.SpecPath, c.getSpec)
 		r.Handle("/api/*", http.StripPrefix("/swagger-ui/", http.FileServer(http.FS(openapi.APIFs))))
-		r.Get("/*", swagger.Handler(swagger.URL("api/openapi.yaml")))
+		r.Get("/*", swagger.Handler(swagger.URL(api.SpecPath)))
 	})
 }
+
+func (c *SwaggerController) getSpec(w http.ResponseWriter, r *http.Request) {
+	spec, err := c.spec()
+	if err != nil {
+		_ = render.Render(w, r, &APIError{StatusCode: http.StatusInternalServerError, Error: openapi.Error{
+			Title:  utils.Ptr("Specification unavailable"),
+			Detail: utils.Ptr(err.Error()),
+		}})
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	_, _ = w.Write(spec)
+}
@@ -2,20 +2,33 @@ package controller
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/Roshick/go-autumn-web/logging"
 	"github.com/Roshick/go-autumn-web/validation"
+	"github.com/Roshick/manifest-maestro/internal/credentials"
+	"github.com/Roshick/manifest-maestro/internal/service/gitreference"
 	"github.com/Roshick/manifest-maestro/internal/service/helm"
 	"github.com/Roshick/manifest-maestro/internal/service/kustomize"
 	"github.com/Roshick/manifest-maestro/internal/utils"
+	"github.com/Roshick/manifest-maestro/internal/web/api"
 	"github.com/go-chi/render"
 
 	openapi "github.com/Roshick/manifest-maestro-api"
 	"github.com/go-chi/chi/v5"
 )
 
+// maxArchiveUploadSize limits multipart requests carrying a chart or kustomization archive, including all other
+// form fields.
+const maxArchiveUploadSize = 32 << 20
+
 type V1Controller struct {
 	clock Clock
 
@@ -23,18 +36,45 @@ type V1Controller struct {
 	helmChartRenderer     *helm.ChartRenderer
 	kustomizationProvider *kustomize.KustomizationProvider
 	kustomizationRenderer *kustomize.KustomizationRenderer
+	gitReferenceResolver  *gitreference.ReferenceResolver
+	// invalidationToken must be sent as bearer token to invalidate cached references
+	invalidationToken string
 }
 
 type Clock interface {
 	Now() time.Time
 }
 
+type helmGetChartMetadataAction struct {
+	Reference   helm.ChartReference      `json:"reference"`
+	Credentials *credentials.Credentials `json:"credentials,omitempty"`
+}
+
+type helmRenderChartAction struct {
+	Reference   helm.ChartReference           `json:"reference"`
+	Parameters  *openapi.HelmRenderParameters `json:"parameters,omitempty"`
+	Credentials *credentials.Credentials      `json:"credentials,omitempty"`
+}
+
+type kustomizeRenderKustomizationAction struct {
+	Reference   kustomize.KustomizationReference `json:"reference"`
+	Parameters  *kustomize.RenderParameters      `json:"parameters,omitempty"`
+	Credentials *credentials.Credentials         `json:"credentials,omitempty"`
+}
+
+type helmRenderChartActionResponse struct {
+	Manifests []openapi.Manifest   `json:"manifests"`
+	Metadata  *helm.RenderMetadata `json:"metadata,omitempty"`
+}
+
 func NewV1Controller(
 	clock Clock,
 	helmChartProvider *helm.ChartProvider,
 	helmChartRenderer *helm.ChartRenderer,
 	kustomizationProvider *kustomize.KustomizationProvider,
 	kustomizationRenderer *kustomize.KustomizationRenderer,
+	gitReferenceResolver *gitreference.ReferenceResolver,
+	invalidationToken string,
 ) *V1Controller {
 	return &V1Controller{
 		clock:                 clock,
@@ -42,6 +82,8 @@ func NewV1Controller(
 		helmChartRenderer:     helmChartRenderer,
 		kustomizationProvider: kustomizationProvider,
 		kustomizationRenderer: kustomizationRenderer,
+		gitReferenceResolver:  gitReferenceResolver,
+		invalidationToken:     invalidationToken,
 	}
 }
 
@@ -60,14 +102,29 @@ func (c *V1Controller) WireUp(_ context.Context, r chi.Router) {
 					Post("/list-charts", c.helmActionsListCharts)
 				r.With(validation.NewContextRequestBodyMiddleware[openapi.HelmListChartVersionsAction](malformedBodyOptions)).
 					Post("/list-charts", c.helmActionsListChartVersions)
-				r.With(validation.NewContextRequestBodyMiddleware[openapi.HelmGetChartMetadataAction](malformedBodyOptions)).
+				r.With(validation.NewContextRequestBodyMiddleware[helmGetChartMetadataAction](malformedBodyOptions)).
 					Post("/get-chart-metadata", c.helmActionsGetChartMetadata)
-				r.With(validation.NewContextRequestBodyMiddleware[openapi.HelmRenderChartAction](malformedBodyOptions)).
+				r.With(validation.NewContextRequestBodyMiddleware[helmRenderChartAction](malformedBodyOptions)).
 					Post("/render-chart", c.helmActionsRenderChart)
+				r.Post("/render-chart-archive", c.helmActionsRenderChartArchive)
 			})
 			r.Route("/kustomize/actions", func(r chi.Router) {
-				r.With(validation.NewContextRequestBodyMiddleware[openapi.KustomizeRenderKustomizationAction](malformedBodyOptions)).
+				r.With(validation.NewContextRequestBodyMiddleware[kustomizeRenderKustomizationAction](malformedBodyOptions)).
 					Post("/render-kustomization", c.kustomizeRenderKustomization)
+				r.Post("/render-kustomization-archive", c.kustomizeRenderKustomizationArchive)
+			})
+			r.Route("/git/actions", func(r chi.Router) {
+				r.With(validation.NewContextRequestBodyMiddleware[api.GitResolveReferenceAction](malformedBodyOptions)).
+					Post("/resolve-reference", c.gitActionsResolveReference)
+				r.With(validation.NewContextRequestBodyMiddleware[api.GitListReferencesAction](malformedBodyOptions)).
+					Post("/list-references", c.gitActionsListReferences)
+				// without token, cached references can only be invalidated by webhooks
+				if c.invalidationToken != "" {
+					r.With(
+						c.requireInvalidationToken,
+						validation.NewContextRequestBodyMiddleware[api.GitInvalidateReferencesAction](malformedBodyOptions),
+					).Post("/invalidate-references", c.gitActionsInvalidateReferences)
+				}
 			})
 		})
 	})
@@ -100,7 +157,8 @@ func (c *V1Controller) helmActionsListChartVersions(w http.ResponseWriter, r *ht
 func (c *V1Controller) helmActionsGetChartMetadata(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	action := validation.RequestBodyFromContext[openapi.HelmGetChartMetadataAction](ctx)
+	action := validation.RequestBodyFromContext[helmGetChartMetadataAction](ctx)
+	ctx = credentials.NewContext(ctx, action.Credentials)
 	helmChart, err := c.helmChartProvider.GetHelmChart(ctx, action.Reference)
 	if err != nil {
 		handleError(ctx, w, r, err)
@@ -115,7 +173,8 @@ func (c *V1Controller) helmActionsGetChartMetadata(w http.ResponseWriter, r *htt
 func (c *V1Controller) helmActionsRenderChart(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	action := validation.RequestBodyFromContext[openapi.HelmRenderChartAction](ctx)
+	action := validation.RequestBodyFromContext[helmRenderChartAction](ctx)
+	ctx = credentials.NewContext(ctx, action.Credentials)
 
 	helmChart, err := c.helmChartProvider.GetHelmChart(ctx, action.Reference)
 	if err != nil {
@@ -129,7 +188,35 @@ func (c *V1Controller) helmActionsRenderChart(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	render.JSON(w, r, openapi.HelmRenderChartActionResponse{
+	render.JSON(w, r, helmRenderChartActionResponse{
+		Manifests: manifests,
+		Metadata:  metadata,
+	})
+}
+
+func (c *V1Controller) helmActionsRenderChartArchive(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	action, err := parseArchiveUpload[openapi.HelmRenderParameters](w, r)
+	if err != nil {
+		renderMalformedBody(w, r, err)
+		return
+	}
+	ctx = credentials.NewContext(ctx, action.Credentials)
+
+	helmChart, err := c.helmChartProvider.GetHelmChartFromArchive(ctx, action.Archive, action.Path)
+	if err != nil {
+		handleError(ctx, w, r, err)
+		return
+	}
+
+	manifests, metadata, err := c.helmChartRenderer.Render(ctx, helmChart, action.Parameters)
+	if err != nil {
+		handleError(ctx, w, r, err)
+		return
+	}
+
+	render.JSON(w, r, helmRenderChartActionResponse{
 		Manifests: manifests,
 		Metadata:  metadata,
 	})
@@ -138,7 +225,8 @@ func (c *V1Controller) helmActionsRenderChart(w http.ResponseWriter, r *http.Req
 func (c *V1Controller) kustomizeRenderKustomization(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	action := validation.RequestBodyFromContext[openapi.KustomizeRenderKustomizationAction](ctx)
+	action := validation.RequestBodyFromContext[kustomizeRenderKustomizationAction](ctx)
+	ctx = credentials.NewContext(ctx, action.Credentials)
 
 	kustomization, err := c.kustomizationProvider.GetKustomization(ctx, action.Reference)
 	if err != nil {
@@ -156,3 +244,169 @@ func (c *V1Controller) kustomizeRenderKustomization(w http.ResponseWriter, r *ht
 		Manifests: manifests,
 	})
 }
+
+func (c *V1Controller) kustomizeRenderKustomizationArchive(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	action, err := parseArchiveUpload[kustomize.RenderParameters](w, r)
+	if err != nil {
+		renderMalformedBody(w, r, err)
+		return
+	}
+	ctx = credentials.NewContext(ctx, action.Credentials)
+
+	kustomization, err := c.kustomizationProvider.GetKustomizationFromArchive(ctx, action.Archive, action.Path)
+	if err != nil {
+		handleError(ctx, w, r, err)
+		return
+	}
+
+	manifests, err := c.kustomizationRenderer.Render(ctx, kustomization, action.Parameters)
+	if err != nil {
+		handleError(ctx, w, r, err)
+		return
+	}
+
+	render.JSON(w, r, openapi.KustomizeRenderKustomizationActionResponse{
+		Manifests: manifests,
+	})
+}
+
+func (c *V1Controller) gitActionsResolveReference(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	action := validation.RequestBodyFromContext[api.GitResolveReferenceAction](ctx)
+	ctx = credentials.NewContext(ctx, action.Credentials)
+
+	includeCommit := action.IncludeCommit == nil || *action.IncludeCommit
+	resolved, err := c.gitReferenceResolver.ResolveReference(ctx, action.RepositoryURL, action.Reference, includeCommit)
+	if err != nil {
+		handleError(ctx, w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resolved)
+}
+
+func (c *V1Controller) gitActionsListReferences(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	action := validation.RequestBodyFromContext[api.GitListReferencesAction](ctx)
+	ctx = credentials.NewContext(ctx, action.Credentials)
+
+	references, err := c.gitReferenceResolver.ListReferences(ctx, action.RepositoryURL, action.Filter)
+	if err != nil {
+		handleError(ctx, w, r, err)
+		return
+	}
+
+	render.JSON(w, r, api.GitListReferencesActionResponse{
+		References: references,
+	})
+}
+
+func (c *V1Controller) gitActionsInvalidateReferences(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	action := validation.RequestBodyFromContext[api.GitInvalidateReferencesAction](ctx)
+	ctx = credentials.NewContext(ctx, action.Credentials)
+
+	if err := c.gitReferenceResolver.InvalidateReferences(ctx, action.RepositoryURL); err != nil {
+		handleError(ctx, w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireInvalidationToken rejects requests that do not carry the invalidation token as bearer token, so cached
+// references cannot be flushed by anyone able to reach the API.
+func (c *V1Controller) requireInvalidationToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(c.invalidationToken)) != 1 {
+			_ = render.Render(w, r, &APIError{StatusCode: http.StatusUnauthorized, Error: openapi.Error{
+				Title: utils.Ptr("Invalidation token invalid"),
+			}})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func parseArchiveUpload[P any](w http.ResponseWriter, r *http.Request) (*api.ArchiveUpload[P], error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxArchiveUploadSize)
+	if err := r.ParseMultipartForm(maxArchiveUploadSize); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = r.MultipartForm.RemoveAll()
+	}()
+
+	archive, ok, err := multipartField(r.MultipartForm, "archive")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("form field 'archive' is missing")
+	}
+	path, _, err := multipartField(r.MultipartForm, "path")
+	if err != nil {
+		return nil, err
+	}
+	action := &api.ArchiveUpload[P]{
+		Archive: archive,
+		Path:    string(path),
+	}
+
+	parameters, ok, err := multipartField(r.MultipartForm, "parameters")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		action.Parameters = new(P)
+		if err = json.Unmarshal(parameters, action.Parameters); err != nil {
+			return nil, fmt.Errorf("form field 'parameters' is malformed: %w", err)
+		}
+	}
+
+	requestCredentials, ok, err := multipartField(r.MultipartForm, "credentials")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		action.Credentials = new(credentials.Credentials)
+		if err = json.Unmarshal(requestCredentials, action.Credentials); err != nil {
+			return nil, fmt.Errorf("form field 'credentials' is malformed")
+		}
+	}
+	return action, nil
+}
+
+// multipartField returns the content of the form field, which is either a file or a plain value.
+func multipartField(form *multipart.Form, name string) ([]byte, bool, error) {
+	if files := form.File[name]; len(files) > 0 {
+		file, err := files[0].Open()
+		if err != nil {
+			return nil, false, err
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		content, err := io.ReadAll(file)
+		return content, true, err
+	}
+	if values := form.Value[name]; len(values) > 0 {
+		return []byte(values[0]), true, nil
+	}
+	return nil, false, nil
+}
+
+func renderMalformedBody(w http.ResponseWriter, r *http.Request, err error) {
+	if innerErr := render.Render(w, r, &APIError{StatusCode: http.StatusBadRequest, Error: openapi.Error{
+		Title:  utils.Ptr("Malformed body"),
+		Detail: utils.Ptr(err.Error()),
+	}}); innerErr != nil {
+		panic(innerErr)
+	}
+}
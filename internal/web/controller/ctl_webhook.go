@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	openapi "github.com/Roshick/manifest-maestro-api"
+	"github.com/Roshick/manifest-maestro/internal/service/githubwebhook"
+	"github.com/Roshick/manifest-maestro/internal/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/google/go-github/v90/github"
+)
+
+// maxWebhookPayloadSize is the size limit GitHub applies to webhook payloads.
+const maxWebhookPayloadSize = 25 << 20
+
+type WebhookController struct {
+	gitHubWebhookReceiver *githubwebhook.Receiver
+}
+
+// NewWebhookController creates the controller receiving webhooks. Without a receiver, e.g. if no webhook secret is
+// configured, no webhook endpoint is served.
+func NewWebhookController(gitHubWebhookReceiver *githubwebhook.Receiver) *WebhookController {
+	return &WebhookController{
+		gitHubWebhookReceiver: gitHubWebhookReceiver,
+	}
+}
+
+func (c *WebhookController) WireUp(_ context.Context, r chi.Router) {
+	if c.gitHubWebhookReceiver == nil {
+		return
+	}
+	r.Group(func(r chi.Router) {
+		r.Post("/webhooks/github", c.receiveGitHubWebhook)
+	})
+}
+
+func (c *WebhookController) receiveGitHubWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayloadSize))
+	if err != nil {
+		_ = render.Render(w, r, &APIError{StatusCode: http.StatusBadRequest, Error: openapi.Error{
+			Title:  utils.Ptr("Malformed body"),
+			Detail: utils.Ptr(err.Error()),
+		}})
+		return
+	}
+
+	err = c.gitHubWebhookReceiver.Receive(ctx, githubwebhook.Delivery{
+		ID:          github.DeliveryID(r),
+		EventType:   github.WebHookType(r),
+		Signature:   r.Header.Get(github.SHA256SignatureHeader),
+		ContentType: r.Header.Get("Content-Type"),
+		Body:        body,
+	})
+	if err != nil {
+		handleError(ctx, w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
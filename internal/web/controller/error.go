@@ -8,9 +8,16 @@ import (
 	openapi "github.com/Roshick/manifest-maestro-api"
 	"github.com/Roshick/manifest-maestro/internal/repository/git"
 	"github.com/Roshick/manifest-maestro/internal/repository/helmremote"
+	"github.com/Roshick/manifest-maestro/internal/repository/s3"
+	"github.com/Roshick/manifest-maestro/internal/service/bucket"
 	"github.com/Roshick/manifest-maestro/internal/service/cache"
+	"github.com/Roshick/manifest-maestro/internal/service/githubwebhook"
+	"github.com/Roshick/manifest-maestro/internal/service/gitreference"
 	"github.com/Roshick/manifest-maestro/internal/service/helm"
 	"github.com/Roshick/manifest-maestro/internal/service/kustomize"
+	"github.com/Roshick/manifest-maestro/internal/service/localpath"
+	"github.com/Roshick/manifest-maestro/internal/service/ociartifact"
+	"github.com/Roshick/manifest-maestro/internal/service/upload"
 	"github.com/Roshick/manifest-maestro/internal/utils"
 	aulogging "github.com/StephanHCB/go-autumn-logging"
 	"github.com/go-chi/render"
@@ -54,6 +61,21 @@ func handleErrorWrapped(ctx context.Context, w http.ResponseWriter, r *http.Requ
 			Title:  utils.Ptr("Helm repository URL invalid"),
 			Detail: utils.Ptr(err.Error()),
 		}})
+	case errors.As(err, new(*cache.InvalidHelmChartVersionError)):
+		return render.Render(w, r, &APIError{StatusCode: http.StatusBadRequest, Error: openapi.Error{
+			Title:  utils.Ptr("Helm chart version invalid"),
+			Detail: utils.Ptr(err.Error()),
+		}})
+	case errors.As(err, new(*cache.InvalidHelmChartURLError)):
+		return render.Render(w, r, &APIError{StatusCode: http.StatusBadRequest, Error: openapi.Error{
+			Title:  utils.Ptr("Helm chart URL invalid"),
+			Detail: utils.Ptr(err.Error()),
+		}})
+	case errors.As(err, new(*cache.HelmChartChecksumMismatchError)):
+		return render.Render(w, r, &APIError{StatusCode: http.StatusBadRequest, Error: openapi.Error{
+			Title:  utils.Ptr("Helm chart checksum mismatch"),
+			Detail: utils.Ptr(err.Error()),
+		}})
 	case errors.As(err, new(*git.RepositoryNotFoundError)):
 		return render.Render(w, r, &APIError{StatusCode: http.StatusBadRequest, Error: openapi.Error{
 			Title:  utils.Ptr("Git repository not found"),
@@ -64,6 +86,81 @@ func handleErrorWrapped(ctx context.Context, w http.ResponseWriter, r *http.Requ
 			Title:  utils.Ptr("Git repository reference not found"),
 			Detail: utils.Ptr(err.Error()),
 		}})
+	case errors.As(err, new(*git.SubmoduleURLNotAllowedError)):
+		return render.Render(w, r, &APIError{StatusCode: http.StatusBadRequest, Error: openapi.Error{
+			Title:  utils.Ptr("Git submodule URL not allowed"),
+			Detail: utils.Ptr(err.Error()),
+		}})
+	case errors.As(err, new(*git.LFSObjectsTooLargeError)):
+		return render.Render(w, r, &APIError{StatusCode: http.StatusBadRequest, Error: openapi.Error{
+			Title:  utils.Ptr("Git LFS objects too large"),
+			Detail: utils.Ptr(err.Error()),
+		}})
+	case errors.As(err, new(*githubwebhook.SignatureInvalidError)):
+		return render.Render(w, r, &APIError{StatusCode: http.StatusUnauthorized, Error: openapi.Error{
+			Title:  utils.Ptr("GitHub webhook signature invalid"),
+			Detail: utils.Ptr(err.Error()),
+		}})
+	case errors.As(err, new(*githubwebhook.PayloadInvalidError)):
+		return render.Render(w, r, &APIError{StatusCode: http.StatusBadRequest, Error: openapi.Error{
+			Title:  utils.Ptr("GitHub webhook payload invalid"),
+			Detail: utils.Ptr(err.Error()),
+		}})
+	case errors.As(err, new(*gitreference.ReferenceRequestInvalidError)):
+		return render.Render(w, r, &APIError{StatusCode: http.StatusBadRequest, Error: openapi.Error{
+			Title:  utils.Ptr("Git reference request invalid"),
+			Detail: utils.Ptr(err.Error()),
+		}})
+	case errors.As(err, new(*localpath.PathNotAllowedError)):
+		return render.Render(w, r, &APIError{StatusCode: http.StatusForbidden, Error: openapi.Error{
+			Title:  utils.Ptr("Local path not allowed"),
+			Detail: utils.Ptr(err.Error()),
+		}})
+	case errors.As(err, new(*localpath.PathNotFoundError)):
+		return render.Render(w, r, &APIError{StatusCode: http.StatusBadRequest, Error: openapi.Error{
+			Title:  utils.Ptr("Local path not found"),
+			Detail: utils.Ptr(err.Error()),
+		}})
+	case errors.As(err, new(*s3.ObjectNotFoundError)):
+		return render.Render(w, r, &APIError{StatusCode: http.StatusBadRequest, Error: openapi.Error{
+			Title:  utils.Ptr("S3 object not found"),
+			Detail: utils.Ptr(err.Error()),
+		}})
+	case errors.As(err, new(*s3.EndpointNotAllowedError)):
+		return render.Render(w, r, &APIError{StatusCode: http.StatusForbidden, Error: openapi.Error{
+			Title:  utils.Ptr("S3 endpoint not allowed"),
+			Detail: utils.Ptr(err.Error()),
+		}})
+	case errors.As(err, new(*s3.ObjectTooLargeError)):
+		return render.Render(w, r, &APIError{StatusCode: http.StatusBadRequest, Error: openapi.Error{
+			Title:  utils.Ptr("S3 object too large"),
+			Detail: utils.Ptr(err.Error()),
+		}})
+	case errors.As(err, new(*bucket.ReferenceInvalidError)):
+		return render.Render(w, r, &APIError{StatusCode: http.StatusBadRequest, Error: openapi.Error{
+			Title:  utils.Ptr("Bucket reference invalid"),
+			Detail: utils.Ptr(err.Error()),
+		}})
+	case errors.As(err, new(*ociartifact.ReferenceInvalidError)):
+		return render.Render(w, r, &APIError{StatusCode: http.StatusBadRequest, Error: openapi.Error{
+			Title:  utils.Ptr("OCI artifact reference invalid"),
+			Detail: utils.Ptr(err.Error()),
+		}})
+	case errors.As(err, new(*ociartifact.ArtifactNotFoundError)):
+		return render.Render(w, r, &APIError{StatusCode: http.StatusBadRequest, Error: openapi.Error{
+			Title:  utils.Ptr("OCI artifact not found"),
+			Detail: utils.Ptr(err.Error()),
+		}})
+	case errors.As(err, new(*ociartifact.ArtifactInvalidError)):
+		return render.Render(w, r, &APIError{StatusCode: http.StatusBadRequest, Error: openapi.Error{
+			Title:  utils.Ptr("OCI artifact invalid"),
+			Detail: utils.Ptr(err.Error()),
+		}})
+	case errors.As(err, new(*upload.ArchiveInvalidError)):
+		return render.Render(w, r, &APIError{StatusCode: http.StatusBadRequest, Error: openapi.Error{
+			Title:  utils.Ptr("Uploaded archive invalid"),
+			Detail: utils.Ptr(err.Error()),
+		}})
 	case errors.As(err, new(*helm.ChartReferenceInvalidError)):
 		return render.Render(w, r, &APIError{StatusCode: http.StatusBadRequest, Error: openapi.Error{
 			Title:  utils.Ptr("Helm chart reference invalid"),
@@ -2,9 +2,11 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
+	"github.com/Roshick/manifest-maestro/internal/client"
 	aulogging "github.com/StephanHCB/go-autumn-logging"
 	"github.com/google/go-github/v90/github"
 	"go.opentelemetry.io/otel"
@@ -15,9 +17,10 @@ import (
 // RecordRequestMetrics //
 
 type RecordGitHubRateLimitMetricsOptions struct {
-	Client            *github.Client
-	AppID             int64
-	AppInstallationID int64
+	Client *github.Client
+	AppID  int64
+	// AppInstallationIDs returns the installations to record the rate limits of, as each has its own limits.
+	AppInstallationIDs func() []int64
 }
 
 func RecordGitHubRateLimitMetrics(options RecordGitHubRateLimitMetricsOptions) func(next http.Handler) http.Handler {
@@ -36,33 +39,42 @@ func RecordGitHubRateLimitMetrics(options RecordGitHubRateLimitMetricsOptions) f
 		metric.WithDescription("Unix timestamp (in seconds) of when the next rate limit reset will occur."),
 	)
 
+	recordInstallation := func(ctx context.Context, appInstallationID int64) {
+		timeoutCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		defer cancel()
+		limits, _, err := options.Client.RateLimit.Get(client.WithGitHubAppInstallationID(timeoutCtx, appInstallationID))
+		if errorResponse := new(github.ErrorResponse); errors.As(err, &errorResponse) &&
+			errorResponse.Response.StatusCode == http.StatusNotFound {
+			// GitHub Enterprise Server does not serve rate limits if rate limiting is disabled
+			aulogging.Logger.Ctx(ctx).Debug().
+				Printf("rate limiting is disabled for github application %d installation %d",
+					options.AppID, appInstallationID)
+			return
+		}
+		if err != nil {
+			aulogging.Logger.Ctx(ctx).
+				Warn().
+				WithErr(err).
+				Printf("failed to update rate limits for github application %d installation %d",
+					options.AppID, appInstallationID)
+			return
+		}
+		attributes := metric.WithAttributes(
+			attribute.Int64("github_app_id", options.AppID),
+			attribute.Int64("github_app_installation_id", appInstallationID),
+			attribute.String("github_resource", "core"),
+		)
+		apiRequestsLimit.Record(ctx, int64(limits.Core.Limit), attributes)
+		apiRequestsRemaining.Record(ctx, int64(limits.Core.Remaining), attributes)
+		apiRequestsResetTimestamp.Record(ctx, limits.Core.Reset.Unix(), attributes)
+	}
+
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, req *http.Request) {
 			ctx := req.Context()
 
-			timeoutCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
-			defer cancel()
-			if limits, _, err := options.Client.RateLimit.Get(timeoutCtx); err != nil {
-				aulogging.Logger.Ctx(ctx).
-					Warn().
-					WithErr(err).
-					Printf("failed to update rate limits for github application %d", options.AppID)
-			} else {
-				apiRequestsLimit.Record(ctx, int64(limits.Core.Limit), metric.WithAttributes(
-					attribute.Int64("github_app_id", options.AppID),
-					attribute.Int64("github_app_installation_id", options.AppInstallationID),
-					attribute.String("github_resource", "core"),
-				))
-				apiRequestsRemaining.Record(ctx, int64(limits.Core.Remaining), metric.WithAttributes(
-					attribute.Int64("github_app_id", options.AppID),
-					attribute.Int64("github_app_installation_id", options.AppInstallationID),
-					attribute.String("github_resource", "core"),
-				))
-				apiRequestsResetTimestamp.Record(ctx, limits.Core.Reset.Unix(), metric.WithAttributes(
-					attribute.Int64("github_app_id", options.AppID),
-					attribute.Int64("github_app_installation_id", options.AppInstallationID),
-					attribute.String("github_resource", "core"),
-				))
+			for _, appInstallationID := range options.AppInstallationIDs() {
+				recordInstallation(ctx, appInstallationID)
 			}
 
 			next.ServeHTTP(w, req)
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
 	"time"
 
 	aucache "github.com/Roshick/go-autumn-synchronisation/pkg/cache"
@@ -26,8 +27,15 @@ import (
 	"github.com/Roshick/manifest-maestro/internal/repository/clock"
 	augit "github.com/Roshick/manifest-maestro/internal/repository/git"
 	"github.com/Roshick/manifest-maestro/internal/repository/helmremote"
+	"github.com/Roshick/manifest-maestro/internal/repository/ociregistry"
+	"github.com/Roshick/manifest-maestro/internal/repository/s3"
+	"github.com/Roshick/manifest-maestro/internal/service/bucket"
+	"github.com/Roshick/manifest-maestro/internal/service/githubwebhook"
+	"github.com/Roshick/manifest-maestro/internal/service/gitreference"
 	"github.com/Roshick/manifest-maestro/internal/service/helm"
 	"github.com/Roshick/manifest-maestro/internal/service/kustomize"
+	"github.com/Roshick/manifest-maestro/internal/service/localpath"
+	"github.com/Roshick/manifest-maestro/internal/service/ociartifact"
 	"github.com/Roshick/manifest-maestro/internal/web"
 	aulogging "github.com/StephanHCB/go-autumn-logging"
 )
@@ -43,12 +51,20 @@ type ClientFactory interface {
 		appID int64,
 		appInstallationID int64,
 		privateKey *rsa.PrivateKey,
+		tokenBroker *client.GitHubTokenBroker,
+		opts *client.GitHubClientOptions,
+	) (*github.Client, error)
+
+	NewGitHubAppClient(
+		appID int64,
+		privateKey *rsa.PrivateKey,
 		opts *client.GitHubClientOptions,
 	) (*github.Client, error)
 }
 
 type Git interface {
 	cache.Git
+	gitreference.Git
 }
 
 type HelmRemote interface {
@@ -70,18 +86,31 @@ type Application struct {
 	TracerProvider  *trace.TracerProvider
 
 	// repositories (outgoing connectors)
-	GitHubClient *github.Client
-	Git          Git
-	HelmRemote   HelmRemote
+	GitHubTokenBroker     *client.GitHubTokenBroker
+	GitHubClient          *github.Client
+	GitHubAppAuthProvider *augit.GitHubAppAuthProvider
+	GitAuthProvider       *augit.HostAuthProvider
+	Git                   Git
+	GitHubArchive         *augit.GitHubArchive
+	S3                    *s3.S3
+	OCIRegistry           *ociregistry.OCIRegistry
+	HelmRemote            HelmRemote
 
 	// services (business logic)
+	GitReferenceCache     *cache.GitReferenceCache
+	FileSystemCache       *cache.FileSystemCache
 	GitRepositoryCache    *cache.GitRepositoryCache
 	HelmIndexCache        *cache.HelmIndexCache
 	HelmChartCache        *cache.HelmChartCache
+	LocalPathSource       *localpath.Source
+	BucketSource          *bucket.Source
+	OCIArtifactSource     *ociartifact.Source
 	HelmChartProvider     *helm.ChartProvider
 	HelmChartRenderer     *helm.ChartRenderer
 	KustomizationProvider *kustomize.KustomizationProvider
 	KustomizationRenderer *kustomize.KustomizationRenderer
+	GitReferenceResolver  *gitreference.ReferenceResolver
+	GitHubWebhookReceiver *githubwebhook.Receiver
 
 	// web stack
 	// controllers (incoming connectors)
@@ -90,6 +119,7 @@ type Application struct {
 	MetricsCtl  *controller.MetricsController
 	ProfilerCtl *controller.ProfilerController
 	V1Ctl       *controller.V1Controller
+	WebhookCtl  *controller.WebhookController
 
 	// server
 	Server *web.Server
@@ -117,14 +147,28 @@ func (a *Application) Create(ctx context.Context) error {
 	if err := a.createGitHub(ctx); err != nil {
 		return fmt.Errorf("failed to set up github: %w", err)
 	}
+	// the reference cache is set up early, as git lists remote references through it
+	if err := a.createGitReferenceCache(ctx); err != nil {
+		return fmt.Errorf("failed to set up git reference cache: %w", err)
+	}
 	if err := a.createGit(ctx); err != nil {
 		return fmt.Errorf("failed to set up git: %w", err)
 	}
+	if err := a.createGitHubArchive(ctx); err != nil {
+		return fmt.Errorf("failed to set up github archive: %w", err)
+	}
+	if err := a.createS3(ctx); err != nil {
+		return fmt.Errorf("failed to set up s3: %w", err)
+	}
+	if err := a.createOCIRegistry(ctx); err != nil {
+		return fmt.Errorf("failed to set up oci registry: %w", err)
+	}
 	if err := a.createHelmRemote(ctx); err != nil {
 		return fmt.Errorf("failed to set up helm-remote: %w", err)
 	}
 
 	// services (business logic)
+	a.createFileSystemCache(ctx)
 	if err := a.createGitRepositoryCache(ctx); err != nil {
 		return fmt.Errorf("failed to set up git repository cache: %w", err)
 	}
@@ -134,6 +178,15 @@ func (a *Application) Create(ctx context.Context) error {
 	if err := a.createHelmChartCache(ctx); err != nil {
 		return fmt.Errorf("failed to set up helm chart cache: %w", err)
 	}
+	if err := a.createLocalPathSource(ctx); err != nil {
+		return fmt.Errorf("failed to set up local path source: %w", err)
+	}
+	if err := a.createBucketSource(ctx); err != nil {
+		return fmt.Errorf("failed to set up bucket source: %w", err)
+	}
+	if err := a.createOCIArtifactSource(ctx); err != nil {
+		return fmt.Errorf("failed to set up oci artifact source: %w", err)
+	}
 	if err := a.createHelmChartProvider(ctx); err != nil {
 		return fmt.Errorf("failed to set up helm chart provider: %w", err)
 	}
@@ -146,6 +199,10 @@ func (a *Application) Create(ctx context.Context) error {
 	if err := a.createKustomizationRenderer(ctx); err != nil {
 		return fmt.Errorf("failed to set up kustomization renderer: %w", err)
 	}
+	if err := a.createGitReferenceResolver(ctx); err != nil {
+		return fmt.Errorf("failed to set up git reference resolver: %w", err)
+	}
+	a.createGitHubWebhookReceiver(ctx)
 
 	// web stack
 	a.createHealthController(ctx)
@@ -153,6 +210,7 @@ func (a *Application) Create(ctx context.Context) error {
 	a.createMetricsController(ctx)
 	a.createProfilerController(ctx)
 	a.createV1Controller(ctx)
+	a.createWebhookController(ctx)
 
 	if err := a.createServer(ctx); err != nil {
 		return fmt.Errorf("failed to set up server: %w", err)
@@ -192,6 +250,11 @@ func (a *Application) Run() int {
 		return config.ExitCodeCreateFailed
 	}
 
+	// background work starts once all components are wired
+	go a.GitHubTokenBroker.Run(ctx)
+	if a.GitHubWebhookReceiver != nil {
+		go a.GitHubWebhookReceiver.Run(ctx)
+	}
 	if err := a.Server.Run(ctx); err != nil {
 		aulogging.Logger.Ctx(ctx).Error().WithErr(err).Printf("failed to run application")
 		return config.ExitCodeRunFailed
@@ -276,24 +339,80 @@ func (a *Application) createClientFactory(_ context.Context) {
 func (a *Application) createGitHub(_ context.Context) error {
 	var err error
 
+	gitHubClientOptions := client.DefaultGitHubClientOptions()
+	gitHubClientOptions.EnterpriseBaseURL = a.ApplicationCfg.GitHubAPIURL
+	gitHubClientOptions.EnterpriseUploadURL = a.ApplicationCfg.GitHubUploadURL
+	if a.GitHubTokenBroker == nil {
+		// installation tokens are created with the app's own credentials, independently of the installation tokens
+		appClient, innerErr := a.ClientFactory.NewGitHubAppClient(
+			a.ApplicationCfg.GitHubAppID,
+			&a.ApplicationCfg.GitHubAppPrivateKey,
+			gitHubClientOptions,
+		)
+		if innerErr != nil {
+			return innerErr
+		}
+		a.GitHubTokenBroker, err = client.NewGitHubTokenBroker(
+			a.ApplicationCfg.GitHubAppID,
+			client.NewGitHubInstallationTokenMint(appClient),
+			a.Clock,
+			nil,
+		)
+		if err != nil {
+			return err
+		}
+	}
 	if a.GitHubClient == nil {
 		a.GitHubClient, err = a.ClientFactory.NewGitHubClient(
 			a.ApplicationCfg.GitHubAppID,
 			a.ApplicationCfg.GitHubAppInstallationID,
 			&a.ApplicationCfg.GitHubAppPrivateKey,
-			nil,
+			a.GitHubTokenBroker,
+			gitHubClientOptions,
 		)
 		if err != nil {
 			return err
 		}
 	}
+	if a.GitHubAppAuthProvider == nil {
+		a.GitHubAppAuthProvider = augit.NewGitHubAppAuthProvider(
+			a.GitHubClient,
+			a.GitHubTokenBroker,
+			a.Clock,
+			a.ApplicationCfg.GitHubAppInstallationID,
+			a.ApplicationCfg.GitHubAppInstallationIDs,
+		)
+	}
 	return nil
 }
 
 func (a *Application) createGit(_ context.Context) error {
+	if a.GitAuthProvider == nil {
+		providers, err := gitHostAuthProviders(
+			a.ApplicationCfg.GitHostCredentials, a.ApplicationCfg.GitHubHost(), a.GitHubAppAuthProvider,
+		)
+		if err != nil {
+			return err
+		}
+		a.GitAuthProvider = augit.NewHostAuthProvider(providers)
+	}
 	if a.Git == nil {
-		authProvider := augit.NewGitHubAppAuthProvider(a.GitHubClient, a.ApplicationCfg.GitHubAppInstallationID)
-		if iGit, err := augit.New(authProvider.GetAuth); err != nil {
+		var err error
+		gitOptions := augit.DefaultOptions()
+		gitOptions.Submodules = a.ApplicationCfg.GitSubmodules
+		gitOptions.SubmodulesAllowOtherHosts = a.ApplicationCfg.GitSubmodulesAllowOtherHosts
+		gitOptions.LFS = a.ApplicationCfg.GitLFS
+		gitOptions.LFSSizeLimit = a.ApplicationCfg.GitLFSSizeLimit
+		gitOptions.ReferenceCache = a.GitReferenceCache
+		gitOptions.MirrorDirectory = a.ApplicationCfg.GitMirrorDirectory
+		gitOptions.MirrorSizeLimit = a.ApplicationCfg.GitMirrorSizeLimit
+		// large lfs objects take much longer than the default timeout
+		httpClientOptions := client.DefaultHTTPClientOptions()
+		httpClientOptions.Timeout = a.ApplicationCfg.GitLFSTimeout
+		if gitOptions.HTTPClient, err = a.ClientFactory.NewHTTPClient("git-lfs", httpClientOptions); err != nil {
+			return err
+		}
+		if iGit, err := augit.New(a.GitAuthProvider.GetAuth, gitOptions); err != nil {
 			return err
 		} else {
 			a.Git = iGit
@@ -302,20 +421,159 @@ func (a *Application) createGit(_ context.Context) error {
 	return nil
 }
 
+func (a *Application) createGitHubArchive(ctx context.Context) error {
+	if a.GitHubArchive == nil && a.ApplicationCfg.GitHubArchiveDownload {
+		if a.ApplicationCfg.GitSubmodules || a.ApplicationCfg.GitLFS {
+			aulogging.Logger.Ctx(ctx).Warn().Print(
+				"github archive download is disabled, as archives contain neither submodules nor lfs objects")
+			return nil
+		}
+		// tarballs of large repositories take much longer than the default timeout
+		httpClientOptions := client.DefaultHTTPClientOptions()
+		httpClientOptions.Timeout = a.ApplicationCfg.GitHubArchiveTimeout
+		httpClient, err := a.ClientFactory.NewHTTPClient("github-archive", httpClientOptions)
+		if err != nil {
+			return err
+		}
+		a.GitHubArchive = augit.NewGitHubArchive(
+			a.ApplicationCfg.GitHubHost(), a.GitHubClient.BaseURL(), a.GitAuthProvider.GetAuth, httpClient,
+		)
+	}
+	return nil
+}
+
+func gitHostAuthProviders(
+	credentials config.GitHostCredentials,
+	gitHubHost string,
+	gitHubAppAuthProvider *augit.GitHubAppAuthProvider,
+) (map[string]augit.AuthProviderFn, error) {
+	providers := make(map[string]augit.AuthProviderFn)
+	for host, credential := range credentials {
+		switch credential.Type {
+		case config.GitCredentialTypeBasicAuth:
+			providers[host] = augit.NewBasicAuthProvider(credential.Username, credential.Password)
+		case config.GitCredentialTypeToken:
+			if credential.Username != "" {
+				providers[host] = augit.NewBasicAuthProvider(credential.Username, credential.Token)
+			} else {
+				providers[host] = augit.NewTokenAuthProvider(credential.Token)
+			}
+		case config.GitCredentialTypeSSH:
+			provider, err := augit.NewSSHAuthProvider(
+				credential.SSHUser, credential.SSHPrivateKey, credential.SSHPassphrase, credential.SSHKnownHosts,
+			)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ssh credentials for git host '%s': %w", host, err)
+			}
+			providers[host] = provider
+		case config.GitCredentialTypeGitHubApp:
+			providers[host] = gitHubAppAuthProvider.GetAuth
+		}
+	}
+	// repositories of the configured GitHub instance are accessed as the GitHub App by default
+	if _, ok := providers[gitHubHost]; !ok {
+		providers[gitHubHost] = gitHubAppAuthProvider.GetAuth
+	}
+	return providers, nil
+}
+
+func (a *Application) createS3(_ context.Context) error {
+	if a.S3 == nil {
+		httpClient, err := a.ClientFactory.NewHTTPClient("s3", nil)
+		if err != nil {
+			return err
+		}
+		credentials := make(map[string]s3.Credentials)
+		for host, credential := range a.ApplicationCfg.S3EndpointCredentials {
+			credentials[host] = s3.Credentials{
+				Region:             credential.Region,
+				AccessKeyID:        credential.AccessKeyID,
+				SecretAccessKey:    credential.SecretAccessKey,
+				SessionToken:       credential.SessionToken,
+				VirtualHostedStyle: credential.VirtualHostedStyle,
+			}
+		}
+		a.S3 = s3.New(credentials, a.ApplicationCfg.S3AllowedHosts, httpClient)
+	}
+	return nil
+}
+
+func (a *Application) createOCIRegistry(_ context.Context) error {
+	if a.OCIRegistry == nil {
+		httpClient, err := a.ClientFactory.NewHTTPClient("oci-registry", nil)
+		if err != nil {
+			return err
+		}
+		hosts := make(map[string]ociregistry.Host)
+		for host, providers := range a.ApplicationCfg.HelmHostProviders {
+			for _, provider := range providers {
+				if provider.Type != config.HelmProviderTypeOCI {
+					continue
+				}
+				ociHost := ociregistry.Host{
+					Username:    provider.Username,
+					Password:    provider.Password,
+					AccessToken: provider.BearerToken,
+					PlainHTTP:   provider.PlainHTTP,
+				}
+				if provider.HasTransportOptions() {
+					clientOptions := client.DefaultHTTPClientOptions()
+					clientOptions.Transport = provider.NewTransport()
+					ociHost.HTTPClient, err = a.ClientFactory.NewHTTPClient("oci-registry-"+host, clientOptions)
+					if err != nil {
+						return err
+					}
+				}
+				hosts[host] = ociHost
+				break
+			}
+		}
+		a.OCIRegistry = ociregistry.New(hosts, httpClient)
+	}
+	return nil
+}
+
 func (a *Application) createHelmRemote(_ context.Context) error {
 	if a.HelmRemote == nil {
-		a.HelmRemote = helmremote.New(a.ApplicationCfg.HelmHostProviders)
+		helmRemote, err := helmremote.New(a.ApplicationCfg.HelmHostProviders, a.ClientFactory, a.S3, a.OCIRegistry)
+		if err != nil {
+			return err
+		}
+		a.HelmRemote = helmRemote
 	}
 	return nil
 }
 
+func (a *Application) createGitReferenceCache(ctx context.Context) error {
+	if a.GitReferenceCache == nil {
+		byteSliceCache, err := a.createByteSliceCache(ctx, "git-reference")
+		if err != nil {
+			return err
+		}
+		a.GitReferenceCache = cache.NewGitReferenceCache(byteSliceCache, a.ApplicationCfg.GitReferenceCacheTTL)
+	}
+	return nil
+}
+
+func (a *Application) createFileSystemCache(_ context.Context) {
+	if a.FileSystemCache == nil {
+		a.FileSystemCache = cache.NewFileSystemCache(a.ApplicationCfg.FileSystemCacheSizeLimit)
+	}
+}
+
 func (a *Application) createGitRepositoryCache(ctx context.Context) error {
 	if a.GitRepositoryCache == nil {
 		byteSliceCache, err := a.createByteSliceCache(ctx, "git-repository")
 		if err != nil {
 			return err
 		}
-		a.GitRepositoryCache = cache.NewGitRepositoryCache(a.Git, byteSliceCache)
+		var archive cache.GitArchive
+		if a.GitHubArchive != nil {
+			archive = a.GitHubArchive
+		}
+		a.GitRepositoryCache = cache.NewGitRepositoryCache(
+			a.Git, archive, byteSliceCache, a.FileSystemCache, a.ApplicationCfg.GitSparseFetch,
+		)
 	}
 	return nil
 }
@@ -337,14 +595,58 @@ func (a *Application) createHelmChartCache(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
-		a.HelmChartCache = cache.NewHelmChartCache(a.HelmRemote, a.HelmIndexCache, byteSliceCache)
+		a.HelmChartCache = cache.NewHelmChartCache(a.HelmRemote, a.HelmIndexCache, byteSliceCache, a.FileSystemCache)
+	}
+	return nil
+}
+
+func (a *Application) createLocalPathSource(_ context.Context) error {
+	if a.LocalPathSource == nil {
+		localPathSource, err := localpath.NewSource(a.ApplicationCfg.LocalPathBaseDirectories)
+		if err != nil {
+			return err
+		}
+		a.LocalPathSource = localPathSource
+	}
+	return nil
+}
+
+func (a *Application) createBucketSource(ctx context.Context) error {
+	if a.BucketSource == nil {
+		byteSliceCache, err := a.createByteSliceCache(ctx, "bucket")
+		if err != nil {
+			return err
+		}
+		a.BucketSource = bucket.NewSource(a.S3, byteSliceCache, a.FileSystemCache)
+	}
+	return nil
+}
+
+func (a *Application) createOCIArtifactSource(ctx context.Context) error {
+	if a.OCIArtifactSource == nil {
+		byteSliceCache, err := a.createByteSliceCache(ctx, "oci-artifact")
+		if err != nil {
+			return err
+		}
+		// artifacts are only pulled from registries with oci providers and the explicitly allowed ones
+		allowedHosts := slices.Clone(a.ApplicationCfg.OCIArtifactAllowedHosts)
+		for host, providers := range a.ApplicationCfg.HelmHostProviders {
+			if slices.ContainsFunc(providers, func(provider config.HelmHostProvider) bool {
+				return provider.Type == config.HelmProviderTypeOCI
+			}) {
+				allowedHosts = append(allowedHosts, host)
+			}
+		}
+		a.OCIArtifactSource = ociartifact.NewSource(a.OCIRegistry, allowedHosts, byteSliceCache, a.FileSystemCache)
 	}
 	return nil
 }
 
 func (a *Application) createHelmChartProvider(_ context.Context) error {
 	if a.HelmChartProvider == nil {
-		a.HelmChartProvider = helm.NewChartProvider(a.HelmChartCache, a.GitRepositoryCache)
+		a.HelmChartProvider = helm.NewChartProvider(
+			a.HelmChartCache, a.GitRepositoryCache, a.LocalPathSource, a.BucketSource,
+		)
 	}
 	return nil
 }
@@ -359,7 +661,9 @@ func (a *Application) createHelmChartRenderer(_ context.Context) error {
 
 func (a *Application) createKustomizationProvider(_ context.Context) error {
 	if a.KustomizationProvider == nil {
-		a.KustomizationProvider = kustomize.NewKustomizationProvider(a.GitRepositoryCache)
+		a.KustomizationProvider = kustomize.NewKustomizationProvider(
+			a.GitRepositoryCache, a.LocalPathSource, a.BucketSource, a.OCIArtifactSource,
+		)
 	}
 	return nil
 }
@@ -371,6 +675,24 @@ func (a *Application) createKustomizationRenderer(_ context.Context) error {
 	return nil
 }
 
+func (a *Application) createGitReferenceResolver(_ context.Context) error {
+	if a.GitReferenceResolver == nil {
+		a.GitReferenceResolver = gitreference.NewReferenceResolver(a.Git, a.GitReferenceCache)
+	}
+	return nil
+}
+
+func (a *Application) createGitHubWebhookReceiver(_ context.Context) {
+	if a.GitHubWebhookReceiver == nil && a.ApplicationCfg.GitHubWebhookSecret != "" {
+		a.GitHubWebhookReceiver = githubwebhook.NewReceiver(
+			a.ApplicationCfg.GitHubWebhookSecret,
+			a.GitReferenceCache,
+			a.GitRepositoryCache,
+			a.ApplicationCfg.GitHubWebhookPrefetch,
+		)
+	}
+}
+
 func (a *Application) createHealthController(_ context.Context) {
 	a.HealthCtl = controller.NewHealthController()
 }
@@ -383,7 +705,7 @@ func (a *Application) createMetricsController(_ context.Context) {
 	a.MetricsCtl = controller.NewMetricsController(
 		a.GitHubClient,
 		a.ApplicationCfg.GitHubAppID,
-		a.ApplicationCfg.GitHubAppInstallationID,
+		a.GitHubAppAuthProvider.InstallationIDs,
 	)
 }
 
@@ -398,15 +720,21 @@ func (a *Application) createV1Controller(_ context.Context) {
 		a.HelmChartRenderer,
 		a.KustomizationProvider,
 		a.KustomizationRenderer,
+		a.GitReferenceResolver,
+		a.ApplicationCfg.ReferenceInvalidationToken,
 	)
 }
 
+func (a *Application) createWebhookController(_ context.Context) {
+	a.WebhookCtl = controller.NewWebhookController(a.GitHubWebhookReceiver)
+}
+
 func (a *Application) createServer(ctx context.Context) error {
 	if a.Server == nil {
 		server, err := web.NewServer(ctx,
 			a.ApplicationCfg.ServerAddress, a.ApplicationCfg.ServerPrimaryPort,
 			a.ApplicationCfg.ApplicationName,
-			a.HealthCtl, a.SwaggerCtl, a.MetricsCtl, a.ProfilerCtl, a.V1Ctl,
+			a.HealthCtl, a.SwaggerCtl, a.MetricsCtl, a.ProfilerCtl, a.V1Ctl, a.WebhookCtl,
 		)
 		if err != nil {
 			return err
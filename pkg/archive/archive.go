@@ -0,0 +1,61 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/Roshick/manifest-maestro/pkg/archive/limit"
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+	"github.com/Roshick/manifest-maestro/pkg/targz"
+	"github.com/Roshick/manifest-maestro/pkg/ziparchive"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zipMagics = [][]byte{[]byte("PK\x03\x04"), []byte("PK\x05\x06")}
+)
+
+// Extract extracts a gzip-compressed tarball or zip archive into the target path of the file system, detecting the
+// format by the leading magic bytes of the content.
+func Extract(ctx context.Context, fileSystem *filesystem.FileSystem, content []byte, targetPath string) error {
+	return ExtractWithLimits(ctx, fileSystem, content, targetPath, limit.Limits{})
+}
+
+// ExtractWithLimits is like Extract, but fails with limit.ErrExceeded once the archive has more entries or more
+// uncompressed content than allowed.
+func ExtractWithLimits(
+	ctx context.Context,
+	fileSystem *filesystem.FileSystem,
+	content []byte,
+	targetPath string,
+	limits limit.Limits,
+) error {
+	switch {
+	case bytes.HasPrefix(content, gzipMagic):
+		return targz.ExtractWithLimits(ctx, fileSystem, bytes.NewReader(content), targetPath, limits)
+	case slices.ContainsFunc(zipMagics, func(magic []byte) bool { return bytes.HasPrefix(content, magic) }):
+		return ziparchive.ExtractWithLimits(ctx, fileSystem, bytes.NewReader(content), int64(len(content)), targetPath, limits)
+	default:
+		return fmt.Errorf("archive is neither a gzip-compressed tarball nor a zip archive")
+	}
+}
+
+// Root returns the directory, unless it contains none of the marker files but a single directory, like packaged
+// Helm charts do. In that case, the single directory is returned.
+func Root(fileSystem *filesystem.FileSystem, directory string, markers ...string) string {
+	for _, marker := range markers {
+		if fileSystem.Exists(fileSystem.Join(directory, marker)) {
+			return directory
+		}
+	}
+	entries, err := fileSystem.ReadDir(directory)
+	if err != nil || len(entries) != 1 {
+		return directory
+	}
+	if entryPath := fileSystem.Join(directory, entries[0]); fileSystem.IsDir(entryPath) {
+		return entryPath
+	}
+	return directory
+}
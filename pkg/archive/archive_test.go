@@ -0,0 +1,67 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+	"github.com/Roshick/manifest-maestro/pkg/targz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createFileSystem(t *testing.T, files map[string]string) *filesystem.FileSystem {
+	t.Helper()
+	fileSystem := filesystem.New()
+	for name, content := range files {
+		filePath := fileSystem.Join(fileSystem.Root, name)
+		require.NoError(t, fileSystem.MkdirAll(fileSystem.Dir(filePath)))
+		require.NoError(t, fileSystem.WriteFile(filePath, []byte(content)))
+	}
+	return fileSystem
+}
+
+func TestExtract(t *testing.T) {
+	files := map[string]string{
+		"app/Chart.yaml":        "name: app\n",
+		"app/templates/cm.yaml": "kind: ConfigMap\n",
+	}
+
+	tarball := new(bytes.Buffer)
+	sourceFS := createFileSystem(t, files)
+	require.NoError(t, targz.Compress(context.Background(), sourceFS, sourceFS.Root, "", tarball))
+
+	zipArchive := new(bytes.Buffer)
+	zw := zip.NewWriter(zipArchive)
+	for name, content := range files {
+		writer, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = writer.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	for _, content := range [][]byte{tarball.Bytes(), zipArchive.Bytes()} {
+		fileSystem := filesystem.New()
+		require.NoError(t, Extract(context.Background(), fileSystem, content, fileSystem.Root))
+		data, err := fileSystem.ReadFile("/app/templates/cm.yaml")
+		require.NoError(t, err)
+		assert.Equal(t, "kind: ConfigMap\n", string(data))
+	}
+
+	assert.Error(t, Extract(context.Background(), filesystem.New(), []byte("plain text"), "/"))
+}
+
+func TestRoot(t *testing.T) {
+	fileSystem := createFileSystem(t, map[string]string{"app/Chart.yaml": "name: app\n"})
+	assert.Equal(t, "/app", Root(fileSystem, fileSystem.Root, "Chart.yaml"))
+	assert.Equal(t, "/app", Root(fileSystem, "/app", "Chart.yaml"))
+
+	fileSystem = createFileSystem(t, map[string]string{
+		"kustomization.yaml":   "resources:\n- base\n",
+		"base/deployment.yaml": "kind: Deployment\n",
+	})
+	assert.Equal(t, "/", Root(fileSystem, fileSystem.Root, "kustomization.yaml"))
+}
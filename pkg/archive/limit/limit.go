@@ -0,0 +1,58 @@
+package limit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrExceeded is returned once an archive exceeds the limits of its extraction.
+var ErrExceeded = errors.New("archive exceeds extraction limits")
+
+// Limits cap the content extracted from an archive, so archives decompressing to much more than their own size
+// cannot exhaust the memory of the in-memory file system. Zero values mean no limit.
+type Limits struct {
+	MaxEntries int
+	MaxSize    int64
+}
+
+// Counter tracks the entries and bytes extracted from a single archive. A nil Counter does not limit anything.
+type Counter struct {
+	limits  Limits
+	entries int
+	size    int64
+}
+
+func NewCounter(limits Limits) *Counter {
+	return &Counter{limits: limits}
+}
+
+// AddEntry counts an extracted entry, failing once the archive has more entries than allowed.
+func (c *Counter) AddEntry() error {
+	if c == nil {
+		return nil
+	}
+	c.entries++
+	if c.limits.MaxEntries > 0 && c.entries > c.limits.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrExceeded, c.limits.MaxEntries)
+	}
+	return nil
+}
+
+// Copy copies the content of an entry, failing once the content of all entries exceeds the allowed size. Never more
+// than one byte beyond the allowed size is read.
+func (c *Counter) Copy(writer io.Writer, reader io.Reader) error {
+	if c == nil || c.limits.MaxSize <= 0 {
+		_, err := io.Copy(writer, reader)
+		return err
+	}
+	written, err := io.Copy(writer, io.LimitReader(reader, c.limits.MaxSize-c.size+1))
+	c.size += written
+	if err != nil {
+		return err
+	}
+	if c.size > c.limits.MaxSize {
+		return fmt.Errorf("%w: more than %d bytes uncompressed", ErrExceeded, c.limits.MaxSize)
+	}
+	return nil
+}
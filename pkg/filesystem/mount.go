@@ -0,0 +1,179 @@
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// NewMount returns a file system that presents the given file system below the mount path. All other paths are
+// backed by a writable in-memory layer owned by the mount, so files can be placed next to the mounted file system
+// without touching it.
+func NewMount(mounted *FileSystem, mountPath string) *FileSystem {
+	mountPath = filepath.Join(string(filepath.Separator), mountPath)
+	layer := filesys.MakeFsInMemory()
+	// the in-memory file system cannot fail to create directories
+	_ = layer.MkdirAll(mountPath)
+	return &FileSystem{
+		Root:      string(filepath.Separator),
+		Separator: string(filepath.Separator),
+		FileSystem: &mount{
+			mounted:   mounted.FileSystem,
+			mountPath: mountPath,
+			layer:     layer,
+		},
+	}
+}
+
+type mount struct {
+	mounted   filesys.FileSystem
+	mountPath string
+	layer     filesys.FileSystem
+}
+
+func (m *mount) Create(path string) (filesys.File, error) {
+	if innerPath, ok := m.resolve(path); ok {
+		return m.mounted.Create(innerPath)
+	}
+	return m.layer.Create(path)
+}
+
+func (m *mount) Mkdir(path string) error {
+	if innerPath, ok := m.resolve(path); ok {
+		return m.mounted.Mkdir(innerPath)
+	}
+	return m.layer.Mkdir(path)
+}
+
+func (m *mount) MkdirAll(path string) error {
+	if innerPath, ok := m.resolve(path); ok {
+		return m.mounted.MkdirAll(innerPath)
+	}
+	return m.layer.MkdirAll(path)
+}
+
+func (m *mount) RemoveAll(path string) error {
+	if innerPath, ok := m.resolve(path); ok {
+		return m.mounted.RemoveAll(innerPath)
+	}
+	return m.layer.RemoveAll(path)
+}
+
+func (m *mount) Open(path string) (filesys.File, error) {
+	if innerPath, ok := m.resolve(path); ok {
+		return m.mounted.Open(innerPath)
+	}
+	return m.layer.Open(path)
+}
+
+func (m *mount) IsDir(path string) bool {
+	if innerPath, ok := m.resolve(path); ok {
+		return m.mounted.IsDir(innerPath)
+	}
+	return m.layer.IsDir(path)
+}
+
+func (m *mount) ReadDir(path string) ([]string, error) {
+	if innerPath, ok := m.resolve(path); ok {
+		return m.mounted.ReadDir(innerPath)
+	}
+	return m.layer.ReadDir(path)
+}
+
+func (m *mount) CleanedAbs(path string) (filesys.ConfirmedDir, string, error) {
+	innerPath, ok := m.resolve(path)
+	if !ok {
+		return m.layer.CleanedAbs(path)
+	}
+	dir, file, err := m.mounted.CleanedAbs(innerPath)
+	if err != nil {
+		return "", "", err
+	}
+	return filesys.ConfirmedDir(filepath.Join(m.mountPath, string(dir))), file, nil
+}
+
+func (m *mount) Exists(path string) bool {
+	if innerPath, ok := m.resolve(path); ok {
+		return m.mounted.Exists(innerPath)
+	}
+	return m.layer.Exists(path)
+}
+
+func (m *mount) Glob(pattern string) ([]string, error) {
+	allFiles := make([]string, 0)
+	err := m.Walk(string(filepath.Separator), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			match, innerErr := filepath.Match(pattern, path)
+			if innerErr != nil {
+				return innerErr
+			}
+			if match {
+				allFiles = append(allFiles, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !filesys.IsHiddenFilePath(pattern) {
+		allFiles = filesys.RemoveHiddenFiles(allFiles)
+	}
+	slices.Sort(allFiles)
+	return allFiles, nil
+}
+
+func (m *mount) ReadFile(path string) ([]byte, error) {
+	if innerPath, ok := m.resolve(path); ok {
+		return m.mounted.ReadFile(innerPath)
+	}
+	return m.layer.ReadFile(path)
+}
+
+func (m *mount) WriteFile(path string, data []byte) error {
+	if innerPath, ok := m.resolve(path); ok {
+		return m.mounted.WriteFile(innerPath, data)
+	}
+	return m.layer.WriteFile(path, data)
+}
+
+func (m *mount) Walk(path string, walkFn filepath.WalkFunc) error {
+	if innerPath, ok := m.resolve(path); ok {
+		return m.walkMounted(innerPath, walkFn)
+	}
+	return m.layer.Walk(path, func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil || filepath.Clean(currentPath) != m.mountPath {
+			return walkFn(currentPath, info, err)
+		}
+		// the mount path is an empty directory in the layer, descend into the mounted file system instead
+		if innerErr := m.walkMounted(string(filepath.Separator), walkFn); innerErr != nil {
+			return innerErr
+		}
+		return filepath.SkipDir
+	})
+}
+
+func (m *mount) walkMounted(innerPath string, walkFn filepath.WalkFunc) error {
+	return m.mounted.Walk(innerPath, func(currentPath string, info os.FileInfo, err error) error {
+		return walkFn(filepath.Join(m.mountPath, currentPath), info, err)
+	})
+}
+
+// resolve translates a path at or below the mount path into the corresponding path of the mounted file system.
+func (m *mount) resolve(path string) (string, bool) {
+	path = filepath.Join(string(filepath.Separator), path)
+	if path == m.mountPath {
+		return string(filepath.Separator), true
+	}
+	innerPath, ok := strings.CutPrefix(path, m.mountPath+string(filepath.Separator))
+	if !ok {
+		return "", false
+	}
+	return string(filepath.Separator) + innerPath, true
+}
@@ -0,0 +1,63 @@
+package filesystem
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMount_PresentsFileSystemBelowMountPath(t *testing.T) {
+	mounted := newBase(t)
+	mount := NewMount(mounted, "/mnt/base")
+
+	content, err := mount.ReadFile("/mnt/base/dir/sub/b.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "b", string(content))
+	assert.True(t, mount.IsDir("/mnt/base"))
+	assert.True(t, mount.IsDir("/mnt/base/dir"))
+	assert.False(t, mount.Exists("/dir/a.txt"))
+
+	dir, file, err := mount.CleanedAbs("/mnt/base/dir/../file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "/mnt/base", string(dir))
+	assert.Equal(t, "file.txt", file)
+
+	names, err := mount.ReadDir("/mnt")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"base"}, names)
+}
+
+func TestMount_WritesOutsideMountPathDoNotLeakIntoMountedFileSystem(t *testing.T) {
+	mounted := newBase(t)
+	mount := NewMount(mounted, "/mnt/base")
+
+	require.NoError(t, mount.WriteFile("/wrapper.txt", []byte("wrapper")))
+	require.NoError(t, mount.WriteFile("/mnt/base/c.txt", []byte("c")))
+
+	assert.True(t, mount.Exists("/wrapper.txt"))
+	assert.False(t, mounted.Exists("/wrapper.txt"))
+	content, err := mounted.ReadFile("/c.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "c", string(content))
+}
+
+func TestMount_WalkDescendsIntoMountedFileSystem(t *testing.T) {
+	mount := NewMount(newBase(t), "/mnt/base")
+	require.NoError(t, mount.WriteFile("/wrapper.txt", []byte("wrapper")))
+
+	visited := make([]string, 0)
+	require.NoError(t, mount.Walk("/", func(path string, _ os.FileInfo, err error) error {
+		visited = append(visited, path)
+		return err
+	}))
+	assert.Equal(t, []string{
+		"/", "/mnt", "/mnt/base", "/mnt/base/dir", "/mnt/base/dir/a.txt", "/mnt/base/dir/sub",
+		"/mnt/base/dir/sub/b.txt", "/mnt/base/file.txt", "/wrapper.txt",
+	}, visited)
+
+	files, err := mount.Glob("/mnt/base/dir/*.txt")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/mnt/base/dir/a.txt"}, files)
+}
@@ -0,0 +1,276 @@
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// NewOverlay returns a copy-on-write file system on top of the given base. All mutations are recorded in a
+// writable layer owned by the overlay, the base is only ever read and can therefore be shared between several
+// overlays, also concurrently. The base must not be mutated while overlays on top of it are in use.
+func NewOverlay(base *FileSystem) *FileSystem {
+	return &FileSystem{
+		Root:      base.Root,
+		Separator: base.Separator,
+		FileSystem: &overlay{
+			base:      base.FileSystem,
+			upper:     filesys.MakeFsInMemory(),
+			deletions: make(map[string]struct{}),
+		},
+	}
+}
+
+type overlay struct {
+	base  filesys.FileSystem
+	upper filesys.FileSystem
+	// deletions hide paths of the base, including everything below them
+	deletions map[string]struct{}
+}
+
+func (o *overlay) Create(path string) (filesys.File, error) {
+	path = o.clean(path)
+	if err := o.upper.MkdirAll(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	return o.upper.Create(path)
+}
+
+func (o *overlay) Mkdir(path string) error {
+	path = o.clean(path)
+	if !o.IsDir(filepath.Dir(path)) {
+		return fmt.Errorf("cannot make dir '%s': parent directory does not exist", path)
+	}
+	return o.upper.MkdirAll(path)
+}
+
+func (o *overlay) MkdirAll(path string) error {
+	return o.upper.MkdirAll(o.clean(path))
+}
+
+func (o *overlay) RemoveAll(path string) error {
+	path = o.clean(path)
+	if path == string(filepath.Separator) {
+		return fmt.Errorf("cannot remove a root node")
+	}
+	if o.upper.Exists(path) {
+		if err := o.upper.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	o.deletions[path] = struct{}{}
+	return nil
+}
+
+// Open opens a file for reading and writing. Files of the base are copied into the writable layer first, as the
+// in-memory file system does not support opening the same file more than once at a time.
+func (o *overlay) Open(path string) (filesys.File, error) {
+	path = o.clean(path)
+	if !o.upper.Exists(path) && o.inBase(path) && !o.base.IsDir(path) {
+		content, err := o.base.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err = o.WriteFile(path, content); err != nil {
+			return nil, err
+		}
+	}
+	if !o.upper.Exists(path) {
+		if o.inBase(path) {
+			return nil, fmt.Errorf("cannot open directory '%s'", path)
+		}
+		return nil, notExistError(path)
+	}
+	return o.upper.Open(path)
+}
+
+func (o *overlay) IsDir(path string) bool {
+	path = o.clean(path)
+	if o.upper.Exists(path) {
+		return o.upper.IsDir(path)
+	}
+	return o.inBase(path) && o.base.IsDir(path)
+}
+
+func (o *overlay) ReadDir(path string) ([]string, error) {
+	path = o.clean(path)
+	if !o.Exists(path) {
+		return nil, notExistError(path)
+	}
+	if !o.IsDir(path) {
+		return nil, fmt.Errorf("%s is not a directory", path)
+	}
+
+	names := make([]string, 0)
+	if o.upper.Exists(path) {
+		upperNames, err := o.upper.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, upperNames...)
+	}
+	if o.inBase(path) && o.base.IsDir(path) {
+		baseNames, err := o.base.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range baseNames {
+			if !slices.Contains(names, name) && o.inBase(filepath.Join(path, name)) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+func (o *overlay) CleanedAbs(path string) (filesys.ConfirmedDir, string, error) {
+	path = o.clean(path)
+	if !o.Exists(path) {
+		return "", "", notExistError(path)
+	}
+	if o.IsDir(path) {
+		return filesys.ConfirmedDir(path), "", nil
+	}
+	return filesys.ConfirmedDir(filepath.Dir(path)), filepath.Base(path), nil
+}
+
+func (o *overlay) Exists(path string) bool {
+	path = o.clean(path)
+	return o.upper.Exists(path) || o.inBase(path)
+}
+
+func (o *overlay) Glob(pattern string) ([]string, error) {
+	allFiles := make([]string, 0)
+	err := o.Walk(string(filepath.Separator), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			match, innerErr := filepath.Match(pattern, path)
+			if innerErr != nil {
+				return innerErr
+			}
+			if match {
+				allFiles = append(allFiles, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !filesys.IsHiddenFilePath(pattern) {
+		allFiles = filesys.RemoveHiddenFiles(allFiles)
+	}
+	slices.Sort(allFiles)
+	return allFiles, nil
+}
+
+func (o *overlay) ReadFile(path string) ([]byte, error) {
+	path = o.clean(path)
+	if o.upper.Exists(path) {
+		return o.upper.ReadFile(path)
+	}
+	if o.inBase(path) {
+		return o.base.ReadFile(path)
+	}
+	return nil, notExistError(path)
+}
+
+func (o *overlay) WriteFile(path string, data []byte) error {
+	path = o.clean(path)
+	if err := o.upper.MkdirAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+	return o.upper.WriteFile(path, data)
+}
+
+func (o *overlay) Walk(path string, walkFn filepath.WalkFunc) error {
+	path = o.clean(path)
+	info := o.stat(path)
+	if info == nil {
+		return notExistError(path)
+	}
+	return o.walk(path, info, walkFn)
+}
+
+func (o *overlay) walk(path string, info os.FileInfo, walkFn filepath.WalkFunc) error {
+	// always visit self first
+	err := walkFn(path, info, nil)
+	if !info.IsDir() {
+		return err
+	}
+	if err != nil {
+		if err == filepath.SkipDir { //nolint:errorlint // the walk function is expected to return SkipDir as is
+			return nil
+		}
+		return err
+	}
+
+	names, err := o.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	// walk is supposed to visit in lexical order
+	slices.Sort(names)
+	for _, name := range names {
+		childPath := filepath.Join(path, name)
+		if innerErr := o.walk(childPath, o.stat(childPath), walkFn); innerErr != nil {
+			if innerErr == filepath.SkipDir { //nolint:errorlint // the walk function is expected to return SkipDir as is
+				// stop processing this directory
+				break
+			}
+			return innerErr
+		}
+	}
+	return nil
+}
+
+// stat retrieves the file info of a path without opening it, as opening a file of the base is not safe for
+// concurrent use.
+func (o *overlay) stat(path string) os.FileInfo {
+	layer := o.base
+	if o.upper.Exists(path) {
+		layer = o.upper
+	} else if !o.inBase(path) {
+		return nil
+	}
+
+	var info os.FileInfo
+	_ = layer.Walk(path, func(_ string, fileInfo os.FileInfo, _ error) error {
+		info = fileInfo
+		return filepath.SkipDir
+	})
+	return info
+}
+
+// inBase reports whether the path exists in the base and is neither deleted itself nor located below a deleted
+// directory.
+func (o *overlay) inBase(path string) bool {
+	for current := path; ; current = filepath.Dir(current) {
+		if _, ok := o.deletions[current]; ok {
+			return false
+		}
+		if current == filepath.Dir(current) {
+			break
+		}
+	}
+	return o.base.Exists(path)
+}
+
+func (o *overlay) clean(path string) string {
+	return filepath.Join(string(filepath.Separator), path)
+}
+
+type notExistError string
+
+func (e notExistError) Error() string {
+	return fmt.Sprintf("'%s' doesn't exist", string(e))
+}
+
+func (e notExistError) Unwrap() error {
+	return os.ErrNotExist
+}
@@ -0,0 +1,160 @@
+package filesystem
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBase(t *testing.T) *FileSystem {
+	t.Helper()
+
+	base := New()
+	require.NoError(t, base.MkdirAll("/dir/sub"))
+	require.NoError(t, base.WriteFile("/file.txt", []byte("base file")))
+	require.NoError(t, base.WriteFile("/dir/a.txt", []byte("a")))
+	require.NoError(t, base.WriteFile("/dir/sub/b.txt", []byte("b")))
+	return base
+}
+
+func TestOverlay_ReadsFallThroughToBase(t *testing.T) {
+	overlay := NewOverlay(newBase(t))
+
+	content, err := overlay.ReadFile("/dir/sub/b.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "b", string(content))
+	assert.True(t, overlay.Exists("/dir/a.txt"))
+	assert.True(t, overlay.IsDir("/dir/sub"))
+	assert.False(t, overlay.IsDir("/file.txt"))
+	assert.False(t, overlay.Exists("/missing.txt"))
+}
+
+func TestOverlay_WritesDoNotLeakIntoBase(t *testing.T) {
+	base := newBase(t)
+	overlay := NewOverlay(base)
+
+	require.NoError(t, overlay.WriteFile("/file.txt", []byte("overlay file")))
+	require.NoError(t, overlay.WriteFile("/new/nested/c.txt", []byte("c")))
+	require.NoError(t, overlay.MkdirAll("/dir/charts"))
+
+	content, err := overlay.ReadFile("/file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "overlay file", string(content))
+	assert.True(t, overlay.Exists("/new/nested/c.txt"))
+	assert.True(t, overlay.IsDir("/dir/charts"))
+
+	content, err = base.ReadFile("/file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "base file", string(content))
+	assert.False(t, base.Exists("/new"))
+	assert.False(t, base.Exists("/dir/charts"))
+
+	otherOverlay := NewOverlay(base)
+	content, err = otherOverlay.ReadFile("/file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "base file", string(content))
+}
+
+func TestOverlay_RemoveAllHidesBase(t *testing.T) {
+	base := newBase(t)
+	overlay := NewOverlay(base)
+
+	require.NoError(t, overlay.RemoveAll("/dir"))
+	assert.False(t, overlay.Exists("/dir"))
+	assert.False(t, overlay.Exists("/dir/sub/b.txt"))
+	_, err := overlay.ReadFile("/dir/a.txt")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.True(t, base.Exists("/dir/sub/b.txt"))
+
+	require.NoError(t, overlay.WriteFile("/dir/c.txt", []byte("c")))
+	names, err := overlay.ReadDir("/dir")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c.txt"}, names)
+
+	assert.Error(t, overlay.RemoveAll("/"))
+}
+
+func TestOverlay_ReadDirMergesLayers(t *testing.T) {
+	overlay := NewOverlay(newBase(t))
+
+	require.NoError(t, overlay.WriteFile("/dir/a.txt", []byte("overwritten")))
+	require.NoError(t, overlay.WriteFile("/dir/c.txt", []byte("c")))
+	require.NoError(t, overlay.RemoveAll("/dir/sub"))
+
+	names, err := overlay.ReadDir("/dir")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a.txt", "c.txt"}, names)
+
+	_, err = overlay.ReadDir("/missing")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestOverlay_WalkVisitsMergedTreeInOrder(t *testing.T) {
+	overlay := NewOverlay(newBase(t))
+
+	require.NoError(t, overlay.WriteFile("/dir/sub/0.txt", []byte("0")))
+	require.NoError(t, overlay.RemoveAll("/file.txt"))
+
+	visited := make([]string, 0)
+	err := overlay.Walk("/", func(path string, info os.FileInfo, err error) error {
+		require.NoError(t, err)
+		visited = append(visited, path)
+		if info.IsDir() && info.Name() == "sub" {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/", "/dir", "/dir/a.txt", "/dir/sub"}, visited)
+
+	files, err := overlay.Glob("/dir/*/*.txt")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dir/sub/0.txt", "/dir/sub/b.txt"}, files)
+}
+
+func TestOverlay_OpenCopiesFromBase(t *testing.T) {
+	base := newBase(t)
+	overlay := NewOverlay(base)
+
+	file, err := overlay.Open("/dir/a.txt")
+	require.NoError(t, err)
+	_, err = file.Write([]byte("changed"))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	content, err := overlay.ReadFile("/dir/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "changed", string(content))
+
+	content, err = base.ReadFile("/dir/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(content))
+
+	// the base file is never opened, so it can still be opened by other overlays
+	otherFile, err := NewOverlay(base).Open("/dir/a.txt")
+	require.NoError(t, err)
+	otherContent, err := io.ReadAll(otherFile)
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(otherContent))
+}
+
+func TestOverlay_CleanedAbs(t *testing.T) {
+	overlay := NewOverlay(newBase(t))
+
+	dir, name, err := overlay.CleanedAbs("/dir/sub/../a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "/dir", string(dir))
+	assert.Equal(t, "a.txt", name)
+
+	dir, name, err = overlay.CleanedAbs("/dir/sub")
+	require.NoError(t, err)
+	assert.Equal(t, "/dir/sub", string(dir))
+	assert.Empty(t, name)
+
+	_, _, err = overlay.CleanedAbs("/missing")
+	assert.Error(t, err)
+}
@@ -8,8 +8,10 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"path"
 	"strings"
 
+	"github.com/Roshick/manifest-maestro/pkg/archive/limit"
 	"github.com/Roshick/manifest-maestro/pkg/filesystem"
 	"github.com/go-git/go-billy/v5"
 
@@ -78,6 +80,57 @@ func Compress(
 }
 
 func Extract(ctx context.Context, fileSystem *filesystem.FileSystem, sourceReader io.Reader, targetPath string) error {
+	return extract(ctx, fileSystem, sourceReader, targetPath, nil, func(_ string) bool {
+		return true
+	})
+}
+
+// ExtractWithLimits is like Extract, but fails with limit.ErrExceeded once the archive has more entries or more
+// uncompressed content than allowed, e.g. for archives sent by clients.
+func ExtractWithLimits(
+	ctx context.Context,
+	fileSystem *filesystem.FileSystem,
+	sourceReader io.Reader,
+	targetPath string,
+	limits limit.Limits,
+) error {
+	return extract(ctx, fileSystem, sourceReader, targetPath, limit.NewCounter(limits), func(_ string) bool {
+		return true
+	})
+}
+
+// ExtractPaths extracts only the files located at or below the given slash-separated paths relative to the root of
+// the archive, all other entries are skipped while streaming. The path "." selects the whole archive.
+func ExtractPaths(
+	ctx context.Context,
+	fileSystem *filesystem.FileSystem,
+	sourceReader io.Reader,
+	targetPath string,
+	paths []string,
+) error {
+	cleanPaths := make([]string, 0, len(paths))
+	for _, p := range paths {
+		cleanPaths = append(cleanPaths, path.Clean(strings.TrimPrefix(p, "/")))
+	}
+	return extract(ctx, fileSystem, sourceReader, targetPath, nil, func(name string) bool {
+		name = path.Clean(strings.TrimPrefix(name, "/"))
+		for _, p := range cleanPaths {
+			if p == "." || name == p || strings.HasPrefix(name, p+"/") {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func extract(
+	ctx context.Context,
+	fileSystem *filesystem.FileSystem,
+	sourceReader io.Reader,
+	targetPath string,
+	counter *limit.Counter,
+	include func(name string) bool,
+) error {
 	if err := fileSystem.MkdirAll(targetPath); err != nil {
 		return err
 	}
@@ -102,6 +155,13 @@ func Extract(ctx context.Context, fileSystem *filesystem.FileSystem, sourceReade
 			return innerErr
 		}
 
+		if !include(header.Name) {
+			continue
+		}
+		if innerErr = counter.AddEntry(); innerErr != nil {
+			return innerErr
+		}
+
 		filePath := fileSystem.Join(targetPath, header.Name)
 		if filePath != targetPath && !strings.HasPrefix(filePath, strings.TrimSuffix(targetPath, fileSystem.Separator)+fileSystem.Separator) {
 			return fmt.Errorf("failed to extract file '%s': path escapes target directory '%s'", header.Name, targetPath)
@@ -117,7 +177,8 @@ func Extract(ctx context.Context, fileSystem *filesystem.FileSystem, sourceReade
 			if innerErr2 != nil {
 				return innerErr2
 			}
-			if _, innerErr2 = io.Copy(file, tr); innerErr2 != nil {
+			if innerErr2 = counter.Copy(file, tr); innerErr2 != nil {
+				_ = file.Close()
 				return innerErr2
 			}
 			if innerErr2 = file.Close(); innerErr2 != nil {
@@ -131,6 +192,65 @@ func Extract(ctx context.Context, fileSystem *filesystem.FileSystem, sourceReade
 	return nil
 }
 
+// StripTopLevelDirectory rewrites an archive whose entries are all located in a single top-level directory, like
+// the repository archives of GitHub, so its entries are located at the root instead. Directory entries and global
+// headers are dropped, like in the archives of CompressFromBilly.
+func StripTopLevelDirectory(ctx context.Context, sourceReader io.Reader, targetWriter io.Writer) error {
+	gzr, err := gzip.NewReader(sourceReader)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if innerErr := gzr.Close(); innerErr != nil {
+			aulogging.Logger.Ctx(ctx).Warn().WithErr(innerErr).Printf("failed to close gzip reader")
+		}
+	}()
+	tr := tar.NewReader(gzr)
+
+	gzw := gzip.NewWriter(targetWriter)
+	defer func() {
+		if innerErr := gzw.Close(); innerErr != nil {
+			aulogging.Logger.Ctx(ctx).Warn().WithErr(innerErr).Printf("failed to close gzip writer")
+		}
+	}()
+	tw := tar.NewWriter(gzw)
+	defer func() {
+		if innerErr := tw.Close(); innerErr != nil {
+			aulogging.Logger.Ctx(ctx).Warn().WithErr(innerErr).Printf("failed to close tar writer")
+		}
+	}()
+
+	topLevelDirectory := ""
+	for {
+		header, innerErr := tr.Next()
+		if errors.Is(innerErr, io.EOF) {
+			return nil
+		}
+		if innerErr != nil {
+			return innerErr
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader || header.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		directory, name, found := strings.Cut(strings.TrimPrefix(header.Name, "./"), "/")
+		if topLevelDirectory == "" {
+			topLevelDirectory = directory
+		}
+		if !found || directory != topLevelDirectory || name == "" {
+			return fmt.Errorf("archive entry '%s' is not located in top-level directory '%s'",
+				header.Name, topLevelDirectory)
+		}
+		header.Name = name
+		if innerErr = tw.WriteHeader(header); innerErr != nil {
+			return innerErr
+		}
+		if _, innerErr = io.Copy(tw, tr); innerErr != nil {
+			return innerErr
+		}
+	}
+}
+
 // CompressFromBilly compresses a billy filesystem directly into a tar.gz stream,
 // avoiding an intermediate copy to an in-memory filesystem.
 func CompressFromBilly(
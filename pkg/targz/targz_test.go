@@ -260,3 +260,90 @@ func TestExtract_RejectsUnsupportedFileType(t *testing.T) {
 }
 
 
+
+func TestExtractPaths_OnlyExtractsSelectedPaths(t *testing.T) {
+	ctx := context.Background()
+
+	srcFS := filesystem.New()
+	writeFile(t, srcFS, srcFS.Join(srcFS.Root, "charts", "app", "Chart.yaml"), "name: app")
+	writeFile(t, srcFS, srcFS.Join(srcFS.Root, "charts", "app-other", "Chart.yaml"), "name: app-other")
+	writeFile(t, srcFS, srcFS.Join(srcFS.Root, "charts", "common", "Chart.yaml"), "name: common")
+	writeFile(t, srcFS, srcFS.Join(srcFS.Root, "docs", "README.md"), "docs")
+	writeFile(t, srcFS, srcFS.Join(srcFS.Root, "LICENSE"), "license")
+
+	var buf bytes.Buffer
+	require.NoError(t, Compress(ctx, srcFS, srcFS.Root, "", &buf))
+
+	dstFS := filesystem.New()
+	err := ExtractPaths(ctx, dstFS, &buf, dstFS.Root, []string{"charts/app", "/charts/common/", "LICENSE"})
+	require.NoError(t, err)
+
+	assertFileContent(t, dstFS, dstFS.Join(dstFS.Root, "charts", "app", "Chart.yaml"), "name: app")
+	assertFileContent(t, dstFS, dstFS.Join(dstFS.Root, "charts", "common", "Chart.yaml"), "name: common")
+	assertFileContent(t, dstFS, dstFS.Join(dstFS.Root, "LICENSE"), "license")
+	assert.False(t, dstFS.Exists(dstFS.Join(dstFS.Root, "charts", "app-other")))
+	assert.False(t, dstFS.Exists(dstFS.Join(dstFS.Root, "docs")))
+}
+
+func TestExtractPaths_RootSelectsEverything(t *testing.T) {
+	ctx := context.Background()
+
+	srcFS := filesystem.New()
+	writeFile(t, srcFS, srcFS.Join(srcFS.Root, "a", "file.txt"), "a")
+	writeFile(t, srcFS, srcFS.Join(srcFS.Root, "b.txt"), "b")
+
+	var buf bytes.Buffer
+	require.NoError(t, Compress(ctx, srcFS, srcFS.Root, "", &buf))
+
+	dstFS := filesystem.New()
+	require.NoError(t, ExtractPaths(ctx, dstFS, &buf, dstFS.Root, []string{"."}))
+
+	assertFileContent(t, dstFS, dstFS.Join(dstFS.Root, "a", "file.txt"), "a")
+	assertFileContent(t, dstFS, dstFS.Join(dstFS.Root, "b.txt"), "b")
+}
+
+func TestStripTopLevelDirectory(t *testing.T) {
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeXGlobalHeader,
+		Name:       "pax_global_header",
+		PAXRecords: map[string]string{"comment": "0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c"},
+	}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "org-repo-0d1a26e/", Mode: 0o755}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "org-repo-0d1a26e/charts/", Mode: 0o755}))
+	for name, content := range map[string]string{
+		"org-repo-0d1a26e/README.md":          "# repo\n",
+		"org-repo-0d1a26e/charts/Chart.yaml": "name: app\n",
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg, Name: name, Mode: 0o644, Size: int64(len(content)),
+		}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+
+	var stripped bytes.Buffer
+	require.NoError(t, StripTopLevelDirectory(ctx, &buf, &stripped))
+
+	dstFS := filesystem.New()
+	require.NoError(t, Extract(ctx, dstFS, &stripped, dstFS.Root))
+	assertFileContent(t, dstFS, dstFS.Join(dstFS.Root, "README.md"), "# repo\n")
+	assertFileContent(t, dstFS, dstFS.Join(dstFS.Root, "charts", "Chart.yaml"), "name: app\n")
+}
+
+func TestStripTopLevelDirectory_RejectsEntriesOutsideTopLevelDirectory(t *testing.T) {
+	ctx := context.Background()
+
+	archive := createArchive(t, map[string]string{
+		"README.md": "# repo\n",
+	})
+
+	err := StripTopLevelDirectory(ctx, bytes.NewReader(archive), &bytes.Buffer{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,111 @@
+package ziparchive
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Roshick/manifest-maestro/pkg/archive/limit"
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+
+	aulogging "github.com/StephanHCB/go-autumn-logging"
+)
+
+// Extract extracts the zip archive into the target path of the file system. Like targz.Extract, it rejects entries
+// escaping the target path and entries other than regular files and directories.
+func Extract(
+	ctx context.Context,
+	fileSystem *filesystem.FileSystem,
+	sourceReader io.ReaderAt,
+	size int64,
+	targetPath string,
+) error {
+	return extract(ctx, fileSystem, sourceReader, size, targetPath, nil)
+}
+
+// ExtractWithLimits is like Extract, but fails with limit.ErrExceeded once the archive has more entries or more
+// uncompressed content than allowed, e.g. for archives sent by clients. The sizes declared by the entries are not
+// trusted, the content is counted while it is extracted.
+func ExtractWithLimits(
+	ctx context.Context,
+	fileSystem *filesystem.FileSystem,
+	sourceReader io.ReaderAt,
+	size int64,
+	targetPath string,
+	limits limit.Limits,
+) error {
+	return extract(ctx, fileSystem, sourceReader, size, targetPath, limit.NewCounter(limits))
+}
+
+func extract(
+	ctx context.Context,
+	fileSystem *filesystem.FileSystem,
+	sourceReader io.ReaderAt,
+	size int64,
+	targetPath string,
+	counter *limit.Counter,
+) error {
+	if err := fileSystem.MkdirAll(targetPath); err != nil {
+		return err
+	}
+
+	zr, err := zip.NewReader(sourceReader, size)
+	if err != nil {
+		return err
+	}
+	for _, entry := range zr.File {
+		filePath := fileSystem.Join(targetPath, entry.Name)
+		if filePath != targetPath && !strings.HasPrefix(filePath, strings.TrimSuffix(targetPath, fileSystem.Separator)+fileSystem.Separator) {
+			return fmt.Errorf("failed to extract file '%s': path escapes target directory '%s'", entry.Name, targetPath)
+		}
+		if err = counter.AddEntry(); err != nil {
+			return err
+		}
+		switch {
+		case entry.Mode().IsDir():
+			continue
+		case entry.Mode().IsRegular():
+			if innerErr := extractFile(ctx, fileSystem, entry, filePath, counter); innerErr != nil {
+				return innerErr
+			}
+		default:
+			return fmt.Errorf("failed to extract file '%s' of unsupported type from '%s'", entry.Name, targetPath)
+		}
+	}
+	return nil
+}
+
+func extractFile(
+	ctx context.Context,
+	fileSystem *filesystem.FileSystem,
+	entry *zip.File,
+	filePath string,
+	counter *limit.Counter,
+) error {
+	if err := fileSystem.MkdirAll(fileSystem.Dir(filePath)); err != nil {
+		return err
+	}
+	reader, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if innerErr := reader.Close(); innerErr != nil {
+			aulogging.Logger.Ctx(ctx).Warn().WithErr(innerErr).Printf("failed to close zip entry '%s'", entry.Name)
+		}
+	}()
+	file, err := fileSystem.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if err = counter.Copy(file, reader); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		aulogging.Logger.Ctx(ctx).Warn().WithErr(err).Printf("failed to close '%s'", filePath)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package ziparchive
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/Roshick/manifest-maestro/pkg/filesystem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		writer, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = writer.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestExtract(t *testing.T) {
+	ctx := context.Background()
+	dstFS := filesystem.New()
+
+	archive := createArchive(t, map[string]string{
+		"app/Chart.yaml":          "name: app\n",
+		"app/templates/cm.yaml":   "kind: ConfigMap\n",
+		"app/subdir/../file.yaml": "safe: true\n",
+	})
+
+	targetPath := dstFS.Join(dstFS.Root, "target")
+	require.NoError(t, Extract(ctx, dstFS, bytes.NewReader(archive), int64(len(archive)), targetPath))
+
+	for filePath, expected := range map[string]string{
+		"app/Chart.yaml":        "name: app\n",
+		"app/templates/cm.yaml": "kind: ConfigMap\n",
+		"app/file.yaml":         "safe: true\n",
+	} {
+		content, err := dstFS.ReadFile(dstFS.Join(targetPath, filePath))
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(content))
+	}
+}
+
+func TestExtract_RejectsPathTraversal(t *testing.T) {
+	ctx := context.Background()
+	dstFS := filesystem.New()
+
+	archive := createArchive(t, map[string]string{
+		"subdir/../../evil.txt": "malicious content",
+	})
+
+	targetPath := dstFS.Join(dstFS.Root, "target")
+	err := Extract(ctx, dstFS, bytes.NewReader(archive), int64(len(archive)), targetPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "escapes target directory")
+	assert.False(t, dstFS.Exists(dstFS.Join(dstFS.Root, "evil.txt")))
+}
+
+func TestExtract_RejectsUnsupportedFileType(t *testing.T) {
+	ctx := context.Background()
+	dstFS := filesystem.New()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	header := &zip.FileHeader{Name: "link"}
+	header.SetMode(os.ModeSymlink | 0o777)
+	writer, err := zw.CreateHeader(header)
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("/etc/passwd"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	err = Extract(ctx, dstFS, bytes.NewReader(buf.Bytes()), int64(buf.Len()), dstFS.Root)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported type")
+}
@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync/atomic"
 
 	"github.com/go-git/go-billy/v5"
@@ -23,11 +26,17 @@ type Mock struct {
 	// CloneCommitCallCount tracks how many times CloneCommit was called.
 	CloneCommitCallCount atomic.Int32
 
+	// ClonePathsCallCount tracks how many times ClonePaths was called.
+	ClonePathsCallCount atomic.Int32
+
 	// toHashFn is the custom handler for ToHash.
 	toHashFn func(ctx context.Context, repositoryURL string, gitReference string) (string, error)
 
 	// cloneCommitFn is the custom handler for CloneCommit.
 	cloneCommitFn func(ctx context.Context, repositoryURL string, reference string) (*git.Repository, error)
+
+	// clonePathsFn is the custom handler for ClonePaths.
+	clonePathsFn func(ctx context.Context, repositoryURL string, commitHash string, paths []string) (*git.Repository, error)
 }
 
 func NewMock() *Mock {
@@ -46,6 +55,12 @@ func (m *Mock) WithCloneCommit(fn func(ctx context.Context, repositoryURL string
 	return m
 }
 
+// WithClonePaths sets a custom handler for ClonePaths calls.
+func (m *Mock) WithClonePaths(fn func(ctx context.Context, repositoryURL string, commitHash string, paths []string) (*git.Repository, error)) *Mock {
+	m.clonePathsFn = fn
+	return m
+}
+
 func (m *Mock) ToHash(ctx context.Context, repositoryURL string, gitReference string) (string, error) {
 	m.ToHashCallCount.Add(1)
 	if m.toHashFn != nil {
@@ -63,6 +78,58 @@ func (m *Mock) CloneCommit(ctx context.Context, repositoryURL string, reference
 	return createEmptyRepo()
 }
 
+// ClonePaths defaults to the CloneCommit handler, removing all files outside the given paths from the worktree.
+func (m *Mock) ClonePaths(ctx context.Context, repositoryURL string, commitHash string, paths []string) (*git.Repository, error) {
+	m.ClonePathsCallCount.Add(1)
+	if m.clonePathsFn != nil {
+		return m.clonePathsFn(ctx, repositoryURL, commitHash, paths)
+	}
+
+	var repo *git.Repository
+	var err error
+	if m.cloneCommitFn != nil {
+		repo, err = m.cloneCommitFn(ctx, repositoryURL, commitHash)
+	} else {
+		repo, err = createEmptyRepo()
+	}
+	if err != nil {
+		return nil, err
+	}
+	tree, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	if err = removeOutsidePaths(tree.Filesystem, "", paths); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func removeOutsidePaths(fs billy.Filesystem, currentPath string, paths []string) error {
+	files, err := fs.ReadDir(currentPath)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		filePath := path.Join(currentPath, file.Name())
+		if slices.ContainsFunc(paths, func(p string) bool {
+			return p == "." || filePath == p || strings.HasPrefix(filePath, p+"/")
+		}) {
+			continue
+		}
+		if file.IsDir() {
+			if err = removeOutsidePaths(fs, filePath, paths); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = fs.Remove(filePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // CreateRepoFromDir creates a git.Repository in memory with files from a local directory.
 func CreateRepoFromDir(dir string) (*git.Repository, error) {
 	fs := memfs.New()
@@ -2,14 +2,19 @@ package helmremotemock
 
 import (
 	"context"
+	"crypto/sha256"
+	"fmt"
 	"net/url"
+	"strings"
 	"sync"
 	"sync/atomic"
 )
 
-// ChartMock implements cache.HelmChartRemote.
+// ChartMock implements cache.HelmChartRemote. Charts added by an OCI tag URL like 'oci://host/charts/mychart:1.0.0'
+// resolve to the digest of their data, and are retrievable by 'oci://host/charts/mychart@<digest>' as well.
 type ChartMock struct {
-	GetChartCallCount atomic.Int32
+	GetChartCallCount           atomic.Int32
+	ResolveChartDigestCallCount atomic.Int32
 
 	mu     sync.RWMutex
 	charts map[string][]byte
@@ -25,6 +30,36 @@ func (m *ChartMock) AddChart(chartURL string, data []byte) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.charts[chartURL] = data
+	if repositoryURL, _, ok := cutTag(chartURL); ok {
+		m.charts[fmt.Sprintf("%s@%s", repositoryURL, Digest(data))] = data
+	}
+}
+
+// Digest returns the digest an OCI chart with the data resolves to.
+func Digest(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+func (m *ChartMock) ResolveChartDigest(_ context.Context, chartURL url.URL) (string, error) {
+	m.ResolveChartDigestCallCount.Add(1)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data, ok := m.charts[chartURL.String()]
+	if _, _, isTag := cutTag(chartURL.String()); !ok || !isTag {
+		return "", &ChartNotFoundError{URL: chartURL.String()}
+	}
+	return Digest(data), nil
+}
+
+func cutTag(chartURL string) (string, string, bool) {
+	if !strings.HasPrefix(chartURL, "oci://") || strings.Contains(chartURL, "@") {
+		return "", "", false
+	}
+	i := strings.LastIndex(chartURL, ":")
+	if i < len("oci://") || strings.Contains(chartURL[i:], "/") {
+		return "", "", false
+	}
+	return chartURL[:i], chartURL[i+1:], true
 }
 
 func (m *ChartMock) GetChart(_ context.Context, chartURL url.URL) ([]byte, error) {
@@ -0,0 +1,136 @@
+package ocimock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Roshick/manifest-maestro/internal/repository/ociregistry"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content/memory"
+)
+
+// Registry is an in-memory stand-in for OCI registries, implementing ociartifact.Registry.
+type Registry struct {
+	ResolveCallCount atomic.Int32
+	FetchCallCount   atomic.Int32
+
+	mu           sync.Mutex
+	repositories map[string]*Repository
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		repositories: make(map[string]*Repository),
+	}
+}
+
+// Repository is a repository of the in-memory registry.
+type Repository struct {
+	*memory.Store
+
+	registry *Registry
+	mu       sync.Mutex
+	tags     []string
+}
+
+func (r *Registry) Repository(_ context.Context, repository string) (ociregistry.Repository, error) {
+	return r.repository(repository), nil
+}
+
+func (r *Registry) repository(repository string) *Repository {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repository = strings.TrimPrefix(repository, "oci://")
+	if _, ok := r.repositories[repository]; !ok {
+		r.repositories[repository] = &Repository{Store: memory.New(), registry: r}
+	}
+	return r.repositories[repository]
+}
+
+// PushArtifact pushes an artifact with a single layer to the repository, tags it and returns its manifest digest.
+func (r *Registry) PushArtifact(
+	ctx context.Context, repository string, tag string, layerMediaType string, layer []byte,
+) (digest.Digest, error) {
+	target := r.repository(repository)
+
+	config := []byte("{}")
+	configDescriptor := ocispec.Descriptor{
+		MediaType: "application/vnd.cncf.flux.config.v1+json",
+		Digest:    digest.FromBytes(config),
+		Size:      int64(len(config)),
+	}
+	layerDescriptor := ocispec.Descriptor{
+		MediaType: layerMediaType,
+		Digest:    digest.FromBytes(layer),
+		Size:      int64(len(layer)),
+	}
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    configDescriptor,
+		Layers:    []ocispec.Descriptor{layerDescriptor},
+	})
+	if err != nil {
+		return "", err
+	}
+	manifestDescriptor := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Digest:    digest.FromBytes(manifest),
+		Size:      int64(len(manifest)),
+	}
+
+	for _, blob := range []struct {
+		descriptor ocispec.Descriptor
+		data       []byte
+	}{{configDescriptor, config}, {layerDescriptor, layer}, {manifestDescriptor, manifest}} {
+		exists, innerErr := target.Exists(ctx, blob.descriptor)
+		if innerErr != nil {
+			return "", innerErr
+		}
+		if exists {
+			continue
+		}
+		if innerErr = target.Push(ctx, blob.descriptor, bytes.NewReader(blob.data)); innerErr != nil {
+			return "", fmt.Errorf("failed to push %s: %w", blob.descriptor.MediaType, innerErr)
+		}
+	}
+	// registries resolve manifest digests like tags, the memory store only resolves tags
+	for _, reference := range []string{tag, manifestDescriptor.Digest.String()} {
+		if err = target.Store.Tag(ctx, manifestDescriptor, reference); err != nil {
+			return "", err
+		}
+	}
+	target.mu.Lock()
+	defer target.mu.Unlock()
+	if !slices.Contains(target.tags, tag) {
+		target.tags = append(target.tags, tag)
+	}
+	return manifestDescriptor.Digest, nil
+}
+
+func (r *Repository) Resolve(ctx context.Context, reference string) (ocispec.Descriptor, error) {
+	r.registry.ResolveCallCount.Add(1)
+	return r.Store.Resolve(ctx, reference)
+}
+
+func (r *Repository) Fetch(ctx context.Context, target ocispec.Descriptor) (io.ReadCloser, error) {
+	r.registry.FetchCallCount.Add(1)
+	return r.Store.Fetch(ctx, target)
+}
+
+func (r *Repository) Tags(_ context.Context, _ string, fn func(tags []string) error) error {
+	r.mu.Lock()
+	tags := slices.Clone(r.tags)
+	r.mu.Unlock()
+	slices.Sort(tags)
+	return fn(tags)
+}
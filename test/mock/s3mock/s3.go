@@ -0,0 +1,131 @@
+package s3mock
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Server is an in-process stand-in for an S3-compatible object storage, addressed path-style. It supports
+// retrieving objects, their metadata and ListObjectsV2 listings, with ETags being the MD5 digest of the content
+// like for objects uploaded in a single part.
+type Server struct {
+	*httptest.Server
+
+	GetObjectCallCount   atomic.Int32
+	HeadObjectCallCount  atomic.Int32
+	ListObjectsCallCount atomic.Int32
+
+	accessKeyID string
+
+	mu      sync.RWMutex
+	objects map[string]map[string][]byte
+}
+
+// New starts the server. With accessKeyID, requests not signed with that access key are rejected.
+func New(accessKeyID string) *Server {
+	s := &Server{
+		accessKeyID: accessKeyID,
+		objects:     make(map[string]map[string][]byte),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *Server) PutObject(bucket string, key string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.objects[bucket]; !ok {
+		s.objects[bucket] = make(map[string][]byte)
+	}
+	s.objects[bucket][key] = content
+}
+
+func ETag(content []byte) string {
+	sum := md5.Sum(content)
+	return fmt.Sprintf("\"%s\"", hex.EncodeToString(sum[:]))
+}
+
+type listBucketResult struct {
+	XMLName  xml.Name `xml:"ListBucketResult"`
+	Name     string   `xml:"Name"`
+	Prefix   string   `xml:"Prefix"`
+	KeyCount int      `xml:"KeyCount"`
+	Contents []struct {
+		Key  string `xml:"Key"`
+		ETag string `xml:"ETag"`
+		Size int    `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated bool `xml:"IsTruncated"`
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if s.accessKeyID != "" &&
+		!strings.Contains(r.Header.Get("Authorization"), "Credential="+s.accessKeyID+"/") {
+		writeError(w, http.StatusForbidden, "AccessDenied", "Access Denied")
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	objects, ok := s.objects[bucket]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && key == "" && r.URL.Query().Get("list-type") == "2":
+		s.ListObjectsCallCount.Add(1)
+		prefix := r.URL.Query().Get("prefix")
+		result := listBucketResult{Name: bucket, Prefix: prefix}
+		keys := make([]string, 0, len(objects))
+		for objectKey := range objects {
+			if strings.HasPrefix(objectKey, prefix) {
+				keys = append(keys, objectKey)
+			}
+		}
+		slices.Sort(keys)
+		for _, objectKey := range keys {
+			result.Contents = append(result.Contents, struct {
+				Key  string `xml:"Key"`
+				ETag string `xml:"ETag"`
+				Size int    `xml:"Size"`
+			}{Key: objectKey, ETag: ETag(objects[objectKey]), Size: len(objects[objectKey])})
+		}
+		result.KeyCount = len(keys)
+		w.Header().Set("Content-Type", "application/xml")
+		_ = xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		content, found := objects[key]
+		if !found {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+			return
+		}
+		w.Header().Set("ETag", ETag(content))
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+		if r.Method == http.MethodHead {
+			s.HeadObjectCallCount.Add(1)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		s.GetObjectCallCount.Add(1)
+		_, _ = w.Write(content)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The method is not allowed")
+	}
+}
+
+func writeError(w http.ResponseWriter, statusCode int, code string, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(statusCode)
+	_, _ = fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, message)
+}